@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
@@ -22,24 +23,30 @@ func main() {
 		}
 	}
 
+	// go run ./cmd/api migrate <up|down|status|create>: quản lý schema rồi thoát, không chạy server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8090"
 	}
 
 	r := gin.Default()
+	h := handlers.NewHandler()
 
 	// Khởi tạo kết nối database trong một goroutine để không chặn việc khởi động server.
 	// Đây là chìa khóa để khắc phục lỗi "Timed Out" trên Render.
-	go func() {
-		log.Println("Attempting to connect to the database...")
-		_, dbErr := database.Connect()
-		if dbErr != nil {
-			log.Printf("!!! Asynchronous database connection failed: %v", dbErr)
-		} else {
-			log.Println("Database connection established successfully.")
-		}
-	}()
+	// Supervisor thử lại khi kết nối thất bại và báo cho handler khi mất/có lại kết nối;
+	// trong lúc đó các API cần database trả về 503.
+	go database.NewSupervisor(h.SetStore).Run(context.Background())
+	// Phân tích lại ở nền các kết quả cũ được đưa vào hàng đợi (STALE_POLICY=requeue)
+	go h.RunReanalysis(context.Background())
+	// Tạo embedding ở nền cho tìm kiếm ngữ nghĩa sau mỗi lần phân tích
+	go h.RunEmbedder(context.Background())
+	// Áp dụng thời hạn lưu giữ (ANALYSIS_RETENTION, TRASH_RETENTION) theo chu kỳ PURGE_INTERVAL
+	go h.RunPurger(context.Background())
 
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
@@ -58,14 +65,42 @@ func main() {
 			"message": "pong",
 		})
 	})
+	r.GET("/healthz", handlers.HealthzHandler)
+	r.GET("/readyz", h.ReadyzHandler)
 
 	// Các API endpoints của ứng dụng
 	api := r.Group("/api/v1")
 	{
-		api.POST("/analyze", handlers.AnalyzeHandler)
-		api.POST("/contract-chat", handlers.ContractChatHandler)
-		api.GET("/analyses", handlers.GetAnalyses)
-		api.GET("/analyses/:id", handlers.GetAnalysisDetail)
+		api.POST("/analyze", h.AnalyzeHandler)
+		api.POST("/extract", handlers.ExtractHandler)
+		api.POST("/contract-chat", h.ContractChatHandler)
+		api.GET("/analyses", h.GetAnalyses)
+		api.GET("/search", h.SearchAnalyses)
+		api.GET("/semantic-search", h.SemanticSearch)
+		api.GET("/analyses/:id", h.GetAnalysisDetail)
+		api.DELETE("/analyses/:id", h.DeleteAnalysis)
+		api.GET("/analyses/:id/structure", h.GetAnalysisStructure)
+		api.GET("/analyses/:id/provenance", h.GetAnalysisProvenance)
+		api.GET("/analyses/:id/compare/:other", h.CompareAnalyses)
+		api.GET("/analyses/:id/similar", h.GetSimilarAnalyses)
+		api.POST("/analyses/:id/rerun", h.RerunAnalysis)
+		api.GET("/documents/:id/analyses", h.GetDocumentAnalyses)
+		api.PUT("/documents/:id/tags", h.SetDocumentTags)
+		api.GET("/trash", h.GetTrash)
+		api.POST("/trash/:id/restore", h.RestoreAnalysis)
+	}
+
+	// API quản trị, cần header "Authorization: Bearer <ADMIN_TOKEN>"
+	admin := r.Group("/api/v1/admin", handlers.AdminOnly())
+	{
+		admin.GET("/reanalysis", h.GetReanalysisStatus)
+		admin.POST("/reanalysis", h.StartReanalysis)
+		admin.DELETE("/reanalysis", h.CancelReanalysis)
+		admin.GET("/embeddings", h.GetEmbeddingStatus)
+		admin.POST("/embeddings", h.QueueMissingEmbeddings)
+		admin.DELETE("/trash/:id", h.PurgeAnalysis)
+		admin.PUT("/documents/:id/legal-hold", h.SetLegalHold)
+		admin.GET("/retention", h.GetRetentionStatus)
 	}
 
 	log.Printf("Server starting on port %s", port)
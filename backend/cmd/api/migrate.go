@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"documind/backend/internal/storage"
+	"documind/backend/pkg/database"
+)
+
+const migrateUsage = `Usage: api migrate <command>
+
+Commands:
+  up             apply all pending migrations
+  down [n]       roll back the last n migrations (default 1)
+  status         list migrations and whether they were applied
+  create <name>  create empty up/down files for a new migration
+                 (in internal/storage/migrations, or MIGRATIONS_DIR)`
+
+// runMigrate chạy lệnh con "migrate" và trả về exit code.
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	// create chỉ ghi file vào mã nguồn, không cần kết nối cơ sở dữ liệu
+	if args[0] == "create" {
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		dir := os.Getenv("MIGRATIONS_DIR")
+		if dir == "" {
+			dir = "internal/storage/migrations"
+		}
+		paths, err := storage.CreateMigration(dir, args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate create:", err)
+			return 1
+		}
+		for _, p := range paths {
+			fmt.Println("created", p)
+		}
+		return 0
+	}
+
+	store, err := database.Connect()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+	defer store.Close()
+
+	switch args[0] {
+	case "up":
+		done, err := store.MigrateUp()
+		for _, m := range done {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate up:", err)
+			return 1
+		}
+		if len(done) == 0 {
+			fmt.Println("schema is up to date")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				fmt.Fprintln(os.Stderr, "migrate down: n must be a positive integer")
+				return 2
+			}
+		}
+		done, err := store.MigrateDown(steps)
+		for _, m := range done {
+			fmt.Printf("rolled back %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate down:", err)
+			return 1
+		}
+		if len(done) == 0 {
+			fmt.Println("no migrations to roll back")
+		}
+	case "status":
+		states, err := store.MigrationStatus()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate status:", err)
+			return 1
+		}
+		for _, st := range states {
+			status := "pending"
+			if st.AppliedAt != nil {
+				status = "applied " + st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if st.Unknown {
+				status += " (not in this build)"
+			}
+			fmt.Printf("%04d_%-40s %s\n", st.Version, st.Name, status)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
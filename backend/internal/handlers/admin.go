@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminOnly chỉ cho các request có header "Authorization: Bearer <ADMIN_TOKEN>" đi tiếp.
+// Khi ADMIN_TOKEN chưa được đặt, các API quản trị bị tắt.
+func AdminOnly() gin.HandlerFunc {
+	token := os.Getenv("ADMIN_TOKEN")
+	return func(c *gin.Context) {
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API quản trị chưa được bật (cần đặt ADMIN_TOKEN)."})
+			return
+		}
+		got, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -4,41 +4,282 @@ import (
 	"crypto/sha256"
 	"documind/backend/internal/models"
 	"documind/backend/internal/services"
-	"documind/backend/pkg/database"
+	"documind/backend/internal/storage"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
+// Mã lỗi trả về trong trường "code" để client xử lý theo từng trường hợp.
+const (
+	ErrCodePDFPasswordRequired = "PDF_PASSWORD_REQUIRED"
+	ErrCodePDFPasswordInvalid  = "PDF_PASSWORD_INVALID"
+	ErrCodeLegalHold           = "LEGAL_HOLD"
+	ErrCodeDocumentInTrash     = "DOCUMENT_IN_TRASH"
+)
+
+// Handler chứa kho lưu trữ dùng chung cho các HTTP handler. Cơ sở dữ liệu được kết nối
+// sau khi server đã chạy nên kho lưu trữ được gán sau qua SetStore (xem database.Supervisor).
+type Handler struct {
+	store atomic.Pointer[storage.Store]
+	// reanalysis phân tích lại ở nền các analysis tạo bởi phiên bản pipeline cũ
+	reanalysis *reanalyzer
+	// embeddings tạo embedding ở nền cho tìm kiếm ngữ nghĩa
+	embeddings *embedder
+	// retention áp dụng thời hạn lưu giữ và dọn thùng rác
+	retention *purger
+}
+
+// NewHandler tạo Handler chưa có kho lưu trữ.
+func NewHandler() *Handler {
+	return &Handler{reanalysis: newReanalyzer(), embeddings: newEmbedder(), retention: newPurger()}
+}
+
+// SetStore gán kho lưu trữ khi kết nối cơ sở dữ liệu thành công; nil khi mất kết nối.
+func (h *Handler) SetStore(s *storage.Store) {
+	h.store.Store(s)
+}
+
+// storeOrUnavailable trả về kho lưu trữ; nếu cơ sở dữ liệu chưa kết nối (hoặc đang mất kết nối)
+// thì gửi 503 kèm Retry-After và trả về nil.
+func (h *Handler) storeOrUnavailable(c *gin.Context) *storage.Store {
+	s := h.store.Load()
+	if s == nil {
+		c.Header("Retry-After", strconv.Itoa(retryAfterSeconds))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Cơ sở dữ liệu chưa sẵn sàng, vui lòng thử lại sau."})
+	}
+	return s
+}
+
 type AnalysisResponse struct {
+	// AnalysisID là lần phân tích, DocumentID là file được phân tích (một file có thể có nhiều lần phân tích)
+	AnalysisID     uint     `json:"analysis_id,omitempty"`
+	DocumentID     uint     `json:"document_id,omitempty"`
 	FileHash       string   `json:"file_hash"`
 	Summary        string   `json:"summary"`
 	KeyClauses     []string `json:"key_clauses"`
 	PotentialRisks []string `json:"potential_risks"`
+	// Warnings: cảnh báo về chất lượng trích xuất, ví dụ trang scan phải OCR
+	Warnings []string `json:"warnings,omitempty"`
+	// Chỉ có khi phân tích bộ hồ sơ ZIP
+	CrossReferences []string           `json:"cross_references,omitempty"`
+	Reconciliation  []string           `json:"reconciliation,omitempty"`
+	Files           []AnalysisFileItem `json:"files,omitempty"`
+	// Chỉ có khi tài liệu được tải lên dưới dạng e-mail
+	Email *EmailInfo `json:"email,omitempty"`
+	// Chỉ có khi nội dung gần trùng với một analysis đã có
+	Similar *SimilarAnalysis `json:"similar,omitempty"`
+	// Chỉ có khi tài liệu có chữ ký số
+	SignatureStatus *SignatureStatus `json:"signature_status,omitempty"`
+	// Cách nội dung được gửi cho AI: text, multimodal hoặc document
+	AnalysisMode string `json:"analysis_mode,omitempty"`
+	// Chỉ số chất lượng trích xuất text
+	Quality *services.QualityMetrics `json:"quality,omitempty"`
+	// Ngôn ngữ của hợp đồng: vi, en, bilingual hoặc other
+	Language string `json:"language,omitempty"`
+	// Phân loại hợp đồng: loại hợp đồng (xem services.ContractTypes), các bên và mức rủi ro tổng thể
+	ContractType string   `json:"contract_type,omitempty"`
+	Parties      []string `json:"parties,omitempty"`
+	RiskLevel    string   `json:"risk_level,omitempty"`
+	// Phiên bản pipeline đã tạo ra kết quả; Stale khi khác phiên bản hiện tại
+	PipelineVersion string `json:"pipeline_version,omitempty"`
+	Stale           bool   `json:"stale,omitempty"`
+	// RefreshQueued: kết quả cũ đã được đưa vào hàng đợi phân tích lại (chính sách requeue)
+	RefreshQueued bool `json:"refresh_queued,omitempty"`
+}
+
+// SignatureStatus là kết quả kiểm tra chữ ký số offline: chữ ký hợp lệ chứng minh nội dung
+// không bị sửa, nhưng chứng thư của người ký không được đối chiếu với CA tin cậy.
+type SignatureStatus struct {
+	Summary    string                   `json:"summary"`
+	Signatures []services.SignatureInfo `json:"signatures"`
+}
+
+type SimilarAnalysis struct {
+	AnalysisID uint    `json:"analysis_id"`
+	FileHash   string  `json:"file_hash"`
+	Similarity float64 `json:"similarity"`
+	Message    string  `json:"message"`
+	// Các dòng khác nhau ("- " dòng của analysis cũ, "+ " dòng của tài liệu mới)
+	Diff []string `json:"diff,omitempty"`
+}
+
+type EmailInfo struct {
+	From    string     `json:"from"`
+	Subject string     `json:"subject"`
+	Date    *time.Time `json:"date,omitempty"`
+}
+
+type AnalysisFileItem struct {
+	ID        uint   `json:"id,omitempty"`
+	FileName  string `json:"file_name"`
+	FileHash  string `json:"file_hash"`
+	Role      string `json:"role"`
+	Label     string `json:"label,omitempty"`
+	Size      int64  `json:"size"`
+	PageCount int    `json:"page_count,omitempty"`
 }
 
 type AnalysisListItem struct {
-	ID             uint      `json:"id"`
-	FileHash       string    `json:"file_hash"`
-	CreatedAt      time.Time `json:"created_at"`
-	SummaryPreview string    `json:"summary_preview"`
+	ID              uint          `json:"id"`
+	DocumentID      uint          `json:"document_id"`
+	FileHash        string        `json:"file_hash"`
+	CreatedAt       time.Time     `json:"created_at"`
+	SummaryPreview  string        `json:"summary_preview"`
+	Language        string        `json:"language,omitempty"`
+	ContractType    string        `json:"contract_type,omitempty"`
+	RiskLevel       string        `json:"risk_level,omitempty"`
+	RiskCount       int           `json:"risk_count"`
+	Parties         []string      `json:"parties,omitempty"`
+	Tags            []string      `json:"tags,omitempty"`
+	Model           string        `json:"model,omitempty"`
+	PipelineVersion string        `json:"pipeline_version,omitempty"`
+	Email           *EmailInfo    `json:"email,omitempty"`
+	Metadata        *MetadataInfo `json:"metadata,omitempty"`
+}
+
+// AnalysisListResponse là một trang của danh sách analysis. Items là []AnalysisListItem, hoặc
+// chỉ các trường được chọn bằng query "fields".
+type AnalysisListResponse struct {
+	Items interface{} `json:"items"`
+	// Total là số analysis khớp bộ lọc trên mọi trang
+	Total int64 `json:"total"`
+	// NextCursor dùng cho query "cursor" để lấy trang sau; rỗng ở trang cuối
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type DocumentTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+type DocumentTagsResponse struct {
+	DocumentID uint     `json:"document_id"`
+	Tags       []string `json:"tags"`
+}
+
+type MetadataInfo struct {
+	FileName           string     `json:"file_name"`
+	FileSize           int64      `json:"file_size"`
+	MIMEType           string     `json:"mime_type"`
+	Format             string     `json:"format"`
+	PageCount          int        `json:"page_count,omitempty"`
+	Title              string     `json:"title,omitempty"`
+	Author             string     `json:"author,omitempty"`
+	Subject            string     `json:"subject,omitempty"`
+	Keywords           string     `json:"keywords,omitempty"`
+	Creator            string     `json:"creator,omitempty"`
+	Producer           string     `json:"producer,omitempty"`
+	Company            string     `json:"company,omitempty"`
+	LastModifiedBy     string     `json:"last_modified_by,omitempty"`
+	DocumentCreatedAt  *time.Time `json:"document_created_at,omitempty"`
+	DocumentModifiedAt *time.Time `json:"document_modified_at,omitempty"`
 }
 
 type AnalysisDetailResponse struct {
-	ID             uint     `json:"id"`
-	AnalysisID     uint     `json:"analysis_id"`
-	Summary        string   `json:"summary"`
-	KeyClauses     []string `json:"key_clauses"`
-	PotentialRisks []string `json:"potential_risks"`
+	ID              uint                     `json:"id"`
+	AnalysisID      uint                     `json:"analysis_id"`
+	DocumentID      uint                     `json:"document_id"`
+	Summary         string                   `json:"summary"`
+	KeyClauses      []string                 `json:"key_clauses"`
+	PotentialRisks  []string                 `json:"potential_risks"`
+	Warnings        []string                 `json:"warnings,omitempty"`
+	CrossReferences []string                 `json:"cross_references,omitempty"`
+	Reconciliation  []string                 `json:"reconciliation,omitempty"`
+	Files           []AnalysisFileItem       `json:"files,omitempty"`
+	SignatureStatus *SignatureStatus         `json:"signature_status,omitempty"`
+	AnalysisMode    string                   `json:"analysis_mode,omitempty"`
+	Quality         *services.QualityMetrics `json:"quality,omitempty"`
+	ContractType    string                   `json:"contract_type,omitempty"`
+	Parties         []string                 `json:"parties,omitempty"`
+	RiskLevel       string                   `json:"risk_level,omitempty"`
+	Tags            []string                 `json:"tags,omitempty"`
+}
+
+type AnalysisStructureResponse struct {
+	AnalysisID uint                   `json:"analysis_id"`
+	Clauses    []*services.ClauseNode `json:"clauses"`
+}
+
+// ExtractResponse là kết quả của POST /extract: text trích xuất và chỉ số chất lượng, không gọi AI.
+type ExtractResponse struct {
+	FileHash string                   `json:"file_hash"`
+	Format   string                   `json:"format"`
+	Text     string                   `json:"text"`
+	Quality  *services.QualityMetrics `json:"quality"`
+	Warnings []string                 `json:"warnings,omitempty"`
+	// Chỉ có với tài liệu đơn lẻ
+	Pages []ExtractPageItem `json:"pages,omitempty"`
+	// Chỉ có với bộ hồ sơ ZIP và e-mail có file đính kèm
+	Files           []ExtractFileItem      `json:"files,omitempty"`
+	Info            *services.DocumentInfo `json:"info,omitempty"`
+	SignatureStatus *SignatureStatus       `json:"signature_status,omitempty"`
+}
+
+type ExtractPageItem struct {
+	Number     int     `json:"number"`
+	Source     string  `json:"source"`
+	Confidence float64 `json:"confidence"`
+	Characters int     `json:"characters"`
+}
+
+type ExtractFileItem struct {
+	FileName string                   `json:"file_name"`
+	Role     string                   `json:"role"`
+	Label    string                   `json:"label,omitempty"`
+	Quality  *services.QualityMetrics `json:"quality"`
+	Pages    []ExtractPageItem        `json:"pages,omitempty"`
+}
+
+// ProvenanceResponse mô tả cách một analysis được tạo ra, dùng để kiểm tra và gỡ lỗi.
+type ProvenanceResponse struct {
+	AnalysisID       uint            `json:"analysis_id"`
+	Model            string          `json:"model"`
+	PromptVersion    string          `json:"prompt_version"`
+	GenerationConfig json.RawMessage `json:"generation_config"`
+	AnalysisMode     string          `json:"analysis_mode"`
+	Extractor        ExtractorInfo   `json:"extractor"`
+	LatencyMs        StageLatency    `json:"latency_ms"`
+	TokenUsage       TokenUsage      `json:"token_usage"`
+	FinishReason     string          `json:"finish_reason"`
+	RawResponse      string          `json:"raw_response"`
+	CreatedAt        time.Time       `json:"created_at"`
+}
+
+type ExtractorInfo struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	OCREngine string `json:"ocr_engine,omitempty"`
+}
+
+type StageLatency struct {
+	Upload  int64 `json:"upload"`
+	Extract int64 `json:"extract"`
+	Model   int64 `json:"model"`
+	Total   int64 `json:"total"`
+}
+
+type TokenUsage struct {
+	PromptTokens   int `json:"prompt_tokens"`
+	ResponseTokens int `json:"response_tokens"`
+	TotalTokens    int `json:"total_tokens"`
 }
 
 type ContractChatRequest struct {
@@ -51,152 +292,839 @@ type ContractChatResponse struct {
 	Answer string `json:"answer"`
 }
 
-func AnalyzeHandler(c *gin.Context) {
-	fileHeader, err := c.FormFile("file")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "File upload failed: " + err.Error()})
+func (h *Handler) AnalyzeHandler(c *gin.Context) {
+	store := h.storeOrUnavailable(c)
+	if store == nil {
 		return
 	}
-	file, err := fileHeader.Open()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not open file: " + err.Error()})
+	// Thời gian từng bước được lưu vào provenance
+	start := time.Now()
+	limits := services.DefaultLimits()
+	up := receiveUpload(c, limits)
+	if up == nil {
 		return
 	}
-	defer file.Close()
+	defer up.file.Close()
+	uploadDuration := time.Since(start)
 
-	fileBytes, err := io.ReadAll(file)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not read file content: " + err.Error()})
-		return
+	// Chế độ phân tích: auto, text, multimodal (gửi kèm file PDF gốc) hoặc document (chỉ gửi file gốc)
+	requestedMode := services.DefaultAnalysisMode()
+	if v := c.PostForm("analysis_mode"); v != "" {
+		var err error
+		if requestedMode, err = services.ParseAnalysisMode(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Chế độ phân tích không hợp lệ. Dùng auto, text, multimodal hoặc document."})
+			return
+		}
 	}
 
-	hash := sha256.New()
-	hash.Write(fileBytes)
-	fileHash := hex.EncodeToString(hash.Sum(nil))
-
-	var existingAnalysis models.Analysis
-	// Dùng Preload để GORM tự động lấy dữ liệu từ bảng analysis_details liên quan
-	result := database.DB.Where("file_hash = ?", fileHash).Preload("AnalysisDetail").First(&existingAnalysis)
+	// Kết quả đã lưu được nạp kèm chi tiết, các file con và chỉ số chất lượng
+	stalePolicy := services.DefaultStalePolicy()
+	existingAnalysis, err := store.Analyses.ByFileHash(up.hash)
+	// refreshDocumentID là document có kết quả cũ được phân tích lại ngay (chính sách refresh)
+	var refreshDocumentID uint
 
 	// Cache Hit: Nếu tìm thấy và không có lỗi nào khác ngoài "không tìm thấy"
-	if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		if result.Error == nil {
-			log.Printf("Cache hit for file hash: %s", fileHash)
-			c.JSON(http.StatusOK, AnalysisResponse{
-				FileHash:       existingAnalysis.FileHash,
-				Summary:        existingAnalysis.AnalysisDetail.Summary,
-				KeyClauses:     existingAnalysis.AnalysisDetail.KeyClauses,
-				PotentialRisks: existingAnalysis.AnalysisDetail.PotentialRisks,
+	if !errors.Is(err, storage.ErrNotFound) {
+		if err != nil {
+			// Xử lý các lỗi database khác nếu có
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error: " + err.Error()})
+			return
+		}
+		if !isStale(existingAnalysis) || stalePolicy != services.StalePolicyRefresh {
+			log.Printf("Cache hit for file hash: %s", up.hash)
+			c.JSON(http.StatusOK, h.cachedResponse(existingAnalysis, stalePolicy))
+			return
+		}
+		log.Printf("Stale cache hit for file hash %s (pipeline %q). Analyzing again.", up.hash, existingAnalysis.PipelineVersion)
+		refreshDocumentID = existingAnalysis.DocumentID
+	} else {
+		// File đã bị xoá vào thùng rác: document vẫn giữ file hash cho tới khi bị xoá vĩnh viễn
+		if trashed, err := store.Trash.TrashedDocument(up.hash); err == nil {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":       "File này đang nằm trong thùng rác. Khôi phục analysis của nó hoặc đợi xoá vĩnh viễn trước khi tải lên lại.",
+				"code":        ErrCodeDocumentInTrash,
+				"document_id": trashed.ID,
 			})
 			return
+		} else if !errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error: " + err.Error()})
+			return
 		}
-		// Xử lý các lỗi database khác nếu có
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error: " + result.Error.Error()})
+		// Cache Miss: Tiếp tục xử lý file mới
+		log.Printf("Cache miss for file hash: %s. Processing new file.", up.hash)
+	}
+
+	opts := services.ExtractOptions{Password: up.password, OCR: services.DefaultOCREngine(), Limits: limits}
+	extractStart := time.Now()
+	ex, err := extractUpload(up, opts)
+	if err != nil {
+		respondExtractionError(c, err)
 		return
 	}
+	extractDuration := time.Since(extractStart)
 
-	// Cache Miss: Tiếp tục xử lý file mới
-	log.Printf("Cache miss for file hash: %s. Processing new file.", fileHash)
+	// File gốc chỉ gửi được cho model với PDF đơn lẻ không có mật khẩu
+	analysisMode := services.AnalysisModeText
+	var document *services.DocumentBlob
+	if ex.format == "pdf" && !up.encryptedPDF {
+		var reason string
+		analysisMode, reason = services.ChooseAnalysisMode(requestedMode, ex.extracted)
+		if reason != "" {
+			ex.warnings = append(ex.warnings, reason)
+		}
+		if analysisMode != services.AnalysisModeText {
+			document = &services.DocumentBlob{Name: up.header.Filename, MIMEType: "application/pdf", Reader: up.file, Size: up.file.Size()}
+		}
+	} else if requestedMode == services.AnalysisModeMultimodal || requestedMode == services.AnalysisModeDocument {
+		ex.warnings = append(ex.warnings, fmt.Sprintf("Chế độ %s chỉ hỗ trợ file PDF đơn lẻ không có mật khẩu, tài liệu được phân tích bằng text.", requestedMode))
+	}
+	// PDF scan không OCR được vẫn phân tích được khi gửi file gốc cho model
+	if !ex.hasText && document == nil {
+		resp := gin.H{"error": "Không trích xuất được nội dung văn bản từ file. Nếu đây là bản scan, vui lòng bật OCR hoặc tải lên file có lớp text."}
+		if len(ex.warnings) > 0 {
+			resp["warnings"] = ex.warnings
+		}
+		c.JSON(http.StatusUnprocessableEntity, resp)
+		return
+	}
 
-	fileReader := strings.NewReader(string(fileBytes))
-	contentType := fileHeader.Header.Get("Content-Type")
-	filename := strings.ToLower(fileHeader.Filename)
-	var textContent string
+	// Cache theo nội dung: cùng hợp đồng được xuất lại thành PDF khác hoặc lưu thành DOCX.
+	// Tài liệu không có text (PDF scan gửi thẳng cho model) không có khoá nội dung.
+	contentHash := services.ContentHash(ex.contentText)
+	simHash := services.SimHash(ex.contentText)
+	var similar *SimilarAnalysis
+	if ex.hasText {
+		cached, err := store.Analyses.ByContentHash(contentHash)
+		if err == nil && cached.DocumentID != refreshDocumentID && (!isStale(cached) || stalePolicy != services.StalePolicyRefresh) {
+			log.Printf("Content cache hit for file hash %s: analysis #%d", up.hash, cached.ID)
+			// Cùng nội dung nhưng file khác: chữ ký số là của file vừa tải lên
+			resp := h.cachedResponse(cached, stalePolicy)
+			resp.SignatureStatus = signatureStatus(ex.signatures)
+			resp.Quality = ex.quality
+			c.JSON(http.StatusOK, resp)
+			return
+		} else if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error: " + err.Error()})
+			return
+		}
+		// Khi phân tích lại, tài liệu gần trùng nhất chính là kết quả cũ của file này
+		if refreshDocumentID == 0 {
+			similar = findSimilarAnalysis(store, simHash, ex.contentText)
+		}
+	}
 
-	// ... (Toàn bộ khối switch để trích xuất text vẫn giữ nguyên)
-	switch {
-	case strings.Contains(contentType, "pdf") || strings.HasSuffix(filename, ".pdf"):
-		textContent, err = services.ExtractTextFromPDF(fileReader)
-	case strings.Contains(contentType, "officedocument.wordprocessingml.document") || strings.HasSuffix(filename, ".docx"):
-		textContent, err = services.ExtractTextFromDOCX(fileReader)
-	case strings.Contains(contentType, "msword") || strings.HasSuffix(filename, ".doc"):
-		textContent, err = services.ExtractTextFromDOCX(fileReader)
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Định dạng file không được hỗ trợ."})
+	// Ngôn ngữ của hợp đồng quyết định prompt, bộ từ khoá chọn model và ngôn ngữ của kết quả
+	language := ex.quality.Language
+	var references []string
+	var call *services.ModelCall
+	if ex.bundle != nil {
+		// Phân tích cả bộ hồ sơ trong một lần gọi để AI thấy được liên kết giữa các tài liệu
+		references = append(ex.bundle.CrossReferences(), ex.reconciliation...)
+		call, err = services.AnalyzeBundle(ex.textContent, references, language, services.AnalysisOptions{})
+	} else if document != nil {
+		call, err = services.AnalyzeDocument(document, ex.textContent, analysisMode, language, services.AnalysisOptions{})
+	} else {
+		call, err = services.AnalyzeText(ex.textContent, language, services.AnalysisOptions{})
+	}
+	if err != nil {
+		respondAnalysisError(c, err)
 		return
 	}
+	analysisResp, err := parseAnalysisResult(call)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not extract text from file: " + err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse AI response."})
 		return
 	}
 
-	aiResultString, err := services.AnalyzeText(textContent)
+	// Lưu document cùng analysis, chi tiết, metadata, chỉ số chất lượng, khoá cache theo nội dung
+	// và các file con của bộ hồ sơ trong một transaction
+	analysisModel := models.Analysis{
+		FileHash:        up.hash,
+		SummaryPreview:  summaryPreview(analysisResp.Summary),
+		Language:        language,
+		PipelineVersion: services.PipelineVersion,
+	}
+	classifyAnalysis(&analysisModel, analysisResp)
+	if ex.email != nil {
+		analysisModel.EmailFrom = ex.email.From
+		analysisModel.EmailSubject = ex.email.Subject
+		analysisModel.EmailDate = ex.email.Date
+	}
+
+	structureJSON, err := json.Marshal(ex.clauses)
 	if err != nil {
-		// Kiểm tra lỗi quota API
-		if strings.Contains(err.Error(), "quota") || strings.Contains(err.Error(), "429") || strings.Contains(err.Error(), "exceeded") {
-			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "API quota đã hết. Vui lòng thử lại sau hoặc liên hệ admin để nâng cấp quota."})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode document structure."})
+		return
+	}
+	var signaturesJSON []byte
+	if len(ex.signatures) > 0 {
+		if signaturesJSON, err = json.Marshal(ex.signatures); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode signatures."})
 			return
 		}
-		
-		// Kiểm tra lỗi API key
-		if strings.Contains(err.Error(), "API_KEY") || strings.Contains(err.Error(), "authentication") {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi xác thực API. Vui lòng kiểm tra cấu hình."})
-			return
+	}
+	record := &storage.NewAnalysis{
+		Document: &models.Document{
+			FileHash:         up.hash,
+			Format:           ex.format,
+			Language:         language,
+			AnalysisText:     ex.textContent,
+			Bundle:           ex.bundle != nil,
+			PromptReferences: references,
+		},
+		Analysis: &analysisModel,
+		Parties:  analysisModel.Parties,
+		Detail: &models.AnalysisDetail{
+			Summary:         analysisResp.Summary,
+			KeyClauses:      analysisResp.KeyClauses,
+			PotentialRisks:  analysisResp.PotentialRisks,
+			Warnings:        ex.warnings,
+			Structure:       string(structureJSON),
+			CrossReferences: analysisResp.CrossReferences,
+			Reconciliation:  ex.reconciliation,
+			ExtractedText:   ex.contentText,
+			Signatures:      string(signaturesJSON),
+			AnalysisMode:    analysisMode,
+		},
+	}
+
+	// Khoá cache theo nội dung
+	if ex.hasText {
+		record.Fingerprint = &models.ContentFingerprint{
+			ContentHash: contentHash,
+			SimHash:     int64(simHash),
+			Band0:       services.SimHashBand(simHash, 0),
+			Band1:       services.SimHashBand(simHash, 1),
+			Band2:       services.SimHashBand(simHash, 2),
+			Band3:       services.SimHashBand(simHash, 3),
 		}
-		
-		// Lỗi chung
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "AI analysis failed: " + err.Error()})
+	}
+
+	// Metadata của file tải lên
+	metadata := newDocumentMetadata(up.header.Filename, up.file, up.contentType, ex.format, ex.info)
+	if ex.bundle != nil {
+		// Bộ hồ sơ: tổng số trang của mọi tài liệu, không chỉ hợp đồng chính
+		pages := 0
+		for _, doc := range ex.bundle.Documents {
+			pages += len(doc.Result.Pages)
+		}
+		metadata.PageCount = pages
+	}
+	record.Metadata = &metadata
+
+	// Chỉ số chất lượng trích xuất
+	metrics := extractionMetrics(ex.quality)
+	record.Metrics = &metrics
+
+	// Model, prompt, extractor và thời gian từng bước đã tạo ra kết quả này
+	generationConfig, _ := json.Marshal(call.GenerationConfig)
+	provenance := models.AnalysisProvenance{
+		Model:            call.Model,
+		PromptVersion:    call.PromptVersion,
+		GenerationConfig: string(generationConfig),
+		AnalysisMode:     analysisMode,
+		Extractor:        ex.format,
+		ExtractorVersion: services.ExtractorVersion,
+		UploadMs:         uploadDuration.Milliseconds(),
+		ExtractMs:        extractDuration.Milliseconds(),
+		ModelMs:          call.Latency.Milliseconds(),
+		RawResponse:      call.RawResponse,
+		FinishReason:     call.FinishReason,
+		PromptTokens:     call.PromptTokens,
+		ResponseTokens:   call.ResponseTokens,
+		TotalTokens:      call.TotalTokens,
+	}
+	if opts.OCR != nil {
+		provenance.OCREngine = opts.OCR.Name()
+	}
+	record.Provenance = &provenance
+
+	// Bộ hồ sơ ZIP: lưu từng file con
+	if ex.bundle != nil {
+		for _, doc := range ex.bundle.Documents {
+			docStructure, _ := json.Marshal(doc.Result.ClauseStructure())
+			record.Files = append(record.Files, models.AnalysisFile{
+				FileName:  doc.Name,
+				FileHash:  doc.Hash,
+				Role:      doc.Role,
+				Label:     doc.Label,
+				Size:      doc.Size,
+				PageCount: len(doc.Result.Pages),
+				Structure: string(docStructure),
+			})
+		}
+	}
+
+	// Phân tích lại file đã có: kết quả là một analysis mới của document cũ, các bản ghi
+	// gắn với file (metadata, chỉ số chất lượng, khoá nội dung, file con) giữ nguyên
+	if refreshDocumentID != 0 {
+		record.Document = nil
+		analysisModel.DocumentID = refreshDocumentID
+	}
+
+	provenance.TotalMs = time.Since(start).Milliseconds()
+	if err := store.Analyses.Create(record); err != nil {
+		log.Printf("Failed to save analysis: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save analysis."})
 		return
 	}
+	h.queueEmbedding(&analysisModel)
 
-	cleanedJSONString := cleanAIResponse(aiResultString)
-	var analysisResp AnalysisResponse
-	err = json.Unmarshal([]byte(cleanedJSONString), &analysisResp)
-	if err != nil {
-		log.Printf("Lỗi khi parse JSON từ AI: %v. \nChuỗi gốc: %s", err, aiResultString)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse AI response."})
+	c.JSON(http.StatusOK, AnalysisResponse{
+		AnalysisID:      analysisModel.ID,
+		DocumentID:      analysisModel.DocumentID,
+		FileHash:        up.hash,
+		Summary:         analysisResp.Summary,
+		KeyClauses:      analysisResp.KeyClauses,
+		PotentialRisks:  analysisResp.PotentialRisks,
+		Warnings:        ex.warnings,
+		CrossReferences: analysisResp.CrossReferences,
+		Reconciliation:  ex.reconciliation,
+		Files:           analysisFileItems(record.Files),
+		Email:           emailInfo(analysisModel),
+		Similar:         similar,
+		SignatureStatus: signatureStatus(ex.signatures),
+		AnalysisMode:    analysisMode,
+		Quality:         ex.quality,
+		Language:        language,
+		ContractType:    analysisResp.ContractType,
+		Parties:         analysisResp.Parties,
+		RiskLevel:       analysisResp.RiskLevel,
+		PipelineVersion: services.PipelineVersion,
+	})
+}
+
+// POST /api/v1/extract - Trích xuất text và chẩn đoán chất lượng trích xuất, không gọi AI và không lưu kết quả
+func ExtractHandler(c *gin.Context) {
+	limits := services.DefaultLimits()
+	up := receiveUpload(c, limits)
+	if up == nil {
 		return
 	}
+	defer up.file.Close()
 
-	// SỬ DỤNG DATABASE TRANSACTION ĐỂ LƯU DỮ LIỆU VÀO 2 BẢNG
-	tx := database.DB.Begin()
-	if tx.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start database transaction."})
+	opts := services.ExtractOptions{Password: up.password, OCR: services.DefaultOCREngine(), Limits: limits}
+	ex, err := extractUpload(up, opts)
+	if err != nil {
+		respondExtractionError(c, err)
 		return
 	}
 
-	// 1. Tạo bản ghi chính (analyses) trước
-	summaryPreview := analysisResp.Summary
-	if len(summaryPreview) > 200 {
-		summaryPreview = summaryPreview[:200]
+	resp := ExtractResponse{
+		FileHash:        up.hash,
+		Format:          ex.format,
+		Text:            ex.textContent,
+		Quality:         ex.quality,
+		Warnings:        ex.warnings,
+		Info:            ex.info,
+		SignatureStatus: signatureStatus(ex.signatures),
 	}
-	analysisModel := models.Analysis{
-		FileHash:       fileHash,
-		SummaryPreview: summaryPreview,
+	if ex.extracted != nil {
+		resp.Pages = extractPageItems(ex.extracted.Pages)
 	}
-	if err := tx.Create(&analysisModel).Error; err != nil {
-		tx.Rollback()
-		log.Printf("Failed to save main analysis record: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save main analysis record."})
-		return
+	if ex.bundle != nil {
+		for _, doc := range ex.bundle.Documents {
+			resp.Files = append(resp.Files, ExtractFileItem{
+				FileName: doc.Name,
+				Role:     doc.Role,
+				Label:    doc.Label,
+				Quality:  doc.Result.Quality(),
+				Pages:    extractPageItems(doc.Result.Pages),
+			})
+		}
 	}
+	c.JSON(http.StatusOK, resp)
+}
 
-	// 2. Tạo bản ghi chi tiết (analysis_details) với AnalysisID vừa tạo
-	detail := models.AnalysisDetail{
-		AnalysisID:     analysisModel.ID,
-		Summary:        analysisResp.Summary,
-		KeyClauses:     analysisResp.KeyClauses,
-		PotentialRisks: analysisResp.PotentialRisks,
+// extractPageItems tóm tắt từng trang: nguồn text (lớp text hay OCR), độ tin cậy và số ký tự khác khoảng trắng.
+func extractPageItems(pages []services.ExtractedPage) []ExtractPageItem {
+	items := make([]ExtractPageItem, 0, len(pages))
+	for _, p := range pages {
+		items = append(items, ExtractPageItem{
+			Number:     p.Number,
+			Source:     p.Source,
+			Confidence: p.Confidence,
+			Characters: utf8.RuneCountInString(strings.Join(strings.Fields(p.Text), "")),
+		})
 	}
-	if err := tx.Create(&detail).Error; err != nil {
-		tx.Rollback()
-		log.Printf("Failed to save analysis details: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save analysis details."})
-		return
+	return items
+}
+
+// receivedUpload là file tải lên đã được ghi ra file tạm, kèm các trường của form liên quan tới việc trích xuất.
+type receivedUpload struct {
+	header      *multipart.FileHeader
+	file        *uploadFile
+	hash        string
+	contentType string
+	// filename là tên file viết thường, dùng để nhận dạng định dạng
+	filename     string
+	isZIP, isEML bool
+	encryptedPDF bool
+	// Mật khẩu chỉ dùng để giải mã trong request này, không được lưu hay ghi log
+	password string
+}
+
+// receiveUpload đọc trường "file" của form ra file tạm, tính hash và kiểm tra mật khẩu.
+// Trả về nil khi đã gửi response lỗi; người gọi phải đóng upload.file.
+func receiveUpload(c *gin.Context, limits services.Limits) *receivedUpload {
+	// Chặn request quá lớn trước khi gin đọc multipart form (dư 1 MB cho các trường khác của form)
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limits.MaxUploadBytes+1<<20)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondExtractionError(c, &services.LimitError{Subject: "upload", Limit: "MB", Max: limits.MaxUploadBytes >> 20})
+			return nil
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File upload failed: " + err.Error()})
+		return nil
 	}
+	if fileHeader.Size > limits.MaxUploadBytes {
+		respondExtractionError(c, &services.LimitError{Subject: "upload", Limit: "MB", Max: limits.MaxUploadBytes >> 20})
+		return nil
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not open file: " + err.Error()})
+		return nil
+	}
+	defer file.Close()
 
-	if err := tx.Commit().Error; err != nil {
-		log.Printf("Failed to commit transaction: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction."})
-		return
+	// Ghi file ra file tạm và tính hash trong cùng một lần đọc; các extractor đọc
+	// trực tiếp từ file tạm thay vì giữ cả file trong bộ nhớ
+	fileReader, fileHash, err := spoolUpload(file, limits.MaxUploadBytes)
+	if err != nil {
+		if errors.Is(err, services.ErrLimitExceeded) {
+			respondExtractionError(c, err)
+			return nil
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not read file content: " + err.Error()})
+		return nil
 	}
 
-	c.JSON(http.StatusOK, AnalysisResponse{
-		FileHash:       fileHash,
-		Summary:        analysisResp.Summary,
-		KeyClauses:     analysisResp.KeyClauses,
-		PotentialRisks: analysisResp.PotentialRisks,
+	contentType := fileHeader.Header.Get("Content-Type")
+	filename := strings.ToLower(fileHeader.Filename)
+	isPDF := strings.Contains(contentType, "pdf") || strings.HasSuffix(filename, ".pdf")
+	// Bộ hồ sơ: hợp đồng chính kèm phụ lục, SOW, văn bản sửa đổi trong một file ZIP
+	isZIP := strings.Contains(contentType, "zip") || strings.HasSuffix(filename, ".zip")
+	// E-mail: thân thư là bối cảnh đàm phán, các file đính kèm được phân tích như một bộ hồ sơ
+	isEML := strings.Contains(contentType, "message/rfc822") || strings.HasSuffix(filename, ".eml")
+	// Mật khẩu chỉ dùng để giải mã trong request này, không được lưu hay ghi log
+	password := c.PostForm("password")
+
+	// PDF có mật khẩu: kiểm tra mật khẩu trước khi tra cache để kết quả đã lưu
+	// không bị trả về cho người không có mật khẩu
+	encryptedPDF := isPDF && services.IsEncryptedPDF(fileReader, fileReader.Size())
+	if encryptedPDF {
+		if err := services.VerifyPDFPassword(fileReader, fileReader.Size(), password); err != nil {
+			fileReader.Close()
+			respondExtractionError(c, err)
+			return nil
+		}
+	}
+	if isZIP {
+		if err := services.VerifyBundlePasswords(fileReader, fileReader.Size(), password); err != nil {
+			fileReader.Close()
+			respondExtractionError(c, err)
+			return nil
+		}
+	}
+	if isEML {
+		if err := services.VerifyEmailPasswords(fileReader, fileReader.Size(), password); err != nil {
+			fileReader.Close()
+			respondExtractionError(c, err)
+			return nil
+		}
+	}
+
+	return &receivedUpload{
+		header:       fileHeader,
+		file:         fileReader,
+		hash:         fileHash,
+		contentType:  contentType,
+		filename:     filename,
+		isZIP:        isZIP,
+		isEML:        isEML,
+		encryptedPDF: encryptedPDF,
+		password:     password,
+	}
+}
+
+// uploadExtraction là kết quả trích xuất một file tải lên: tài liệu đơn lẻ, bộ hồ sơ ZIP hoặc e-mail.
+type uploadExtraction struct {
+	format string
+	// textContent là nội dung gửi cho AI, kèm dấu mốc trang và tên file
+	textContent string
+	// contentText: text đã chuẩn hoá không kèm dấu mốc trang hay tên file, dùng làm khoá cache theo nội dung
+	contentText string
+	warnings    []string
+	clauses     []*services.ClauseNode
+	bundle      *services.Bundle
+	email       *services.EmailMessage
+	// extracted là kết quả trích xuất của tài liệu đơn lẻ (không phải ZIP hay e-mail)
+	extracted *services.ExtractionResult
+	// Đối chiếu tổng tiền trong bảng tính của bộ hồ sơ với hợp đồng chính
+	reconciliation []string
+	// Chữ ký số của các file PDF
+	signatures []services.SignatureInfo
+	// Metadata nhúng trong file; với ZIP và e-mail lấy từ hợp đồng chính
+	info    *services.DocumentInfo
+	quality *services.QualityMetrics
+	hasText bool
+}
+
+// extractUpload trích xuất file tải lên theo định dạng của nó.
+func extractUpload(up *receivedUpload, opts services.ExtractOptions) (*uploadExtraction, error) {
+	ex := &uploadExtraction{}
+	switch {
+	case up.isEML:
+		ex.format = "eml"
+		email, err := services.ExtractEmail(up.file, up.file.Size(), opts)
+		if err != nil {
+			return nil, err
+		}
+		ex.email = email
+		ex.bundle = email.Bundle
+		ex.textContent = email.Text()
+		ex.contentText = email.ContentText()
+		ex.warnings = email.Warnings
+		ex.quality = email.Quality()
+		ex.hasText = strings.TrimSpace(email.Body) != ""
+		if ex.bundle == nil {
+			// Thư không có file đính kèm: hợp đồng nằm ngay trong thân thư
+			ex.clauses = services.ParseClauses(email.Body)
+		}
+	case up.isZIP:
+		ex.format = "zip"
+		bundle, err := services.ExtractBundle(up.file, up.file.Size(), opts)
+		if err != nil {
+			return nil, err
+		}
+		ex.bundle = bundle
+		ex.textContent = bundle.Text()
+		ex.contentText = bundle.ContentText()
+		ex.warnings = bundle.Warnings
+		ex.quality = bundle.Quality()
+	default:
+		extractor := services.FindExtractor(up.filename, up.contentType)
+		if extractor == nil {
+			return nil, services.ErrUnsupportedFormat
+		}
+		ex.format = extractor.Name()
+		extracted, err := extractor.Extract(up.file, up.file.Size(), opts)
+		if err != nil {
+			return nil, err
+		}
+		ex.extracted = extracted
+		// Giữ dấu mốc trang để AI có thể trích dẫn số trang
+		ex.textContent = extracted.TextWithPageMarkers()
+		ex.contentText = extracted.Text
+		ex.warnings = extracted.Warnings
+		ex.signatures = extracted.Signatures
+		ex.clauses = extracted.ClauseStructure()
+		ex.info = extracted.Info
+		ex.quality = extracted.Quality()
+		ex.hasText = strings.TrimSpace(extracted.Text) != ""
+	}
+
+	if ex.bundle != nil {
+		ex.clauses = ex.bundle.Main().Result.ClauseStructure()
+		ex.info = ex.bundle.Main().Result.Info
+		for _, doc := range ex.bundle.Documents {
+			ex.hasText = ex.hasText || strings.TrimSpace(doc.Result.Text) != ""
+		}
+		ex.reconciliation = ex.bundle.Reconcile()
+		ex.signatures = ex.bundle.Signatures()
+	}
+	return ex, nil
+}
+
+// cachedAnalysisResponse trả về kết quả đã lưu của một analysis.
+func cachedAnalysisResponse(a models.Analysis) AnalysisResponse {
+	var files []models.AnalysisFile
+	var metrics *models.ExtractionMetrics
+	if a.Document != nil {
+		files, metrics = a.Document.Files, a.Document.Metrics
+	}
+	return AnalysisResponse{
+		AnalysisID:      a.ID,
+		DocumentID:      a.DocumentID,
+		FileHash:        a.FileHash,
+		Summary:         a.AnalysisDetail.Summary,
+		KeyClauses:      a.AnalysisDetail.KeyClauses,
+		PotentialRisks:  a.AnalysisDetail.PotentialRisks,
+		Warnings:        a.AnalysisDetail.Warnings,
+		CrossReferences: a.AnalysisDetail.CrossReferences,
+		Reconciliation:  a.AnalysisDetail.Reconciliation,
+		Files:           analysisFileItems(files),
+		Email:           emailInfo(a),
+		SignatureStatus: storedSignatureStatus(a.AnalysisDetail.Signatures),
+		AnalysisMode:    a.AnalysisDetail.AnalysisMode,
+		Quality:         qualityMetrics(metrics),
+		Language:        a.Language,
+		ContractType:    a.ContractType,
+		Parties:         partyNames(a.Parties),
+		RiskLevel:       services.RiskLevel(a.RiskSeverity),
+		PipelineVersion: a.PipelineVersion,
+	}
+}
+
+// cachedResponse trả về kết quả đã lưu theo chính sách với kết quả cũ: đánh dấu "stale" và
+// với chính sách requeue thì đưa vào hàng đợi phân tích lại.
+func (h *Handler) cachedResponse(a *models.Analysis, stalePolicy string) AnalysisResponse {
+	resp := cachedAnalysisResponse(*a)
+	if isStale(a) {
+		resp.Stale = true
+		if stalePolicy == services.StalePolicyRequeue {
+			resp.RefreshQueued = h.reanalysis.enqueue(a)
+		}
+	}
+	return resp
+}
+
+// signatureStatus tạo mục "signature_status" của response; nil nếu không có chữ ký số.
+func signatureStatus(sigs []services.SignatureInfo) *SignatureStatus {
+	if len(sigs) == 0 {
+		return nil
+	}
+	return &SignatureStatus{Summary: services.SignatureSummary(sigs), Signatures: sigs}
+}
+
+// storedSignatureStatus đọc kết quả kiểm tra chữ ký đã lưu dạng JSON.
+func storedSignatureStatus(stored string) *SignatureStatus {
+	if stored == "" {
+		return nil
+	}
+	var sigs []services.SignatureInfo
+	if err := json.Unmarshal([]byte(stored), &sigs); err != nil {
+		log.Printf("Failed to decode stored signatures: %v", err)
+		return nil
+	}
+	return signatureStatus(sigs)
+}
+
+// maxSimilarDiffLines giới hạn số dòng khác biệt trả về cho tài liệu gần trùng.
+const maxSimilarDiffLines = 200
+
+// findSimilarAnalysis tìm analysis có SimHash lệch không quá services.NearDuplicateDistance bit
+// và so sánh text của nó với tài liệu mới. Trả về nil nếu không có tài liệu gần trùng.
+func findSimilarAnalysis(store *storage.Store, simHash uint64, text string) *SimilarAnalysis {
+	// Hai SimHash lệch nhau ít bit chắc chắn trùng ít nhất một dải 16 bit
+	candidates, err := store.Analyses.FingerprintsByBand([4]int{
+		services.SimHashBand(simHash, 0), services.SimHashBand(simHash, 1),
+		services.SimHashBand(simHash, 2), services.SimHashBand(simHash, 3),
 	})
+	if err != nil {
+		log.Printf("Failed to look up similar analyses: %v", err)
+		return nil
+	}
+	var best *models.ContentFingerprint
+	bestDistance := services.NearDuplicateDistance + 1
+	for i := range candidates {
+		if d := services.HammingDistance(uint64(candidates[i].SimHash), simHash); d < bestDistance {
+			best, bestDistance = &candidates[i], d
+		}
+	}
+	if best == nil {
+		return nil
+	}
+
+	analysis, err := store.Analyses.LatestByDocument(best.DocumentID)
+	if err != nil {
+		return nil
+	}
+	similar := &SimilarAnalysis{
+		AnalysisID: analysis.ID,
+		FileHash:   analysis.FileHash,
+		Similarity: 1 - float64(bestDistance)/64,
+		Message:    fmt.Sprintf("Tương tự analysis #%d", analysis.ID),
+	}
+	if diff, ok := services.DiffLines(analysis.AnalysisDetail.ExtractedText, text); ok {
+		similar.Diff = services.ChangedLines(diff, maxSimilarDiffLines)
+	} else {
+		similar.Message += " (quá nhiều khác biệt để hiển thị chi tiết)"
+	}
+	return similar
+}
+
+// newDocumentMetadata gom metadata của file tải lên: thông tin từ request và thuộc tính nhúng trong file.
+func newDocumentMetadata(filename string, upload *uploadFile, contentType, format string, info *services.DocumentInfo) models.DocumentMetadata {
+	// http.DetectContentType chỉ xét tối đa 512 byte đầu
+	head := make([]byte, 512)
+	n, _ := upload.ReadAt(head, 0)
+	m := models.DocumentMetadata{
+		FileName: filename,
+		FileSize: upload.Size(),
+		MIMEType: detectMIMEType(filename, contentType, head[:n]),
+		Format:   format,
+	}
+	if info != nil {
+		m.PageCount = info.PageCount
+		m.Title = info.Title
+		m.Author = info.Author
+		m.Subject = info.Subject
+		m.Keywords = info.Keywords
+		m.Creator = info.Creator
+		m.Producer = info.Producer
+		m.Company = info.Company
+		m.LastModifiedBy = info.LastModifiedBy
+		m.DocumentCreatedAt = info.CreatedAt
+		m.DocumentModifiedAt = info.ModifiedAt
+	}
+	return m
+}
+
+// detectMIMEType ưu tiên Content-Type client gửi lên, sau đó đến phần mở rộng của tên file,
+// cuối cùng mới đoán từ nội dung (DOCX sẽ bị nhận là ZIP nếu chỉ dựa vào nội dung).
+func detectMIMEType(filename, contentType string, data []byte) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType != "application/octet-stream" {
+		return mediaType
+	}
+	if byExt := mime.TypeByExtension(strings.ToLower(path.Ext(filename))); byExt != "" {
+		mediaType, _, _ := mime.ParseMediaType(byExt)
+		return mediaType
+	}
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	return mediaType
+}
+
+// metadataInfo chuyển metadata sang dạng trả về cho client, nil nếu analysis chưa có metadata.
+func metadataInfo(m *models.DocumentMetadata) *MetadataInfo {
+	if m == nil {
+		return nil
+	}
+	return &MetadataInfo{
+		FileName:           m.FileName,
+		FileSize:           m.FileSize,
+		MIMEType:           m.MIMEType,
+		Format:             m.Format,
+		PageCount:          m.PageCount,
+		Title:              m.Title,
+		Author:             m.Author,
+		Subject:            m.Subject,
+		Keywords:           m.Keywords,
+		Creator:            m.Creator,
+		Producer:           m.Producer,
+		Company:            m.Company,
+		LastModifiedBy:     m.LastModifiedBy,
+		DocumentCreatedAt:  m.DocumentCreatedAt,
+		DocumentModifiedAt: m.DocumentModifiedAt,
+	}
+}
+
+// extractionMetrics chuyển chỉ số chất lượng trích xuất sang bản ghi để lưu.
+func extractionMetrics(q *services.QualityMetrics) models.ExtractionMetrics {
+	return models.ExtractionMetrics{
+		PageCount:         q.PageCount,
+		EmptyPages:        q.EmptyPages,
+		Characters:        q.Characters,
+		CharsPerPage:      q.CharsPerPage,
+		NonLetterRatio:    q.NonLetterRatio,
+		DictionaryHitRate: q.DictionaryHitRate,
+		Language:          q.Language,
+		Score:             q.Score,
+	}
+}
+
+// qualityMetrics đọc chỉ số chất lượng đã lưu, nil nếu analysis được tạo trước khi có chỉ số này.
+func qualityMetrics(m *models.ExtractionMetrics) *services.QualityMetrics {
+	if m == nil {
+		return nil
+	}
+	return &services.QualityMetrics{
+		PageCount:         m.PageCount,
+		EmptyPages:        m.EmptyPages,
+		Characters:        m.Characters,
+		CharsPerPage:      m.CharsPerPage,
+		NonLetterRatio:    m.NonLetterRatio,
+		DictionaryHitRate: m.DictionaryHitRate,
+		Language:          m.Language,
+		Score:             m.Score,
+	}
+}
+
+// uploadFile là file tải lên đã được ghi ra file tạm; Close xoá file tạm.
+type uploadFile struct {
+	*os.File
+	size int64
+}
+
+func (u *uploadFile) Size() int64 { return u.size }
+
+func (u *uploadFile) Close() error {
+	err := u.File.Close()
+	os.Remove(u.Name())
+	return err
+}
+
+// spoolUpload chép file tải lên ra file tạm và tính SHA-256 trong cùng một lần đọc.
+// Trả về LimitError nếu file lớn hơn maxBytes.
+func spoolUpload(r io.Reader, maxBytes int64) (*uploadFile, string, error) {
+	tmp, err := os.CreateTemp("", "documind-upload-*")
+	if err != nil {
+		return nil, "", err
+	}
+	upload := &uploadFile{File: tmp}
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		upload.Close()
+		return nil, "", err
+	}
+	if n > maxBytes {
+		upload.Close()
+		return nil, "", &services.LimitError{Subject: "upload", Limit: "MB", Max: maxBytes >> 20}
+	}
+	upload.size = n
+	return upload, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// emailInfo trả về thông tin thư của analysis, nil nếu tài liệu không đến từ e-mail.
+func emailInfo(a models.Analysis) *EmailInfo {
+	if a.EmailFrom == "" && a.EmailSubject == "" && a.EmailDate == nil {
+		return nil
+	}
+	return &EmailInfo{From: a.EmailFrom, Subject: a.EmailSubject, Date: a.EmailDate}
+}
+
+// analysisFileItems chuyển các file con của bộ hồ sơ sang dạng trả về cho client.
+func analysisFileItems(files []models.AnalysisFile) []AnalysisFileItem {
+	var items []AnalysisFileItem
+	for _, f := range files {
+		items = append(items, AnalysisFileItem{
+			ID:        f.ID,
+			FileName:  f.FileName,
+			FileHash:  f.FileHash,
+			Role:      f.Role,
+			Label:     f.Label,
+			Size:      f.Size,
+			PageCount: f.PageCount,
+		})
+	}
+	return items
+}
+
+// respondExtractionError trả về lỗi trích xuất; PDF thiếu hoặc sai mật khẩu có mã lỗi riêng
+// để client hiển thị ô nhập mật khẩu và gửi lại file kèm trường "password".
+func respondExtractionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrPDFPasswordRequired):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "File PDF được bảo vệ bằng mật khẩu. Vui lòng nhập mật khẩu.", "code": ErrCodePDFPasswordRequired})
+	case errors.Is(err, services.ErrPDFInvalidPassword):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Mật khẩu PDF không đúng.", "code": ErrCodePDFPasswordInvalid})
+	case errors.Is(err, services.ErrLimitExceeded):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Tài liệu vượt quá giới hạn xử lý: " + err.Error()})
+	case errors.Is(err, services.ErrBundleLimit):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Bộ hồ sơ ZIP vượt quá giới hạn cho phép: " + err.Error()})
+	case errors.Is(err, services.ErrInvalidEmail):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File e-mail không hợp lệ: " + err.Error()})
+	case errors.Is(err, services.ErrUnsupportedFormat):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Định dạng file không được hỗ trợ."})
+	case errors.Is(err, services.ErrEmptyBundle):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File ZIP không chứa tài liệu PDF, DOCX hoặc XLSX nào."})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not extract text from file: " + err.Error()})
+	}
 }
 
 func cleanAIResponse(s string) string {
@@ -212,44 +1140,533 @@ func cleanAIResponse(s string) string {
 	return strings.TrimSpace(s)
 }
 
-// GET /api/v1/analyses - Lấy danh sách analyses (lịch sử)
-func GetAnalyses(c *gin.Context) {
-	var analyses []models.Analysis
-	if err := database.DB.Order("created_at desc").Find(&analyses).Error; err != nil {
+// respondAnalysisError trả lỗi của một lần gọi AI phân tích: hết quota, sai API key hoặc lỗi chung.
+func respondAnalysisError(c *gin.Context, err error) {
+	// Kiểm tra lỗi quota API
+	if strings.Contains(err.Error(), "quota") || strings.Contains(err.Error(), "429") || strings.Contains(err.Error(), "exceeded") {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "API quota đã hết. Vui lòng thử lại sau hoặc liên hệ admin để nâng cấp quota."})
+		return
+	}
+	// Kiểm tra lỗi API key
+	if strings.Contains(err.Error(), "API_KEY") || strings.Contains(err.Error(), "authentication") {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi xác thực API. Vui lòng kiểm tra cấu hình."})
+		return
+	}
+	// Lỗi chung
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "AI analysis failed: " + err.Error()})
+}
+
+// parseAnalysisResult parse kết quả JSON mà AI trả về.
+func parseAnalysisResult(call *services.ModelCall) (AnalysisResponse, error) {
+	var analysisResp AnalysisResponse
+	if err := json.Unmarshal([]byte(cleanAIResponse(call.Text)), &analysisResp); err != nil {
+		log.Printf("Lỗi khi parse JSON từ AI: %v. \nChuỗi gốc: %s", err, call.Text)
+		return AnalysisResponse{}, err
+	}
+	analysisResp.ContractType = services.NormalizeContractType(analysisResp.ContractType)
+	analysisResp.RiskLevel = services.RiskLevel(services.RiskSeverity(analysisResp.RiskLevel))
+	// Bỏ tên rỗng và tên lặp lại
+	var parties []string
+	seen := map[string]bool{}
+	for _, p := range analysisResp.Parties {
+		p = strings.TrimSpace(p)
+		if p != "" && !seen[strings.ToLower(p)] {
+			seen[strings.ToLower(p)] = true
+			parties = append(parties, p)
+		}
+	}
+	analysisResp.Parties = parties
+	return analysisResp, nil
+}
+
+// classifyAnalysis lưu phân loại của kết quả phân tích (loại hợp đồng, mức rủi ro, số rủi ro
+// và các bên) vào analysis để lọc và sắp xếp danh sách.
+func classifyAnalysis(a *models.Analysis, resp AnalysisResponse) {
+	a.ContractType = resp.ContractType
+	a.RiskSeverity = services.RiskSeverity(resp.RiskLevel)
+	a.RiskCount = len(resp.PotentialRisks)
+	a.Parties = nil
+	for _, name := range resp.Parties {
+		a.Parties = append(a.Parties, models.AnalysisParty{Name: name})
+	}
+}
+
+// partyNames trả về tên các bên của hợp đồng.
+func partyNames(parties []models.AnalysisParty) []string {
+	var names []string
+	for _, p := range parties {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// summaryPreview là đoạn đầu của tóm tắt, lưu cùng analysis để hiển thị trong danh sách.
+func summaryPreview(summary string) string {
+	if len(summary) > 200 {
+		return summary[:200]
+	}
+	return summary
+}
+
+// Giới hạn số analysis trên một trang của danh sách.
+const (
+	defaultAnalysisPageSize = 50
+	maxAnalysisPageSize     = 200
+)
+
+// Giới hạn nhãn của một document.
+const (
+	maxDocumentTags   = 20
+	maxDocumentTagLen = 50
+)
+
+// GET /api/v1/analyses - Lấy danh sách analyses (lịch sử), theo trang
+// Lọc theo metadata: file_name, author, title, producer (chứa chuỗi, không phân biệt hoa thường),
+// mime_type, format, min_pages, max_pages, created_from, created_to (ngày tạo ghi trong file).
+// Lọc theo kết quả phân tích: analyzed_from, analyzed_to (ngày phân tích), risk_level (một hoặc
+// nhiều mức, cách nhau bởi dấu phẩy), contract_type, party (chứa chuỗi), tag, language, model.
+// Sắp xếp: sort (created_at, risk_severity, risk_count), order (desc, asc). Phân trang: limit,
+// cursor (next_cursor của trang trước). fields chỉ trả về các trường được liệt kê.
+func (h *Handler) GetAnalyses(c *gin.Context) {
+	store := h.storeOrUnavailable(c)
+	if store == nil {
+		return
+	}
+	filter, err := analysisFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Bộ lọc không hợp lệ: " + err.Error()})
+		return
+	}
+	opts, err := analysisListOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	fields, err := analysisListFields(c.Query("fields"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := store.Analyses.List(filter, opts)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analyses: " + err.Error()})
 		return
 	}
-	var result []AnalysisListItem
-	for _, a := range analyses {
-		result = append(result, AnalysisListItem{
-			ID:             a.ID,
-			FileHash:       a.FileHash,
-			CreatedAt:      a.CreatedAt,
-			SummaryPreview: a.SummaryPreview,
-		})
+	items := make([]AnalysisListItem, 0, len(page.Analyses))
+	for _, a := range page.Analyses {
+		item := AnalysisListItem{
+			ID:              a.ID,
+			DocumentID:      a.DocumentID,
+			FileHash:        a.FileHash,
+			CreatedAt:       a.CreatedAt,
+			SummaryPreview:  a.SummaryPreview,
+			Language:        a.Language,
+			ContractType:    a.ContractType,
+			RiskLevel:       services.RiskLevel(a.RiskSeverity),
+			RiskCount:       a.RiskCount,
+			Parties:         partyNames(a.Parties),
+			PipelineVersion: a.PipelineVersion,
+			Email:           emailInfo(a),
+		}
+		if a.Document != nil {
+			item.Metadata = metadataInfo(a.Document.Metadata)
+			item.Tags = tagNames(a.Document.Tags)
+		}
+		if a.Provenance != nil {
+			item.Model = a.Provenance.Model
+		}
+		items = append(items, item)
+	}
+
+	resp := AnalysisListResponse{Items: items, Total: page.Total}
+	if fields != nil {
+		if resp.Items, err = selectFields(items, fields); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode analyses."})
+			return
+		}
+	}
+	if page.Next != nil {
+		resp.NextCursor = encodeListCursor(opts, page.Next)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// analysisFilter đọc các điều kiện lọc theo metadata và kết quả phân tích từ query string.
+func analysisFilter(c *gin.Context) (storage.AnalysisFilter, error) {
+	f := storage.AnalysisFilter{
+		FileName: strings.TrimSpace(c.Query("file_name")),
+		Author:   strings.TrimSpace(c.Query("author")),
+		Title:    strings.TrimSpace(c.Query("title")),
+		Producer: strings.TrimSpace(c.Query("producer")),
+		MIMEType: strings.TrimSpace(c.Query("mime_type")),
+		Format:   strings.TrimSpace(c.Query("format")),
+		Language: strings.TrimSpace(c.Query("language")),
+		Party:    strings.TrimSpace(c.Query("party")),
+		Tag:      strings.TrimSpace(c.Query("tag")),
+		Model:    strings.TrimSpace(c.Query("model")),
+	}
+	for _, p := range []struct {
+		param string
+		dst   **int
+	}{{"min_pages", &f.MinPages}, {"max_pages", &f.MaxPages}} {
+		if v := c.Query(p.param); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return f, fmt.Errorf("%s phải là số nguyên không âm: %q", p.param, v)
+			}
+			*p.dst = &n
+		}
 	}
-	c.JSON(http.StatusOK, result)
+	for _, p := range []struct {
+		param string
+		dst   **time.Time
+	}{
+		{"created_from", &f.CreatedFrom}, {"created_to", &f.CreatedBefore},
+		{"analyzed_from", &f.AnalyzedFrom}, {"analyzed_to", &f.AnalyzedBefore},
+	} {
+		if v := c.Query(p.param); v != "" {
+			t, dateOnly, err := parseDateParam(v)
+			if err != nil {
+				return f, fmt.Errorf("%s phải có dạng YYYY-MM-DD hoặc RFC 3339: %q", p.param, v)
+			}
+			// created_to=2024-05-31 bao gồm cả ngày 31
+			if strings.HasSuffix(p.param, "_to") && dateOnly {
+				t = t.AddDate(0, 0, 1)
+			}
+			*p.dst = &t
+		}
+	}
+	if v := strings.TrimSpace(c.Query("contract_type")); v != "" {
+		if services.NormalizeContractType(v) != strings.ToLower(v) {
+			return f, fmt.Errorf("contract_type phải là một trong %s: %q", strings.Join(services.ContractTypes, ", "), v)
+		}
+		f.ContractType = v
+	}
+	if v := c.Query("risk_level"); v != "" {
+		for _, level := range strings.Split(v, ",") {
+			severity := services.RiskSeverity(level)
+			if severity == 0 {
+				return f, fmt.Errorf("risk_level phải là high, medium hoặc low: %q", level)
+			}
+			f.RiskSeverities = append(f.RiskSeverities, severity)
+		}
+	}
+	return f, nil
+}
+
+// listCursor là nội dung của cursor phân trang (JSON mã hoá base64). Cursor ghi kèm cách sắp
+// xếp để không bị dùng với một cách sắp xếp khác.
+type listCursor struct {
+	Sort      string    `json:"sort"`
+	Desc      bool      `json:"desc"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+	Value     int       `json:"value,omitempty"`
+	ID        uint      `json:"id"`
+}
+
+// analysisListOptions đọc sort, order, limit và cursor từ query string.
+func analysisListOptions(c *gin.Context) (storage.ListOptions, error) {
+	opts := storage.ListOptions{Sort: storage.SortCreatedAt, Desc: true, Limit: defaultAnalysisPageSize}
+	switch v := c.Query("sort"); v {
+	case "", storage.SortCreatedAt:
+	case storage.SortRiskSeverity, storage.SortRiskCount:
+		opts.Sort = v
+	default:
+		return opts, fmt.Errorf("sort phải là %s, %s hoặc %s: %q", storage.SortCreatedAt, storage.SortRiskSeverity, storage.SortRiskCount, v)
+	}
+	switch v := c.Query("order"); v {
+	case "", "desc":
+	case "asc":
+		opts.Desc = false
+	default:
+		return opts, fmt.Errorf("order phải là desc hoặc asc: %q", v)
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAnalysisPageSize {
+			return opts, fmt.Errorf("limit phải là số nguyên từ 1 tới %d: %q", maxAnalysisPageSize, v)
+		}
+		opts.Limit = n
+	}
+	if v := c.Query("cursor"); v != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(v)
+		var cur listCursor
+		if err != nil || json.Unmarshal(raw, &cur) != nil || cur.ID == 0 {
+			return opts, fmt.Errorf("cursor không hợp lệ")
+		}
+		if cur.Sort != opts.Sort || cur.Desc != opts.Desc {
+			return opts, fmt.Errorf("cursor được tạo với cách sắp xếp khác, hãy dùng cùng sort và order với trang trước")
+		}
+		opts.After = &storage.Cursor{CreatedAt: cur.CreatedAt, Value: cur.Value, ID: cur.ID}
+	}
+	return opts, nil
+}
+
+// encodeListCursor tạo next_cursor từ vị trí của analysis cuối trang.
+func encodeListCursor(opts storage.ListOptions, next *storage.Cursor) string {
+	cur := listCursor{Sort: opts.Sort, Desc: opts.Desc, ID: next.ID}
+	if opts.Sort == storage.SortCreatedAt {
+		cur.CreatedAt = next.CreatedAt
+	} else {
+		cur.Value = next.Value
+	}
+	raw, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// listItemFields là tên các trường JSON của AnalysisListItem, dùng cho query "fields".
+var listItemFields = func() map[string]bool {
+	fields := map[string]bool{}
+	t := reflect.TypeOf(AnalysisListItem{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields[name] = true
+	}
+	return fields
+}()
+
+// analysisListFields đọc query "fields" (tên trường cách nhau bởi dấu phẩy); nil khi không chọn
+// trường nào. "id" luôn được trả về để dùng với các API khác.
+func analysisListFields(v string) ([]string, error) {
+	if strings.TrimSpace(v) == "" {
+		return nil, nil
+	}
+	fields := []string{"id"}
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		if !listItemFields[f] {
+			return nil, fmt.Errorf("fields chứa trường không tồn tại: %q", f)
+		}
+		if f != "id" {
+			fields = append(fields, f)
+		}
+	}
+	return fields, nil
+}
+
+// selectFields chỉ giữ các trường được chọn của mỗi mục trong danh sách.
+func selectFields(items []AnalysisListItem, fields []string) ([]map[string]json.RawMessage, error) {
+	selected := make([]map[string]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		raw, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &all); err != nil {
+			return nil, err
+		}
+		m := make(map[string]json.RawMessage, len(fields))
+		for _, f := range fields {
+			if v, ok := all[f]; ok {
+				m[f] = v
+			}
+		}
+		selected = append(selected, m)
+	}
+	return selected, nil
+}
+
+// tagNames trả về các nhãn của document.
+func tagNames(tags []models.DocumentTag) []string {
+	var names []string
+	for _, t := range tags {
+		names = append(names, t.Tag)
+	}
+	return names
+}
+
+// PUT /api/v1/documents/:id/tags - Thay các nhãn của document (chữ thường, không trùng)
+func (h *Handler) SetDocumentTags(c *gin.Context) {
+	store := h.storeOrUnavailable(c)
+	if store == nil {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return
+	}
+	var req DocumentTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, t := range req.Tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		if utf8.RuneCountInString(t) > maxDocumentTagLen {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Nhãn dài quá %d ký tự: %q", maxDocumentTagLen, t)})
+			return
+		}
+		seen[t] = true
+		tags = append(tags, t)
+	}
+	if len(tags) > maxDocumentTags {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Một document có tối đa %d nhãn.", maxDocumentTags)})
+		return
+	}
+	sort.Strings(tags)
+	if err := store.Analyses.SetTags(uint(id), tags); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save tags: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, DocumentTagsResponse{DocumentID: uint(id), Tags: tags})
+}
+
+// parseDateParam nhận ngày dạng YYYY-MM-DD (theo UTC) hoặc RFC 3339.
+func parseDateParam(v string) (t time.Time, dateOnly bool, err error) {
+	if t, err = time.Parse(time.DateOnly, v); err == nil {
+		return t, true, nil
+	}
+	t, err = time.Parse(time.RFC3339, v)
+	return t, false, err
 }
 
 // GET /api/v1/analyses/:id - Lấy chi tiết analysis
-func GetAnalysisDetail(c *gin.Context) {
-	id := c.Param("id")
-	var detail models.AnalysisDetail
-	if err := database.DB.Where("analysis_id = ?", id).First(&detail).Error; err != nil {
+func (h *Handler) GetAnalysisDetail(c *gin.Context) {
+	store := h.storeOrUnavailable(c)
+	if store == nil {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis detail not found"})
+		return
+	}
+	// ByID nạp kèm document để lấy các file con và chỉ số chất lượng của file
+	a, err := store.Analyses.ByID(uint(id))
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis detail not found"})
 		return
 	}
+	detail := a.AnalysisDetail
 	resp := AnalysisDetailResponse{
-		ID:             detail.ID,
-		AnalysisID:     detail.AnalysisID,
-		Summary:        detail.Summary,
-		KeyClauses:     detail.KeyClauses,
-		PotentialRisks: detail.PotentialRisks,
+		ID:              detail.ID,
+		AnalysisID:      detail.AnalysisID,
+		DocumentID:      a.DocumentID,
+		Summary:         detail.Summary,
+		KeyClauses:      detail.KeyClauses,
+		PotentialRisks:  detail.PotentialRisks,
+		Warnings:        detail.Warnings,
+		CrossReferences: detail.CrossReferences,
+		Reconciliation:  detail.Reconciliation,
+		SignatureStatus: storedSignatureStatus(detail.Signatures),
+		AnalysisMode:    detail.AnalysisMode,
+		ContractType:    a.ContractType,
+		Parties:         partyNames(a.Parties),
+		RiskLevel:       services.RiskLevel(a.RiskSeverity),
+	}
+	if a.Document != nil {
+		resp.Files = analysisFileItems(a.Document.Files)
+		resp.Quality = qualityMetrics(a.Document.Metrics)
+		resp.Tags = tagNames(a.Document.Tags)
 	}
 	c.JSON(http.StatusOK, resp)
 }
 
-func ContractChatHandler(c *gin.Context) {
+// GET /api/v1/analyses/:id/structure - Lấy cây điều khoản của hợp đồng
+// Query "ref" (ví dụ ?ref=Điều 5.2) chỉ trả về một điều khoản; "file" chọn một file trong bộ hồ sơ ZIP.
+func (h *Handler) GetAnalysisStructure(c *gin.Context) {
+	store := h.storeOrUnavailable(c)
+	if store == nil {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis detail not found"})
+		return
+	}
+	a, err := store.Analyses.ByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis detail not found"})
+		return
+	}
+	structure := a.AnalysisDetail.Structure
+	// Bộ hồ sơ ZIP: ?file=<id> lấy cấu trúc của một file con thay vì hợp đồng chính
+	if v := c.Query("file"); v != "" {
+		fileID, err := strconv.ParseUint(v, 10, 0)
+		var file *models.AnalysisFile
+		if err == nil {
+			file, err = store.Details.File(a.DocumentID, uint(fileID))
+		}
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Analysis file not found"})
+			return
+		}
+		structure = file.Structure
+	}
+	clauses := []*services.ClauseNode{}
+	if structure != "" {
+		if err := json.Unmarshal([]byte(structure), &clauses); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode document structure: " + err.Error()})
+			return
+		}
+	}
+	if ref := c.Query("ref"); ref != "" {
+		node := services.FindClause(clauses, ref)
+		if node == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy điều khoản " + ref})
+			return
+		}
+		c.JSON(http.StatusOK, node)
+		return
+	}
+	c.JSON(http.StatusOK, AnalysisStructureResponse{AnalysisID: a.ID, Clauses: clauses})
+}
+
+// GET /api/v1/analyses/:id/provenance - Lấy thông tin model, prompt, extractor và phản hồi gốc của analysis
+func (h *Handler) GetAnalysisProvenance(c *gin.Context) {
+	store := h.storeOrUnavailable(c)
+	if store == nil {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found"})
+		return
+	}
+	if _, err := store.Details.Detail(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found"})
+		return
+	}
+	p, err := store.Details.Provenance(uint(id))
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis này được tạo trước khi có provenance."})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error: " + err.Error()})
+		return
+	}
+
+	generationConfig := json.RawMessage(p.GenerationConfig)
+	if !json.Valid(generationConfig) {
+		generationConfig = json.RawMessage("{}")
+	}
+	c.JSON(http.StatusOK, ProvenanceResponse{
+		AnalysisID:       p.AnalysisID,
+		Model:            p.Model,
+		PromptVersion:    p.PromptVersion,
+		GenerationConfig: generationConfig,
+		AnalysisMode:     p.AnalysisMode,
+		Extractor:        ExtractorInfo{Name: p.Extractor, Version: p.ExtractorVersion, OCREngine: p.OCREngine},
+		LatencyMs:        StageLatency{Upload: p.UploadMs, Extract: p.ExtractMs, Model: p.ModelMs, Total: p.TotalMs},
+		TokenUsage:       TokenUsage{PromptTokens: p.PromptTokens, ResponseTokens: p.ResponseTokens, TotalTokens: p.TotalTokens},
+		FinishReason:     p.FinishReason,
+		RawResponse:      p.RawResponse,
+		CreatedAt:        p.CreatedAt,
+	})
+}
+
+func (h *Handler) ContractChatHandler(c *gin.Context) {
 	var req ContractChatRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
@@ -262,17 +1679,24 @@ func ContractChatHandler(c *gin.Context) {
 	}
 
 	var contractText string
+	// analysis khác nil khi hỏi về hợp đồng đã lưu: câu hỏi và câu trả lời được lưu theo document
+	var store *storage.Store
+	var analysis *models.Analysis
 	if req.FileHash != "" {
 		// Lấy nội dung hợp đồng từ DB
-		var analysis models.Analysis
-		result := database.DB.Where("file_hash = ?", req.FileHash).Preload("AnalysisDetail").First(&analysis)
-		if result.Error != nil {
+		if store = h.storeOrUnavailable(c); store == nil {
+			return
+		}
+		var err error
+		analysis, err = store.Analyses.ByFileHash(req.FileHash)
+		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy hợp đồng với file_hash đã cung cấp."})
 			return
 		}
 		contractText = analysis.AnalysisDetail.Summary + "\n" + strings.Join(analysis.AnalysisDetail.KeyClauses, "\n") + "\n" + strings.Join(analysis.AnalysisDetail.PotentialRisks, "\n")
 	} else if req.ContractText != "" {
-		contractText = req.ContractText
+		// Text do client gửi (thường copy từ PDF) cũng được chuẩn hoá như text trích xuất
+		contractText = services.NormalizeText(req.ContractText)
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Cần cung cấp file_hash hoặc contract_text."})
 		return
@@ -297,5 +1721,13 @@ func ContractChatHandler(c *gin.Context) {
 		return
 	}
 
+	if analysis != nil {
+		message := &models.ChatMessage{DocumentID: analysis.DocumentID, Question: req.Question, Answer: aiAnswer}
+		if err := store.Chats.Add(message); err != nil {
+			// Câu trả lời vẫn được trả về, chỉ thiếu trong lịch sử
+			log.Printf("Failed to save chat message of document #%d: %v", analysis.DocumentID, err)
+		}
+	}
+
 	c.JSON(http.StatusOK, ContractChatResponse{Answer: aiAnswer})
 }
\ No newline at end of file
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"documind/backend/internal/models"
+	"documind/backend/internal/services"
+	"documind/backend/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// embeddingQueueSize là số analysis tối đa chờ tạo embedding
+	embeddingQueueSize = 100
+	embeddingBatchSize = 20
+)
+
+type EmbeddingStatus struct {
+	Model string `json:"model"`
+	// MissingDocuments là số document có analysis mới nhất chưa có embedding của Model
+	MissingDocuments int64 `json:"missing_documents"`
+	QueueLength      int   `json:"queue_length"`
+	// Queued là số analysis chưa có embedding đang nằm trong hàng đợi sau POST, chỉ có trong kết quả của POST
+	Queued int `json:"queued,omitempty"`
+}
+
+// embedder tạo embedding ở nền cho các analysis mới và các analysis được quản trị viên yêu cầu.
+type embedder struct {
+	queue chan queuedAnalysis
+
+	mu sync.Mutex
+	// inFlight là các analysis đang chờ hoặc đang được tạo embedding
+	inFlight map[uint]bool
+}
+
+func newEmbedder() *embedder {
+	return &embedder{queue: make(chan queuedAnalysis, embeddingQueueSize), inFlight: map[uint]bool{}}
+}
+
+// enqueue đưa analysis vào hàng đợi tạo embedding; false khi hàng đợi đã đầy.
+func (e *embedder) enqueue(a *models.Analysis) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.inFlight[a.ID] {
+		return true
+	}
+	select {
+	case e.queue <- queuedAnalysis{analysisID: a.ID, documentID: a.DocumentID}:
+		e.inFlight[a.ID] = true
+		return true
+	default:
+		return false
+	}
+}
+
+func (e *embedder) release(analysisID uint) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.inFlight, analysisID)
+}
+
+// queueEmbedding đưa analysis vừa lưu vào hàng đợi tạo embedding. Khi hàng đợi đầy, analysis
+// được tạo embedding sau qua POST /api/v1/admin/embeddings.
+func (h *Handler) queueEmbedding(a *models.Analysis) {
+	if !h.embeddings.enqueue(a) {
+		log.Printf("Embedding queue is full, analysis #%d was not queued", a.ID)
+	}
+}
+
+// RunEmbedder creates the embeddings of the queued analyses, one at a time, until ctx is
+// cancelled.
+func (h *Handler) RunEmbedder(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case q := <-h.embeddings.queue:
+			h.embedQueued(q)
+			h.embeddings.release(q.analysisID)
+		}
+	}
+}
+
+// embedQueued tạo embedding cho một analysis trong hàng đợi nếu nó vẫn là analysis mới nhất
+// của document; analysis cũ hơn không được dùng khi tìm kiếm.
+func (h *Handler) embedQueued(q queuedAnalysis) {
+	store := h.store.Load()
+	if store == nil {
+		log.Printf("Skipping embedding of analysis #%d: database is not connected", q.analysisID)
+		return
+	}
+	latest, err := store.Analyses.LatestByDocument(q.documentID)
+	if err != nil || latest.ID != q.analysisID {
+		return
+	}
+	if err := embedAnalysis(store, latest); err != nil {
+		log.Printf("Failed to embed analysis #%d: %v", q.analysisID, err)
+	}
+}
+
+// embedAnalysis tạo và lưu embedding profile, risk của analysis và embedding các điều khoản
+// của document nếu document chưa có. a phải được nạp kèm AnalysisDetail (xem AnalysisStore.ByID).
+func embedAnalysis(store *storage.Store, a *models.Analysis) error {
+	detail := &a.AnalysisDetail
+	var clauses []*services.ClauseNode
+	if detail.Structure != "" {
+		if err := json.Unmarshal([]byte(detail.Structure), &clauses); err != nil {
+			return fmt.Errorf("failed to decode document structure: %w", err)
+		}
+	}
+
+	inputs := []services.EmbeddingInput{services.ProfileEmbeddingInput(a.ContractType, detail.Summary, detail.KeyClauses, clauses)}
+	if in, ok := services.RiskEmbeddingInput(services.RiskLevel(a.RiskSeverity), detail.PotentialRisks); ok {
+		inputs = append(inputs, in)
+	}
+	analysisInputs := len(inputs)
+	// Các lần phân tích của một document có cùng text nên điều khoản chỉ cần tạo embedding một lần
+	hasClauses, err := store.Embeddings.HasClauses(a.DocumentID, services.EmbeddingModel)
+	if err != nil {
+		return err
+	}
+	if !hasClauses {
+		inputs = append(inputs, services.ClauseEmbeddingInputs(clauses)...)
+	}
+
+	texts := make([]string, len(inputs))
+	for i, in := range inputs {
+		texts[i] = in.Text
+	}
+	vectors, err := services.EmbedDocuments(texts)
+	if err != nil {
+		return err
+	}
+	embeddings := make([]models.Embedding, len(inputs))
+	for i, in := range inputs {
+		embeddings[i] = models.Embedding{
+			Kind:   in.Kind,
+			Ref:    in.Ref,
+			Text:   in.Excerpt(),
+			Model:  services.EmbeddingModel,
+			Vector: storage.EncodeVector(vectors[i]),
+		}
+	}
+	var clauseEmbeddings []models.Embedding
+	if len(embeddings) > analysisInputs {
+		clauseEmbeddings = embeddings[analysisInputs:]
+	}
+	return store.Embeddings.Save(a.DocumentID, a.ID, embeddings[:analysisInputs], clauseEmbeddings)
+}
+
+// respondEmbeddingStatus trả về số document chưa có embedding và độ dài hàng đợi.
+func (h *Handler) respondEmbeddingStatus(c *gin.Context, store *storage.Store, code, queued int) {
+	n, err := store.Embeddings.CountMissing(services.EmbeddingModel)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error: " + err.Error()})
+		return
+	}
+	c.JSON(code, EmbeddingStatus{
+		Model:            services.EmbeddingModel,
+		MissingDocuments: n,
+		QueueLength:      len(h.embeddings.queue),
+		Queued:           queued,
+	})
+}
+
+// GET /api/v1/admin/embeddings - Xem số document chưa có embedding và hàng đợi tạo embedding
+func (h *Handler) GetEmbeddingStatus(c *gin.Context) {
+	store := h.storeOrUnavailable(c)
+	if store == nil {
+		return
+	}
+	h.respondEmbeddingStatus(c, store, http.StatusOK, 0)
+}
+
+// POST /api/v1/admin/embeddings - Đưa các document chưa có embedding vào hàng đợi, tới khi hàng đợi đầy
+// Dùng cho các analysis tạo trước khi có tìm kiếm ngữ nghĩa hoặc khi EmbeddingModel thay đổi.
+func (h *Handler) QueueMissingEmbeddings(c *gin.Context) {
+	store := h.storeOrUnavailable(c)
+	if store == nil {
+		return
+	}
+	queued := 0
+	var afterID uint
+	for full := false; !full; {
+		batch, err := store.Embeddings.Missing(services.EmbeddingModel, afterID, embeddingBatchSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error: " + err.Error()})
+			return
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for i := range batch {
+			afterID = batch[i].ID
+			if !h.embeddings.enqueue(&batch[i]) {
+				full = true
+				break
+			}
+			queued++
+		}
+	}
+	log.Printf("Queued %d analyses for embedding with %s", queued, services.EmbeddingModel)
+	h.respondEmbeddingStatus(c, store, http.StatusAccepted, queued)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"documind/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// retryAfterSeconds là giá trị header Retry-After của các response 503
+	retryAfterSeconds = 5
+	readyzTimeout     = 3 * time.Second
+	// llmCheckTTL: kết quả kiểm tra Gemini được dùng lại để probe dày không tốn request tới API
+	llmCheckTTL = time.Minute
+)
+
+// ReadinessResponse là kết quả của /readyz. Chi tiết lỗi chỉ ghi vào log vì lỗi của Gemini
+// có thể chứa URL kèm API key.
+type ReadinessResponse struct {
+	Status   string `json:"status"`   // ready, not_ready
+	Database string `json:"database"` // ok, not_connected, unreachable
+	LLM      string `json:"llm"`      // ok, unreachable
+}
+
+// llmCheck lưu kết quả kiểm tra Gemini gần nhất.
+var llmCheck struct {
+	sync.Mutex
+	at  time.Time
+	err error
+}
+
+// HealthzHandler is the liveness probe: it succeeds as long as the process serves HTTP.
+func HealthzHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// ReadyzHandler is the readiness probe: it succeeds when the database is connected and
+// the Gemini API is reachable, and returns 503 with Retry-After otherwise.
+func (h *Handler) ReadyzHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readyzTimeout)
+	defer cancel()
+
+	resp := ReadinessResponse{Status: "ready", Database: "ok", LLM: "ok"}
+	if s := h.store.Load(); s == nil {
+		resp.Database = "not_connected"
+	} else if err := s.Ping(ctx); err != nil {
+		log.Printf("Readiness check: database ping failed: %v", err)
+		resp.Database = "unreachable"
+	}
+	if err := checkLLM(ctx); err != nil {
+		resp.LLM = "unreachable"
+	}
+
+	if resp.Database != "ok" || resp.LLM != "ok" {
+		resp.Status = "not_ready"
+		c.Header("Retry-After", strconv.Itoa(retryAfterSeconds))
+		c.JSON(http.StatusServiceUnavailable, resp)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// checkLLM kiểm tra Gemini, dùng lại kết quả trong llmCheckTTL.
+func checkLLM(ctx context.Context) error {
+	llmCheck.Lock()
+	defer llmCheck.Unlock()
+	if !llmCheck.at.IsZero() && time.Since(llmCheck.at) < llmCheckTTL {
+		return llmCheck.err
+	}
+	llmCheck.err = services.CheckGemini(ctx)
+	llmCheck.at = time.Now()
+	if llmCheck.err != nil {
+		log.Printf("Readiness check: %v", llmCheck.err)
+	}
+	return llmCheck.err
+}
@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"documind/backend/internal/models"
+	"documind/backend/internal/services"
+	"documind/backend/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// reanalysisQueueSize là số analysis tối đa chờ phân tích lại theo chính sách requeue
+	reanalysisQueueSize = 100
+	reanalysisBatchSize = 20
+	// maxReanalysisFailures: dừng lần phân tích lại hàng loạt sau chừng này lỗi liên tiếp
+	// (thường là hết quota Gemini) thay vì thử hết danh sách
+	maxReanalysisFailures = 3
+)
+
+// Trạng thái của một lần phân tích lại hàng loạt.
+const (
+	ReanalysisRunning         = "running"
+	ReanalysisCompleted       = "completed"
+	ReanalysisBudgetExhausted = "budget_exhausted"
+	ReanalysisCancelled       = "cancelled"
+	ReanalysisFailed          = "failed"
+)
+
+// ReanalysisRequest starts a background re-analysis of the stale documents.
+type ReanalysisRequest struct {
+	// TokenBudget là tổng số token tối đa cho cả lần phân tích lại
+	TokenBudget int `json:"token_budget"`
+	// Limit giới hạn số document được phân tích lại, 0 là không giới hạn
+	Limit int `json:"limit"`
+}
+
+// ReanalysisJob is the progress of a background re-analysis of the stale documents.
+type ReanalysisJob struct {
+	ID          uint       `json:"id"`
+	State       string     `json:"state"` // running, completed, budget_exhausted, cancelled, failed
+	TokenBudget int        `json:"token_budget"`
+	Limit       int        `json:"limit,omitempty"`
+	TokensUsed  int        `json:"tokens_used"`
+	Reanalyzed  int        `json:"reanalyzed"`
+	Failed      int        `json:"failed"`
+	LastError   string     `json:"last_error,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// newReanalysisJob chuyển job đã lưu thành dữ liệu trả về.
+func newReanalysisJob(j *models.Job) *ReanalysisJob {
+	return &ReanalysisJob{
+		ID:          j.ID,
+		State:       j.State,
+		TokenBudget: j.TokenBudget,
+		Limit:       j.ItemLimit,
+		TokensUsed:  j.TokensUsed,
+		Reanalyzed:  j.Succeeded,
+		Failed:      j.Failed,
+		LastError:   j.LastError,
+		StartedAt:   j.StartedAt,
+		FinishedAt:  j.FinishedAt,
+	}
+}
+
+type ReanalysisStatus struct {
+	PipelineVersion string `json:"pipeline_version"`
+	// StaleDocuments là số document có analysis mới nhất tạo bởi phiên bản pipeline khác
+	StaleDocuments int64          `json:"stale_documents"`
+	QueueLength    int            `json:"queue_length"`
+	Job            *ReanalysisJob `json:"job,omitempty"`
+}
+
+// queuedAnalysis là một analysis cũ chờ phân tích lại theo chính sách requeue.
+type queuedAnalysis struct {
+	analysisID uint
+	documentID uint
+}
+
+// reanalyzer giữ hàng đợi của chính sách requeue và lần phân tích lại hàng loạt do tiến trình
+// này chạy. Tiến độ của job được lưu qua storage.JobStore sau mỗi thay đổi.
+type reanalyzer struct {
+	queue chan queuedAnalysis
+
+	mu sync.Mutex
+	// inFlight là các document đang chờ hoặc đang được phân tích lại, để một document không
+	// được phân tích lại hai lần cùng lúc
+	inFlight map[uint]bool
+	job      *models.Job
+	cancel   context.CancelFunc
+}
+
+func newReanalyzer() *reanalyzer {
+	return &reanalyzer{queue: make(chan queuedAnalysis, reanalysisQueueSize), inFlight: map[uint]bool{}}
+}
+
+// isStale cho biết analysis được tạo bởi phiên bản pipeline khác phiên bản hiện tại.
+func isStale(a *models.Analysis) bool {
+	return a.PipelineVersion != services.PipelineVersion
+}
+
+// enqueue đưa analysis vào hàng đợi phân tích lại; false khi hàng đợi đã đầy.
+func (r *reanalyzer) enqueue(a *models.Analysis) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.inFlight[a.DocumentID] {
+		return true
+	}
+	select {
+	case r.queue <- queuedAnalysis{analysisID: a.ID, documentID: a.DocumentID}:
+		r.inFlight[a.DocumentID] = true
+		return true
+	default:
+		return false
+	}
+}
+
+// claim đánh dấu document đang được phân tích lại; false nếu document đã được đánh dấu.
+func (r *reanalyzer) claim(documentID uint) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.inFlight[documentID] {
+		return false
+	}
+	r.inFlight[documentID] = true
+	return true
+}
+
+func (r *reanalyzer) release(documentID uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.inFlight, documentID)
+}
+
+// updateJob sửa job dưới khoá để GET trạng thái đọc được trong lúc job chạy, rồi lưu job.
+// store là nil khi mất kết nối cơ sở dữ liệu: job chỉ được sửa trong bộ nhớ và được lưu ở
+// lần cập nhật hoặc lần xem trạng thái sau.
+func (r *reanalyzer) updateJob(store *storage.Store, job *models.Job, update func(*models.Job)) {
+	r.mu.Lock()
+	update(job)
+	saved := *job
+	r.mu.Unlock()
+	if store == nil {
+		return
+	}
+	if err := store.Jobs.Update(&saved); err != nil {
+		log.Printf("Failed to save re-analysis job #%d: %v", saved.ID, err)
+	}
+}
+
+// finishJob kết thúc job với trạng thái state.
+func (r *reanalyzer) finishJob(store *storage.Store, job *models.Job, state, lastError string) {
+	r.updateJob(store, job, func(j *models.Job) {
+		now := time.Now()
+		j.State, j.FinishedAt = state, &now
+		if lastError != "" {
+			j.LastError = lastError
+		}
+	})
+	log.Printf("Re-analysis %s: %d re-analyzed, %d failed, %d/%d tokens used", state, job.Succeeded, job.Failed, job.TokensUsed, job.TokenBudget)
+}
+
+// RunReanalysis re-analyzes the analyses queued by the requeue stale policy, one at a time,
+// until ctx is cancelled.
+func (h *Handler) RunReanalysis(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case q := <-h.reanalysis.queue:
+			h.reanalyzeQueued(q)
+			h.reanalysis.release(q.documentID)
+		}
+	}
+}
+
+// reanalyzeQueued phân tích lại một analysis trong hàng đợi nếu nó vẫn là analysis mới nhất
+// của document và vẫn cũ.
+func (h *Handler) reanalyzeQueued(q queuedAnalysis) {
+	store := h.store.Load()
+	if store == nil {
+		log.Printf("Skipping re-analysis of analysis #%d: database is not connected", q.analysisID)
+		return
+	}
+	latest, err := store.Analyses.LatestByDocument(q.documentID)
+	if err != nil || latest.ID != q.analysisID || !isStale(latest) || latest.Document == nil {
+		return
+	}
+	a, err := rerunAnalysis(store, latest, services.AnalysisOptions{})
+	if err != nil {
+		log.Printf("Failed to re-analyze analysis #%d: %v", q.analysisID, err)
+		return
+	}
+	h.queueEmbedding(a)
+	log.Printf("Re-analyzed stale analysis #%d as #%d", q.analysisID, a.ID)
+}
+
+// runReanalysisJob phân tích lại analysis mới nhất của các document cũ theo thứ tự id cho tới
+// khi hết danh sách, hết ngân sách token, đạt giới hạn hoặc ctx bị huỷ.
+func (h *Handler) runReanalysisJob(ctx context.Context, job *models.Job) {
+	r := h.reanalysis
+	var afterID uint
+	failures := 0
+	for {
+		store := h.store.Load()
+		if store == nil {
+			r.finishJob(nil, job, ReanalysisFailed, "database is not connected")
+			return
+		}
+		batch, err := store.Analyses.Stale(services.PipelineVersion, afterID, reanalysisBatchSize)
+		if err != nil {
+			r.finishJob(store, job, ReanalysisFailed, err.Error())
+			return
+		}
+		if len(batch) == 0 {
+			r.finishJob(store, job, ReanalysisCompleted, "")
+			return
+		}
+		for i := range batch {
+			a := &batch[i]
+			afterID = a.ID
+			if ctx.Err() != nil {
+				r.finishJob(store, job, ReanalysisCancelled, "")
+				return
+			}
+			if job.ItemLimit > 0 && job.Succeeded >= job.ItemLimit {
+				r.finishJob(store, job, ReanalysisCompleted, "")
+				return
+			}
+			if a.Document == nil {
+				continue
+			}
+			// Ước lượng theo số token của lần phân tích trước, hoặc theo độ dài text
+			text := a.Document.AnalysisText
+			if text == "" {
+				text = a.AnalysisDetail.ExtractedText
+			}
+			estimate := services.EstimateTokens(text)
+			if a.Provenance != nil && a.Provenance.TotalTokens > 0 {
+				estimate = a.Provenance.TotalTokens
+			}
+			if job.TokensUsed+estimate > job.TokenBudget {
+				r.finishJob(store, job, ReanalysisBudgetExhausted, "")
+				return
+			}
+			if !r.claim(a.DocumentID) {
+				continue
+			}
+			fresh, err := rerunAnalysis(store, a, services.AnalysisOptions{})
+			r.release(a.DocumentID)
+			if err != nil {
+				log.Printf("Failed to re-analyze analysis #%d: %v", a.ID, err)
+				r.updateJob(store, job, func(j *models.Job) { j.Failed++; j.LastError = err.Error() })
+				if failures++; failures >= maxReanalysisFailures {
+					r.finishJob(store, job, ReanalysisFailed, "")
+					return
+				}
+				continue
+			}
+			failures = 0
+			h.queueEmbedding(fresh)
+			r.updateJob(store, job, func(j *models.Job) { j.Succeeded++; j.TokensUsed += fresh.Provenance.TotalTokens })
+		}
+	}
+}
+
+// respondReanalysisStatus trả về số document cũ, hàng đợi và job gần nhất đã lưu.
+func (h *Handler) respondReanalysisStatus(c *gin.Context, store *storage.Store, code int) {
+	n, err := store.Analyses.CountStale(services.PipelineVersion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error: " + err.Error()})
+		return
+	}
+	job, err := store.Jobs.Latest(storage.JobKindReanalysis)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error: " + err.Error()})
+		return
+	}
+
+	r := h.reanalysis
+	r.mu.Lock()
+	status := ReanalysisStatus{PipelineVersion: services.PipelineVersion, StaleDocuments: n, QueueLength: len(r.queue)}
+	// Job do tiến trình này chạy được đọc từ bộ nhớ vì có thể mới hơn bản đã lưu; job đã kết
+	// thúc mà bản lưu vẫn đang chạy (lần lưu cuối thất bại, thường do mất kết nối) được lưu lại
+	var unsaved *models.Job
+	if job != nil && r.job != nil && r.job.ID == job.ID {
+		copied := *r.job
+		if copied.State != job.State {
+			unsaved = &copied
+		}
+		job = &copied
+	} else if job != nil && job.State == ReanalysisRunning {
+		// Job đang chạy đã lưu nhưng không thuộc tiến trình này: server đã khởi động lại giữa chừng
+		now := time.Now()
+		job.State, job.LastError, job.FinishedAt = ReanalysisFailed, "interrupted by a server restart", &now
+		unsaved = job
+	}
+	r.mu.Unlock()
+	if unsaved != nil {
+		if err := store.Jobs.Update(unsaved); err != nil {
+			log.Printf("Failed to save re-analysis job #%d: %v", unsaved.ID, err)
+		}
+	}
+	if job != nil {
+		status.Job = newReanalysisJob(job)
+	}
+	c.JSON(code, status)
+}
+
+// GET /api/v1/admin/reanalysis - Xem số document cũ và tiến độ phân tích lại
+func (h *Handler) GetReanalysisStatus(c *gin.Context) {
+	store := h.storeOrUnavailable(c)
+	if store == nil {
+		return
+	}
+	h.respondReanalysisStatus(c, store, http.StatusOK)
+}
+
+// POST /api/v1/admin/reanalysis - Phân tích lại ở nền các document cũ trong ngân sách token
+func (h *Handler) StartReanalysis(c *gin.Context) {
+	store := h.storeOrUnavailable(c)
+	if store == nil {
+		return
+	}
+	var req ReanalysisRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if req.TokenBudget <= 0 || req.Limit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token_budget phải là số nguyên dương và limit không được âm."})
+		return
+	}
+
+	r := h.reanalysis
+	r.mu.Lock()
+	if r.job != nil && r.job.State == ReanalysisRunning {
+		r.mu.Unlock()
+		c.JSON(http.StatusConflict, gin.H{"error": "Đang có một lần phân tích lại chạy ở nền."})
+		return
+	}
+	job := &models.Job{
+		Kind:        storage.JobKindReanalysis,
+		State:       ReanalysisRunning,
+		TokenBudget: req.TokenBudget,
+		ItemLimit:   req.Limit,
+		StartedAt:   time.Now(),
+	}
+	if err := store.Jobs.Create(job); err != nil {
+		r.mu.Unlock()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start re-analysis: " + err.Error()})
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.job, r.cancel = job, cancel
+	r.mu.Unlock()
+
+	log.Printf("Re-analysis of stale documents started (pipeline %s, budget %d tokens)", services.PipelineVersion, req.TokenBudget)
+	go func() {
+		defer cancel()
+		h.runReanalysisJob(ctx, job)
+	}()
+	h.respondReanalysisStatus(c, store, http.StatusAccepted)
+}
+
+// DELETE /api/v1/admin/reanalysis - Dừng lần phân tích lại đang chạy sau document hiện tại
+func (h *Handler) CancelReanalysis(c *gin.Context) {
+	store := h.storeOrUnavailable(c)
+	if store == nil {
+		return
+	}
+	r := h.reanalysis
+	r.mu.Lock()
+	running := r.job != nil && r.job.State == ReanalysisRunning
+	if running {
+		r.cancel()
+	}
+	r.mu.Unlock()
+	if !running {
+		c.JSON(http.StatusConflict, gin.H{"error": "Không có lần phân tích lại nào đang chạy."})
+		return
+	}
+	h.respondReanalysisStatus(c, store, http.StatusAccepted)
+}
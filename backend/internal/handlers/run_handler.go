@@ -0,0 +1,352 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"documind/backend/internal/models"
+	"documind/backend/internal/services"
+	"documind/backend/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxRerunInstructions giới hạn số ký tự yêu cầu bổ sung khi chạy lại phân tích.
+const maxRerunInstructions = 1000
+
+// RerunRequest là các tuỳ chọn của POST /analyses/:id/rerun; trường trống thì dùng mặc định.
+type RerunRequest struct {
+	Model        string `json:"model"`
+	Depth        string `json:"depth"` // standard, deep
+	Instructions string `json:"instructions"`
+}
+
+type AnalysisRunItem struct {
+	ID             uint        `json:"id"`
+	CreatedAt      time.Time   `json:"created_at"`
+	SummaryPreview string      `json:"summary_preview"`
+	Model          string      `json:"model,omitempty"`
+	PromptVersion  string      `json:"prompt_version,omitempty"`
+	Depth          string      `json:"depth,omitempty"`
+	AnalysisMode   string      `json:"analysis_mode,omitempty"`
+	TokenUsage     *TokenUsage `json:"token_usage,omitempty"`
+}
+
+type DocumentAnalysesResponse struct {
+	DocumentID uint              `json:"document_id"`
+	FileHash   string            `json:"file_hash"`
+	Runs       []AnalysisRunItem `json:"runs"`
+}
+
+// ComparedRun là một lần phân tích trong kết quả so sánh.
+type ComparedRun struct {
+	AnalysisID     uint        `json:"analysis_id"`
+	CreatedAt      time.Time   `json:"created_at"`
+	Model          string      `json:"model,omitempty"`
+	PromptVersion  string      `json:"prompt_version,omitempty"`
+	Depth          string      `json:"depth,omitempty"`
+	Instructions   string      `json:"instructions,omitempty"`
+	TokenUsage     *TokenUsage `json:"token_usage,omitempty"`
+	ModelLatencyMs int64       `json:"model_latency_ms,omitempty"`
+	Summary        string      `json:"summary"`
+	KeyClauses     []string    `json:"key_clauses"`
+	PotentialRisks []string    `json:"potential_risks"`
+}
+
+// ListDiff chia hai danh sách thành phần chung và phần chỉ có ở mỗi bên.
+type ListDiff struct {
+	Common []string `json:"common"`
+	OnlyA  []string `json:"only_a"`
+	OnlyB  []string `json:"only_b"`
+}
+
+type CompareResponse struct {
+	DocumentID     uint        `json:"document_id"`
+	A              ComparedRun `json:"a"`
+	B              ComparedRun `json:"b"`
+	KeyClauses     ListDiff    `json:"key_clauses"`
+	PotentialRisks ListDiff    `json:"potential_risks"`
+}
+
+// POST /api/v1/analyses/:id/rerun - Phân tích lại document của analysis với model, độ sâu hoặc
+// yêu cầu bổ sung khác. Kết quả là một analysis mới của cùng document, analysis cũ được giữ nguyên.
+func (h *Handler) RerunAnalysis(c *gin.Context) {
+	store := h.storeOrUnavailable(c)
+	if store == nil {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found"})
+		return
+	}
+	var req RerunRequest
+	// Body rỗng nghĩa là chạy lại với tuỳ chọn mặc định
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	req.Model = strings.TrimSpace(req.Model)
+	if req.Model != "" && !services.IsSupportedModel(req.Model) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Model không được hỗ trợ. Chọn một trong: " + strings.Join(services.SupportedModels, ", ")})
+		return
+	}
+	depth, err := services.ParseDepth(strings.TrimSpace(req.Depth))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	instructions := strings.TrimSpace(req.Instructions)
+	if utf8.RuneCountInString(instructions) > maxRerunInstructions {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Yêu cầu bổ sung không được quá %d ký tự.", maxRerunInstructions)})
+		return
+	}
+
+	source, err := store.Analyses.ByID(uint(id))
+	if err != nil || source.Document == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found"})
+		return
+	}
+	analysis, err := rerunAnalysis(store, source, services.AnalysisOptions{Model: req.Model, Depth: depth, Instructions: instructions})
+	switch {
+	case errors.Is(err, errNoAnalysisText):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Analysis này không có text để phân tích lại."})
+	case errors.Is(err, errParseAIResponse):
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse AI response."})
+	case errors.Is(err, errSaveAnalysis):
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save analysis."})
+	case err != nil:
+		respondAnalysisError(c, err)
+	default:
+		h.queueEmbedding(analysis)
+		c.JSON(http.StatusCreated, cachedAnalysisResponse(*analysis))
+	}
+}
+
+// Lỗi của rerunAnalysis ngoài lỗi gọi AI.
+var (
+	errNoAnalysisText  = errors.New("analysis has no text to analyze again")
+	errParseAIResponse = errors.New("failed to parse AI response")
+	errSaveAnalysis    = errors.New("failed to save analysis")
+)
+
+// rerunAnalysis phân tích lại text đã lưu của document của source và lưu kết quả thành một
+// analysis mới của document đó. source phải được nạp kèm Document (xem AnalysisStore.ByID).
+func rerunAnalysis(store *storage.Store, source *models.Analysis, opts services.AnalysisOptions) (*models.Analysis, error) {
+	doc := source.Document
+	// Document cũ chưa lưu nội dung gửi cho AI: dùng text đã chuẩn hoá của lần phân tích đầu
+	text := doc.AnalysisText
+	if text == "" {
+		text = source.AnalysisDetail.ExtractedText
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, errNoAnalysisText
+	}
+	language := doc.Language
+	if language == "" {
+		language = source.Language
+	}
+	if opts.Depth == "" {
+		opts.Depth = services.DepthStandard
+	}
+
+	start := time.Now()
+	var call *services.ModelCall
+	var err error
+	if doc.Bundle {
+		call, err = services.AnalyzeBundle(text, doc.PromptReferences, language, opts)
+	} else {
+		call, err = services.AnalyzeText(text, language, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	analysisResp, err := parseAnalysisResult(call)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errParseAIResponse, err)
+	}
+
+	// File gốc không được lưu nên lần chạy lại chỉ gửi text
+	warnings := append([]string(nil), source.AnalysisDetail.Warnings...)
+	if mode := source.AnalysisDetail.AnalysisMode; mode != "" && mode != services.AnalysisModeText {
+		warnings = append(warnings, fmt.Sprintf("Lần phân tích gốc dùng chế độ %s; lần chạy lại chỉ gửi text đã trích xuất.", mode))
+	}
+
+	analysis := models.Analysis{
+		DocumentID:      source.DocumentID,
+		FileHash:        source.FileHash,
+		SummaryPreview:  summaryPreview(analysisResp.Summary),
+		Language:        language,
+		PipelineVersion: services.PipelineVersion,
+		EmailFrom:       source.EmailFrom,
+		EmailSubject:    source.EmailSubject,
+		EmailDate:       source.EmailDate,
+	}
+	classifyAnalysis(&analysis, analysisResp)
+	// Các trường lấy từ file (cấu trúc, chữ ký, text) giống lần phân tích gốc
+	detail := models.AnalysisDetail{
+		Summary:         analysisResp.Summary,
+		KeyClauses:      analysisResp.KeyClauses,
+		PotentialRisks:  analysisResp.PotentialRisks,
+		Warnings:        warnings,
+		Structure:       source.AnalysisDetail.Structure,
+		CrossReferences: analysisResp.CrossReferences,
+		Reconciliation:  source.AnalysisDetail.Reconciliation,
+		ExtractedText:   source.AnalysisDetail.ExtractedText,
+		Signatures:      source.AnalysisDetail.Signatures,
+		AnalysisMode:    services.AnalysisModeText,
+	}
+	generationConfig, _ := json.Marshal(call.GenerationConfig)
+	provenance := models.AnalysisProvenance{
+		Model:            call.Model,
+		PromptVersion:    call.PromptVersion,
+		GenerationConfig: string(generationConfig),
+		AnalysisMode:     services.AnalysisModeText,
+		Extractor:        doc.Format,
+		Depth:            opts.Depth,
+		Instructions:     opts.Instructions,
+		ModelMs:          call.Latency.Milliseconds(),
+		RawResponse:      call.RawResponse,
+		FinishReason:     call.FinishReason,
+		PromptTokens:     call.PromptTokens,
+		ResponseTokens:   call.ResponseTokens,
+		TotalTokens:      call.TotalTokens,
+	}
+	// Text được trích xuất bởi lần phân tích gốc, không trích xuất lại
+	if source.Provenance != nil {
+		provenance.Extractor = source.Provenance.Extractor
+		provenance.ExtractorVersion = source.Provenance.ExtractorVersion
+		provenance.OCREngine = source.Provenance.OCREngine
+	}
+	provenance.TotalMs = time.Since(start).Milliseconds()
+	if err := store.Analyses.Create(&storage.NewAnalysis{Analysis: &analysis, Detail: &detail, Provenance: &provenance, Parties: analysis.Parties}); err != nil {
+		log.Printf("Failed to save analysis rerun: %v", err)
+		return nil, fmt.Errorf("%w: %v", errSaveAnalysis, err)
+	}
+
+	analysis.Document = doc
+	analysis.AnalysisDetail = detail
+	analysis.Provenance = &provenance
+	return &analysis, nil
+}
+
+// GET /api/v1/documents/:id/analyses - Lấy các lần phân tích của một document, cũ nhất trước
+func (h *Handler) GetDocumentAnalyses(c *gin.Context) {
+	store := h.storeOrUnavailable(c)
+	if store == nil {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return
+	}
+	analyses, err := store.Analyses.ByDocument(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analyses: " + err.Error()})
+		return
+	}
+	if len(analyses) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return
+	}
+	resp := DocumentAnalysesResponse{DocumentID: uint(id), FileHash: analyses[0].FileHash, Runs: []AnalysisRunItem{}}
+	for _, a := range analyses {
+		item := AnalysisRunItem{ID: a.ID, CreatedAt: a.CreatedAt, SummaryPreview: a.SummaryPreview}
+		if p := a.Provenance; p != nil {
+			item.Model = p.Model
+			item.PromptVersion = p.PromptVersion
+			item.Depth = p.Depth
+			item.AnalysisMode = p.AnalysisMode
+			item.TokenUsage = &TokenUsage{PromptTokens: p.PromptTokens, ResponseTokens: p.ResponseTokens, TotalTokens: p.TotalTokens}
+		}
+		resp.Runs = append(resp.Runs, item)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GET /api/v1/analyses/:id/compare/:other - So sánh hai lần phân tích của cùng một document
+func (h *Handler) CompareAnalyses(c *gin.Context) {
+	store := h.storeOrUnavailable(c)
+	if store == nil {
+		return
+	}
+	var runs [2]*models.Analysis
+	for i, param := range []string{"id", "other"} {
+		id, err := strconv.ParseUint(c.Param(param), 10, 0)
+		if err == nil {
+			runs[i], err = store.Analyses.ByID(uint(id))
+		}
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found"})
+			return
+		}
+	}
+	a, b := runs[0], runs[1]
+	if a.DocumentID != b.DocumentID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Chỉ so sánh được hai lần phân tích của cùng một document."})
+		return
+	}
+	c.JSON(http.StatusOK, CompareResponse{
+		DocumentID:     a.DocumentID,
+		A:              comparedRun(a),
+		B:              comparedRun(b),
+		KeyClauses:     diffLists(a.AnalysisDetail.KeyClauses, b.AnalysisDetail.KeyClauses),
+		PotentialRisks: diffLists(a.AnalysisDetail.PotentialRisks, b.AnalysisDetail.PotentialRisks),
+	})
+}
+
+func comparedRun(a *models.Analysis) ComparedRun {
+	run := ComparedRun{
+		AnalysisID:     a.ID,
+		CreatedAt:      a.CreatedAt,
+		Summary:        a.AnalysisDetail.Summary,
+		KeyClauses:     a.AnalysisDetail.KeyClauses,
+		PotentialRisks: a.AnalysisDetail.PotentialRisks,
+	}
+	if p := a.Provenance; p != nil {
+		run.Model = p.Model
+		run.PromptVersion = p.PromptVersion
+		run.Depth = p.Depth
+		run.Instructions = p.Instructions
+		run.TokenUsage = &TokenUsage{PromptTokens: p.PromptTokens, ResponseTokens: p.ResponseTokens, TotalTokens: p.TotalTokens}
+		run.ModelLatencyMs = p.ModelMs
+	}
+	return run
+}
+
+// diffLists so sánh hai danh sách điều khoản/rủi ro, coi hai mục là một nếu chỉ khác hoa thường
+// và khoảng trắng. Thứ tự của mỗi danh sách được giữ nguyên.
+func diffLists(a, b []string) ListDiff {
+	key := func(s string) string { return strings.ToLower(strings.Join(strings.Fields(s), " ")) }
+	inA := make(map[string]bool, len(a))
+	for _, s := range a {
+		inA[key(s)] = true
+	}
+	inB := make(map[string]bool, len(b))
+	for _, s := range b {
+		inB[key(s)] = true
+	}
+	d := ListDiff{Common: []string{}, OnlyA: []string{}, OnlyB: []string{}}
+	for _, s := range a {
+		if inB[key(s)] {
+			d.Common = append(d.Common, s)
+		} else {
+			d.OnlyA = append(d.OnlyA, s)
+		}
+	}
+	for _, s := range b {
+		if !inA[key(s)] {
+			d.OnlyB = append(d.OnlyB, s)
+		}
+	}
+	return d
+}
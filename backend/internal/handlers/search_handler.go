@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"documind/backend/internal/models"
+	"documind/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Giới hạn của tìm kiếm toàn văn.
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+	maxSearchQueryLen     = 500
+)
+
+type SearchResultItem struct {
+	AnalysisID     uint      `json:"analysis_id"`
+	DocumentID     uint      `json:"document_id"`
+	FileHash       string    `json:"file_hash"`
+	FileName       string    `json:"file_name,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	SummaryPreview string    `json:"summary_preview"`
+	ContractType   string    `json:"contract_type,omitempty"`
+	RiskLevel      string    `json:"risk_level,omitempty"`
+	Score          float64   `json:"score"`
+	// Snippets: đoạn trích khớp truy vấn của từng trường, tối đa một đoạn mỗi trường
+	Snippets []services.SearchSnippet `json:"snippets"`
+}
+
+type SearchResponse struct {
+	Query string             `json:"query"`
+	Total int64              `json:"total"`
+	Items []SearchResultItem `json:"items"`
+}
+
+// GET /api/v1/search - Tìm kiếm toàn văn trong tóm tắt, điều khoản, rủi ro và text của các hợp đồng
+// Query "q" không phân biệt hoa thường và dấu: "cụm từ" trong ngoặc kép, OR, -loại trừ.
+// Chỉ tìm trong analysis mới nhất của mỗi document. Phân trang: limit, offset.
+func (h *Handler) SearchAnalyses(c *gin.Context) {
+	store := h.storeOrUnavailable(c)
+	if store == nil {
+		return
+	}
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" || utf8.RuneCountInString(q) > maxSearchQueryLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("q phải có từ 1 tới %d ký tự.", maxSearchQueryLen)})
+		return
+	}
+	// Lỗi duy nhất là services.ErrEmptySearchQuery
+	query, err := services.ParseSearchQuery(q)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Truy vấn không có từ nào để tìm (cần ít nhất một từ không bị loại trừ)."})
+		return
+	}
+	limit, offset := defaultSearchPageSize, 0
+	if v := c.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxSearchPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit phải là số nguyên từ 1 tới %d: %q", maxSearchPageSize, v)})
+			return
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("offset phải là số nguyên không âm: %q", v)})
+			return
+		}
+	}
+
+	page, err := store.Search.Search(query, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed: " + err.Error()})
+		return
+	}
+	resp := SearchResponse{Query: q, Total: page.Total, Items: []SearchResultItem{}}
+	for _, hit := range page.Hits {
+		a := hit.Analysis
+		item := SearchResultItem{
+			AnalysisID:     a.ID,
+			DocumentID:     a.DocumentID,
+			FileHash:       a.FileHash,
+			CreatedAt:      a.CreatedAt,
+			SummaryPreview: a.SummaryPreview,
+			ContractType:   a.ContractType,
+			RiskLevel:      services.RiskLevel(a.RiskSeverity),
+			Score:          hit.Score,
+			Snippets:       searchSnippets(query, &a.AnalysisDetail),
+		}
+		if a.Document != nil && a.Document.Metadata != nil {
+			item.FileName = a.Document.Metadata.FileName
+		}
+		resp.Items = append(resp.Items, item)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// searchSnippets trả về đoạn trích đầu tiên khớp truy vấn của mỗi trường được tìm kiếm.
+func searchSnippets(q *services.SearchQuery, d *models.AnalysisDetail) []services.SearchSnippet {
+	snippets := []services.SearchSnippet{}
+	for _, f := range []struct {
+		name  string
+		texts []string
+	}{
+		{"summary", []string{d.Summary}},
+		{"key_clauses", d.KeyClauses},
+		{"potential_risks", d.PotentialRisks},
+		{"text", []string{d.ExtractedText}},
+	} {
+		for _, text := range f.texts {
+			if s := q.Snippet(text); s != "" {
+				snippets = append(snippets, services.SearchSnippet{Field: f.name, Text: s})
+				break
+			}
+		}
+	}
+	return snippets
+}
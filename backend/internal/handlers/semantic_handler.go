@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"documind/backend/internal/models"
+	"documind/backend/internal/services"
+	"documind/backend/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Giới hạn của tìm kiếm ngữ nghĩa và gợi ý hợp đồng tương tự.
+const (
+	defaultSemanticPageSize = 10
+	maxSemanticPageSize     = 50
+	// maxSemanticMatches là số đoạn khớp tối đa trả về cho mỗi hợp đồng
+	maxSemanticMatches = 3
+)
+
+// SemanticMatch is a part of a contract whose meaning is close to the query.
+type SemanticMatch struct {
+	Kind string `json:"kind"` // profile, risk, clause
+	// Ref là số hiệu điều khoản, chỉ có với kind clause
+	Ref        string  `json:"ref,omitempty"`
+	Text       string  `json:"text"`
+	Similarity float64 `json:"similarity"`
+}
+
+type SemanticResultItem struct {
+	AnalysisID     uint    `json:"analysis_id"`
+	DocumentID     uint    `json:"document_id"`
+	FileName       string  `json:"file_name,omitempty"`
+	SummaryPreview string  `json:"summary_preview"`
+	ContractType   string  `json:"contract_type,omitempty"`
+	RiskLevel      string  `json:"risk_level,omitempty"`
+	Similarity     float64 `json:"similarity"`
+	// Matches: các đoạn gần truy vấn nhất của hợp đồng, giống nhất trước
+	Matches []SemanticMatch `json:"matches"`
+}
+
+type SemanticSearchResponse struct {
+	Query string               `json:"query"`
+	Kind  string               `json:"kind"`
+	Items []SemanticResultItem `json:"items"`
+}
+
+type SimilarContractItem struct {
+	AnalysisID     uint    `json:"analysis_id"`
+	DocumentID     uint    `json:"document_id"`
+	FileName       string  `json:"file_name,omitempty"`
+	SummaryPreview string  `json:"summary_preview"`
+	ContractType   string  `json:"contract_type,omitempty"`
+	RiskLevel      string  `json:"risk_level,omitempty"`
+	Similarity     float64 `json:"similarity"`
+	// StructureSimilarity/RiskSimilarity là độ giống theo từng tiêu chí đã được so sánh
+	StructureSimilarity *float64 `json:"structure_similarity,omitempty"`
+	RiskSimilarity      *float64 `json:"risk_similarity,omitempty"`
+}
+
+type SimilarContractsResponse struct {
+	AnalysisID uint                  `json:"analysis_id"`
+	By         string                `json:"by"`
+	Items      []SimilarContractItem `json:"items"`
+}
+
+// GET /api/v1/semantic-search - Tìm các hợp đồng và điều khoản có nội dung gần nghĩa với câu hỏi "q"
+// "kind" giới hạn loại đoạn được so sánh: analysis (tóm tắt, điều khoản chính, rủi ro), clause
+// (nội dung từng điều) hoặc all. Kết quả được nhóm theo document, giống nhất trước.
+func (h *Handler) SemanticSearch(c *gin.Context) {
+	store := h.storeOrUnavailable(c)
+	if store == nil {
+		return
+	}
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" || utf8.RuneCountInString(q) > maxSearchQueryLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("q phải có từ 1 tới %d ký tự.", maxSearchQueryLen)})
+		return
+	}
+	kind := c.DefaultQuery("kind", "all")
+	var kinds []string
+	switch kind {
+	case "all":
+		kinds = []string{services.EmbeddingProfile, services.EmbeddingRisk, services.EmbeddingClause}
+	case "analysis":
+		kinds = []string{services.EmbeddingProfile, services.EmbeddingRisk}
+	case "clause":
+		kinds = []string{services.EmbeddingClause}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("kind phải là all, analysis hoặc clause: %q", kind)})
+		return
+	}
+	limit, ok := semanticLimit(c)
+	if !ok {
+		return
+	}
+
+	vector, err := services.EmbedQuery(q)
+	if err != nil {
+		respondAnalysisError(c, err)
+		return
+	}
+	hits, err := store.Embeddings.Nearest(vector, services.EmbeddingModel, kinds, 0, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed: " + err.Error()})
+		return
+	}
+
+	// Nhóm theo document: các hit đã xếp giống nhất trước nên hit đầu tiên là độ giống của document
+	var order []uint
+	byDocument := map[uint][]storage.EmbeddingHit{}
+	for _, hit := range hits {
+		if _, seen := byDocument[hit.DocumentID]; !seen {
+			if len(order) == limit {
+				continue
+			}
+			order = append(order, hit.DocumentID)
+		}
+		if len(byDocument[hit.DocumentID]) < maxSemanticMatches {
+			byDocument[hit.DocumentID] = append(byDocument[hit.DocumentID], hit)
+		}
+	}
+	var ids []uint
+	for _, documentID := range order {
+		ids = append(ids, byDocument[documentID][0].AnalysisID)
+	}
+	analyses, err := analysesByID(store, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error: " + err.Error()})
+		return
+	}
+
+	resp := SemanticSearchResponse{Query: q, Kind: kind, Items: []SemanticResultItem{}}
+	for _, documentID := range order {
+		matches := byDocument[documentID]
+		a, ok := analyses[matches[0].AnalysisID]
+		if !ok {
+			continue
+		}
+		item := SemanticResultItem{
+			AnalysisID:     a.ID,
+			DocumentID:     a.DocumentID,
+			FileName:       analysisFileName(&a),
+			SummaryPreview: a.SummaryPreview,
+			ContractType:   a.ContractType,
+			RiskLevel:      services.RiskLevel(a.RiskSeverity),
+			Similarity:     matches[0].Similarity,
+		}
+		for _, m := range matches {
+			item.Matches = append(item.Matches, SemanticMatch{Kind: m.Kind, Ref: m.Ref, Text: m.Text, Similarity: m.Similarity})
+		}
+		resp.Items = append(resp.Items, item)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GET /api/v1/analyses/:id/similar - Gợi ý các hợp đồng có cấu trúc hoặc rủi ro tương tự
+// "by" chọn tiêu chí: structure (loại hợp đồng, tóm tắt, dàn ý điều khoản), risk (các rủi ro)
+// hoặc all (trung bình của hai tiêu chí). Mỗi document được so sánh qua analysis mới nhất có embedding.
+func (h *Handler) GetSimilarAnalyses(c *gin.Context) {
+	store := h.storeOrUnavailable(c)
+	if store == nil {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found"})
+		return
+	}
+	by := c.DefaultQuery("by", "all")
+	if by != "all" && by != "structure" && by != "risk" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("by phải là all, structure hoặc risk: %q", by)})
+		return
+	}
+	limit, ok := semanticLimit(c)
+	if !ok {
+		return
+	}
+	a, err := store.Analyses.ByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found"})
+		return
+	}
+
+	embeddings, err := store.Embeddings.ByAnalysis(a.ID, services.EmbeddingModel)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error: " + err.Error()})
+		return
+	}
+	// Analysis chưa có embedding (tạo trước khi có tìm kiếm ngữ nghĩa, hoặc hàng đợi chưa xử
+	// tới): tạo ngay để trả lời
+	if len(embeddings) == 0 {
+		if err := embedAnalysis(store, a); err != nil {
+			respondAnalysisError(c, err)
+			return
+		}
+		if embeddings, err = store.Embeddings.ByAnalysis(a.ID, services.EmbeddingModel); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error: " + err.Error()})
+			return
+		}
+	}
+	vectors := map[string][]float32{}
+	for _, e := range embeddings {
+		vectors[e.Kind] = storage.DecodeVector(e.Vector)
+	}
+	var kinds []string
+	if by != "risk" {
+		kinds = append(kinds, services.EmbeddingProfile)
+	}
+	if by != "structure" {
+		if vectors[services.EmbeddingRisk] == nil {
+			if by == "risk" {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Analysis này không có rủi ro nào để so sánh."})
+				return
+			}
+		} else {
+			kinds = append(kinds, services.EmbeddingRisk)
+		}
+	}
+
+	// Độ giống theo từng tiêu chí của mỗi document; document thiếu một tiêu chí (ví dụ không
+	// có rủi ro) được tính 0 cho tiêu chí đó
+	type scored struct {
+		analysisID      uint
+		structure, risk *float64
+		total           float64
+	}
+	byDocument := map[uint]*scored{}
+	for _, kind := range kinds {
+		hits, err := store.Embeddings.Nearest(vectors[kind], services.EmbeddingModel, []string{kind}, a.DocumentID, 0)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed: " + err.Error()})
+			return
+		}
+		for _, hit := range hits {
+			s := byDocument[hit.DocumentID]
+			if s == nil {
+				s = &scored{analysisID: hit.AnalysisID}
+				byDocument[hit.DocumentID] = s
+			}
+			similarity := hit.Similarity
+			if kind == services.EmbeddingProfile {
+				s.structure = &similarity
+			} else {
+				s.risk = &similarity
+			}
+			s.total += similarity / float64(len(kinds))
+		}
+	}
+	ranked := make([]*scored, 0, len(byDocument))
+	for _, s := range byDocument {
+		ranked = append(ranked, s)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].total != ranked[j].total {
+			return ranked[i].total > ranked[j].total
+		}
+		return ranked[i].analysisID < ranked[j].analysisID
+	})
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	var ids []uint
+	for _, s := range ranked {
+		ids = append(ids, s.analysisID)
+	}
+	analyses, err := analysesByID(store, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error: " + err.Error()})
+		return
+	}
+
+	resp := SimilarContractsResponse{AnalysisID: a.ID, By: by, Items: []SimilarContractItem{}}
+	for _, s := range ranked {
+		other, ok := analyses[s.analysisID]
+		if !ok {
+			continue
+		}
+		resp.Items = append(resp.Items, SimilarContractItem{
+			AnalysisID:          other.ID,
+			DocumentID:          other.DocumentID,
+			FileName:            analysisFileName(&other),
+			SummaryPreview:      other.SummaryPreview,
+			ContractType:        other.ContractType,
+			RiskLevel:           services.RiskLevel(other.RiskSeverity),
+			Similarity:          s.total,
+			StructureSimilarity: s.structure,
+			RiskSimilarity:      s.risk,
+		})
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// semanticLimit đọc query "limit"; gửi 400 và trả về false khi không hợp lệ.
+func semanticLimit(c *gin.Context) (int, bool) {
+	v := c.Query("limit")
+	if v == "" {
+		return defaultSemanticPageSize, true
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 1 || limit > maxSemanticPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit phải là số nguyên từ 1 tới %d: %q", maxSemanticPageSize, v)})
+		return 0, false
+	}
+	return limit, true
+}
+
+// analysesByID nạp các analysis có id trong ids kèm Document.Metadata.
+func analysesByID(store *storage.Store, ids []uint) (map[uint]models.Analysis, error) {
+	analyses, err := store.Analyses.ByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Analysis, len(analyses))
+	for _, a := range analyses {
+		byID[a.ID] = a
+	}
+	return byID, nil
+}
+
+// analysisFileName là tên file của document của analysis, "" khi không có metadata.
+func analysisFileName(a *models.Analysis) string {
+	if a.Document != nil && a.Document.Metadata != nil {
+		return a.Document.Metadata.FileName
+	}
+	return ""
+}
@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"documind/backend/internal/services"
+	"documind/backend/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultTrashPageSize = 50
+	maxTrashPageSize     = 200
+	// retentionBatchSize là số analysis được xoá trong một lượt khi áp dụng thời hạn lưu giữ
+	retentionBatchSize = 100
+	// maxLegalHoldReason giới hạn số ký tự lý do của legal hold
+	maxLegalHoldReason = 1000
+)
+
+type DeleteAnalysisResponse struct {
+	AnalysisID uint      `json:"analysis_id"`
+	DeletedAt  time.Time `json:"deleted_at"`
+	// PurgeAfter là thời điểm analysis bị xoá vĩnh viễn, không có khi TRASH_RETENTION là 0
+	PurgeAfter *time.Time `json:"purge_after,omitempty"`
+}
+
+type TrashItem struct {
+	AnalysisID     uint       `json:"analysis_id"`
+	DocumentID     uint       `json:"document_id"`
+	FileHash       string     `json:"file_hash"`
+	FileName       string     `json:"file_name,omitempty"`
+	SummaryPreview string     `json:"summary_preview"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeletedAt      time.Time  `json:"deleted_at"`
+	PurgeAfter     *time.Time `json:"purge_after,omitempty"`
+	// LegalHold: document đang bị giữ nên analysis không bị xoá vĩnh viễn
+	LegalHold bool `json:"legal_hold"`
+}
+
+type TrashResponse struct {
+	Total int64       `json:"total"`
+	Items []TrashItem `json:"items"`
+}
+
+// LegalHoldRequest sets or lifts the legal hold of a document.
+type LegalHoldRequest struct {
+	LegalHold *bool  `json:"legal_hold"`
+	Reason    string `json:"reason"`
+}
+
+type LegalHoldResponse struct {
+	DocumentID uint   `json:"document_id"`
+	LegalHold  bool   `json:"legal_hold"`
+	Reason     string `json:"reason,omitempty"`
+	// InTrash: mọi analysis của document đang nằm trong thùng rác
+	InTrash bool `json:"in_trash"`
+}
+
+// RetentionRun is the result of the last application of the retention policy.
+type RetentionRun struct {
+	StartedAt time.Time `json:"started_at"`
+	Trashed   int       `json:"trashed"`
+	Purged    int       `json:"purged"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type RetentionStatus struct {
+	// Thời hạn dạng Go duration, "0s" là không giới hạn
+	AnalysisRetention string        `json:"analysis_retention"`
+	TrashRetention    string        `json:"trash_retention"`
+	PurgeInterval     string        `json:"purge_interval"`
+	LastRun           *RetentionRun `json:"last_run,omitempty"`
+}
+
+// purger áp dụng thời hạn lưu giữ theo chu kỳ.
+type purger struct {
+	policy services.RetentionPolicy
+
+	mu      sync.Mutex
+	lastRun *RetentionRun
+}
+
+func newPurger() *purger {
+	return &purger{policy: services.DefaultRetentionPolicy()}
+}
+
+// purgeAfter là thời điểm một analysis xoá lúc deletedAt bị xoá vĩnh viễn; nil khi không tự xoá.
+func (p *purger) purgeAfter(deletedAt time.Time) *time.Time {
+	if p.policy.Trash <= 0 {
+		return nil
+	}
+	t := deletedAt.Add(p.policy.Trash)
+	return &t
+}
+
+// RunPurger applies the retention policy every PURGE_INTERVAL until ctx is cancelled: analyses
+// older than ANALYSIS_RETENTION are moved to the trash and analyses in the trash for longer
+// than TRASH_RETENTION are purged.
+func (h *Handler) RunPurger(ctx context.Context) {
+	ticker := time.NewTicker(h.retention.policy.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.applyRetention()
+		}
+	}
+}
+
+// applyRetention xoá theo từng lượt retentionBatchSize analysis cho tới khi hết analysis quá hạn.
+func (h *Handler) applyRetention() {
+	store := h.store.Load()
+	if store == nil {
+		return
+	}
+	p := h.retention
+	run := &RetentionRun{StartedAt: time.Now()}
+	var err error
+	if p.policy.Analysis > 0 {
+		for n := retentionBatchSize; n == retentionBatchSize && err == nil; {
+			n, err = store.Trash.DeleteCreatedBefore(run.StartedAt.Add(-p.policy.Analysis), retentionBatchSize)
+			run.Trashed += n
+		}
+	}
+	if p.policy.Trash > 0 && err == nil {
+		for n := retentionBatchSize; n == retentionBatchSize && err == nil; {
+			n, err = store.Trash.PurgeDeletedBefore(run.StartedAt.Add(-p.policy.Trash), retentionBatchSize)
+			run.Purged += n
+		}
+	}
+	if err != nil {
+		run.Error = err.Error()
+		log.Printf("Failed to apply retention policy: %v", err)
+	}
+	if run.Trashed > 0 || run.Purged > 0 {
+		log.Printf("Retention policy: %d analyses moved to trash, %d purged", run.Trashed, run.Purged)
+	}
+	p.mu.Lock()
+	p.lastRun = run
+	p.mu.Unlock()
+}
+
+// DELETE /api/v1/analyses/:id - Chuyển analysis vào thùng rác
+// Document vào thùng rác cùng analysis cuối cùng của nó. Analysis bị xoá vĩnh viễn sau TRASH_RETENTION.
+func (h *Handler) DeleteAnalysis(c *gin.Context) {
+	store := h.storeOrUnavailable(c)
+	if store == nil {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found"})
+		return
+	}
+	err = store.Trash.Delete(uint(id))
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found"})
+	case errors.Is(err, storage.ErrLegalHold):
+		c.JSON(http.StatusConflict, gin.H{"error": "Document đang bị giữ theo yêu cầu pháp lý (legal hold), không thể xoá.", "code": ErrCodeLegalHold})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete analysis: " + err.Error()})
+	default:
+		now := time.Now()
+		log.Printf("Analysis #%d moved to trash", id)
+		c.JSON(http.StatusOK, DeleteAnalysisResponse{AnalysisID: uint(id), DeletedAt: now, PurgeAfter: h.retention.purgeAfter(now)})
+	}
+}
+
+// GET /api/v1/trash - Lấy các analysis trong thùng rác, xoá gần nhất trước. Phân trang: limit, offset.
+func (h *Handler) GetTrash(c *gin.Context) {
+	store := h.storeOrUnavailable(c)
+	if store == nil {
+		return
+	}
+	limit, offset := defaultTrashPageSize, 0
+	var err error
+	if v := c.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxTrashPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit phải là số nguyên từ 1 tới %d: %q", maxTrashPageSize, v)})
+			return
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("offset phải là số nguyên không âm: %q", v)})
+			return
+		}
+	}
+	analyses, total, err := store.Trash.List(limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch trash: " + err.Error()})
+		return
+	}
+	resp := TrashResponse{Total: total, Items: []TrashItem{}}
+	for i := range analyses {
+		a := &analyses[i]
+		item := TrashItem{
+			AnalysisID:     a.ID,
+			DocumentID:     a.DocumentID,
+			FileHash:       a.FileHash,
+			FileName:       analysisFileName(a),
+			SummaryPreview: a.SummaryPreview,
+			CreatedAt:      a.CreatedAt,
+			DeletedAt:      a.DeletedAt.Time,
+		}
+		if a.Document != nil && a.Document.LegalHold {
+			item.LegalHold = true
+		} else {
+			item.PurgeAfter = h.retention.purgeAfter(a.DeletedAt.Time)
+		}
+		resp.Items = append(resp.Items, item)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// POST /api/v1/trash/:id/restore - Khôi phục analysis (và document của nó) từ thùng rác
+func (h *Handler) RestoreAnalysis(c *gin.Context) {
+	store := h.storeOrUnavailable(c)
+	if store == nil {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found in trash"})
+		return
+	}
+	if err := store.Trash.Restore(uint(id)); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found in trash"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore analysis: " + err.Error()})
+		return
+	}
+	a, err := store.Analyses.ByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error: " + err.Error()})
+		return
+	}
+	log.Printf("Analysis #%d restored from trash", id)
+	c.JSON(http.StatusOK, cachedAnalysisResponse(*a))
+}
+
+// DELETE /api/v1/admin/trash/:id - Xoá vĩnh viễn một analysis trong thùng rác cùng dữ liệu dẫn xuất
+// Document được xoá cùng analysis cuối cùng của nó.
+func (h *Handler) PurgeAnalysis(c *gin.Context) {
+	store := h.storeOrUnavailable(c)
+	if store == nil {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found in trash"})
+		return
+	}
+	err = store.Trash.Purge(uint(id))
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found in trash"})
+	case errors.Is(err, storage.ErrLegalHold):
+		c.JSON(http.StatusConflict, gin.H{"error": "Document đang bị giữ theo yêu cầu pháp lý (legal hold), không thể xoá.", "code": ErrCodeLegalHold})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge analysis: " + err.Error()})
+	default:
+		log.Printf("Analysis #%d purged", id)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// PUT /api/v1/admin/documents/:id/legal-hold - Đặt hoặc bỏ legal hold của document
+// Document bị giữ không thể bị xoá, kể cả theo thời hạn lưu giữ; document trong thùng rác vẫn bị giữ.
+func (h *Handler) SetLegalHold(c *gin.Context) {
+	store := h.storeOrUnavailable(c)
+	if store == nil {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return
+	}
+	var req LegalHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.LegalHold == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": `Body phải có dạng {"legal_hold": true, "reason": "..."}`})
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if utf8.RuneCountInString(reason) > maxLegalHoldReason {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Lý do không được quá %d ký tự.", maxLegalHoldReason)})
+		return
+	}
+	document, err := store.Trash.SetLegalHold(uint(id), *req.LegalHold, reason)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update legal hold: " + err.Error()})
+		return
+	}
+	log.Printf("Legal hold of document #%d set to %t", id, document.LegalHold)
+	c.JSON(http.StatusOK, LegalHoldResponse{
+		DocumentID: document.ID,
+		LegalHold:  document.LegalHold,
+		Reason:     document.LegalHoldReason,
+		InTrash:    document.DeletedAt.Valid,
+	})
+}
+
+// GET /api/v1/admin/retention - Xem thời hạn lưu giữ và kết quả lần áp dụng gần nhất
+func (h *Handler) GetRetentionStatus(c *gin.Context) {
+	p := h.retention
+	status := RetentionStatus{
+		AnalysisRetention: p.policy.Analysis.String(),
+		TrashRetention:    p.policy.Trash.String(),
+		PurgeInterval:     p.policy.Interval.String(),
+	}
+	p.mu.Lock()
+	if p.lastRun != nil {
+		run := *p.lastRun
+		status.LastRun = &run
+	}
+	p.mu.Unlock()
+	c.JSON(http.StatusOK, status)
+}
@@ -4,25 +4,237 @@ package models
 import (
 	"time"
 
-	"github.com/lib/pq"
+	"gorm.io/gorm"
 )
 
-// Analysis là model cho bảng chính, chứa các thông tin nhẹ.
+// Document là một file đã tải lên, định danh theo FileHash. Mỗi lần phân tích file (lần đầu
+// và các lần chạy lại với model hay prompt khác) là một Analysis của Document.
+type Document struct {
+	ID        uint   `gorm:"primaryKey"`
+	FileHash  string `gorm:"type:varchar(64);uniqueIndex"`
+	CreatedAt time.Time
+	Format    string `gorm:"type:varchar(20)"` // pdf, docx, xlsx, zip, eml
+	Language  string `gorm:"type:varchar(10);index"`
+	// Nội dung đã gửi cho AI (kèm dấu mốc trang và tên file), dùng để chạy lại phân tích.
+	// Rỗng với document tạo trước khi có cột này: khi đó dùng AnalysisDetail.ExtractedText
+	AnalysisText string `gorm:"type:text"`
+	// Bundle: bộ hồ sơ ZIP hoặc e-mail có file đính kèm, được phân tích bằng prompt bộ hồ sơ
+	Bundle bool
+	// Dẫn chiếu giữa các tài liệu và kết quả đối chiếu số liệu gửi kèm prompt bộ hồ sơ
+	PromptReferences StringList
+	// LegalHold chặn việc xoá document và các analysis của nó, kể cả theo thời hạn lưu giữ
+	LegalHold       bool   `gorm:"not null;default:false"`
+	LegalHoldReason string `gorm:"type:text"`
+	// DeletedAt khác nil khi mọi analysis của document đã vào thùng rác
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	// Các file con khi phân tích một bộ hồ sơ ZIP (rỗng với file đơn lẻ)
+	Files []AnalysisFile `gorm:"foreignKey:DocumentID"`
+	// Metadata của file được tải lên (tên file, kích thước, tác giả...)
+	Metadata *DocumentMetadata `gorm:"foreignKey:DocumentID"`
+	// Chỉ số chất lượng trích xuất text (có thể nil với document cũ)
+	Metrics *ExtractionMetrics `gorm:"foreignKey:DocumentID"`
+	// Nhãn do người dùng gắn cho file
+	Tags []DocumentTag `gorm:"foreignKey:DocumentID"`
+}
+
+// DocumentTag là một nhãn của document (chữ thường, không trùng trong một document).
+type DocumentTag struct {
+	ID         uint   `gorm:"primaryKey"`
+	DocumentID uint   `gorm:"not null;uniqueIndex:idx_document_tags_document_tag"`
+	Tag        string `gorm:"type:varchar(50);not null;uniqueIndex:idx_document_tags_document_tag;index"`
+}
+
+// Analysis là một lần phân tích một Document, chứa các thông tin nhẹ.
 type Analysis struct {
-	ID             uint      `gorm:"primaryKey"`
-	FileHash       string    `gorm:"type:varchar(64);uniqueIndex"`
-	CreatedAt      time.Time
+	// Các index ghép (cột sắp xếp, id) phục vụ phân trang theo cursor của danh sách analysis
+	ID         uint `gorm:"primaryKey;index:idx_analyses_created_at_id,priority:2;index:idx_analyses_risk_severity_id,priority:2;index:idx_analyses_risk_count_id,priority:2"`
+	DocumentID uint `gorm:"not null;index"`
+	// FileHash lặp lại Document.FileHash để tra cứu nhanh; một file có thể có nhiều analysis
+	FileHash       string    `gorm:"type:varchar(64);index"`
+	CreatedAt      time.Time `gorm:"index:idx_analyses_created_at_id,priority:1"`
 	SummaryPreview string    `gorm:"type:varchar(200)"` // Lưu 200 ký tự đầu của summary
+	// Ngôn ngữ của hợp đồng (vi, en, bilingual, other), quyết định profile phân tích
+	Language string `gorm:"type:varchar(10);index"`
+	// Phiên bản pipeline đã tạo ra analysis, xem services.PipelineVersion (rỗng với analysis cũ)
+	PipelineVersion string `gorm:"type:varchar(20);index"`
+	// Loại hợp đồng theo kết quả phân tích, xem services.ContractTypes (rỗng với analysis cũ)
+	ContractType string `gorm:"type:varchar(20);index"`
+	// Mức rủi ro tổng thể dạng số để lọc và sắp xếp: 0 chưa rõ, 1 low, 2 medium, 3 high
+	RiskSeverity int `gorm:"not null;default:0;index:idx_analyses_risk_severity_id,priority:1"`
+	// Số rủi ro tiềm ẩn của kết quả phân tích
+	RiskCount int `gorm:"not null;default:0;index:idx_analyses_risk_count_id,priority:1"`
 
+	// Thông tin thư khi tài liệu được tải lên dưới dạng e-mail (.eml)
+	EmailFrom    string `gorm:"type:varchar(320)"`
+	EmailSubject string `gorm:"type:text"`
+	EmailDate    *time.Time
+	// DeletedAt là thời điểm analysis được chuyển vào thùng rác
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	Document *Document `gorm:"foreignKey:DocumentID"`
 	// GORM relation: Một Analysis sẽ có một AnalysisDetail
-	AnalysisDetail   AnalysisDetail `gorm:"foreignKey:AnalysisID"`
+	AnalysisDetail AnalysisDetail `gorm:"foreignKey:AnalysisID"`
+	// Model, prompt và thời gian của lần phân tích (nil với analysis cũ)
+	Provenance *AnalysisProvenance `gorm:"foreignKey:AnalysisID"`
+	// Các bên của hợp đồng theo kết quả phân tích
+	Parties []AnalysisParty `gorm:"foreignKey:AnalysisID"`
+}
+
+// AnalysisParty là một bên ký kết hợp đồng theo kết quả của một lần phân tích.
+type AnalysisParty struct {
+	ID         uint   `gorm:"primaryKey"`
+	AnalysisID uint   `gorm:"not null;index"`
+	Name       string `gorm:"type:text"`
 }
 
 // AnalysisDetail chứa các dữ liệu văn bản dài.
 type AnalysisDetail struct {
-	ID             uint           `gorm:"primaryKey"`
-	AnalysisID     uint           `gorm:"not null;index"` // Khóa ngoại liên kết ngược lại với bảng Analysis
-	Summary        string         `gorm:"type:text"`
-	KeyClauses     pq.StringArray `gorm:"type:text[]"`
-	PotentialRisks pq.StringArray `gorm:"type:text[]"`
-}
\ No newline at end of file
+	ID             uint   `gorm:"primaryKey"`
+	AnalysisID     uint   `gorm:"not null;index"` // Khóa ngoại liên kết ngược lại với bảng Analysis
+	Summary        string `gorm:"type:text"`
+	KeyClauses     StringList
+	PotentialRisks StringList
+	// Cảnh báo về chất lượng trích xuất (trang scan đã OCR, text lỗi font...)
+	Warnings StringList
+	// Cây điều khoản (Chương → Điều → Khoản → Điểm) dạng JSON, xem services.ClauseNode
+	Structure string `gorm:"type:text"`
+	// Liên kết giữa các tài liệu trong bộ hồ sơ (phụ lục ↔ hợp đồng chính)
+	CrossReferences StringList
+	// Đối chiếu tổng tiền trong bảng tính (bảng giá, lịch thanh toán) với số tiền trong hợp đồng chính
+	Reconciliation StringList
+	// Text đã chuẩn hoá của tài liệu, dùng để so sánh với các tài liệu gần trùng
+	ExtractedText string `gorm:"type:text"`
+	// Chữ ký số của PDF và kết quả kiểm tra dạng JSON, xem services.SignatureInfo
+	Signatures string `gorm:"type:text"`
+	// Cách nội dung được gửi cho AI: text, multimodal (file PDF gốc kèm text) hoặc document (chỉ file gốc)
+	AnalysisMode string `gorm:"type:varchar(20)"`
+}
+
+// AnalysisFile là một tài liệu trong bộ hồ sơ ZIP (hợp đồng chính, phụ lục, SOW, sửa đổi).
+type AnalysisFile struct {
+	ID         uint   `gorm:"primaryKey"`
+	DocumentID uint   `gorm:"not null;index"`
+	FileName   string `gorm:"type:text"`
+	FileHash   string `gorm:"type:varchar(64);index"`
+	Role       string `gorm:"type:varchar(20)"`  // main, annex, sow, amendment
+	Label      string `gorm:"type:varchar(100)"` // ví dụ "Phụ lục 01"
+	Size       int64
+	PageCount  int
+	Structure  string `gorm:"type:text"` // cây điều khoản của file dạng JSON
+}
+// ContentFingerprint là khoá cache theo nội dung của một document: ContentHash cho tài liệu
+// có text giống hệt, SimHash (chia thành 4 dải 16 bit có index) cho tài liệu gần trùng.
+type ContentFingerprint struct {
+	ID          uint   `gorm:"primaryKey"`
+	DocumentID  uint   `gorm:"not null;uniqueIndex"`
+	ContentHash string `gorm:"type:varchar(64);index"`
+	SimHash     int64  // uint64 lưu dưới dạng int64 vì Postgres không có kiểu số nguyên không dấu
+	Band0       int    `gorm:"index"`
+	Band1       int    `gorm:"index"`
+	Band2       int    `gorm:"index"`
+	Band3       int    `gorm:"index"`
+}
+
+// DocumentMetadata là metadata của file được tải lên, thu thập khi trích xuất.
+// Với bộ hồ sơ ZIP và e-mail, các trường thuộc tính tài liệu lấy từ hợp đồng chính.
+type DocumentMetadata struct {
+	ID         uint   `gorm:"primaryKey"`
+	DocumentID uint   `gorm:"not null;uniqueIndex"`
+	FileName   string `gorm:"type:text"` // tên file gốc khi tải lên
+	FileSize   int64
+	MIMEType   string `gorm:"type:varchar(255);index"`
+	Format     string `gorm:"type:varchar(20);index"` // pdf, docx, zip, eml
+	PageCount  int
+
+	// Thuộc tính nhúng trong file: Info của PDF, core/app properties của DOCX
+	Title          string `gorm:"type:text"`
+	Author         string `gorm:"type:text;index"`
+	Subject        string `gorm:"type:text"`
+	Keywords       string `gorm:"type:text"`
+	Creator        string `gorm:"type:text"`
+	Producer       string `gorm:"type:text"`
+	Company        string `gorm:"type:text"`
+	LastModifiedBy string `gorm:"type:text"`
+	// Ngày tạo/sửa ghi trong file, khác với ngày phân tích Analysis.CreatedAt
+	DocumentCreatedAt  *time.Time `gorm:"index"`
+	DocumentModifiedAt *time.Time
+}
+
+// TableName đặt tên bảng cố định thay vì để GORM tự chia số nhiều.
+func (DocumentMetadata) TableName() string {
+	return "document_metadata"
+}
+
+// ExtractionMetrics là chỉ số chất lượng trích xuất text của tài liệu, xem services.QualityMetrics.
+type ExtractionMetrics struct {
+	ID                uint `gorm:"primaryKey"`
+	DocumentID        uint `gorm:"not null;uniqueIndex"`
+	PageCount         int
+	EmptyPages        int
+	Characters        int
+	CharsPerPage      float64
+	NonLetterRatio    float64
+	DictionaryHitRate float64
+	Language          string `gorm:"type:varchar(10);index"` // vi, en, bilingual, other
+	Score             float64
+}
+
+// TableName đặt tên bảng cố định thay vì để GORM tự chia số nhiều.
+func (ExtractionMetrics) TableName() string {
+	return "extraction_metrics"
+}
+
+// AnalysisProvenance ghi lại cách một analysis được tạo ra (model, prompt, extractor, thời gian
+// từng bước, phản hồi gốc và số token) để kiểm tra và gỡ lỗi.
+type AnalysisProvenance struct {
+	ID            uint   `gorm:"primaryKey"`
+	AnalysisID    uint   `gorm:"not null;uniqueIndex"`
+	Model         string `gorm:"type:varchar(100);index"`
+	PromptVersion string `gorm:"type:varchar(50)"`
+	// Cấu hình sinh dạng JSON, xem services.GenerationConfig; "{}" là mặc định của model
+	GenerationConfig string `gorm:"type:text"`
+	AnalysisMode     string `gorm:"type:varchar(20)"`
+	Extractor        string `gorm:"type:varchar(20)"` // pdf, docx, xlsx, zip, eml
+	ExtractorVersion string `gorm:"type:varchar(20)"`
+	OCREngine        string `gorm:"type:varchar(100)"` // rỗng khi không bật OCR
+	// Tuỳ chọn khi chạy lại: độ sâu (standard, deep) và yêu cầu bổ sung thêm vào prompt
+	Depth        string `gorm:"type:varchar(20)"`
+	Instructions string `gorm:"type:text"`
+	// Thời gian từng bước (ms): nhận file, trích xuất, gọi model, tổng cộng tới lúc lưu
+	UploadMs  int64
+	ExtractMs int64
+	ModelMs   int64
+	TotalMs   int64
+	// Phản hồi nguyên văn của model, trước khi làm sạch và parse JSON
+	RawResponse    string `gorm:"type:text"`
+	FinishReason   string `gorm:"type:varchar(30)"` // Stop, MaxTokens, Safety, Recitation, Other
+	PromptTokens   int
+	ResponseTokens int
+	TotalTokens    int
+	CreatedAt      time.Time
+}
+
+// TableName đặt tên bảng cố định thay vì để GORM tự chia số nhiều.
+func (AnalysisProvenance) TableName() string {
+	return "analysis_provenance"
+}
+
+// Embedding là vector ngữ nghĩa của một phần kết quả phân tích, dùng cho tìm kiếm ngữ nghĩa
+// và gợi ý hợp đồng tương tự. Embedding "profile" và "risk" thuộc về một analysis; embedding
+// "clause" của từng điều khoản thuộc về document vì cây điều khoản không đổi giữa các lần phân tích.
+type Embedding struct {
+	ID         uint `gorm:"primaryKey"`
+	DocumentID uint `gorm:"not null;index"`
+	// AnalysisID là nil với embedding của điều khoản
+	AnalysisID *uint  `gorm:"index"`
+	Kind       string `gorm:"type:varchar(20);not null"` // profile, risk, clause
+	// Ref là số hiệu điều khoản ("Điều 5"), chỉ có với embedding của điều khoản
+	Ref string `gorm:"type:varchar(100)"`
+	// Text là đoạn đầu của nội dung đã tạo embedding, để hiển thị trong kết quả tìm kiếm
+	Text  string `gorm:"type:text"`
+	Model string `gorm:"type:varchar(100);index"`
+	// Vector là các số float32 little-endian, đã chuẩn hoá về độ dài 1
+	Vector    []byte
+	CreatedAt time.Time
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// ChatMessage là một câu hỏi về hợp đồng đã lưu và câu trả lời của AI. Chỉ các câu hỏi gửi
+// kèm file_hash được lưu; câu hỏi về contract_text không thuộc document nào.
+type ChatMessage struct {
+	ID         uint   `gorm:"primaryKey"`
+	DocumentID uint   `gorm:"not null;index"`
+	Question   string `gorm:"type:text;not null"`
+	Answer     string `gorm:"type:text;not null"`
+	CreatedAt  time.Time
+}
+
+// Job là tiến độ của một tác vụ nền do quản trị viên chạy, được lưu để xem lại sau khi server
+// khởi động lại.
+type Job struct {
+	ID    uint   `gorm:"primaryKey"`
+	Kind  string `gorm:"type:varchar(20);not null;index"` // reanalysis
+	State string `gorm:"type:varchar(20);not null"`
+	// TokenBudget là tổng số token tối đa, ItemLimit là số mục tối đa (0 là không giới hạn)
+	TokenBudget int
+	ItemLimit   int
+	TokensUsed  int
+	Succeeded   int
+	Failed      int
+	LastError   string `gorm:"type:text"`
+	StartedAt   time.Time
+	FinishedAt  *time.Time
+}
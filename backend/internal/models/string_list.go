@@ -0,0 +1,88 @@
+package models
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// StringList là danh sách chuỗi lưu được trên mọi cơ sở dữ liệu: mảng text[] trên Postgres
+// (giữ nguyên schema cũ dùng pq.StringArray), chuỗi JSON trong cột text trên SQLite.
+type StringList []string
+
+// GormDataType là kiểu dữ liệu chung của trường, kiểu cột cụ thể do GormDBDataType quyết định.
+func (StringList) GormDataType() string {
+	return "text"
+}
+
+// GormDBDataType chọn kiểu cột theo cơ sở dữ liệu.
+func (StringList) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	if db.Dialector.Name() == "postgres" {
+		return "text[]"
+	}
+	return "text"
+}
+
+// GormValue mã hoá danh sách theo cơ sở dữ liệu khi ghi.
+func (l StringList) GormValue(ctx context.Context, db *gorm.DB) clause.Expr {
+	var v driver.Value
+	var err error
+	if db.Dialector.Name() == "postgres" {
+		v, err = pq.StringArray(l).Value()
+	} else {
+		v, err = l.Value()
+	}
+	if err != nil {
+		_ = db.AddError(err)
+	}
+	return clause.Expr{SQL: "?", Vars: []interface{}{v}}
+}
+
+// Value mã hoá danh sách thành JSON; danh sách nil được lưu là NULL.
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal([]string(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan đọc cả mảng Postgres ("{a,b}") lẫn JSON ("["a","b"]").
+func (l *StringList) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return fmt.Errorf("cannot scan %T into StringList", src)
+	}
+	if strings.HasPrefix(s, "{") {
+		var a pq.StringArray
+		if err := a.Scan(s); err != nil {
+			return err
+		}
+		*l = StringList(a)
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal([]byte(s), &list); err != nil {
+		return fmt.Errorf("failed to decode string list: %w", err)
+	}
+	*l = list
+	return nil
+}
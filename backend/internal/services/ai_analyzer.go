@@ -2,101 +2,194 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/google/generative-ai-go/genai"
 	"google.golang.org/api/option"
 )
 
-// AnalyzeText sends text to Google Gemini for analysis and returns a structured JSON response
-func AnalyzeText(textContent string, modelName ...string) (string, error) {
+// AnalyzeText sends text to Google Gemini for analysis; the returned call holds the structured JSON response.
+// language (LanguageVietnamese, LanguageEnglish...) selects the analysis profile; "" detects it from the text.
+// opts overrides the model and adds depth and user instructions to the prompt.
+func AnalyzeText(textContent, language string, opts AnalysisOptions) (*ModelCall, error) {
+	profile := profileFor(language, textContent)
+	// Construct the prompt
+	prompt := fmt.Sprintf(`
+	Phân tích nội dung hợp đồng sau và trả về kết quả bằng %[1]s dưới dạng một chuỗi JSON duy nhất.
+	QUAN TRỌNG: Phản hồi của bạn CHỈ ĐƯỢC chứa chuỗi JSON, không có văn bản, giải thích hay định dạng markdown nào khác.
+	%[2]s
+	Nếu nội dung có các dấu mốc "--- Trang N ---", hãy ghi kèm số trang ở cuối mỗi điều khoản và rủi ro, ví dụ "(%[3]s 3)".
+	Phần bắt đầu bằng "--- Sheet: tên ---" là bảng tính, các ô cách nhau bởi " | ".
+	Nếu có phần "=== E-mail (bối cảnh đàm phán) ===", đó là thư trao đổi giữa các bên: dùng nó để hiểu bối cảnh và các điểm đang đàm phán, ghi rủi ro nếu thư mâu thuẫn với văn bản hợp đồng.
+	Khi nhắc tới một điều khoản, ghi đúng số hiệu như trong văn bản, ví dụ %[4]s.
+
+	JSON phải tuân theo cấu trúc chính xác sau:
+	{
+		"summary": "Một bản tóm tắt chuyên nghiệp, ngắn gọn bằng %[1]s về các điểm chính của hợp đồng",
+		"key_clauses": ["Danh sách các điều khoản quan trọng nhất bằng %[1]s, dưới dạng một mảng các chuỗi"],
+		"potential_risks": ["Danh sách các rủi ro tiềm ẩn hoặc các điểm cần lưu ý bằng %[1]s, dưới dạng một mảng các chuỗi. Trả về mảng rỗng [] nếu không tìm thấy"],
+		%[6]s
+	}
+
+	Nội dung hợp đồng cần phân tích:
+	---
+	%[5]s
+	---
+`, profile.replyLanguage, profile.guidance+opts.guidance(), profile.pageLabel, profile.clauseExample, textContent, classificationFields)
+
+	return runAnalysisPrompt(prompt, PromptVersionText, textContent, profile, nil, opts)
+}
+
+// AnalyzeBundle analyses a main contract together with its annexes, SOWs and amendments.
+// references are cross-document references already detected in the text; the JSON response
+// additionally contains "cross_references". language and opts are used as in AnalyzeText.
+func AnalyzeBundle(bundleText string, references []string, language string, opts AnalysisOptions) (*ModelCall, error) {
+	profile := profileFor(language, bundleText)
+	hints := "Không có."
+	if len(references) > 0 {
+		hints = "- " + strings.Join(references, "\n	- ")
+	}
+	prompt := fmt.Sprintf(`
+	Phân tích bộ hồ sơ hợp đồng sau và trả về kết quả bằng %[1]s dưới dạng một chuỗi JSON duy nhất.
+	QUAN TRỌNG: Phản hồi của bạn CHỈ ĐƯỢC chứa chuỗi JSON, không có văn bản, giải thích hay định dạng markdown nào khác.
+	%[2]s
+	Bộ hồ sơ gồm hợp đồng chính và các tài liệu kèm theo (phụ lục, phạm vi công việc, văn bản sửa đổi), mỗi tài liệu bắt đầu bằng dấu mốc "=== Tài liệu N: tên (loại) ===".
+	Phần bắt đầu bằng "--- Sheet: tên ---" là bảng tính (bảng giá, lịch giao hàng, lịch thanh toán), các ô cách nhau bởi " | "; hãy đối chiếu số liệu trong bảng với số tiền, số lượng và thời hạn trong hợp đồng chính.
+	Hãy phân tích chúng như MỘT giao dịch thống nhất: phụ lục và văn bản sửa đổi bổ sung hoặc thay thế nội dung của hợp đồng chính; chỉ ra các mâu thuẫn giữa các tài liệu.
+	Nếu nội dung có các dấu mốc "--- Trang N ---", hãy ghi kèm tên tài liệu và số trang ở cuối mỗi điều khoản và rủi ro, ví dụ "(%[4]s 01, %[3]s 3)".
+	Nếu có phần "=== E-mail (bối cảnh đàm phán) ===", đó là thư trao đổi giữa các bên: dùng nó để hiểu bối cảnh và các điểm đang đàm phán, ghi rủi ro nếu thư mâu thuẫn với văn bản hợp đồng.
+	Khi nhắc tới một điều khoản, ghi đúng số hiệu như trong văn bản, ví dụ %[5]s.
+
+	JSON phải tuân theo cấu trúc chính xác sau:
+	{
+		"summary": "Một bản tóm tắt chuyên nghiệp, ngắn gọn bằng %[1]s về toàn bộ giao dịch",
+		"key_clauses": ["Danh sách các điều khoản quan trọng nhất bằng %[1]s, dưới dạng một mảng các chuỗi"],
+		"potential_risks": ["Danh sách các rủi ro tiềm ẩn hoặc các điểm cần lưu ý bằng %[1]s, kể cả mâu thuẫn giữa các tài liệu. Trả về mảng rỗng [] nếu không tìm thấy"],
+		"cross_references": ["Các liên kết giữa tài liệu, ví dụ 'Phụ lục 01 thay thế bảng giá tại Điều 3.1 của hợp đồng chính'. Trả về mảng rỗng [] nếu không có"],
+		%[8]s
+	}
+
+	Các dẫn chiếu giữa tài liệu và kết quả đối chiếu số liệu đã phát hiện tự động:
+	%[6]s
+
+	Nội dung bộ hồ sơ cần phân tích:
+	---
+	%[7]s
+	---
+`, profile.replyLanguage, profile.guidance+opts.guidance(), profile.pageLabel, profile.annexLabel, profile.clauseExample, hints, bundleText, classificationFields)
+	return runAnalysisPrompt(prompt, PromptVersionBundle, bundleText, profile, nil, opts)
+}
+
+// runAnalysisPrompt gửi prompt phân tích tới Gemini và trả về chuỗi JSON kết quả kèm thông tin
+// của lần gọi (model, token, thời gian). profile dùng để chọn model khi opts không chỉ định;
+// doc khác nil thì file gốc được gửi kèm trước prompt.
+func runAnalysisPrompt(prompt, promptVersion, textContent string, profile *analysisProfile, doc *DocumentBlob, opts AnalysisOptions) (*ModelCall, error) {
 	// Step 1: Initialize the client
 	ctx := context.Background()
 	apiKey := os.Getenv("GEMINI_API_KEY")
 	if apiKey == "" {
-		return "", fmt.Errorf("GEMINI_API_KEY environment variable is not set")
+		return nil, fmt.Errorf("GEMINI_API_KEY environment variable is not set")
 	}
 
 	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
 	if err != nil {
 		log.Printf("Error creating Gemini client: %v", err)
-		return "", fmt.Errorf("failed to initialize Gemini client: %w", err)
+		return nil, fmt.Errorf("failed to initialize Gemini client: %w", err)
 	}
 	defer client.Close()
 
 	// Smart model selection based on content length
-	chosenModel := selectOptimalModel(textContent)
-	if len(modelName) > 0 && modelName[0] != "" {
-		chosenModel = modelName[0]
+	chosenModel := selectOptimalModel(textContent, profile)
+	if opts.Model != "" {
+		chosenModel = opts.Model
+	} else if opts.Depth == DepthDeep {
+		chosenModel = GeminiPro25
 	}
 	
-	log.Printf("Using model: %s for content length: %d characters", chosenModel, len(textContent))
+	log.Printf("Using model: %s for content length: %d characters, language profile: %s", chosenModel, len(textContent), profile.language)
 	model := client.GenerativeModel(chosenModel)
-
-	// Step 2: Construct the prompt
-	prompt := fmt.Sprintf(`
-	Phân tích nội dung hợp đồng sau và trả về kết quả bằng tiếng Việt dưới dạng một chuỗi JSON duy nhất.
-	QUAN TRỌNG: Phản hồi của bạn CHỈ ĐƯỢC chứa chuỗi JSON, không có văn bản, giải thích hay định dạng markdown nào khác.
-
-	JSON phải tuân theo cấu trúc chính xác sau:
-	{
-		"summary": "Một bản tóm tắt chuyên nghiệp, ngắn gọn bằng tiếng Việt về các điểm chính của hợp đồng",
-		"key_clauses": ["Danh sách các điều khoản quan trọng nhất bằng tiếng Việt, dưới dạng một mảng các chuỗi"],
-		"potential_risks": ["Danh sách các rủi ro tiềm ẩn hoặc các điểm cần lưu ý bằng tiếng Việt, dưới dạng một mảng các chuỗi. Trả về mảng rỗng [] nếu không tìm thấy"]
+	call := &ModelCall{
+		Model:            chosenModel,
+		PromptVersion:    opts.promptVersion(promptVersion),
+		GenerationConfig: generationConfig(model.GenerationConfig),
 	}
+	start := time.Now()
 
-	Nội dung hợp đồng cần phân tích:
-	---
-	%s
-	---
-`, textContent)
+	parts := []genai.Part{genai.Text(prompt)}
+	if doc != nil {
+		part, cleanup, err := documentPart(ctx, client, doc)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		parts = append([]genai.Part{part}, parts...)
+	}
 
-	// Step 3: Send request to AI
+	// Step 2: Send request to AI
 	log.Println("Sending request to Gemini API...")
-	resp, err := model.GenerateContent(ctx, genai.Text(prompt))
+	resp, err := model.GenerateContent(ctx, parts...)
 	if err != nil {
 		log.Printf("Error calling Gemini API: %v", err)
 		
 		// Kiểm tra lỗi quota API
 		if strings.Contains(err.Error(), "429") || strings.Contains(err.Error(), "quota") || strings.Contains(err.Error(), "exceeded") {
-			return "", fmt.Errorf("API quota exceeded: %w", err)
+			return nil, fmt.Errorf("API quota exceeded: %w", err)
 		}
 		
 		// Kiểm tra lỗi API key
 		if strings.Contains(err.Error(), "API_KEY") || strings.Contains(err.Error(), "authentication") {
-			return "", fmt.Errorf("API authentication failed: %w", err)
+			return nil, fmt.Errorf("API authentication failed: %w", err)
 		}
 		
 		// Lỗi chung
-		return "", fmt.Errorf("failed to generate content: %w", err)
+		return nil, fmt.Errorf("failed to generate content: %w", err)
+	}
+	call.Latency = time.Since(start)
+	if u := resp.UsageMetadata; u != nil {
+		call.PromptTokens = int(u.PromptTokenCount)
+		call.ResponseTokens = int(u.CandidatesTokenCount)
+		call.TotalTokens = int(u.TotalTokenCount)
 	}
 
-	// Step 4: Process and return the response
+	// Step 3: Process and return the response
 	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("received empty response from Gemini API")
+		return nil, fmt.Errorf("received empty response from Gemini API")
+	}
+	// "FinishReasonStop" → "Stop", "FinishReasonMaxTokens" → "MaxTokens"
+	call.FinishReason = strings.TrimPrefix(resp.Candidates[0].FinishReason.String(), "FinishReason")
+
+	var raw strings.Builder
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if txt, ok := part.(genai.Text); ok {
+			raw.WriteString(string(txt))
+		}
 	}
+	call.RawResponse = raw.String()
 
 	if txt, ok := resp.Candidates[0].Content.Parts[0].(genai.Text); ok {
 		// Clean the response string to ensure it's valid JSON
-		cleanedResponse := strings.TrimSpace(string(txt))
-		if cleanedResponse == "" {
-			return "", fmt.Errorf("received empty analysis from Gemini API")
+		call.Text = strings.TrimSpace(string(txt))
+		if call.Text == "" {
+			return nil, fmt.Errorf("received empty analysis from Gemini API")
 		}
-		return cleanedResponse, nil
+		return call, nil
 	}
 
-	return "", fmt.Errorf("failed to extract text from Gemini API response")
+	return nil, fmt.Errorf("failed to extract text from Gemini API response")
 }
 
-// selectOptimalModel chọn model tối ưu dựa trên độ dài nội dung
-func selectOptimalModel(content string) string {
+// selectOptimalModel chọn model tối ưu dựa trên độ dài nội dung và bộ từ khoá của ngôn ngữ hợp đồng
+func selectOptimalModel(content string, profile *analysisProfile) string {
 	contentLength := len(content)
 	
 	// Kiểm tra các tiêu chí để chọn model
-	if shouldUsePro(content, contentLength) {
+	if shouldUsePro(content, contentLength, profile) {
 		log.Printf("Selected Gemini Pro 2.5 - Content analysis: length=%d chars", contentLength)
 		return GeminiPro25
 	}
@@ -106,20 +199,14 @@ func selectOptimalModel(content string) string {
 }
 
 // shouldUsePro quyết định có nên dùng model Pro không
-func shouldUsePro(content string, length int) bool {
+func shouldUsePro(content string, length int, profile *analysisProfile) bool {
 	// Tiêu chí 1: Độ dài nội dung
 	if length > ModelSwitchThreshold {
 		return true
 	}
 	
 	// Tiêu chí 2: Độ phức tạp dựa trên từ khóa pháp lý
-	complexLegalKeywords := []string{
-		"bồi thường", "vi phạm", "tranh chấp", "kiện tụng", "phạt", 
-		"lãi suất", "thế chấp", "bảo lãnh", "trách nhiệm pháp lý",
-		"điều khoản phạt", "force majeure", "bất khả kháng",
-		"quyền sở hữu trí tuệ", "bản quyền", "thương hiệu",
-		"miễn trừ trách nhiệm", "hủy bỏ hợp đồng", "chấm dứt",
-	}
+	complexLegalKeywords := profile.complexKeywords
 	
 	contentLower := strings.ToLower(content)
 	complexKeywordCount := 0
@@ -136,8 +223,8 @@ func shouldUsePro(content string, length int) bool {
 		return true
 	}
 	
-	// Tiêu chí 3: Số lượng điều khoản (đếm "điều", "khoản", "mục")
-	clauseKeywords := []string{"điều ", "khoản ", "mục ", "chương "}
+	// Tiêu chí 3: Số lượng điều khoản (đếm "điều", "khoản", "mục" hoặc "article", "section"...)
+	clauseKeywords := profile.headingKeywords
 	clauseCount := 0
 	
 	for _, keyword := range clauseKeywords {
@@ -155,10 +242,10 @@ func shouldUsePro(content string, length int) bool {
 
 // AnalyzeTextSmart - Wrapper function với tự động chọn model thông minh
 func AnalyzeTextSmart(textContent string) (string, error) {
-	return AnalyzeText(textContent) // Sẽ tự động chọn model qua selectOptimalModel
+	return callText(AnalyzeText(textContent, "", AnalysisOptions{})) // Sẽ tự động chọn model qua selectOptimalModel
 }
 
-// AskContractQuestionSmart - Wrapper function với tự động chọn model thông minh  
+// AskContractQuestionSmart - Wrapper function với tự động chọn model thông minh
 func AskContractQuestionSmart(contractText, question string) (string, error) {
 	return AskContractQuestion(contractText, question) // Sẽ tự động chọn model qua selectOptimalModel
 }
@@ -177,7 +264,7 @@ func AskContractQuestion(contractText, question string, modelName ...string) (st
 	defer client.Close()
 
 	// Smart model selection based on content length
-	chosenModel := selectOptimalModel(contractText)
+	chosenModel := selectOptimalModel(contractText, profileFor("", contractText))
 	if len(modelName) > 0 && modelName[0] != "" {
 		chosenModel = modelName[0]
 	}
@@ -232,13 +319,79 @@ const (
 	ModelSwitchThreshold = 15000 // 15k ký tự
 )
 
+// SupportedModels are the models an analysis can be run with.
+var SupportedModels = []string{GeminiFlash25, GeminiPro25}
+
+// Độ sâu phân tích.
+const (
+	DepthStandard = "standard"
+	// DepthDeep yêu cầu phân tích đầy đủ hơn và mặc định dùng model Pro
+	DepthDeep = "deep"
+)
+
+// AnalysisOptions overrides the defaults of an analysis. The zero value analyses with the
+// model chosen from the content and the standard prompt.
+type AnalysisOptions struct {
+	// Model trống thì chọn theo nội dung (Pro khi Depth là deep)
+	Model string
+	Depth string
+	// Instructions là yêu cầu bổ sung của người dùng, thêm vào prompt
+	Instructions string
+}
+
+// ParseDepth validates an analysis depth; "" means DepthStandard.
+func ParseDepth(s string) (string, error) {
+	switch d := strings.ToLower(strings.TrimSpace(s)); d {
+	case "":
+		return DepthStandard, nil
+	case DepthStandard, DepthDeep:
+		return d, nil
+	default:
+		return "", fmt.Errorf("unknown analysis depth %q", s)
+	}
+}
+
+// IsSupportedModel reports whether name is one of SupportedModels.
+func IsSupportedModel(name string) bool {
+	for _, m := range SupportedModels {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+// guidance là phần thêm vào lời dặn của prompt theo độ sâu và yêu cầu bổ sung; rỗng với tuỳ chọn mặc định.
+func (o AnalysisOptions) guidance() string {
+	var b strings.Builder
+	if o.Depth == DepthDeep {
+		b.WriteString("\n\tPhân tích chuyên sâu: liệt kê đầy đủ các điều khoản về nghĩa vụ, thời hạn, số tiền, phạt vi phạm và chấm dứt; với mỗi rủi ro, nêu mức độ (cao, trung bình, thấp) và đề xuất cách sửa đổi hoặc đàm phán.")
+	}
+	if instructions := strings.TrimSpace(o.Instructions); instructions != "" {
+		b.WriteString("\n\tYêu cầu bổ sung của người dùng (chỉ áp dụng cho nội dung phân tích, không thay đổi cấu trúc JSON): ")
+		b.WriteString(instructions)
+	}
+	return b.String()
+}
+
+// promptVersion ghi nhận các phần đã thêm vào prompt gốc, ví dụ "analyze-text/v2+deep+instructions".
+func (o AnalysisOptions) promptVersion(base string) string {
+	if o.Depth == DepthDeep {
+		base += "+deep"
+	}
+	if strings.TrimSpace(o.Instructions) != "" {
+		base += "+instructions"
+	}
+	return base
+}
+
 // Convenience functions để sử dụng các model cụ thể
 func AnalyzeTextWithFlash25(textContent string) (string, error) {
-	return AnalyzeText(textContent, GeminiFlash25)
+	return callText(AnalyzeText(textContent, "", AnalysisOptions{Model: GeminiFlash25}))
 }
 
 func AnalyzeTextWithPro25(textContent string) (string, error) {
-	return AnalyzeText(textContent, GeminiPro25)
+	return callText(AnalyzeText(textContent, "", AnalysisOptions{Model: GeminiPro25}))
 }
 
 func AskContractQuestionWithFlash25(contractText, question string) (string, error) {
@@ -247,4 +400,28 @@ func AskContractQuestionWithFlash25(contractText, question string) (string, erro
 
 func AskContractQuestionWithPro25(contractText, question string) (string, error) {
 	return AskContractQuestion(contractText, question, GeminiPro25)
-}
\ No newline at end of file
+}
+// CheckGemini reports whether the Gemini API is reachable with the configured key. It reads
+// the model info of the default model, which uses no tokens.
+func CheckGemini(ctx context.Context) error {
+	apiKey := os.Getenv("GEMINI_API_KEY")
+	if apiKey == "" {
+		return fmt.Errorf("GEMINI_API_KEY environment variable is not set")
+	}
+
+	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	if err != nil {
+		return fmt.Errorf("failed to initialize Gemini client: %w", err)
+	}
+	defer client.Close()
+
+	if _, err := client.GenerativeModel(GeminiFlash25).Info(ctx); err != nil {
+		// URL của request chứa API key nên chỉ giữ lỗi bên trong
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("failed to reach Gemini API: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,408 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Giới hạn khi giải nén bộ hồ sơ ZIP, chống zip bomb. Số file và dung lượng từng file nằm
+// trong Limits.
+const (
+	// maxBundleRatio: tỉ lệ giải nén tối đa của một file hoặc entry ZIP (nhỏ hơn 1 MB thì không kiểm tra).
+	maxBundleRatio = 100
+	// bundleHeadLines: số dòng đầu của tài liệu dùng để phân loại.
+	bundleHeadLines = 6
+)
+
+var (
+	// ErrBundleLimit is returned when a ZIP bundle exceeds the file count or size limits.
+	ErrBundleLimit = errors.New("bundle exceeds limits")
+	// ErrEmptyBundle is returned when a ZIP bundle contains no supported document.
+	ErrEmptyBundle = errors.New("bundle contains no supported documents")
+)
+
+// Vai trò của một tài liệu trong bộ hồ sơ.
+const (
+	RoleMain      = "main"      // hợp đồng chính
+	RoleAnnex     = "annex"     // phụ lục
+	RoleSOW       = "sow"       // phạm vi công việc
+	RoleAmendment = "amendment" // văn bản sửa đổi, bổ sung
+)
+
+var roleNames = map[string]string{
+	RoleMain:      "hợp đồng chính",
+	RoleAnnex:     "phụ lục",
+	RoleSOW:       "phạm vi công việc (SOW)",
+	RoleAmendment: "sửa đổi, bổ sung",
+}
+
+var (
+	// Các mẫu phân loại chạy trên text đã bỏ dấu, viết thường.
+	// Tên file thường viết liền ("PhuLuc01", "HopDong.pdf").
+	amendmentRe = regexp.MustCompile(`\b(sua ?doi|bo sung hop dong|amendment|addendum)`)
+	sowRe       = regexp.MustCompile(`\b(statement of work|sow|pham vi cong viec|mo ta cong viec)\b`)
+	annexRe     = regexp.MustCompile(`\b(phu ?luc|annex|appendix|schedule|exhibit)`)
+	mainRe      = regexp.MustCompile(`\b(hop ?dong|agreement|contract)`)
+	// "Phụ lục số 01", "Annex A", "Appendix II"
+	annexLabelRe = regexp.MustCompile(`\b(phu ?luc|annex|appendix|schedule|exhibit)\s*(?:so\s*)?(?:[:.\-]\s*)?([0-9]+|[a-z]|[ivx]+)\b`)
+	// "Điều 5.2", "Article 3" trong text đã bỏ dấu của phụ lục
+	articleMentionRe = regexp.MustCompile(`\b(dieu|article|section)\s+([0-9]+(?:\.[0-9]+)*)`)
+)
+
+// BundleDocument is one file of a ZIP contract bundle.
+type BundleDocument struct {
+	Name string
+	Role string
+	// Label là số hiệu phụ lục đọc được từ tiêu đề, ví dụ "Phụ lục 01", "Annex A".
+	Label  string
+	Size   int64
+	Hash   string
+	Result *ExtractionResult
+}
+
+// Bundle is a main contract with its annexes, SOWs and amendments.
+type Bundle struct {
+	Documents []*BundleDocument
+	Warnings  []string
+}
+
+// ExtractBundle extracts every supported document of a ZIP archive through the extractor
+// registry and classifies it as the main contract, an annex, a SOW or an amendment.
+// The main contract is always Documents[0].
+func ExtractBundle(r io.ReaderAt, size int64, opts ExtractOptions) (*Bundle, error) {
+	bundle := &Bundle{}
+	err := readBundleEntries(r, size, opts.Limits.withDefaults(), func(name string, e Extractor, data []byte) error {
+		return bundle.add(name, e, data, opts)
+	}, &bundle.Warnings)
+	if err != nil {
+		return nil, err
+	}
+	if len(bundle.Documents) == 0 {
+		return nil, ErrEmptyBundle
+	}
+	bundle.pickMain()
+	return bundle, nil
+}
+
+// add trích xuất một file và thêm vào bộ hồ sơ; vai trò được phân loại sơ bộ, hợp đồng
+// chính chỉ được chọn trong pickMain sau khi đã có đủ các file.
+func (b *Bundle) add(name string, e Extractor, data []byte, opts ExtractOptions) error {
+	result, err := e.Extract(bytes.NewReader(data), int64(len(data)), opts)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	sum := sha256.Sum256(data)
+	doc := &BundleDocument{Name: name, Size: int64(len(data)), Hash: hex.EncodeToString(sum[:]), Result: result}
+	doc.Role, doc.Label = classifyDocument(name, result.Text)
+	for _, w := range result.Warnings {
+		b.Warnings = append(b.Warnings, name+": "+w)
+	}
+	b.Documents = append(b.Documents, doc)
+	return nil
+}
+
+// VerifyBundlePasswords checks password against every encrypted PDF inside a ZIP bundle.
+func VerifyBundlePasswords(r io.ReaderAt, size int64, password string) error {
+	var skipped []string
+	return readBundleEntries(r, size, DefaultLimits(), func(name string, e Extractor, data []byte) error {
+		if e.Name() != "pdf" {
+			return nil
+		}
+		pdfReader := bytes.NewReader(data)
+		if !IsEncryptedPDF(pdfReader, pdfReader.Size()) {
+			return nil
+		}
+		if err := VerifyPDFPassword(pdfReader, pdfReader.Size(), password); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	}, &skipped)
+}
+
+// readBundleEntries giải nén từng file được hỗ trợ trong ZIP, kiểm tra giới hạn số file,
+// kích thước và tỉ lệ nén trước khi gọi fn. File bị bỏ qua được ghi vào warnings.
+func readBundleEntries(r io.ReaderAt, size int64, limits Limits, fn func(name string, e Extractor, data []byte) error, warnings *[]string) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("failed to open ZIP archive: %w", err)
+	}
+	if len(zr.File) > limits.MaxArchiveEntries {
+		return &LimitError{Subject: "ZIP bundle", Limit: "archive entries", Max: int64(limits.MaxArchiveEntries)}
+	}
+
+	count := 0
+	var total int64
+	for _, f := range zr.File {
+		name := validBundleName(f.Name)
+		base := path.Base(name)
+		if f.FileInfo().IsDir() || strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(base, ".") {
+			continue
+		}
+		e := FindExtractor(base, "")
+		if e == nil {
+			*warnings = append(*warnings, fmt.Sprintf("Bỏ qua file không được hỗ trợ trong bộ hồ sơ: %s", name))
+			continue
+		}
+		if count++; count > limits.MaxBundleFiles {
+			return fmt.Errorf("%w: more than %d documents", ErrBundleLimit, limits.MaxBundleFiles)
+		}
+		if f.UncompressedSize64 > uint64(limits.MaxBundleFileBytes) {
+			return fmt.Errorf("%w: %s is larger than %d MB", ErrBundleLimit, name, limits.MaxBundleFileBytes>>20)
+		}
+		if f.UncompressedSize64 > 1<<20 && f.UncompressedSize64 > maxBundleRatio*f.CompressedSize64 {
+			return fmt.Errorf("%w: %s has a suspicious compression ratio", ErrBundleLimit, name)
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open %s in ZIP archive: %w", name, err)
+		}
+		// Không tin kích thước khai báo trong header: đọc tối đa giới hạn + 1 byte
+		data, err := io.ReadAll(io.LimitReader(rc, limits.MaxBundleFileBytes+1))
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s in ZIP archive: %w", name, err)
+		}
+		if int64(len(data)) > limits.MaxBundleFileBytes {
+			return fmt.Errorf("%w: %s is larger than %d MB", ErrBundleLimit, name, limits.MaxBundleFileBytes>>20)
+		}
+		if total += int64(len(data)); total > limits.MaxExpandedBytes {
+			return fmt.Errorf("%w: total uncompressed size is larger than %d MB", ErrBundleLimit, limits.MaxExpandedBytes>>20)
+		}
+		if isLegacyWord(e, data) {
+			count--
+			*warnings = append(*warnings, fmt.Sprintf("Bỏ qua file Word định dạng cũ (.doc) trong bộ hồ sơ, hãy lưu lại dưới dạng .docx: %s", name))
+			continue
+		}
+		if err := fn(name, e, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isLegacyWord cho biết file được nhận là DOCX thực ra là file Word nhị phân (.doc) cũ,
+// định dạng không được hỗ trợ. File DOCX luôn là một container ZIP.
+func isLegacyWord(e Extractor, data []byte) bool {
+	return e.Name() == "docx" && !bytes.HasPrefix(data, []byte("PK\x03\x04"))
+}
+
+// classifyDocument phân loại tài liệu theo tên file và vài dòng đầu (tiêu đề).
+func classifyDocument(name, text string) (role, label string) {
+	head := foldDiacritics(strings.ToLower(path.Base(name) + "\n" + titleLines(text, bundleHeadLines)))
+	head = strings.NewReplacer("_", " ", "-", " ").Replace(head)
+
+	// Số hiệu phụ lục chỉ lấy từ tên file và tiêu đề, không lấy từ câu dẫn chiếu trong nội dung
+	title := foldDiacritics(strings.ToLower(path.Base(name) + "\n" + titleLines(text, 2)))
+	title = strings.NewReplacer("_", " ", "-", " ").Replace(title)
+	if m := annexLabelRe.FindStringSubmatch(title); m != nil {
+		label = annexLabelWord(m[1]) + " " + strings.ToUpper(m[2])
+	}
+	switch {
+	case amendmentRe.MatchString(head):
+		return RoleAmendment, label
+	case sowRe.MatchString(head):
+		return RoleSOW, label
+	case annexRe.MatchString(head):
+		return RoleAnnex, label
+	case mainRe.MatchString(head):
+		return RoleMain, label
+	}
+	return "", label
+}
+
+func annexLabelWord(folded string) string {
+	if strings.HasPrefix(folded, "phu") {
+		return "Phụ lục"
+	}
+	return strings.ToUpper(folded[:1]) + folded[1:]
+}
+
+// pickMain chọn hợp đồng chính (tài liệu "hợp đồng" dài nhất, hoặc tài liệu văn bản dài nhất
+// nếu không có) và đưa lên đầu; các tài liệu chưa phân loại được coi là phụ lục.
+func (b *Bundle) pickMain() {
+	best := -1
+	for i, d := range b.Documents {
+		if d.Role != RoleMain {
+			continue
+		}
+		if best < 0 || len(d.Result.Text) > len(b.Documents[best].Result.Text) {
+			best = i
+		}
+	}
+	if best < 0 {
+		// Bảng tính (bảng giá, lịch thanh toán) chỉ là hợp đồng chính khi bộ hồ sơ không có văn bản nào khác
+		isTable := func(d *BundleDocument) bool { return len(d.Result.Tables) > 0 }
+		for i, d := range b.Documents {
+			switch {
+			case best < 0:
+				best = i
+			case isTable(d) != isTable(b.Documents[best]):
+				if !isTable(d) {
+					best = i
+				}
+			case len(d.Result.Text) > len(b.Documents[best].Result.Text):
+				best = i
+			}
+		}
+	}
+	for i, d := range b.Documents {
+		if i == best {
+			d.Role, d.Label = RoleMain, ""
+		} else if d.Role == "" || d.Role == RoleMain {
+			d.Role = RoleAnnex
+		}
+	}
+	main := b.Documents[best]
+	b.Documents = append(b.Documents[:best], b.Documents[best+1:]...)
+	b.Documents = append([]*BundleDocument{main}, b.Documents...)
+}
+
+// Main returns the main contract of the bundle.
+func (b *Bundle) Main() *BundleDocument {
+	return b.Documents[0]
+}
+
+// Text joins all documents, each preceded by a "=== Tài liệu N: name (role) ===" header.
+func (b *Bundle) Text() string {
+	var sb strings.Builder
+	for i, d := range b.Documents {
+		if i > 0 {
+			sb.WriteString(pageSeparator)
+		}
+		title := d.Name
+		if d.Label != "" {
+			title = d.Label + " - " + d.Name
+		}
+		fmt.Fprintf(&sb, "=== Tài liệu %d: %s (%s) ===\n", i+1, title, roleNames[d.Role])
+		sb.WriteString(d.Result.TextWithPageMarkers())
+	}
+	return sb.String()
+}
+
+// CrossReferences finds explicit references between the main contract and the other
+// documents: mentions of an annex label in the main contract, and mentions of an existing
+// article of the main contract inside an annex.
+func (b *Bundle) CrossReferences() []string {
+	main := b.Main()
+	clauses := main.Result.ClauseStructure()
+	mainText, offsets := foldWithOffsets(main.Result.Text, true)
+	seen := map[string]bool{}
+	var refs []string
+	add := func(s string) {
+		if !seen[s] {
+			seen[s] = true
+			refs = append(refs, s)
+		}
+	}
+
+	for _, d := range b.Documents[1:] {
+		if m := annexLabelRe.FindStringSubmatch(foldDiacritics(strings.ToLower(d.Label))); m != nil {
+			number := strings.TrimLeft(m[2], "0")
+			pattern := `\b(phu ?luc|annex|appendix|schedule|exhibit)\s*(so\s*)?0*` + regexp.QuoteMeta(number) + `\b`
+			for _, loc := range regexp.MustCompile(pattern).FindAllStringIndex(mainText, -1) {
+				where := "Hợp đồng chính"
+				if c := ClauseAt(clauses, offsets[loc[0]]); c != nil {
+					where = c.Ref + " của hợp đồng chính"
+				}
+				add(fmt.Sprintf("%s dẫn chiếu %s (%s)", where, d.Label, d.Name))
+			}
+		}
+
+		name := d.Name
+		if d.Label != "" {
+			name = d.Label + " (" + d.Name + ")"
+		}
+		for _, m := range articleMentionRe.FindAllStringSubmatch(foldDiacritics(strings.ToLower(d.Result.Text)), -1) {
+			for _, prefix := range []string{"Điều", "Article", "Section"} {
+				if c := FindClause(clauses, prefix+" "+m[2]); c != nil {
+					add(fmt.Sprintf("%s dẫn chiếu %s của hợp đồng chính", name, c.Ref))
+					break
+				}
+			}
+		}
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// titleLines trả về n dòng không rỗng đầu tiên của text, bỏ qua các dòng căn cứ pháp lý
+// ("Căn cứ Bộ luật Dân sự... sửa đổi, bổ sung") vốn không nói gì về loại tài liệu.
+func titleLines(text string, n int) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		lower := strings.ToLower(line)
+		if strings.HasPrefix(lower, "căn cứ") || strings.HasPrefix(lower, "pursuant") {
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+			if len(lines) == n {
+				break
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// foldDiacritics bỏ dấu tiếng Việt ("Phụ lục" → "Phu luc") để so khớp với tên file không dấu.
+func foldDiacritics(s string) string {
+	folded, _ := foldWithOffsets(s, false)
+	return folded
+}
+
+// foldWithOffsets bỏ dấu như foldDiacritics, chuyển sang chữ thường nếu lower, và trả về vị
+// trí byte trong s của từng byte kết quả, để kết quả so khớp trên text đã bỏ dấu có thể quy
+// về text gốc. Chữ thường được chuyển ở đây vì một số chữ hoa và chữ thường dài khác nhau
+// ("Ⱥ" 2 byte, "ⱥ" 3 byte).
+func foldWithOffsets(s string, lower bool) (string, []int) {
+	var sb strings.Builder
+	offsets := make([]int, 0, len(s)+1)
+	for i, r := range s {
+		for _, d := range norm.NFD.String(string(r)) {
+			if unicode.Is(unicode.Mn, d) {
+				continue
+			}
+			if lower {
+				d = unicode.ToLower(d)
+			}
+			switch d {
+			case 'đ':
+				d = 'd'
+			case 'Đ':
+				d = 'D'
+			}
+			n := sb.Len()
+			sb.WriteRune(d)
+			for ; n < sb.Len(); n++ {
+				offsets = append(offsets, i)
+			}
+		}
+	}
+	offsets = append(offsets, len(s))
+	return sb.String(), offsets
+}
+
+// validBundleName trả về tên file trong ZIP ở dạng UTF-8 hợp lệ để lưu vào database.
+func validBundleName(name string) string {
+	if utf8.ValidString(name) {
+		return name
+	}
+	log.Printf("Warning: ZIP entry name is not valid UTF-8: %q", name)
+	return strings.ToValidUTF8(name, "?")
+}
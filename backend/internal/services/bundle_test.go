@@ -0,0 +1,101 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadBundleEntriesSkipsLegacyWord(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range []struct {
+		name string
+		data []byte
+	}{
+		{"hop-dong.pdf", []byte("%PDF-1.7\n")},
+		// File .doc nhị phân bắt đầu bằng chữ ký OLE, không phải ZIP
+		{"phu-luc-01.doc", []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}},
+		// File DOCX bị đặt tên .doc vẫn được đọc
+		{"phu-luc-02.doc", []byte("PK\x03\x04")},
+	} {
+		w, err := zw.Create(entry.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(entry.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var read, warnings []string
+	err := readBundleEntries(bytes.NewReader(buf.Bytes()), int64(buf.Len()), Limits{}.withDefaults(), func(name string, e Extractor, data []byte) error {
+		read = append(read, name+" "+e.Name())
+		return nil
+	}, &warnings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"hop-dong.pdf pdf", "phu-luc-02.doc docx"}; !reflect.DeepEqual(read, want) {
+		t.Errorf("read %v, want %v", read, want)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "phu-luc-01.doc") {
+		t.Errorf("warnings = %v, want one warning for phu-luc-01.doc", warnings)
+	}
+}
+
+func TestReadBundleEntriesLimits(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"hop-dong.pdf", "phu-luc-01.pdf"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte("%PDF-1.7\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, limits := range []Limits{{MaxBundleFiles: 1}, {MaxBundleFileBytes: 4}} {
+		var warnings []string
+		err := readBundleEntries(bytes.NewReader(buf.Bytes()), int64(buf.Len()), limits.withDefaults(), func(string, Extractor, []byte) error {
+			return nil
+		}, &warnings)
+		if !errors.Is(err, ErrBundleLimit) {
+			t.Errorf("limits %+v: err = %v, want ErrBundleLimit", limits, err)
+		}
+	}
+}
+
+func TestCrossReferencesCaseFoldOffsets(t *testing.T) {
+	// "Ⱥ" dài 2 byte còn "ⱥ" dài 3 byte nên vị trí trên text chữ thường lệch với text gốc
+	tests := []struct {
+		main string
+		want string
+	}{
+		{strings.Repeat("Ⱥ", 20) + " Phụ lục 1", "Hợp đồng chính dẫn chiếu Phụ lục 1 (phu-luc-1.pdf)"},
+		{
+			"Điều 1. Phạm vi\n" + strings.Repeat("Ⱥ", 20) + " theo Phụ lục 1 đính kèm.\nĐiều 2. Giá\nThanh toán một lần.\n",
+			"Điều 1 của hợp đồng chính dẫn chiếu Phụ lục 1 (phu-luc-1.pdf)",
+		},
+	}
+	for _, tt := range tests {
+		b := &Bundle{Documents: []*BundleDocument{
+			{Name: "hop-dong.pdf", Role: RoleMain, Result: &ExtractionResult{Text: tt.main}},
+			{Name: "phu-luc-1.pdf", Role: RoleAnnex, Label: "Phụ lục 1", Result: &ExtractionResult{Text: "Danh mục hàng hoá"}},
+		}}
+		if got := b.CrossReferences(); !reflect.DeepEqual(got, []string{tt.want}) {
+			t.Errorf("CrossReferences() = %v, want [%s]", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package services
+
+import "strings"
+
+// ContractTypes are the contract types an analysis classifies a contract as.
+var ContractTypes = []string{"sale", "service", "lease", "employment", "loan", "nda", "partnership", "construction", "other"}
+
+// Mức rủi ro tổng thể của hợp đồng.
+const (
+	RiskLow    = "low"
+	RiskMedium = "medium"
+	RiskHigh   = "high"
+)
+
+// classificationFields là các trường phân loại thêm vào cấu trúc JSON của mọi prompt phân tích.
+var classificationFields = `"contract_type": "Loại hợp đồng, chỉ một trong các giá trị: ` + strings.Join(ContractTypes, ", ") + `",
+		"parties": ["Tên các bên ký kết hợp đồng, ghi đúng như trong văn bản"],
+		"risk_level": "Mức độ rủi ro tổng thể đối với bên được tư vấn: high, medium hoặc low"`
+
+// NormalizeContractType trả về loại hợp đồng trong ContractTypes; giá trị lạ thành "other".
+func NormalizeContractType(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return ""
+	}
+	for _, t := range ContractTypes {
+		if t == s {
+			return s
+		}
+	}
+	return "other"
+}
+
+// RiskSeverity converts a risk level to a number for filtering and sorting: 0 unknown,
+// 1 low, 2 medium, 3 high.
+func RiskSeverity(level string) int {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case RiskLow:
+		return 1
+	case RiskMedium:
+		return 2
+	case RiskHigh:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// RiskLevel is the inverse of RiskSeverity; "" for an unknown severity.
+func RiskLevel(severity int) string {
+	switch severity {
+	case 1:
+		return RiskLow
+	case 2:
+		return RiskMedium
+	case 3:
+		return RiskHigh
+	default:
+		return ""
+	}
+}
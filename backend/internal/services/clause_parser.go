@@ -0,0 +1,350 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Các cấp của cây điều khoản, từ ngoài vào trong.
+const (
+	ClauseKindChapter = "chapter" // Phần, Chương / Part, Chapter
+	ClauseKindSection = "section" // Mục
+	ClauseKindArticle = "article" // Điều / Article (Section khi văn bản không có Article)
+	ClauseKindClause  = "clause"  // Khoản, 5.2 / Section, Clause
+	ClauseKindPoint   = "point"   // Điểm, a) / (a)
+)
+
+var clauseKindLevel = map[string]int{
+	ClauseKindChapter: 0,
+	ClauseKindSection: 1,
+	ClauseKindArticle: 2,
+	ClauseKindClause:  3,
+	ClauseKindPoint:   4,
+}
+
+const (
+	// maxClauseTitleRunes: phần sau số hiệu dài hơn ngưỡng này là nội dung chứ không phải tiêu đề.
+	maxClauseTitleRunes = 120
+)
+
+var (
+	// "Điều 5. Thanh toán", "CHƯƠNG II - ...", "Article 3: ...", "Section 5.2 Invoicing"
+	clauseKeywordRe = regexp.MustCompile(`^(?i)(phần|chương|mục|điều|khoản|điểm|part|chapter|article|section|clause)\s+([0-9]+(?:\.[0-9]+)*|[ivxlcdm]+|[a-zđ])(\s*[.:)\-–—]+\s*|\s+|$)(.*)$`)
+	clauseArticleRe = regexp.MustCompile(`(?im)^\s*(điều|article)\s+([0-9]+|[ivxlcdm]+)\s*[.:\-–—]`)
+	// "1. ...", "5.2. ...", "5.2.1 ..."
+	clauseNumberRe = regexp.MustCompile(`^([0-9]{1,3}(?:\.[0-9]{1,2})*)(\s*[.)]\s*|\s+)(\S.*)$`)
+	// "a) ...", "(b) ...", "c. ..."
+	clausePointRe = regexp.MustCompile(`^\(?([a-zđ])[.)]\s+(\S.*)$`)
+)
+
+// clauseRules là quy tắc nhận diện tiêu đề điều khoản theo ngôn ngữ của văn bản.
+type clauseRules struct {
+	// keywords là các từ khoá tiêu đề được nhận diện; nil thì nhận cả tiếng Việt và tiếng Anh
+	keywords map[string]bool
+	// labels là ngôn ngữ của nhãn mặc định trong số hiệu trích dẫn ("1." → "Điều 1" hay "Section 1");
+	// rỗng thì theo đa số tiêu đề có từ khoá trong văn bản
+	labels string
+}
+
+func (r clauseRules) allows(label string) bool {
+	return r.keywords == nil || r.keywords[clauseKeyword(label)]
+}
+
+// hasLabelledArticles cho biết văn bản có tiêu đề "Điều N"/"Article N" được nhận diện hay không.
+func (r clauseRules) hasLabelledArticles(text string) bool {
+	for _, m := range clauseArticleRe.FindAllStringSubmatch(text, -1) {
+		if r.allows(m[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClauseNode is one heading of the contract structure (chapter, article, clause or point)
+// together with the span of text it covers.
+type ClauseNode struct {
+	Kind string `json:"kind"`
+	// Label là từ khoá như trong văn bản ("Điều", "Article"...), rỗng với dòng chỉ đánh số "1.", "a)".
+	Label  string `json:"label,omitempty"`
+	Number string `json:"number"`
+	// Ref là số hiệu đầy đủ để trích dẫn, ví dụ "Điều 5.2", "Điều 5.2.a", "Section 3.1(a)".
+	Ref   string `json:"ref"`
+	Title string `json:"title,omitempty"`
+	// Text là nội dung riêng của nút, từ dòng tiêu đề đến nút con đầu tiên.
+	Text string `json:"text"`
+	// Start/End là khoảng byte [Start, End) của nút (gồm cả các nút con) trong text đã phân tích.
+	Start    int           `json:"start"`
+	End      int           `json:"end"`
+	Page     int           `json:"page,omitempty"`
+	Children []*ClauseNode `json:"children,omitempty"`
+
+	level   int
+	english bool
+}
+
+// ParseClauses segments contract text into a tree of chapters, articles, clauses and points.
+// Vietnamese (Chương → Điều → Khoản → Điểm) and English (Article → Section → Clause)
+// headings are recognised according to the detected language of the text, as well as
+// outline numbering such as "5.2." and "a)". Bilingual text accepts both.
+func ParseClauses(text string) []*ClauseNode {
+	return parseClauses(text, profileFor("", text).clauses)
+}
+
+func parseClauses(text string, rules clauseRules) []*ClauseNode {
+	var roots, stack []*ClauseNode
+	english := 0
+	// Văn bản có "Điều"/"Article" thì các dòng "1.", "2." ngoài mọi điều (ví dụ phần
+	// thông tin các bên) không phải là điều
+	labelledArticles := rules.hasLabelledArticles(text)
+
+	offset := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		start := offset
+		offset += len(line)
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		node := parseClauseHeading(trimmed, stack, labelledArticles, rules)
+		if node == nil {
+			continue
+		}
+		if node.english {
+			english++
+		} else if node.Label != "" {
+			english--
+		}
+		node.Start = start + strings.Index(line, trimmed)
+
+		for len(stack) > 0 && stack[len(stack)-1].level >= node.level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, node)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, node)
+		}
+		stack = append(stack, node)
+	}
+
+	switch rules.labels {
+	case LanguageEnglish:
+		english = 1
+	case LanguageVietnamese:
+		english = 0
+	}
+	finishClauses(roots, text, len(text), "", english > 0)
+	return roots
+}
+
+// parseClauseHeading nhận diện một dòng là tiêu đề điều khoản và xác định cấp của nó
+// dựa trên các nút đang mở (stack) và quy tắc của ngôn ngữ văn bản.
+// Trả về nil nếu dòng chỉ là nội dung thường.
+func parseClauseHeading(line string, stack []*ClauseNode, labelledArticles bool, rules clauseRules) *ClauseNode {
+	if m := clauseKeywordRe.FindStringSubmatch(line); m != nil {
+		label, number, sep, rest := m[1], m[2], m[3], strings.TrimSpace(m[4])
+		// Từ khoá của ngôn ngữ khác (ví dụ "Section" trong hợp đồng tiếng Việt) là nội dung thường
+		if !rules.allows(label) {
+			return nil
+		}
+		// "Điều 5 của Hợp đồng này..." là câu tham chiếu, không phải tiêu đề
+		if strings.TrimSpace(sep) == "" && rest != "" && !startsUpper(rest) {
+			return nil
+		}
+		node := &ClauseNode{Label: label, Number: number}
+		switch clauseKeyword(label) {
+		case "phần", "chương", "part", "chapter":
+			node.Kind = ClauseKindChapter
+		case "mục":
+			node.Kind = ClauseKindSection
+		case "điều", "article":
+			node.Kind = ClauseKindArticle
+		case "khoản":
+			node.Kind = ClauseKindClause
+		case "clause":
+			// Clause nằm trong một Section (đóng vai trò khoản) là điểm
+			node.Kind = ClauseKindClause
+			if c := openClause(stack, ClauseKindClause); c != nil && strings.EqualFold(c.Label, "section") {
+				node.Kind = ClauseKindPoint
+			}
+		case "điểm":
+			node.Kind = ClauseKindPoint
+		case "section":
+			// Section nằm trong Article là khoản; văn bản không có Article thì Section là điều
+			node.Kind = ClauseKindArticle
+			if article := openClause(stack, ClauseKindArticle); article != nil && article.Label != "" {
+				node.Kind = ClauseKindClause
+			}
+		}
+		node.english = clauseKeywordIsEnglish(label)
+		node.level = clauseKindLevel[node.Kind]
+		node.Title = clauseTitle(rest)
+		return node
+	}
+
+	if m := clauseNumberRe.FindStringSubmatch(line); m != nil {
+		number, sep := m[1], strings.TrimSpace(m[2])
+		depth := strings.Count(number, ".") + 1
+		// "100 triệu đồng" hay "2024 ..." không phải số mục
+		if depth == 1 && sep == "" {
+			return nil
+		}
+		node := &ClauseNode{Number: number, Title: clauseTitle(m[3])}
+		article := openClause(stack, ClauseKindArticle)
+		if article == nil && labelledArticles {
+			return nil
+		}
+		switch {
+		case depth == 1 && (article == nil || article.Label == ""):
+			node.Kind = ClauseKindArticle
+		case depth == 1 || depth == 2:
+			node.Kind = ClauseKindClause
+		default:
+			node.Kind = ClauseKindPoint
+		}
+		node.level = clauseKindLevel[node.Kind]
+		return node
+	}
+
+	if m := clausePointRe.FindStringSubmatch(line); m != nil {
+		return &ClauseNode{Kind: ClauseKindPoint, Number: m[1], Title: clauseTitle(m[2]), level: clauseKindLevel[ClauseKindPoint]}
+	}
+	return nil
+}
+
+// openClause trả về nút gần nhất thuộc loại kind trong các nút đang mở.
+func openClause(stack []*ClauseNode, kind string) *ClauseNode {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].Kind == kind {
+			return stack[i]
+		}
+	}
+	return nil
+}
+
+// clauseTitle giữ phần sau số hiệu làm tiêu đề nếu nó ngắn và không phải một câu hoàn chỉnh.
+func clauseTitle(rest string) string {
+	rest = strings.TrimSpace(rest)
+	if rest == "" || utf8.RuneCountInString(rest) > maxClauseTitleRunes || strings.ContainsAny(rest[len(rest)-1:], ".;:,") {
+		return ""
+	}
+	return rest
+}
+
+func clauseKeyword(label string) string {
+	return strings.ToLower(label)
+}
+
+func clauseKeywordIsEnglish(label string) bool {
+	switch clauseKeyword(label) {
+	case "part", "chapter", "article", "section", "clause":
+		return true
+	}
+	return false
+}
+
+func startsUpper(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsUpper(r) || unicode.IsDigit(r)
+}
+
+// finishClauses tính End, Text và Ref cho các nút sau khi đã dựng xong cây.
+func finishClauses(nodes []*ClauseNode, text string, end int, parentRef string, english bool) {
+	for i, n := range nodes {
+		n.End = end
+		if i+1 < len(nodes) {
+			n.End = nodes[i+1].Start
+		}
+		ownEnd := n.End
+		if len(n.Children) > 0 {
+			ownEnd = n.Children[0].Start
+		}
+		n.Text = strings.TrimSpace(text[n.Start:ownEnd])
+		n.Ref = clauseRef(n, parentRef, english)
+		finishClauses(n.Children, text, n.End, n.Ref, english)
+	}
+}
+
+// clauseRef dựng số hiệu trích dẫn: khoản và điểm được ghép vào số hiệu của điều chứa nó.
+func clauseRef(n *ClauseNode, parentRef string, english bool) string {
+	// "Section 2.1" đã là số hiệu đầy đủ
+	dotted := n.Label != "" && strings.Contains(n.Number, ".")
+	if n.Kind == ClauseKindChapter || n.Kind == ClauseKindSection || n.Kind == ClauseKindArticle || parentRef == "" || dotted {
+		label := defaultClauseLabel(n.Kind, english)
+		if n.Label != "" {
+			// "ĐIỀU", "điều" → "Điều"
+			keyword := clauseKeyword(n.Label)
+			r, size := utf8.DecodeRuneInString(keyword)
+			label = string(unicode.ToUpper(r)) + keyword[size:]
+		}
+		return label + " " + strings.ToUpper(n.Number)
+	}
+
+	// "5.2" trong Điều 5 chỉ lấy phần cuối
+	local := n.Number
+	if i := strings.LastIndex(local, "."); i >= 0 {
+		local = local[i+1:]
+	}
+	if unicode.IsLetter([]rune(local)[0]) && english {
+		return parentRef + "(" + local + ")"
+	}
+	return parentRef + "." + local
+}
+
+func defaultClauseLabel(kind string, english bool) string {
+	labels := map[string][2]string{
+		ClauseKindChapter: {"Chương", "Chapter"},
+		ClauseKindSection: {"Mục", "Section"},
+		ClauseKindArticle: {"Điều", "Section"},
+		ClauseKindClause:  {"Khoản", "Clause"},
+		ClauseKindPoint:   {"Điểm", "Clause"},
+	}
+	if english {
+		return labels[kind][1]
+	}
+	return labels[kind][0]
+}
+
+// FindClause returns the node whose Ref matches ref (case-insensitive), or nil.
+func FindClause(nodes []*ClauseNode, ref string) *ClauseNode {
+	ref = strings.TrimSpace(ref)
+	for _, n := range nodes {
+		if strings.EqualFold(n.Ref, ref) {
+			return n
+		}
+		if found := FindClause(n.Children, ref); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// ClauseAt returns the innermost node whose span contains offset, or nil.
+func ClauseAt(nodes []*ClauseNode, offset int) *ClauseNode {
+	for _, n := range nodes {
+		if offset >= n.Start && offset < n.End {
+			if inner := ClauseAt(n.Children, offset); inner != nil {
+				return inner
+			}
+			return n
+		}
+	}
+	return nil
+}
+
+// ClauseStructure parses the clause tree of the extracted text and records the page of every node.
+func (r *ExtractionResult) ClauseStructure() []*ClauseNode {
+	nodes := ParseClauses(r.Text)
+	var assign func([]*ClauseNode)
+	assign = func(nodes []*ClauseNode) {
+		for _, n := range nodes {
+			n.Page = r.PageForOffset(n.Start)
+			assign(n.Children)
+		}
+	}
+	assign(nodes)
+	return nodes
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseClauseHeading(t *testing.T) {
+	tests := []struct {
+		line string
+		// kind rỗng: dòng là nội dung thường, không phải tiêu đề
+		kind, number, title string
+	}{
+		{"Điều 1. Định nghĩa", ClauseKindArticle, "1", "Định nghĩa"},
+		{"ĐIỀU 12: THANH TOÁN", ClauseKindArticle, "12", "THANH TOÁN"},
+		{"Điều 1.", ClauseKindArticle, "1", ""},
+		{"CHƯƠNG II", ClauseKindChapter, "II", ""},
+		{"Mục 3 - Nghĩa vụ các bên", ClauseKindSection, "3", "Nghĩa vụ các bên"},
+		{"Khoản 3. Phạt vi phạm", ClauseKindClause, "3", "Phạt vi phạm"},
+		{"Điểm đ) Trường hợp bất khả kháng", ClauseKindPoint, "đ", "Trường hợp bất khả kháng"},
+		{"Article 2", ClauseKindArticle, "2", ""},
+		{"Article IV - Term", ClauseKindArticle, "IV", "Term"},
+		{"Section 5.2 Invoicing", ClauseKindArticle, "5.2", "Invoicing"},
+		{"1. Định nghĩa", ClauseKindArticle, "1", "Định nghĩa"},
+		{"1.1 Phạm vi công việc", ClauseKindClause, "1.1", "Phạm vi công việc"},
+		{"5.2. Thời hạn thanh toán", ClauseKindClause, "5.2", "Thời hạn thanh toán"},
+		{"2.1.3 Chi tiết kỹ thuật", ClauseKindPoint, "2.1.3", "Chi tiết kỹ thuật"},
+		{"a) Cài đặt hệ thống;", ClauseKindPoint, "a", ""},
+		{"(b) Late payments", ClauseKindPoint, "b", "Late payments"},
+
+		// Câu tham chiếu và nội dung thường bắt đầu bằng từ khoá hoặc con số
+		{"Điều 5 của Hợp đồng này được áp dụng cho mọi phụ lục.", "", "", ""},
+		{"Article 3 of this Agreement survives termination.", "", "", ""},
+		{"Theo Điều 5, Bên B phải thanh toán.", "", "", ""},
+		{"100 triệu đồng", "", "", ""},
+		{"2024 là năm ký kết hợp đồng", "", "", ""},
+		{"Mục tiêu", "", "", ""},
+		{"Mục tiêu của hợp đồng là hợp tác lâu dài.", "", "", ""},
+		{"Điều kiện thanh toán", "", "", ""},
+		{"Phần mềm được cài đặt tại trụ sở Bên A.", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			node := parseClauseHeading(tt.line, nil, false, clauseRules{})
+			if tt.kind == "" {
+				if node != nil {
+					t.Fatalf("got %s %q, want no heading", node.Kind, node.Number)
+				}
+				return
+			}
+			if node == nil {
+				t.Fatal("got no heading")
+			}
+			if node.Kind != tt.kind || node.Number != tt.number || node.Title != tt.title {
+				t.Errorf("got %s %q %q, want %s %q %q", node.Kind, node.Number, node.Title, tt.kind, tt.number, tt.title)
+			}
+		})
+	}
+}
+
+func TestParseClauseHeadingLanguageRules(t *testing.T) {
+	vi := profileFor(LanguageVietnamese, "").clauses
+	en := profileFor(LanguageEnglish, "").clauses
+	tests := []struct {
+		line  string
+		rules clauseRules
+		want  bool
+	}{
+		{"Điều 1. Định nghĩa", vi, true},
+		{"Section 2 Thanh toán", vi, false},
+		{"Article 2 Payment", en, true},
+		{"Điều 2 Thanh toán", en, false},
+	}
+	for _, tt := range tests {
+		if got := parseClauseHeading(tt.line, nil, false, tt.rules) != nil; got != tt.want {
+			t.Errorf("%q with %s rules: heading = %v, want %v", tt.line, tt.rules.labels, got, tt.want)
+		}
+	}
+}
+
+// clauseOutline liệt kê cây điều khoản theo thứ tự duyệt, mỗi nút một dòng "kind ref".
+func clauseOutline(nodes []*ClauseNode) []string {
+	var out []string
+	for _, n := range nodes {
+		out = append(out, n.Kind+" "+n.Ref)
+		out = append(out, clauseOutline(n.Children)...)
+	}
+	return out
+}
+
+func TestParseClauses(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "vietnamese",
+			text: `HỢP ĐỒNG CUNG CẤP DỊCH VỤ
+1. Bên A: Công ty TNHH Minh Phát
+2. Bên B: Công ty Cổ phần An Bình
+Điều 1. Phạm vi công việc
+1.1 Bên B cung cấp và cài đặt phần mềm quản lý cho Bên A.
+a) Cài đặt hệ thống;
+b) Đào tạo người dùng.
+1.2 Thời hạn thực hiện là 30 ngày kể từ ngày ký.
+Điều 2. Giá trị hợp đồng
+Tổng giá trị hợp đồng là
+100 triệu đồng
+Điều 5 của Hợp đồng này được áp dụng cho mọi phụ lục.
+Mục tiêu
+Hai bên cùng hợp tác trên tinh thần thiện chí.
+Điều 3: Thanh toán
+Bên A thanh toán một lần bằng chuyển khoản.`,
+			want: []string{
+				"article Điều 1",
+				"clause Điều 1.1",
+				"point Điều 1.1.a",
+				"point Điều 1.1.b",
+				"clause Điều 1.2",
+				"article Điều 2",
+				"article Điều 3",
+			},
+		},
+		{
+			name: "english",
+			text: `SERVICES AGREEMENT
+This agreement is made between the Customer and the Supplier.
+Article 1. Definitions
+1.1 "Services" means the work described in Schedule A.
+Article 2 - Payment
+Section 2.1 Invoicing
+(a) Invoices are due within thirty days of receipt.
+(b) Late payments accrue interest at the agreed rate.
+Section 2.2 Taxes
+Article 3 of this Agreement survives termination of the contract.`,
+			want: []string{
+				"article Article 1",
+				"clause Article 1.1",
+				"article Article 2",
+				"clause Section 2.1",
+				"point Section 2.1(a)",
+				"point Section 2.1(b)",
+				"clause Section 2.2",
+			},
+		},
+		{
+			name: "outline numbering",
+			text: `1. Định nghĩa
+Trong hợp đồng này các từ ngữ dưới đây được hiểu như sau.
+2. Thanh toán
+2.1 Bên A thanh toán cho Bên B trong vòng 10 ngày.
+2.2 Chậm thanh toán chịu lãi theo quy định của pháp luật.`,
+			want: []string{
+				"article Điều 1",
+				"article Điều 2",
+				"clause Điều 2.1",
+				"clause Điều 2.2",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clauseOutline(ParseClauses(tt.text)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("outline:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestParseClausesSpans(t *testing.T) {
+	text := "Điều 1. Phạm vi\nNội dung điều 1.\nĐiều 2. Thanh toán\n1. Bên A trả tiền.\n"
+	nodes := ParseClauses(text)
+	if len(nodes) != 2 {
+		t.Fatalf("got %d articles, want 2", len(nodes))
+	}
+	first, second := nodes[0], nodes[1]
+	if first.Text != "Điều 1. Phạm vi\nNội dung điều 1." {
+		t.Errorf("Điều 1 text = %q", first.Text)
+	}
+	if first.End != second.Start || second.End != len(text) {
+		t.Errorf("spans [%d,%d) [%d,%d), want adjacent and ending at %d", first.Start, first.End, second.Start, second.End, len(text))
+	}
+	if got := FindClause(nodes, "điều 2.1"); got == nil || got.Text != "1. Bên A trả tiền." {
+		t.Errorf("FindClause(điều 2.1) = %+v", got)
+	}
+	if got := ClauseAt(nodes, strings.Index(text, "trả tiền")); got == nil || got.Ref != "Điều 2.1" {
+		t.Errorf("ClauseAt = %+v, want Điều 2.1", got)
+	}
+}
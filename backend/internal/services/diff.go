@@ -0,0 +1,107 @@
+package services
+
+import "strings"
+
+// maxDiffCells giới hạn kích thước bảng LCS (số dòng cũ × số dòng mới sau khi bỏ phần đầu
+// và phần cuối giống nhau); vượt quá thì không tính diff chi tiết.
+const maxDiffCells = 4_000_000
+
+// DiffLine is one line of a line diff: Op is "+" (added), "-" (removed) or " " (unchanged).
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// DiffLines compares two texts line by line. Blank lines are ignored and lines are
+// compared after whitespace normalization. ok is false when the texts differ too much
+// for a detailed diff.
+func DiffLines(oldText, newText string) (diff []DiffLine, ok bool) {
+	a, b := diffableLines(oldText), diffableLines(newText)
+
+	// Bỏ phần đầu và phần cuối giống nhau trước khi tính LCS
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	for _, l := range a[:prefix] {
+		diff = append(diff, DiffLine{Op: " ", Text: l})
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if (len(midA)+1)*(len(midB)+1) > maxDiffCells {
+		return nil, false
+	}
+	diff = append(diff, lcsDiff(midA, midB)...)
+	for _, l := range a[len(a)-suffix:] {
+		diff = append(diff, DiffLine{Op: " ", Text: l})
+	}
+	return diff, true
+}
+
+// ChangedLines returns only the added and removed lines of a diff, at most limit lines.
+func ChangedLines(diff []DiffLine, limit int) []string {
+	var out []string
+	for _, d := range diff {
+		if d.Op == " " {
+			continue
+		}
+		if len(out) == limit {
+			break
+		}
+		out = append(out, d.Op+" "+d.Text)
+	}
+	return out
+}
+
+func diffableLines(text string) []string {
+	var lines []string
+	for _, l := range strings.Split(text, "\n") {
+		if l = strings.Join(strings.Fields(l), " "); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// lcsDiff tính diff theo dãy con chung dài nhất bằng quy hoạch động.
+func lcsDiff(a, b []string) []DiffLine {
+	n, m := len(a), len(b)
+	// lcs[i*(m+1)+j] là độ dài LCS của a[i:] và b[j:]
+	lcs := make([]int32, (n+1)*(m+1))
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i*(m+1)+j] = lcs[(i+1)*(m+1)+j+1] + 1
+			} else {
+				lcs[i*(m+1)+j] = max(lcs[(i+1)*(m+1)+j], lcs[i*(m+1)+j+1])
+			}
+		}
+	}
+
+	var diff []DiffLine
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, DiffLine{Op: " ", Text: a[i]})
+			i++
+			j++
+		case lcs[(i+1)*(m+1)+j] >= lcs[i*(m+1)+j+1]:
+			diff = append(diff, DiffLine{Op: "-", Text: a[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{Op: "+", Text: b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		diff = append(diff, DiffLine{Op: "-", Text: a[i]})
+	}
+	for ; j < m; j++ {
+		diff = append(diff, DiffLine{Op: "+", Text: b[j]})
+	}
+	return diff
+}
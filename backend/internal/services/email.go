@@ -0,0 +1,342 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// maxEmailDepth giới hạn độ sâu lồng nhau của multipart và thư chuyển tiếp.
+const maxEmailDepth = 8
+
+// ErrInvalidEmail is returned when a file is not a readable RFC 5322 message.
+var ErrInvalidEmail = errors.New("invalid e-mail message")
+
+var (
+	htmlDropRe  = regexp.MustCompile(`(?is)<(script|style|head)[^>]*>.*?</(script|style|head)>`)
+	htmlBreakRe = regexp.MustCompile(`(?i)<(br|/p|/div|/tr|/li|/h[1-6])[^>]*>`)
+	htmlTagRe   = regexp.MustCompile(`<[^>]*>`)
+	blankRunRe  = regexp.MustCompile(`\n{3,}`)
+)
+
+// wordDecoder giải mã header RFC 2047 ("=?UTF-8?B?...?=") với mọi bảng mã mà x/text biết.
+var wordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// EmailAttachment is a file attached to an e-mail.
+type EmailAttachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// EmailMessage is a parsed e-mail: headers, body text used as negotiation context,
+// and the attachments extracted as a contract bundle.
+type EmailMessage struct {
+	From    string
+	To      string
+	Subject string
+	Date    *time.Time
+	Body    string
+	// Bundle chứa các file đính kèm được hỗ trợ; nil khi thư không có file đính kèm nào đọc được.
+	Bundle   *Bundle
+	Warnings []string
+
+	attachments []EmailAttachment
+}
+
+// ExtractEmail parses an RFC 5322 message (MIME multipart, quoted-printable/base64,
+// RFC 2047 headers), keeps the body as context and extracts every supported attachment
+// through the extractor registry.
+func ExtractEmail(r io.ReaderAt, size int64, opts ExtractOptions) (*EmailMessage, error) {
+	msg, err := parseEmail(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := opts.Limits.withDefaults()
+	bundle := &Bundle{}
+	for _, a := range msg.attachments {
+		e := FindExtractor(a.Name, a.ContentType)
+		if e == nil {
+			msg.Warnings = append(msg.Warnings, fmt.Sprintf("Bỏ qua file đính kèm không được hỗ trợ: %s", a.Name))
+			continue
+		}
+		if len(bundle.Documents) == limits.MaxBundleFiles {
+			return nil, fmt.Errorf("%w: more than %d attachments", ErrBundleLimit, limits.MaxBundleFiles)
+		}
+		if int64(len(a.Data)) > limits.MaxBundleFileBytes {
+			return nil, fmt.Errorf("%w: %s is larger than %d MB", ErrBundleLimit, a.Name, limits.MaxBundleFileBytes>>20)
+		}
+		if isLegacyWord(e, a.Data) {
+			msg.Warnings = append(msg.Warnings, fmt.Sprintf("Bỏ qua file đính kèm Word định dạng cũ (.doc), hãy lưu lại dưới dạng .docx: %s", a.Name))
+			continue
+		}
+		if err := bundle.add(a.Name, e, a.Data, opts); err != nil {
+			return nil, err
+		}
+	}
+	if len(bundle.Documents) > 0 {
+		bundle.pickMain()
+		msg.Bundle = bundle
+		msg.Warnings = append(msg.Warnings, bundle.Warnings...)
+	}
+	return msg, nil
+}
+
+// VerifyEmailPasswords checks password against every encrypted PDF attached to an e-mail.
+func VerifyEmailPasswords(r io.ReaderAt, size int64, password string) error {
+	msg, err := parseEmail(r, size)
+	if err != nil {
+		return err
+	}
+	for _, a := range msg.attachments {
+		if e := FindExtractor(a.Name, a.ContentType); e == nil || e.Name() != "pdf" {
+			continue
+		}
+		pdfReader := bytes.NewReader(a.Data)
+		if !IsEncryptedPDF(pdfReader, pdfReader.Size()) {
+			continue
+		}
+		if err := VerifyPDFPassword(pdfReader, pdfReader.Size(), password); err != nil {
+			return fmt.Errorf("%s: %w", a.Name, err)
+		}
+	}
+	return nil
+}
+
+// Text returns the e-mail headers and body followed by the attachments, in the
+// "=== ... ===" layout used for bundles.
+func (m *EmailMessage) Text() string {
+	var sb strings.Builder
+	sb.WriteString("=== E-mail (bối cảnh đàm phán) ===\n")
+	if m.From != "" {
+		fmt.Fprintf(&sb, "Người gửi: %s\n", m.From)
+	}
+	if m.To != "" {
+		fmt.Fprintf(&sb, "Người nhận: %s\n", m.To)
+	}
+	if m.Date != nil {
+		fmt.Fprintf(&sb, "Ngày gửi: %s\n", m.Date.Format("02/01/2006 15:04 -0700"))
+	}
+	if m.Subject != "" {
+		fmt.Fprintf(&sb, "Tiêu đề: %s\n", m.Subject)
+	}
+	sb.WriteString("\n")
+	sb.WriteString(m.Body)
+	if m.Bundle != nil {
+		sb.WriteString(pageSeparator)
+		sb.WriteString(m.Bundle.Text())
+	}
+	return sb.String()
+}
+
+// parseEmail đọc header và duyệt cây MIME, chưa trích xuất file đính kèm.
+func parseEmail(r io.ReaderAt, size int64) (*EmailMessage, error) {
+	m, err := mail.ReadMessage(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEmail, err)
+	}
+	msg := &EmailMessage{
+		From:    decodeAddressHeader(m.Header.Get("From")),
+		To:      decodeAddressHeader(m.Header.Get("To")),
+		Subject: decodeHeader(m.Header.Get("Subject")),
+	}
+	if date, err := m.Header.Date(); err == nil {
+		msg.Date = &date
+	}
+
+	var plain, htmlBody []string
+	if err := walkEmailPart(m.Header, m.Body, 0, msg, &plain, &htmlBody); err != nil {
+		return nil, err
+	}
+	switch {
+	case len(plain) > 0:
+		msg.Body = strings.Join(plain, "\n\n")
+	case len(htmlBody) > 0:
+		msg.Body = strings.Join(htmlBody, "\n\n")
+	}
+	msg.Body = strings.TrimSpace(NormalizeText(msg.Body))
+	return msg, nil
+}
+
+// emailHeader là phần chung của mail.Header và textproto.MIMEHeader của multipart.
+type emailHeader interface {
+	Get(key string) string
+}
+
+// walkEmailPart duyệt đệ quy một phần MIME: gom text/plain và text/html vào thân thư,
+// còn các file (có tên hoặc Content-Disposition: attachment) vào danh sách đính kèm.
+func walkEmailPart(h emailHeader, body io.Reader, depth int, msg *EmailMessage, plain, htmlBody *[]string) error {
+	if depth > maxEmailDepth {
+		return fmt.Errorf("%w: MIME parts nested too deeply", ErrInvalidEmail)
+	}
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidEmail, err)
+			}
+			if err := walkEmailPart(part.Header, part, depth+1, msg, plain, htmlBody); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(transferDecoder(h.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return fmt.Errorf("%w: failed to decode part: %v", ErrInvalidEmail, err)
+	}
+
+	disposition, dispParams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	name := dispParams["filename"]
+	if name == "" {
+		name = params["name"]
+	}
+	name = path.Base(strings.ReplaceAll(decodeHeader(name), "\\", "/"))
+	if name == "." || name == "/" {
+		name = ""
+	}
+
+	switch {
+	case mediaType == "message/rfc822" && disposition != "attachment":
+		// Thư chuyển tiếp: nội dung là một phần của chuỗi đàm phán
+		inner, err := mail.ReadMessage(bytes.NewReader(data))
+		if err != nil {
+			return nil
+		}
+		*plain = append(*plain, fmt.Sprintf("--- Thư chuyển tiếp từ %s: %s ---", decodeAddressHeader(inner.Header.Get("From")), decodeHeader(inner.Header.Get("Subject"))))
+		return walkEmailPart(inner.Header, inner.Body, depth+1, msg, plain, htmlBody)
+	case disposition == "attachment" || (name != "" && !strings.HasPrefix(mediaType, "text/")):
+		if name == "" {
+			name = fmt.Sprintf("attachment-%d", len(msg.attachments)+1)
+		}
+		msg.attachments = append(msg.attachments, EmailAttachment{Name: name, ContentType: mediaType, Data: data})
+	case mediaType == "text/plain":
+		*plain = append(*plain, decodeCharset(params["charset"], data))
+	case mediaType == "text/html":
+		*htmlBody = append(*htmlBody, htmlToText(decodeCharset(params["charset"], data)))
+	}
+	return nil
+}
+
+// transferDecoder giải mã Content-Transfer-Encoding; 7bit, 8bit và binary giữ nguyên.
+func transferDecoder(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		// Dòng base64 trong e-mail có CRLF; bỏ khoảng trắng trước khi giải mã
+		return base64.NewDecoder(base64.StdEncoding, &whitespaceStripper{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// whitespaceStripper bỏ mọi ký tự xuống dòng và khoảng trắng khỏi luồng base64.
+type whitespaceStripper struct {
+	r io.Reader
+}
+
+func (w *whitespaceStripper) Read(p []byte) (int, error) {
+	for {
+		n, err := w.r.Read(p)
+		j := 0
+		for _, b := range p[:n] {
+			if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+				p[j] = b
+				j++
+			}
+		}
+		if j > 0 || err != nil {
+			return j, err
+		}
+	}
+}
+
+// decodeCharset chuyển text về UTF-8 theo charset khai báo; charset lạ thì giữ nguyên.
+func decodeCharset(charset string, data []byte) string {
+	charset = strings.ToLower(strings.TrimSpace(charset))
+	if charset == "" || charset == "utf-8" || charset == "us-ascii" {
+		return string(data)
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return string(data)
+	}
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return string(data)
+	}
+	return string(decoded)
+}
+
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q: %w", charset, err)
+	}
+	return enc.NewDecoder().Reader(input), nil
+}
+
+// decodeHeader giải mã encoded-word RFC 2047; header lỗi được trả về nguyên văn.
+func decodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return strings.TrimSpace(value)
+	}
+	return strings.TrimSpace(decoded)
+}
+
+// decodeAddressHeader trả về danh sách địa chỉ dạng "Tên <email>" đã giải mã tên.
+func decodeAddressHeader(value string) string {
+	if value == "" {
+		return ""
+	}
+	parser := mail.AddressParser{WordDecoder: wordDecoder}
+	list, err := parser.ParseList(value)
+	if err != nil {
+		return decodeHeader(value)
+	}
+	parts := make([]string, len(list))
+	for i, a := range list {
+		if a.Name != "" {
+			parts[i] = fmt.Sprintf("%s <%s>", a.Name, a.Address)
+		} else {
+			parts[i] = a.Address
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// htmlToText bỏ thẻ HTML, giữ xuống dòng ở các thẻ khối.
+func htmlToText(s string) string {
+	s = htmlDropRe.ReplaceAllString(s, "")
+	s = htmlBreakRe.ReplaceAllString(s, "\n")
+	s = html.UnescapeString(htmlTagRe.ReplaceAllString(s, ""))
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	return strings.TrimSpace(blankRunRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
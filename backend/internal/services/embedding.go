@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/option"
+)
+
+// EmbeddingModel is the Gemini model that embeds analyses, clauses and search queries.
+// Embeddings of another model are not compared with it; changing it requires embedding the
+// stored analyses again (POST /api/v1/admin/embeddings).
+const EmbeddingModel = "text-embedding-004"
+
+// Các loại embedding.
+const (
+	// EmbeddingProfile: loại hợp đồng, tóm tắt, dàn ý điều khoản và các điều khoản chính
+	EmbeddingProfile = "profile"
+	// EmbeddingRisk: mức rủi ro và các rủi ro tiềm ẩn
+	EmbeddingRisk = "risk"
+	// EmbeddingClause: nội dung một điều khoản của tài liệu
+	EmbeddingClause = "clause"
+)
+
+const (
+	// maxEmbeddingRunes: text dài hơn bị cắt trước khi gửi, model chỉ đọc khoảng 2048 token đầu
+	maxEmbeddingRunes = 6000
+	// maxEmbeddingBatch là số text tối đa của một request BatchEmbedContents
+	maxEmbeddingBatch = 100
+	// maxEmbeddedClauses giới hạn số điều khoản được tạo embedding của một tài liệu
+	maxEmbeddedClauses = 100
+	// embeddingExcerptRunes là độ dài đoạn text lưu kèm embedding để hiển thị
+	embeddingExcerptRunes = 300
+)
+
+// EmbeddingInput is a text to embed together with what it describes.
+type EmbeddingInput struct {
+	Kind string
+	// Ref là số hiệu điều khoản, chỉ có với EmbeddingClause
+	Ref  string
+	Text string
+}
+
+// Excerpt is the beginning of the text, stored with the embedding for display.
+func (in EmbeddingInput) Excerpt() string {
+	return truncateRunes(compactSpace(strings.TrimSpace(in.Text)), embeddingExcerptRunes)
+}
+
+// ProfileEmbeddingInput describes the contract as a whole: its type, summary, outline of
+// articles and key clauses. Contracts with similar inputs have a similar structure.
+func ProfileEmbeddingInput(contractType, summary string, keyClauses []string, clauses []*ClauseNode) EmbeddingInput {
+	var sb strings.Builder
+	if contractType != "" {
+		sb.WriteString("Loại hợp đồng: " + contractType + "\n")
+	}
+	sb.WriteString(summary + "\n")
+	for _, c := range embeddableClauses(clauses) {
+		sb.WriteString(strings.TrimSpace(c.Ref+" "+c.Title) + "\n")
+	}
+	for _, k := range keyClauses {
+		sb.WriteString("- " + k + "\n")
+	}
+	return EmbeddingInput{Kind: EmbeddingProfile, Text: sb.String()}
+}
+
+// RiskEmbeddingInput describes the risk profile of the contract; ok is false when the
+// analysis found no risk.
+func RiskEmbeddingInput(riskLevel string, risks []string) (in EmbeddingInput, ok bool) {
+	if len(risks) == 0 {
+		return EmbeddingInput{}, false
+	}
+	var sb strings.Builder
+	if riskLevel != "" {
+		sb.WriteString("Mức rủi ro: " + riskLevel + "\n")
+	}
+	for _, r := range risks {
+		sb.WriteString("- " + r + "\n")
+	}
+	return EmbeddingInput{Kind: EmbeddingRisk, Text: sb.String()}, true
+}
+
+// ClauseEmbeddingInputs returns one input per article of the clause tree, with the text of
+// its clauses and points.
+func ClauseEmbeddingInputs(clauses []*ClauseNode) []EmbeddingInput {
+	var inputs []EmbeddingInput
+	for _, c := range embeddableClauses(clauses) {
+		var sb strings.Builder
+		writeClauseText(&sb, c)
+		if strings.TrimSpace(sb.String()) == "" {
+			continue
+		}
+		inputs = append(inputs, EmbeddingInput{Kind: EmbeddingClause, Ref: c.Ref, Text: sb.String()})
+	}
+	return inputs
+}
+
+// embeddableClauses trả về các điều (hoặc nút ngoài cùng dưới chương, mục khi tài liệu không
+// có điều), tối đa maxEmbeddedClauses nút.
+func embeddableClauses(nodes []*ClauseNode) []*ClauseNode {
+	var out []*ClauseNode
+	var walk func(nodes []*ClauseNode)
+	walk = func(nodes []*ClauseNode) {
+		for _, n := range nodes {
+			if len(out) >= maxEmbeddedClauses {
+				return
+			}
+			if n.Kind == ClauseKindChapter || n.Kind == ClauseKindSection {
+				walk(n.Children)
+				continue
+			}
+			out = append(out, n)
+		}
+	}
+	walk(nodes)
+	return out
+}
+
+// writeClauseText ghi nội dung của nút và mọi nút con.
+func writeClauseText(sb *strings.Builder, n *ClauseNode) {
+	sb.WriteString(n.Text + "\n")
+	for _, c := range n.Children {
+		writeClauseText(sb, c)
+	}
+}
+
+// EmbedDocuments embeds stored texts for retrieval with EmbeddingModel. The vectors are
+// normalized to unit length, so their dot product is the cosine similarity.
+func EmbedDocuments(texts []string) ([][]float32, error) {
+	return embed(genai.TaskTypeRetrievalDocument, texts)
+}
+
+// EmbedQuery embeds a search query with EmbeddingModel, normalized like EmbedDocuments.
+func EmbedQuery(text string) ([]float32, error) {
+	vectors, err := embed(genai.TaskTypeRetrievalQuery, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+func embed(taskType genai.TaskType, texts []string) ([][]float32, error) {
+	ctx := context.Background()
+	apiKey := os.Getenv("GEMINI_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("GEMINI_API_KEY environment variable is not set")
+	}
+	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize Gemini client: %w", err)
+	}
+	defer client.Close()
+
+	model := client.EmbeddingModel(EmbeddingModel)
+	model.TaskType = taskType
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += maxEmbeddingBatch {
+		batch := model.NewBatch()
+		end := min(start+maxEmbeddingBatch, len(texts))
+		for _, t := range texts[start:end] {
+			batch.AddContent(genai.Text(truncateRunes(t, maxEmbeddingRunes)))
+		}
+		resp, err := model.BatchEmbedContents(ctx, batch)
+		if err != nil {
+			if strings.Contains(err.Error(), "429") || strings.Contains(err.Error(), "quota") || strings.Contains(err.Error(), "exceeded") {
+				return nil, fmt.Errorf("API quota exceeded: %w", err)
+			}
+			return nil, fmt.Errorf("failed to embed content: %w", err)
+		}
+		if len(resp.Embeddings) != end-start {
+			return nil, fmt.Errorf("received %d embeddings for %d texts", len(resp.Embeddings), end-start)
+		}
+		for _, e := range resp.Embeddings {
+			vectors = append(vectors, NormalizeVector(e.Values))
+		}
+	}
+	return vectors, nil
+}
+
+// NormalizeVector scales v to unit length in place and returns it.
+func NormalizeVector(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= norm
+	}
+	return v
+}
+
+// truncateRunes cắt s còn tối đa n ký tự.
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// pageSeparator ngăn cách nội dung giữa hai trang liên tiếp trong ExtractionResult.Text.
+const pageSeparator = "\n\n"
+
+// ExtractOptions configures a document extraction.
+type ExtractOptions struct {
+	// Password mở PDF được mã hoá. Chỉ dùng trong bộ nhớ, không bao giờ được lưu hay ghi log.
+	Password string
+	// OCR nhận dạng các trang scan không có lớp text; nil nghĩa là không OCR.
+	OCR OCREngine
+	// Limits giới hạn số trang, số đoạn và dung lượng giải nén; trường bằng 0 dùng giá trị mặc định.
+	Limits Limits
+}
+
+// Nguồn gốc text của một trang.
+const (
+	PageSourceText = "text" // lớp text của PDF
+	PageSourceOCR  = "ocr"  // nhận dạng từ ảnh trang
+	PageSourceNone = "none" // trang scan không đọc được
+)
+
+// TextLine is a single reconstructed line of text with its position on the page.
+// Coordinates are PDF points, with Y increasing from the bottom of the page.
+type TextLine struct {
+	Text     string  `json:"text"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	Width    float64 `json:"width"`
+	FontSize float64 `json:"font_size"`
+	// Column là cột chứa dòng: 0 (cột trái hoặc trang một cột), 1 (cột phải), -1 (dòng trải rộng qua cả hai cột).
+	Column int `json:"column"`
+}
+
+// ExtractedPage holds the text of one page in reading order.
+type ExtractedPage struct {
+	Number int        `json:"number"`
+	Width  float64    `json:"width"`
+	Height float64    `json:"height"`
+	Lines  []TextLine `json:"lines"`
+	Text   string     `json:"text"`
+	// Offset là vị trí (byte) bắt đầu của trang trong ExtractionResult.Text.
+	Offset int    `json:"offset"`
+	Source string `json:"source"`
+	// Confidence (0..1) là độ tin cậy của OCR, hoặc điểm chất lượng text với trang có lớp text.
+	Confidence float64 `json:"confidence"`
+}
+
+// ExtractionResult is the output of a document extractor.
+type ExtractionResult struct {
+	// Text là text đã chuẩn hoá (NFC, khoảng trắng, ký tự lỗi font), dùng cho phân tích và tìm kiếm.
+	Text string `json:"text"`
+	// RawText là text đúng như extractor đọc được, trước khi chuẩn hoá.
+	RawText string          `json:"raw_text"`
+	Pages   []ExtractedPage `json:"pages"`
+	// RemovedLines đếm số dòng header/footer/số trang đã bị loại bỏ.
+	RemovedLines int      `json:"removed_lines"`
+	OCREngine    string   `json:"ocr_engine,omitempty"`
+	Warnings     []string `json:"warnings,omitempty"`
+	// Tables là các bảng tính của file XLSX, mỗi sheet một bảng.
+	Tables []Table `json:"tables,omitempty"`
+	// Info là metadata nhúng trong file (tác giả, phần mềm tạo, ngày tạo...), nil nếu định dạng không có.
+	Info *DocumentInfo `json:"info,omitempty"`
+	// Signatures là các chữ ký số của PDF và kết quả kiểm tra từng chữ ký.
+	Signatures []SignatureInfo `json:"signatures,omitempty"`
+}
+
+// OCRUsed reports whether any page text came from OCR.
+func (r *ExtractionResult) OCRUsed() bool {
+	for _, p := range r.Pages {
+		if p.Source == PageSourceOCR {
+			return true
+		}
+	}
+	return false
+}
+
+// PageForOffset returns the 1-based page number containing the given byte offset
+// of Text, or 0 when the document has no page information.
+func (r *ExtractionResult) PageForOffset(offset int) int {
+	page := 0
+	for _, p := range r.Pages {
+		if p.Offset > offset {
+			break
+		}
+		page = p.Number
+	}
+	return page
+}
+
+// TextWithPageMarkers returns Text with a "--- Trang N ---" marker before every page,
+// so that the model can cite page numbers in its answer.
+func (r *ExtractionResult) TextWithPageMarkers() string {
+	if len(r.Pages) == 0 {
+		return r.Text
+	}
+	var sb strings.Builder
+	for i, p := range r.Pages {
+		if i > 0 {
+			sb.WriteString(pageSeparator)
+		}
+		fmt.Fprintf(&sb, "--- Trang %d ---\n", p.Number)
+		sb.WriteString(p.Text)
+	}
+	return sb.String()
+}
+
+// newPagedResult ghép text của các trang thành ExtractionResult và tính offset cho từng trang.
+func newPagedResult(pages []ExtractedPage) *ExtractionResult {
+	return &ExtractionResult{Text: joinPages(pages), Pages: pages}
+}
+
+// joinPages ghép text của các trang, cập nhật Offset của từng trang.
+func joinPages(pages []ExtractedPage) string {
+	var sb strings.Builder
+	for i := range pages {
+		if i > 0 {
+			sb.WriteString(pageSeparator)
+		}
+		pages[i].Offset = sb.Len()
+		sb.WriteString(pages[i].Text)
+	}
+	return sb.String()
+}
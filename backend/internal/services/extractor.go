@@ -0,0 +1,83 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+// ErrUnsupportedFormat is returned when no registered extractor handles a file.
+var ErrUnsupportedFormat = errors.New("unsupported document format")
+
+// Extractor extracts the text of one document format.
+type Extractor interface {
+	Name() string
+	// Match reports whether the extractor handles a file with this name and content type.
+	Match(filename, contentType string) bool
+	Extract(r io.ReaderAt, size int64, opts ExtractOptions) (*ExtractionResult, error)
+}
+
+// extractors là danh sách extractor theo thứ tự ưu tiên khi tìm theo tên file.
+var extractors []Extractor
+
+// RegisterExtractor adds an extractor to the registry. Extractors registered earlier win.
+func RegisterExtractor(e Extractor) {
+	extractors = append(extractors, e)
+}
+
+func init() {
+	RegisterExtractor(pdfExtractor{})
+	RegisterExtractor(docxExtractor{})
+	RegisterExtractor(xlsxExtractor{})
+}
+
+// FindExtractor returns the extractor for a file, or nil when the format is not supported.
+func FindExtractor(filename, contentType string) Extractor {
+	filename = strings.ToLower(filename)
+	contentType = strings.ToLower(contentType)
+	for _, e := range extractors {
+		if e.Match(filename, contentType) {
+			return e
+		}
+	}
+	return nil
+}
+
+// hasExt so khớp phần mở rộng của tên file (đã viết thường).
+func hasExt(filename string, exts ...string) bool {
+	ext := path.Ext(filename)
+	for _, e := range exts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+type pdfExtractor struct{}
+
+func (pdfExtractor) Name() string { return "pdf" }
+
+func (pdfExtractor) Match(filename, contentType string) bool {
+	return strings.Contains(contentType, "pdf") || hasExt(filename, ".pdf")
+}
+
+func (pdfExtractor) Extract(r io.ReaderAt, size int64, opts ExtractOptions) (*ExtractionResult, error) {
+	return ExtractPDF(r, size, opts)
+}
+
+type docxExtractor struct{}
+
+func (docxExtractor) Name() string { return "docx" }
+
+// Match nhận cả .doc để giữ hành vi cũ của /analyze; file .doc nhị phân sẽ báo lỗi khi đọc.
+func (docxExtractor) Match(filename, contentType string) bool {
+	return strings.Contains(contentType, "officedocument.wordprocessingml.document") ||
+		strings.Contains(contentType, "msword") ||
+		hasExt(filename, ".docx", ".doc")
+}
+
+func (docxExtractor) Extract(r io.ReaderAt, size int64, opts ExtractOptions) (*ExtractionResult, error) {
+	return ExtractDOCX(r, size, opts)
+}
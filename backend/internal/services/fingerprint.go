@@ -0,0 +1,94 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/fnv"
+	"math/bits"
+	"strings"
+)
+
+const (
+	// simHashShingle: số từ liên tiếp tạo thành một đặc trưng của SimHash.
+	simHashShingle = 3
+	// NearDuplicateDistance is the largest SimHash Hamming distance at which two
+	// documents are reported as near-duplicates.
+	NearDuplicateDistance = 3
+	// SimHashBands is the number of 16-bit bands a SimHash is split into for indexing.
+	// Two hashes within NearDuplicateDistance bits always share at least one band.
+	SimHashBands = 4
+)
+
+// canonicalContent đưa text về dạng dùng để so sánh nội dung: chữ thường, bỏ dấu câu
+// thừa ở mép từ, mọi khoảng trắng và ngắt dòng/ngắt trang gộp thành một dấu cách.
+func canonicalContent(text string) []string {
+	words := strings.Fields(strings.ToLower(NormalizeText(text)))
+	for i, w := range words {
+		words[i] = strings.Trim(w, ".,;:!?\"'()[]“”‘’")
+	}
+	return words
+}
+
+// ContentHash returns a SHA-256 of the canonical form of text, so the same contract
+// re-exported to another PDF or saved as DOCX gets the same key.
+func ContentHash(text string) string {
+	sum := sha256.Sum256([]byte(strings.Join(canonicalContent(text), " ")))
+	return hex.EncodeToString(sum[:])
+}
+
+// SimHash returns a 64-bit SimHash of text over word shingles. Similar texts
+// have hashes with a small Hamming distance.
+func SimHash(text string) uint64 {
+	words := canonicalContent(text)
+	var weights [64]int
+	// Văn bản ngắn hơn một shingle vẫn có một đặc trưng
+	shingles := max(len(words)-simHashShingle+1, min(len(words), 1))
+	for i := 0; i < shingles; i++ {
+		end := min(i+simHashShingle, len(words))
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:end], " ")))
+		sum := h.Sum64()
+		for b := 0; b < 64; b++ {
+			if sum&(1<<b) != 0 {
+				weights[b]++
+			} else {
+				weights[b]--
+			}
+		}
+	}
+	var hash uint64
+	for b, w := range weights {
+		if w > 0 {
+			hash |= 1 << b
+		}
+	}
+	return hash
+}
+
+// HammingDistance returns the number of differing bits between two SimHashes.
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// SimHashBand returns the i-th 16-bit band of a SimHash.
+func SimHashBand(hash uint64, i int) int {
+	return int(hash >> (16 * i) & 0xffff)
+}
+
+// ContentText returns the text of every document of the bundle, main contract first,
+// without the per-file headers of Text so that renaming a file does not change it.
+func (b *Bundle) ContentText() string {
+	texts := make([]string, len(b.Documents))
+	for i, d := range b.Documents {
+		texts[i] = d.Result.Text
+	}
+	return strings.Join(texts, pageSeparator)
+}
+
+// ContentText returns the e-mail body followed by the text of its attachments.
+func (m *EmailMessage) ContentText() string {
+	if m.Bundle == nil {
+		return m.Body
+	}
+	return m.Body + pageSeparator + m.Bundle.ContentText()
+}
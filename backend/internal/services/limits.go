@@ -0,0 +1,161 @@
+package services
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+)
+
+// Giới hạn mặc định, có thể thay đổi bằng biến môi trường (xem DefaultLimits).
+const (
+	defaultMaxUploadMB         = 50
+	defaultMaxPDFPages         = 500
+	defaultMaxDOCXParagraphs   = 20000
+	defaultMaxArchiveEntries   = 1000
+	defaultMaxExpandedMB       = 200
+	defaultMaxSpreadsheetCells = 200000
+	defaultMaxImageMegapixels  = 50
+	defaultMaxBundleFiles      = 20
+	defaultMaxBundleFileMB     = 50
+)
+
+// ErrLimitExceeded is wrapped by every LimitError.
+var ErrLimitExceeded = errors.New("document exceeds processing limits")
+
+// LimitError reports which processing limit a document exceeded.
+type LimitError struct {
+	// Subject là đối tượng vi phạm: "upload", "PDF", "DOCX" hoặc tên file trong bộ hồ sơ.
+	Subject string
+	// Limit mô tả giới hạn, ví dụ "pages", "paragraphs", "archive entries", "MB uncompressed".
+	Limit string
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s exceeds the limit of %d %s", e.Subject, e.Max, e.Limit)
+}
+
+func (e *LimitError) Unwrap() error { return ErrLimitExceeded }
+
+// Limits bounds the size of uploads and the work done to extract one document.
+// Zero fields fall back to the package defaults.
+type Limits struct {
+	MaxUploadBytes    int64
+	MaxPDFPages       int
+	MaxDOCXParagraphs int
+	// MaxArchiveEntries giới hạn số entry trong một container ZIP (DOCX, bộ hồ sơ).
+	MaxArchiveEntries int
+	// MaxExpandedBytes giới hạn tổng dung lượng sau giải nén của một container ZIP.
+	// Với PDF, đây cũng là giới hạn của từng stream sau khi giải nén.
+	MaxExpandedBytes    int64
+	MaxSpreadsheetCells int
+	// MaxImagePixels giới hạn số điểm ảnh (rộng × cao) của ảnh trang scan được giải mã để OCR.
+	MaxImagePixels int64
+	// MaxBundleFiles giới hạn số tài liệu được đọc trong một bộ hồ sơ ZIP hoặc số file đính
+	// kèm của một e-mail; MaxBundleFileBytes giới hạn dung lượng của từng tài liệu đó.
+	MaxBundleFiles     int
+	MaxBundleFileBytes int64
+}
+
+// DefaultLimits returns the limits configured by MAX_UPLOAD_MB, MAX_PDF_PAGES,
+// MAX_DOCX_PARAGRAPHS, MAX_ARCHIVE_ENTRIES, MAX_EXPANDED_MB, MAX_SPREADSHEET_CELLS,
+// MAX_IMAGE_MEGAPIXELS, MAX_BUNDLE_FILES and MAX_BUNDLE_FILE_MB.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxUploadBytes:      int64(envInt("MAX_UPLOAD_MB", defaultMaxUploadMB)) << 20,
+		MaxPDFPages:         envInt("MAX_PDF_PAGES", defaultMaxPDFPages),
+		MaxDOCXParagraphs:   envInt("MAX_DOCX_PARAGRAPHS", defaultMaxDOCXParagraphs),
+		MaxArchiveEntries:   envInt("MAX_ARCHIVE_ENTRIES", defaultMaxArchiveEntries),
+		MaxExpandedBytes:    int64(envInt("MAX_EXPANDED_MB", defaultMaxExpandedMB)) << 20,
+		MaxSpreadsheetCells: envInt("MAX_SPREADSHEET_CELLS", defaultMaxSpreadsheetCells),
+		MaxImagePixels:      int64(envInt("MAX_IMAGE_MEGAPIXELS", defaultMaxImageMegapixels)) * 1000000,
+		MaxBundleFiles:      envInt("MAX_BUNDLE_FILES", defaultMaxBundleFiles),
+		MaxBundleFileBytes:  int64(envInt("MAX_BUNDLE_FILE_MB", defaultMaxBundleFileMB)) << 20,
+	}.withDefaults()
+}
+
+// withDefaults điền giá trị mặc định cho các trường bằng 0.
+func (l Limits) withDefaults() Limits {
+	if l.MaxUploadBytes <= 0 {
+		l.MaxUploadBytes = defaultMaxUploadMB << 20
+	}
+	if l.MaxPDFPages <= 0 {
+		l.MaxPDFPages = defaultMaxPDFPages
+	}
+	if l.MaxDOCXParagraphs <= 0 {
+		l.MaxDOCXParagraphs = defaultMaxDOCXParagraphs
+	}
+	if l.MaxArchiveEntries <= 0 {
+		l.MaxArchiveEntries = defaultMaxArchiveEntries
+	}
+	if l.MaxExpandedBytes <= 0 {
+		l.MaxExpandedBytes = defaultMaxExpandedMB << 20
+	}
+	if l.MaxSpreadsheetCells <= 0 {
+		l.MaxSpreadsheetCells = defaultMaxSpreadsheetCells
+	}
+	if l.MaxImagePixels <= 0 {
+		l.MaxImagePixels = defaultMaxImageMegapixels * 1000000
+	}
+	if l.MaxBundleFiles <= 0 {
+		l.MaxBundleFiles = defaultMaxBundleFiles
+	}
+	if l.MaxBundleFileBytes <= 0 {
+		l.MaxBundleFileBytes = defaultMaxBundleFileMB << 20
+	}
+	return l
+}
+
+// envInt đọc một số nguyên dương từ biến môi trường; giá trị không hợp lệ bị bỏ qua.
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		log.Printf("Invalid %s=%q, using default %d", key, v, def)
+		return def
+	}
+	return n
+}
+
+// checkArchive kiểm tra số entry, kích thước giải nén và tỉ lệ nén của một container ZIP
+// trước khi thư viện đọc nội dung vào bộ nhớ. archive/zip trả lỗi khi dữ liệu giải nén
+// vượt kích thước khai báo trong header, nên kích thước khai báo là đáng tin.
+func checkArchive(r io.ReaderAt, size int64, subject string, limits Limits) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		// Không phải ZIP hợp lệ: để extractor báo lỗi định dạng của nó
+		return nil
+	}
+	if len(zr.File) > limits.MaxArchiveEntries {
+		return &LimitError{Subject: subject, Limit: "archive entries", Max: int64(limits.MaxArchiveEntries)}
+	}
+	var total uint64
+	for _, f := range zr.File {
+		if f.UncompressedSize64 > 1<<20 && f.UncompressedSize64 > maxBundleRatio*f.CompressedSize64 {
+			return fmt.Errorf("%w: %s entry %s has a suspicious compression ratio", ErrLimitExceeded, subject, f.Name)
+		}
+		total += f.UncompressedSize64
+		if total > uint64(limits.MaxExpandedBytes) {
+			return &LimitError{Subject: subject, Limit: "MB uncompressed", Max: limits.MaxExpandedBytes >> 20}
+		}
+	}
+	return nil
+}
+
+// checkImageSize kiểm tra kích thước ảnh khai báo trong file trước khi cấp phát bộ đệm điểm ảnh.
+func checkImageSize(width, height int64, limits Limits) error {
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("invalid image size %dx%d", width, height)
+	}
+	if width > limits.MaxImagePixels/height {
+		return &LimitError{Subject: "PDF image", Limit: "megapixels", Max: limits.MaxImagePixels / 1000000}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"baliance.com/gooxml/common"
+	"github.com/ledongthuc/pdf"
+)
+
+// DocumentInfo holds the metadata embedded in a document file: the PDF Info
+// dictionary or the DOCX core and application properties.
+type DocumentInfo struct {
+	Title    string `json:"title,omitempty"`
+	Author   string `json:"author,omitempty"`
+	Subject  string `json:"subject,omitempty"`
+	Keywords string `json:"keywords,omitempty"`
+	// Creator là phần mềm soạn thảo gốc, Producer là phần mềm tạo ra file PDF.
+	Creator        string     `json:"creator,omitempty"`
+	Producer       string     `json:"producer,omitempty"`
+	Company        string     `json:"company,omitempty"`
+	LastModifiedBy string     `json:"last_modified_by,omitempty"`
+	CreatedAt      *time.Time `json:"created_at,omitempty"`
+	ModifiedAt     *time.Time `json:"modified_at,omitempty"`
+	PageCount      int        `json:"page_count,omitempty"`
+}
+
+// pdfInfo đọc từ điển Info trong trailer của PDF.
+func pdfInfo(reader *pdf.Reader) *DocumentInfo {
+	info := &DocumentInfo{PageCount: reader.NumPage()}
+	dict := reader.Trailer().Key("Info")
+	if dict.IsNull() {
+		return info
+	}
+	text := func(key string) string {
+		return strings.TrimSpace(dict.Key(key).Text())
+	}
+	info.Title = text("Title")
+	info.Author = text("Author")
+	info.Subject = text("Subject")
+	info.Keywords = text("Keywords")
+	info.Creator = text("Creator")
+	info.Producer = text("Producer")
+	info.CreatedAt = parsePDFDate(text("CreationDate"))
+	info.ModifiedAt = parsePDFDate(text("ModDate"))
+	return info
+}
+
+// parsePDFDate phân tích ngày theo định dạng PDF "D:YYYYMMDDHHmmSSOHH'mm'",
+// trong đó mọi phần sau năm đều có thể bị lược bỏ. Trả về nil nếu không hợp lệ.
+func parsePDFDate(s string) *time.Time {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "D:")
+	n := 0
+	for n < len(s) && n < 14 && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	// Các phần của ngày giờ đều có 2 chữ số (riêng năm có 4)
+	if n < 4 || n%2 != 0 {
+		return nil
+	}
+	t, err := time.Parse("20060102150405"[:n], s[:n])
+	if err != nil {
+		return nil
+	}
+
+	// Múi giờ: "Z", "+07'00'", "-05'00" hoặc "+07"; thiếu múi giờ thì coi là UTC
+	zone := strings.ReplaceAll(s[n:], "'", "")
+	if len(zone) >= 3 && (zone[0] == '+' || zone[0] == '-') {
+		hours, errH := strconv.Atoi(zone[1:3])
+		minutes := 0
+		if len(zone) >= 5 {
+			minutes, _ = strconv.Atoi(zone[3:5])
+		}
+		if errH == nil {
+			offset := hours*3600 + minutes*60
+			if zone[0] == '-' {
+				offset = -offset
+			}
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.FixedZone("", offset))
+		}
+	}
+	return &t
+}
+
+// officeInfo đọc core properties (docProps/core.xml) và app properties (docProps/app.xml)
+// của file DOCX/XLSX.
+func officeInfo(core common.CoreProperties, app common.AppProperties) *DocumentInfo {
+	return &DocumentInfo{
+		Title:          strings.TrimSpace(core.Title()),
+		Author:         strings.TrimSpace(core.Author()),
+		Creator:        strings.TrimSpace(app.Application()),
+		Company:        strings.TrimSpace(app.Company()),
+		LastModifiedBy: strings.TrimSpace(core.LastModifiedBy()),
+		CreatedAt:      nonZeroTime(core.Created()),
+		ModifiedAt:     nonZeroTime(core.Modified()),
+	}
+}
+
+func nonZeroTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Analysis modes select how the document content is sent to the model.
+const (
+	// AnalysisModeAuto gửi file gốc kèm text khi chất lượng trích xuất thấp, ngược lại chỉ gửi text.
+	AnalysisModeAuto = "auto"
+	// AnalysisModeText chỉ gửi text đã trích xuất.
+	AnalysisModeText = "text"
+	// AnalysisModeMultimodal gửi file gốc kèm text đã trích xuất.
+	AnalysisModeMultimodal = "multimodal"
+	// AnalysisModeDocument chỉ gửi file gốc, model tự đọc nội dung.
+	AnalysisModeDocument = "document"
+)
+
+const (
+	// multimodalQualityThreshold: điểm chất lượng trích xuất dưới ngưỡng này thì chế độ auto gửi file gốc.
+	multimodalQualityThreshold = poorQualityThreshold
+	// maxInlineDocumentBytes: file lớn hơn được tải lên File API của Gemini thay vì gửi kèm request.
+	maxInlineDocumentBytes = 15 << 20
+	// fileProcessingTimeout: thời gian chờ tối đa để Gemini xử lý xong file đã tải lên.
+	fileProcessingTimeout = 2 * time.Minute
+)
+
+// DocumentBlob is an original document sent to a multimodal model.
+type DocumentBlob struct {
+	Name     string
+	MIMEType string
+	Reader   io.ReaderAt
+	Size     int64
+}
+
+// ParseAnalysisMode validates an analysis mode; "" means AnalysisModeAuto.
+func ParseAnalysisMode(s string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(s)); mode {
+	case "":
+		return AnalysisModeAuto, nil
+	case AnalysisModeAuto, AnalysisModeText, AnalysisModeMultimodal, AnalysisModeDocument:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown analysis mode %q", s)
+	}
+}
+
+// DefaultAnalysisMode returns the mode configured by ANALYSIS_MODE, or AnalysisModeAuto.
+func DefaultAnalysisMode() string {
+	mode, err := ParseAnalysisMode(os.Getenv("ANALYSIS_MODE"))
+	if err != nil {
+		log.Printf("Warning: %v, using %s", err, AnalysisModeAuto)
+		return AnalysisModeAuto
+	}
+	return mode
+}
+
+// ExtractionQuality returns the quality of the extracted text from 0 to 1: the average
+// score of the pages that have content, where scanned pages that could not be read count as 0.
+func (r *ExtractionResult) ExtractionQuality() float64 {
+	if len(r.Pages) == 0 {
+		return TextQualityScore(r.Text)
+	}
+	var sum float64
+	n := 0
+	for _, p := range r.Pages {
+		switch {
+		case p.Source == PageSourceNone:
+			n++
+		case strings.TrimSpace(p.Text) != "":
+			sum += p.Confidence
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+// ChooseAnalysisMode resolves AnalysisModeAuto for an extracted PDF: the original file is
+// sent along with the text when pages could not be read or the text quality is low.
+// reason explains an automatic switch and is empty otherwise.
+func ChooseAnalysisMode(requested string, result *ExtractionResult) (mode, reason string) {
+	if requested != AnalysisModeAuto {
+		return requested, ""
+	}
+	if result == nil {
+		return AnalysisModeText, ""
+	}
+	if strings.TrimSpace(result.Text) == "" {
+		return AnalysisModeDocument, "Không trích xuất được text, file PDF gốc được gửi cho model để đọc trực tiếp."
+	}
+	var unread []int
+	for _, p := range result.Pages {
+		if p.Source == PageSourceNone {
+			unread = append(unread, p.Number)
+		}
+	}
+	if len(unread) > 0 {
+		return AnalysisModeMultimodal, fmt.Sprintf("Trang %s không đọc được text, file PDF gốc được gửi kèm cho model.", formatPageList(unread))
+	}
+	if q := result.Quality().Score; q < multimodalQualityThreshold {
+		return AnalysisModeMultimodal, fmt.Sprintf("Chất lượng trích xuất thấp (%.2f), file PDF gốc được gửi kèm cho model.", q)
+	}
+	return AnalysisModeText, ""
+}
+
+// AnalyzeDocument analyses the original document with a multimodal model. In
+// AnalysisModeMultimodal the extracted text is sent too, as a hint that may contain
+// extraction errors; in AnalysisModeDocument only the file is sent. language and opts are
+// used as in AnalyzeText.
+func AnalyzeDocument(doc *DocumentBlob, textContent, mode, language string, opts AnalysisOptions) (*ModelCall, error) {
+	profile := profileFor(language, textContent)
+	textSection := ""
+	if mode == AnalysisModeMultimodal && strings.TrimSpace(textContent) != "" {
+		textSection = fmt.Sprintf(`
+	Text trích xuất tự động từ file (có thể thiếu trang, sai thứ tự hoặc lỗi font; khi mâu thuẫn với file gốc, luôn theo file gốc):
+	---
+	%s
+	---
+`, textContent)
+	}
+	prompt := fmt.Sprintf(`
+	Phân tích hợp đồng trong file đính kèm và trả về kết quả bằng %[1]s dưới dạng một chuỗi JSON duy nhất.
+	QUAN TRỌNG: Phản hồi của bạn CHỈ ĐƯỢC chứa chuỗi JSON, không có văn bản, giải thích hay định dạng markdown nào khác.
+	%[2]s
+	Đọc toàn bộ file, kể cả trang scan, bảng biểu, con dấu và chữ viết tay; ghi kèm số trang ở cuối mỗi điều khoản và rủi ro, ví dụ "(%[3]s 3)".
+	Khi nhắc tới một điều khoản, ghi đúng số hiệu như trong văn bản, ví dụ %[4]s.
+
+	JSON phải tuân theo cấu trúc chính xác sau:
+	{
+		"summary": "Một bản tóm tắt chuyên nghiệp, ngắn gọn bằng %[1]s về các điểm chính của hợp đồng",
+		"key_clauses": ["Danh sách các điều khoản quan trọng nhất bằng %[1]s, dưới dạng một mảng các chuỗi"],
+		"potential_risks": ["Danh sách các rủi ro tiềm ẩn hoặc các điểm cần lưu ý bằng %[1]s, dưới dạng một mảng các chuỗi. Trả về mảng rỗng [] nếu không tìm thấy"],
+		%[6]s
+	}
+%[5]s`, profile.replyLanguage, profile.guidance+opts.guidance(), profile.pageLabel, profile.clauseExample, textSection, classificationFields)
+
+	// File gốc khó đọc hơn text nên mặc định dùng model Pro
+	if opts.Model == "" {
+		opts.Model = GeminiPro25
+	}
+	return runAnalysisPrompt(prompt, PromptVersionDocument, textContent, profile, doc, opts)
+}
+
+// documentPart đưa file gốc vào request: gửi kèm trực tiếp nếu đủ nhỏ, ngược lại tải lên
+// File API. cleanup xoá file đã tải lên sau khi dùng xong.
+func documentPart(ctx context.Context, client *genai.Client, doc *DocumentBlob) (part genai.Part, cleanup func(), err error) {
+	if doc.Size <= maxInlineDocumentBytes {
+		data, err := readAllAt(doc.Reader, doc.Size)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read document: %w", err)
+		}
+		return genai.Blob{MIMEType: doc.MIMEType, Data: data}, func() {}, nil
+	}
+
+	file, err := client.UploadFile(ctx, "", io.NewSectionReader(doc.Reader, 0, doc.Size), &genai.UploadFileOptions{
+		DisplayName: doc.Name,
+		MIMEType:    doc.MIMEType,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to upload document: %w", err)
+	}
+	cleanup = func() {
+		if err := client.DeleteFile(context.Background(), file.Name); err != nil {
+			log.Printf("Warning: failed to delete uploaded file %s: %v", file.Name, err)
+		}
+	}
+	deadline := time.Now().Add(fileProcessingTimeout)
+	for file.State == genai.FileStateProcessing {
+		if time.Now().After(deadline) {
+			cleanup()
+			return nil, nil, fmt.Errorf("uploaded document %s is still processing", file.Name)
+		}
+		time.Sleep(2 * time.Second)
+		if file, err = client.GetFile(ctx, file.Name); err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to get uploaded document: %w", err)
+		}
+	}
+	if file.State != genai.FileStateActive {
+		cleanup()
+		return nil, nil, fmt.Errorf("uploaded document %s has state %s", file.Name, file.State)
+	}
+	return genai.FileData{MIMEType: file.MIMEType, URI: file.URI}, cleanup, nil
+}
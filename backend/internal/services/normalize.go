@@ -0,0 +1,187 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	// Dấu hiệu của text UTF-8 bị đọc nhầm thành Windows-1252/Latin-1: "Há»£p Ä‘á»“ng".
+	mojibakeRe  = regexp.MustCompile(`Ã[\x{80}-\x{BF}]|á[º»]|Ä[‘\x{90}]|Æ[°¡¯]`)
+	spaceRunRe  = regexp.MustCompile(`[ \t]{2,}`)
+	lineBreakRe = regexp.MustCompile(`\n{3,}`)
+)
+
+// glyphReplacer sửa các ký tự mà PDF hay trích xuất sai: ký tự vô hình, khoảng trắng
+// Unicode, chữ ghép (ligature) và ký tự vùng riêng (PUA) của font Symbol/Wingdings.
+var glyphReplacer = strings.NewReplacer(
+	// Ký tự vô hình: zero-width space/non-joiner/joiner, word joiner, BOM, soft hyphen
+	"\u200b", "", "\u200c", "", "\u200d", "", "\u2060", "", "\ufeff", "", "\u00ad", "",
+	// Khoảng trắng và ngắt dòng Unicode
+	"\u00a0", " ", "\u2002", " ", "\u2003", " ", "\u2009", " ", "\u202f", " ", "\u3000", " ",
+	"\r\n", "\n", "\r", "\n", "\u2028", "\n", "\u2029", "\n", "\f", "\n",
+	// Chữ ghép
+	"\ufb00", "ff", "\ufb01", "fi", "\ufb02", "fl", "\ufb03", "ffi", "\ufb04", "ffl", "\ufb05", "st", "\ufb06", "st",
+	// Ký hiệu đầu dòng của font Symbol/Wingdings
+	"\uf0b7", "•", "\uf0a7", "▪", "\uf0d8", "➢", "\uf0fc", "✓", "\uf06e", "■", "\uf076", "❖", "\uf0e0", "→",
+)
+
+// spacingTones chuyển dấu thanh dạng đứng riêng (spacing) thành dấu kết hợp (combining),
+// để NFC ghép lại được với nguyên âm đứng trước: "ha´t" → "hát".
+var spacingTones = map[rune]rune{
+	'\u00b4': '\u0301', // ´ → dấu sắc
+	'\u02ca': '\u0301', // ˊ → dấu sắc
+	'\u02cb': '\u0300', // ˋ → dấu huyền
+	'\u02dc': '\u0303', // ˜ → dấu ngã
+}
+
+// cp1252Bytes ánh xạ ngược Windows-1252 (và Latin-1 cho các byte 0x80–0x9F không xác định).
+var cp1252Bytes = func() map[rune]byte {
+	m := map[rune]byte{}
+	for b := 0x80; b <= 0xff; b++ {
+		m[rune(b)] = byte(b)
+		if r := charmap.Windows1252.DecodeByte(byte(b)); r != utf8.RuneError {
+			m[r] = byte(b)
+		}
+	}
+	return m
+}()
+
+// normalizeStats đếm các sửa chữa cần báo cho người dùng.
+type normalizeStats struct {
+	mojibakeFixed int // số dòng mojibake đã sửa được
+	mojibakeLeft  int // số dòng vẫn còn dấu hiệu mojibake
+	unreadable    int // số ký tự không đọc được (U+FFFD, ký tự PUA còn lại)
+}
+
+func (s *normalizeStats) add(o normalizeStats) {
+	s.mojibakeFixed += o.mojibakeFixed
+	s.mojibakeLeft += o.mojibakeLeft
+	s.unreadable += o.unreadable
+}
+
+// NormalizeText prepares extracted text for analysis, hashing and search: it repairs
+// mojibake lines, removes invisible characters, expands ligatures, maps symbol-font
+// glyphs, normalizes whitespace and line breaks and composes Unicode to NFC.
+func NormalizeText(s string) string {
+	text, _ := normalizeText(s)
+	return text
+}
+
+func normalizeText(s string) (string, normalizeStats) {
+	var stats normalizeStats
+	s = glyphReplacer.Replace(s)
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if mojibakeRe.MatchString(line) {
+			if fixed, ok := repairMojibakeLine(line); ok {
+				line = fixed
+				stats.mojibakeFixed++
+			} else {
+				stats.mojibakeLeft++
+			}
+		}
+		line = norm.NFC.String(fixRunes(line, &stats))
+		lines[i] = strings.TrimRight(spaceRunRe.ReplaceAllString(line, " "), " \t")
+	}
+	s = strings.Join(lines, "\n")
+	return lineBreakRe.ReplaceAllString(s, "\n\n"), stats
+}
+
+// fixRunes sửa dấu thanh đứng riêng, ký tự PUA của font Symbol và đếm ký tự không đọc được.
+func fixRunes(line string, stats *normalizeStats) string {
+	runes := []rune(line)
+	for i, r := range runes {
+		switch {
+		case spacingTones[r] != 0 && i > 0 && isVowel(runes[i-1]):
+			runes[i] = spacingTones[r]
+		case r >= 0xf020 && r <= 0xf07e:
+			// Font Symbol nhúng sai bảng mã: U+F0xx là ký tự ASCII 0xxx
+			runes[i] = r - 0xf000
+		case r == utf8.RuneError || unicode.In(r, unicode.Co):
+			stats.unreadable++
+		}
+	}
+	return string(runes)
+}
+
+func isVowel(r rune) bool {
+	base := []rune(foldDiacritics(string(unicode.ToLower(r))))
+	return len(base) == 1 && strings.ContainsRune("aeiouy", base[0])
+}
+
+// repairMojibakeLine sửa cả dòng; nếu dòng lẫn text đúng và text lỗi thì sửa từng từ.
+func repairMojibakeLine(line string) (string, bool) {
+	if fixed, ok := repairMojibake(line); ok {
+		return fixed, true
+	}
+	words := strings.Split(line, " ")
+	repaired := false
+	for i, w := range words {
+		if !mojibakeRe.MatchString(w) {
+			continue
+		}
+		if fixed, ok := repairMojibake(w); ok {
+			words[i] = fixed
+			repaired = true
+		}
+	}
+	fixed := strings.Join(words, " ")
+	return fixed, repaired && !mojibakeRe.MatchString(fixed)
+}
+
+// repairMojibake mã hoá lại một dòng bằng Windows-1252 rồi đọc thành UTF-8.
+// Chỉ chấp nhận khi mọi ký tự mã hoá được và kết quả là UTF-8 hợp lệ.
+func repairMojibake(line string) (string, bool) {
+	buf := make([]byte, 0, len(line))
+	for _, r := range line {
+		switch b, ok := cp1252Bytes[r]; {
+		case r < 0x80:
+			buf = append(buf, byte(r))
+		case ok:
+			buf = append(buf, b)
+		default:
+			return "", false
+		}
+	}
+	if !utf8.Valid(buf) {
+		return "", false
+	}
+	return string(buf), true
+}
+
+// normalize chuẩn hoá text của kết quả trích xuất, giữ text gốc trong RawText.
+// Offset của các trang được tính lại theo text đã chuẩn hoá.
+func (r *ExtractionResult) normalize() {
+	r.RawText = r.Text
+	var stats normalizeStats
+	if len(r.Pages) == 0 {
+		text, s := normalizeText(r.Text)
+		r.Text = text
+		stats.add(s)
+	} else {
+		for i := range r.Pages {
+			text, s := normalizeText(r.Pages[i].Text)
+			r.Pages[i].Text = text
+			stats.add(s)
+		}
+		r.Text = joinPages(r.Pages)
+	}
+
+	if stats.mojibakeFixed > 0 {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("Đã sửa %d dòng bị lỗi mã hoá ký tự (mojibake).", stats.mojibakeFixed))
+	}
+	if stats.mojibakeLeft > 0 {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("%d dòng có dấu hiệu lỗi mã hoá ký tự (mojibake) nhưng không tự sửa được.", stats.mojibakeLeft))
+	}
+	if stats.unreadable > 0 {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("Có %d ký tự không đọc được, có thể do font nhúng thiếu bảng mã Unicode.", stats.unreadable))
+	}
+}
@@ -0,0 +1,333 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/option"
+)
+
+// OCRResult is the text recognised on one page image.
+type OCRResult struct {
+	Text string
+	// Confidence nằm trong khoảng 0..1.
+	Confidence float64
+}
+
+// OCREngine recognises text in page images. Implementations must be safe for concurrent use.
+type OCREngine interface {
+	Name() string
+	Recognize(ctx context.Context, img *PageImage) (*OCRResult, error)
+}
+
+const (
+	// minTextLayerRunes: trang có ít chữ cái hơn ngưỡng này được coi là không có lớp text.
+	minTextLayerRunes = 20
+	// poorQualityThreshold: điểm chất lượng text dưới ngưỡng này sẽ sinh cảnh báo.
+	poorQualityThreshold = 0.6
+	ocrPageTimeout       = 2 * time.Minute
+)
+
+var (
+	defaultOCROnce   sync.Once
+	defaultOCREngine OCREngine
+)
+
+// DefaultOCREngine returns the OCR engine selected by the OCR_ENGINE environment variable:
+// "tesseract" (the default when the tesseract binary is installed), "gemini" or "none".
+// It returns nil when OCR is disabled.
+func DefaultOCREngine() OCREngine {
+	defaultOCROnce.Do(func() {
+		engine := strings.ToLower(strings.TrimSpace(os.Getenv("OCR_ENGINE")))
+		switch engine {
+		case "none", "off":
+		case "gemini":
+			defaultOCREngine = &GeminiOCR{Model: GeminiFlash25}
+		case "", "tesseract":
+			if _, err := exec.LookPath("tesseract"); err != nil {
+				if engine != "" {
+					log.Printf("Warning: OCR_ENGINE=tesseract but tesseract binary not found: %v", err)
+				}
+				return
+			}
+			langs := os.Getenv("OCR_LANGUAGES")
+			if langs == "" {
+				langs = "vie+eng"
+			}
+			defaultOCREngine = &TesseractOCR{Languages: langs}
+		default:
+			log.Printf("Warning: unknown OCR_ENGINE %q, OCR disabled", engine)
+		}
+		if defaultOCREngine != nil {
+			log.Printf("OCR engine: %s", defaultOCREngine.Name())
+		}
+	})
+	return defaultOCREngine
+}
+
+// recognizeScannedPages chạy OCR cho các trang hầu như không có lớp text nhưng có ảnh,
+// thay Lines của trang bằng kết quả nhận dạng và trả về các cảnh báo cho người dùng.
+func recognizeScannedPages(pages []ExtractedPage, images func() (*pdfImageSource, error), engine OCREngine) []string {
+	var candidates []int
+	for i := range pages {
+		if countLetters(joinLines(pages[i].Lines)) < minTextLayerRunes {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	source, err := images()
+	if err != nil {
+		log.Printf("Warning: cannot read page images: %v", err)
+		return []string{fmt.Sprintf("Không đọc được ảnh của %d trang không có lớp text, các trang này có thể bị thiếu nội dung.", len(candidates))}
+	}
+
+	var ocrPages, skipped, failed []int
+	if engine == nil {
+		// Không OCR được thì không cần giải mã ảnh, chỉ cần biết trang có ảnh (trang scan) hay trắng
+		for _, i := range candidates {
+			if page := &pages[i]; source.hasImage(page.Number) {
+				page.Source = PageSourceNone
+				skipped = append(skipped, page.Number)
+			}
+		}
+		if len(skipped) > 0 {
+			log.Printf("Warning: pages %s are scanned but OCR is disabled", formatPageList(skipped))
+		}
+		candidates = nil
+	}
+	for _, i := range candidates {
+		page := &pages[i]
+		img, err := source.PageImage(page.Number)
+		if errors.Is(err, errNoPageImage) {
+			continue // trang trắng
+		}
+		if err != nil {
+			log.Printf("Warning: page %d is scanned but cannot be OCRed: %v", page.Number, err)
+			page.Source = PageSourceNone
+			skipped = append(skipped, page.Number)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), ocrPageTimeout)
+		res, err := engine.Recognize(ctx, img)
+		cancel()
+		if err != nil {
+			log.Printf("Warning: OCR of page %d failed: %v", page.Number, err)
+			page.Source = PageSourceNone
+			failed = append(failed, page.Number)
+			continue
+		}
+		page.Lines = ocrLines(res.Text, page.Height)
+		page.Source = PageSourceOCR
+		page.Confidence = res.Confidence
+		ocrPages = append(ocrPages, page.Number)
+	}
+
+	var warnings []string
+	if len(ocrPages) > 0 {
+		warnings = append(warnings, fmt.Sprintf("Trang %s là bản scan, nội dung được nhận dạng bằng OCR (%s) và có thể có sai sót.", formatPageList(ocrPages), engine.Name()))
+	}
+	if len(skipped) > 0 {
+		warnings = append(warnings, fmt.Sprintf("Trang %s là bản scan nhưng không thể OCR, nội dung các trang này bị bỏ qua.", formatPageList(skipped)))
+	}
+	if len(failed) > 0 {
+		warnings = append(warnings, fmt.Sprintf("OCR thất bại ở trang %s, nội dung các trang này bị bỏ qua.", formatPageList(failed)))
+	}
+	return warnings
+}
+
+// ocrLines chuyển text OCR thành các dòng với toạ độ Y giảm dần, để việc lọc
+// header/footer theo vị trí vẫn hoạt động như với trang có lớp text.
+func ocrLines(text string, pageHeight float64) []TextLine {
+	var rows []string
+	for _, row := range strings.Split(text, "\n") {
+		if row = strings.TrimSpace(row); row != "" {
+			rows = append(rows, row)
+		}
+	}
+	if pageHeight <= 0 {
+		pageHeight = 842 // A4
+	}
+	step := pageHeight / float64(len(rows)+1)
+	lines := make([]TextLine, len(rows))
+	for i, row := range rows {
+		lines[i] = TextLine{Text: row, Y: pageHeight - step*float64(i+1)}
+	}
+	return lines
+}
+
+// qualityWarnings cảnh báo các trang có text chất lượng thấp (font lỗi, OCR kém).
+func qualityWarnings(pages []ExtractedPage) []string {
+	var poor []int
+	for _, p := range pages {
+		if p.Source != PageSourceNone && strings.TrimSpace(p.Text) != "" && p.Confidence < poorQualityThreshold {
+			poor = append(poor, p.Number)
+		}
+	}
+	if len(poor) == 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("Text trích xuất ở trang %s có chất lượng thấp, kết quả phân tích các trang này có thể không chính xác.", formatPageList(poor))}
+}
+
+// formatPageList in danh sách số trang, ví dụ "1, 3, 4".
+func formatPageList(numbers []int) string {
+	parts := make([]string, len(numbers))
+	for i, n := range numbers {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// TesseractOCR runs the local tesseract command-line tool.
+type TesseractOCR struct {
+	// Languages là danh sách ngôn ngữ của tesseract, ví dụ "vie+eng".
+	Languages string
+}
+
+func (t *TesseractOCR) Name() string { return "tesseract" }
+
+// Recognize gọi "tesseract stdin stdout tsv" và dựng lại text từ kết quả TSV theo từng dòng.
+func (t *TesseractOCR) Recognize(ctx context.Context, img *PageImage) (*OCRResult, error) {
+	cmd := exec.CommandContext(ctx, "tesseract", "stdin", "stdout", "-l", t.Languages, "tsv")
+	cmd.Stdin = bytes.NewReader(img.Data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("tesseract failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseTesseractTSV(out), nil
+}
+
+// parseTesseractTSV ghép các từ trong output TSV thành dòng và tính độ tin cậy trung bình.
+func parseTesseractTSV(out []byte) *OCRResult {
+	var sb strings.Builder
+	var confSum float64
+	words := 0
+	lastLine := ""
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		// level page_num block_num par_num line_num word_num left top width height conf text
+		cols := strings.Split(scanner.Text(), "\t")
+		if len(cols) < 12 || cols[0] != "5" {
+			continue
+		}
+		conf, err := strconv.ParseFloat(cols[10], 64)
+		text := strings.TrimSpace(cols[11])
+		if err != nil || conf < 0 || text == "" {
+			continue
+		}
+		line := strings.Join(cols[2:5], ".")
+		switch {
+		case sb.Len() == 0:
+		case line != lastLine:
+			sb.WriteByte('\n')
+		default:
+			sb.WriteByte(' ')
+		}
+		lastLine = line
+		sb.WriteString(text)
+		confSum += conf
+		words++
+	}
+	result := &OCRResult{Text: sb.String()}
+	if words > 0 {
+		result.Confidence = confSum / float64(words) / 100
+	}
+	return result
+}
+
+// GeminiOCR sends page images to a multimodal Gemini model for transcription.
+type GeminiOCR struct {
+	Model string
+}
+
+func (g *GeminiOCR) Name() string { return "gemini:" + g.Model }
+
+// Recognize nhờ model chép lại nguyên văn nội dung ảnh. Gemini không trả về độ tin cậy,
+// nên dùng điểm chất lượng của text thu được để ước lượng.
+func (g *GeminiOCR) Recognize(ctx context.Context, img *PageImage) (*OCRResult, error) {
+	format := strings.TrimPrefix(img.MIMEType, "image/")
+	if format != "jpeg" && format != "png" {
+		return nil, fmt.Errorf("gemini OCR does not support %s images", img.MIMEType)
+	}
+	apiKey := os.Getenv("GEMINI_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("GEMINI_API_KEY environment variable is not set")
+	}
+	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize Gemini client: %w", err)
+	}
+	defer client.Close()
+
+	model := client.GenerativeModel(g.Model)
+	prompt := genai.Text(`Chép lại CHÍNH XÁC toàn bộ văn bản trong ảnh trang tài liệu này, giữ nguyên dấu tiếng Việt và xuống dòng.
+Chỉ trả về nội dung văn bản, không giải thích, không định dạng markdown. Nếu trang không có chữ, trả về chuỗi rỗng.`)
+	resp, err := model.GenerateContent(ctx, genai.ImageData(format, img.Data), prompt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate content: %w", err)
+	}
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return &OCRResult{}, nil
+	}
+	var sb strings.Builder
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if txt, ok := part.(genai.Text); ok {
+			sb.WriteString(string(txt))
+		}
+	}
+	text := strings.TrimSpace(sb.String())
+	return &OCRResult{Text: text, Confidence: TextQualityScore(text)}, nil
+}
+
+// TextQualityScore estimates how clean extracted text is, from 0 (garbage) to 1.
+// Nó phạt các ký tự thay thế (U+FFFD), vùng Private Use, ký tự điều khiển và
+// tỉ lệ ký hiệu lạ cao — dấu hiệu của font thiếu bảng ToUnicode hoặc OCR kém.
+func TextQualityScore(text string) float64 {
+	total, good := 0, 0
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		total++
+		switch {
+		case r == unicode.ReplacementChar, unicode.Is(unicode.Co, r), unicode.IsControl(r):
+		case unicode.IsLetter(r), unicode.IsDigit(r), unicode.Is(unicode.Mn, r):
+			good++
+		case strings.ContainsRune(".,;:!?()[]\"'%/-–—+*&@#_=<>“”‘’…§$€₫", r):
+			good++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(good) / float64(total)
+}
+
+// countLetters đếm số chữ cái trong text.
+func countLetters(text string) int {
+	n := 0
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,424 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+
+	"github.com/ledongthuc/pdf"
+)
+
+var (
+	// ErrPDFPasswordRequired is returned when a PDF is encrypted and no password was given.
+	ErrPDFPasswordRequired = errors.New("encrypted PDF: password required")
+	// ErrPDFInvalidPassword is returned when the given password does not open the PDF.
+	ErrPDFInvalidPassword = errors.New("encrypted PDF: invalid password")
+)
+
+// pdfEncryption mô tả từ điển /Encrypt của Standard Security Handler.
+type pdfEncryption struct {
+	Filter          string
+	V, R            int
+	O, U, OE, UE    []byte
+	StmF, StrF      string
+	EncryptMetadata bool
+	ObjNum          int
+}
+
+// IsEncryptedPDF reports whether the PDF has an /Encrypt dictionary in its trailer.
+// Malformed files are reported as not encrypted.
+func IsEncryptedPDF(r io.ReaderAt, size int64) (encrypted bool) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			encrypted = false
+		}
+	}()
+	data, err := readAllAt(r, size)
+	if err != nil {
+		return false
+	}
+	trailer, err := findTrailer(data)
+	return err == nil && trailer["Encrypt"] != nil
+}
+
+// VerifyPDFPassword checks that password opens the PDF. Unencrypted files always pass.
+func VerifyPDFPassword(r io.ReaderAt, size int64, password string) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("malformed PDF: %v", rec)
+		}
+	}()
+	_, _, err = openPDF(r, size, password, DefaultLimits())
+	return err
+}
+
+// openPDF mở PDF, giải mã bằng password nếu file được mã hoá.
+// RC4 và AES-128 (V ≤ 4) do thư viện pdf xử lý; AES-256 (V5, R5/R6) được giải mã
+// trong bộ nhớ thành một bản PDF không mã hoá rồi mới đưa cho thư viện đọc.
+// Khi đó plain là bản PDF đã giải mã; với các trường hợp khác plain là nil.
+func openPDF(r io.ReaderAt, size int64, password string, limits Limits) (reader *pdf.Reader, plain []byte, err error) {
+	tried := false
+	reader, err = pdf.NewReaderEncrypted(r, size, func() string {
+		if tried {
+			return ""
+		}
+		tried = true
+		return password
+	})
+	if err == nil {
+		return reader, nil, nil
+	}
+	if errors.Is(err, pdf.ErrInvalidPassword) {
+		return nil, nil, passwordError(password)
+	}
+
+	data, readErr := readAllAt(r, size)
+	if readErr != nil {
+		return nil, nil, fmt.Errorf("failed to create PDF reader: %w", err)
+	}
+	enc, encErr := readPDFEncryption(data)
+	if encErr != nil || enc == nil || enc.V < 5 {
+		return nil, nil, fmt.Errorf("failed to create PDF reader: %w", err)
+	}
+	plain, err = decryptAES256PDF(data, enc, password, limits)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader, err = pdf.NewReader(bytes.NewReader(plain), int64(len(plain)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create PDF reader: %w", err)
+	}
+	return reader, plain, nil
+}
+
+func passwordError(password string) error {
+	if password == "" {
+		return ErrPDFPasswordRequired
+	}
+	return ErrPDFInvalidPassword
+}
+
+func readAllAt(r io.ReaderAt, size int64) ([]byte, error) {
+	if b, ok := r.(*bytes.Reader); ok && b.Size() == size {
+		data := make([]byte, size)
+		_, err := b.ReadAt(data, 0)
+		return data, err
+	}
+	return io.ReadAll(io.NewSectionReader(r, 0, size))
+}
+
+// readPDFEncryption đọc từ điển /Encrypt từ trailer; trả về nil nếu file không mã hoá.
+func readPDFEncryption(data []byte) (*pdfEncryption, error) {
+	trailer, err := findTrailer(data)
+	if err != nil {
+		return nil, err
+	}
+	var dict pdfDict
+	enc := &pdfEncryption{EncryptMetadata: true}
+	switch v := trailer["Encrypt"].(type) {
+	case nil:
+		return nil, nil
+	case pdfDict:
+		dict = v
+	case pdfRef:
+		obj := findObject(data, v.Num)
+		if obj == nil {
+			return nil, fmt.Errorf("malformed PDF: missing encryption dictionary")
+		}
+		dict, _ = obj.Value.(pdfDict)
+		enc.ObjNum = v.Num
+	}
+	if dict == nil {
+		return nil, fmt.Errorf("malformed PDF: invalid encryption dictionary")
+	}
+
+	name, _ := dict["Filter"].(pdfName)
+	enc.Filter = string(name)
+	v, _ := dict["V"].(int64)
+	r, _ := dict["R"].(int64)
+	enc.V, enc.R = int(v), int(r)
+	o, _ := dict["O"].(pdfString)
+	u, _ := dict["U"].(pdfString)
+	oe, _ := dict["OE"].(pdfString)
+	ue, _ := dict["UE"].(pdfString)
+	enc.O, enc.U, enc.OE, enc.UE = []byte(o), []byte(u), []byte(oe), []byte(ue)
+	stmf, _ := dict["StmF"].(pdfName)
+	strf, _ := dict["StrF"].(pdfName)
+	enc.StmF, enc.StrF = string(stmf), string(strf)
+	if b, ok := dict["EncryptMetadata"].(bool); ok {
+		enc.EncryptMetadata = b
+	}
+	return enc, nil
+}
+
+// findObject tìm phiên bản cuối cùng của một indirect object theo số hiệu.
+func findObject(data []byte, num int) *pdfObject {
+	want := strconv.Itoa(num)
+	var found *pdfObject
+	for _, m := range objHeaderRe.FindAllSubmatchIndex(data, -1) {
+		if string(data[m[2]:m[3]]) != want {
+			continue
+		}
+		if obj, _, err := parseObjectAt(data, m[0]); err == nil {
+			found = obj
+		}
+	}
+	return found
+}
+
+// aes256FileKey xác thực password theo ISO 32000-2 (Algorithm 2.A) và trả về khoá file.
+// Thử password như user password trước, sau đó như owner password.
+func aes256FileKey(enc *pdfEncryption, password string) ([]byte, error) {
+	if enc.Filter != "Standard" {
+		return nil, fmt.Errorf("unsupported PDF: encryption filter %s", enc.Filter)
+	}
+	if enc.R != 5 && enc.R != 6 {
+		return nil, fmt.Errorf("unsupported PDF: encryption revision R=%d", enc.R)
+	}
+	if len(enc.U) < 48 || len(enc.O) < 48 || len(enc.UE) < 32 || len(enc.OE) < 32 {
+		return nil, fmt.Errorf("malformed PDF: missing AES-256 encryption parameters")
+	}
+	pw := []byte(password)
+	if len(pw) > 127 {
+		pw = pw[:127]
+	}
+	u, o := enc.U[:48], enc.O[:48]
+
+	if bytes.Equal(pdfHash(enc.R, pw, u[32:40], nil), u[:32]) {
+		return aesNoIVDecrypt(pdfHash(enc.R, pw, u[40:48], nil), enc.UE[:32])
+	}
+	if bytes.Equal(pdfHash(enc.R, pw, o[32:40], u), o[:32]) {
+		return aesNoIVDecrypt(pdfHash(enc.R, pw, o[40:48], u), enc.OE[:32])
+	}
+	return nil, passwordError(password)
+}
+
+// pdfHash là hàm băm mật khẩu của R5 (SHA-256) và R6 (Algorithm 2.B).
+func pdfHash(revision int, password, salt, udata []byte) []byte {
+	h := sha256.New()
+	h.Write(password)
+	h.Write(salt)
+	h.Write(udata)
+	k := h.Sum(nil)
+	if revision == 5 {
+		return k
+	}
+
+	for round := 0; ; round++ {
+		var k1 []byte
+		for i := 0; i < 64; i++ {
+			k1 = append(k1, password...)
+			k1 = append(k1, k...)
+			k1 = append(k1, udata...)
+		}
+		block, _ := aes.NewCipher(k[:16])
+		e := make([]byte, len(k1))
+		cipher.NewCBCEncrypter(block, k[16:32]).CryptBlocks(e, k1)
+
+		sum := 0
+		for _, b := range e[:16] {
+			sum += int(b)
+		}
+		var next hash.Hash
+		switch sum % 3 {
+		case 0:
+			next = sha256.New()
+		case 1:
+			next = sha512.New384()
+		default:
+			next = sha512.New()
+		}
+		next.Write(e)
+		k = next.Sum(nil)
+
+		if round >= 63 && int(e[len(e)-1]) <= round+1-32 {
+			break
+		}
+	}
+	return k[:32]
+}
+
+func aesNoIVDecrypt(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(out, data)
+	return out, nil
+}
+
+// aesCBCDecrypt giải mã chuỗi/stream AES: 16 byte đầu là IV, cuối có padding PKCS#7.
+func aesCBCDecrypt(key, data []byte) []byte {
+	if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		if len(data) == aes.BlockSize {
+			return nil // chỉ có IV: chuỗi rỗng
+		}
+		return data
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return data
+	}
+	out := make([]byte, len(data)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(out, data[aes.BlockSize:])
+	if pad := int(out[len(out)-1]); pad > 0 && pad <= aes.BlockSize && pad <= len(out) {
+		out = out[:len(out)-pad]
+	}
+	return out
+}
+
+// decryptAES256PDF giải mã toàn bộ chuỗi và stream của file PDF AES-256,
+// tách các object stream thành object thường và ghi lại thành PDF không mã hoá.
+func decryptAES256PDF(data []byte, enc *pdfEncryption, password string, limits Limits) ([]byte, error) {
+	key, err := aes256FileKey(enc, password)
+	if err != nil {
+		return nil, err
+	}
+	trailer, err := findTrailer(data)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := scanObjects(data)
+	out := map[int]*pdfObject{}
+	put := func(obj *pdfObject) {
+		if prev, ok := out[obj.Num]; !ok || prev.Offset <= obj.Offset {
+			out[obj.Num] = obj
+		}
+	}
+	for num, obj := range objects {
+		if num == enc.ObjNum {
+			continue
+		}
+		dict, _ := obj.Value.(pdfDict)
+		typ, _ := dict["Type"].(pdfName)
+		if typ == "XRef" {
+			continue
+		}
+		obj.Value = decryptStrings(obj.Value, key, enc.StrF == "Identity")
+
+		if obj.IsStream && enc.StmF != "Identity" && !(typ == "Metadata" && !enc.EncryptMetadata) {
+			obj.Stream = aesCBCDecrypt(key, obj.Stream)
+		}
+		if typ == "ObjStm" {
+			inner, err := expandObjectStream(obj, limits)
+			if err != nil {
+				return nil, err
+			}
+			for _, o := range inner {
+				put(o)
+			}
+			continue
+		}
+		put(obj)
+	}
+
+	plainTrailer := pdfDict{}
+	for _, k := range []pdfName{"Root", "Info", "ID"} {
+		if v, ok := trailer[k]; ok {
+			plainTrailer[k] = v
+		}
+	}
+	return writePDF(out, plainTrailer)
+}
+
+// decryptStrings giải mã mọi chuỗi trong một giá trị PDF. /Contents của từ điển chữ ký
+// (có /ByteRange) không bao giờ được mã hoá nên được giữ nguyên.
+func decryptStrings(v any, key []byte, identity bool) any {
+	if identity {
+		return v
+	}
+	switch v := v.(type) {
+	case pdfString:
+		return pdfString(aesCBCDecrypt(key, []byte(v)))
+	case pdfArray:
+		for i := range v {
+			v[i] = decryptStrings(v[i], key, identity)
+		}
+	case pdfDict:
+		_, isSig := v["ByteRange"]
+		for k := range v {
+			if isSig && k == "Contents" {
+				continue
+			}
+			v[k] = decryptStrings(v[k], key, identity)
+		}
+	}
+	return v
+}
+
+// expandObjectStream tách các object nằm trong một object stream (/Type /ObjStm) đã giải mã.
+// Object stream hỏng bị bỏ qua; lỗi chỉ được trả về khi stream vượt giới hạn giải nén.
+func expandObjectStream(obj *pdfObject, limits Limits) ([]*pdfObject, error) {
+	dict, _ := obj.Value.(pdfDict)
+	raw := obj.Stream
+	var err error
+	switch f := dict["Filter"].(type) {
+	case nil:
+	case pdfName:
+		if f != "FlateDecode" {
+			return nil, nil
+		}
+		raw, err = inflate(raw, limits)
+	case pdfArray:
+		if len(f) != 1 || f[0] != pdfName("FlateDecode") {
+			return nil, nil
+		}
+		raw, err = inflate(raw, limits)
+	}
+	if errors.Is(err, ErrLimitExceeded) {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, nil
+	}
+
+	n, _ := dict["N"].(int64)
+	first, _ := dict["First"].(int64)
+	if first <= 0 || int(first) > len(raw) {
+		return nil, nil
+	}
+	l := &pdfLexer{data: raw[:first]}
+	var objs []*pdfObject
+	for i := int64(0); i < n; i++ {
+		num, err1 := strconv.Atoi(l.token())
+		off, err2 := strconv.Atoi(l.token())
+		if err1 != nil || err2 != nil || num < 0 || off < 0 || int(first)+off >= len(raw) {
+			break
+		}
+		vl := &pdfLexer{data: raw, pos: int(first) + off}
+		v, err := vl.value()
+		if err != nil {
+			continue
+		}
+		objs = append(objs, &pdfObject{Num: num, Value: v, Offset: obj.Offset})
+	}
+	return objs, nil
+}
+
+// inflate giải nén dữ liệu Flate, giữ phần đọc được nếu dữ liệu bị cắt cụt. Trả về
+// LimitError khi dữ liệu giải nén lớn hơn limits.MaxExpandedBytes.
+func inflate(data []byte, limits Limits) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(io.LimitReader(zr, limits.MaxExpandedBytes+1))
+	if int64(len(out)) > limits.MaxExpandedBytes {
+		return nil, &LimitError{Subject: "PDF stream", Limit: "MB uncompressed", Max: limits.MaxExpandedBytes >> 20}
+	}
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testdata/aes256_r6.pdf được tạo bằng testdata/gen_aes256_pdf.py, một bản cài đặt mã hoá
+// AES-256 (R6) độc lập với mã Go; các giá trị băm dưới đây là kết quả của script đó.
+const (
+	aes256Fixture       = "testdata/aes256_r6.pdf"
+	aes256FixtureText   = "Hop dong ma hoa AES-256"
+	aes256FixtureTitle  = "Hop dong mau"
+	aes256UserPassword  = "user"
+	aes256OwnerPassword = "owner"
+)
+
+func readAES256Fixture(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile(aes256Fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestPDFHashR6(t *testing.T) {
+	data := readAES256Fixture(t)
+	enc, err := readPDFEncryption(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		password string
+		salt     string
+		udata    []byte
+		want     string
+	}{
+		{"user validation", aes256UserPassword, "UVSALT01", nil,
+			"2767bfdcbf33c97e7801a89cb7525250849f8643c4783ca21967491d65b0a9de"},
+		{"owner validation", aes256OwnerPassword, "OVSALT01", enc.U[:48],
+			"8a315bf69dd058f051451db82b059609a733a4f9f4ebc58b17c6de8eccea3284"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pdfHash(6, []byte(tt.password), []byte(tt.salt), tt.udata)
+			if want := mustHex(t, tt.want); !bytes.Equal(got, want) {
+				t.Errorf("pdfHash = %x, want %x", got, want)
+			}
+		})
+	}
+}
+
+func TestAES256FileKey(t *testing.T) {
+	enc, err := readPDFEncryption(readAES256Fixture(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enc.V != 5 || enc.R != 6 {
+		t.Fatalf("V=%d R=%d, want V=5 R=6", enc.V, enc.R)
+	}
+	// Khoá file cố định trong script tạo fixture: các byte 0x40..0x5f
+	want := make([]byte, 32)
+	for i := range want {
+		want[i] = byte(0x40 + i)
+	}
+	for _, password := range []string{aes256UserPassword, aes256OwnerPassword} {
+		key, err := aes256FileKey(enc, password)
+		if err != nil {
+			t.Errorf("password %q: %v", password, err)
+		} else if !bytes.Equal(key, want) {
+			t.Errorf("password %q: file key = %x, want %x", password, key, want)
+		}
+	}
+	if _, err := aes256FileKey(enc, "wrong"); !errors.Is(err, ErrPDFInvalidPassword) {
+		t.Errorf("wrong password: err = %v, want ErrPDFInvalidPassword", err)
+	}
+}
+
+func TestDecryptAES256PDF(t *testing.T) {
+	data := readAES256Fixture(t)
+	enc, err := readPDFEncryption(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := decryptAES256PDF(data, enc, aes256UserPassword, Limits{}.withDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	trailer, err := findTrailer(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trailer["Encrypt"] != nil {
+		t.Error("decrypted PDF still has /Encrypt")
+	}
+	objects := scanObjects(plain)
+	info, _ := resolvePDF(objects, trailer["Info"]).(pdfDict)
+	if title, _ := info["Title"].(pdfString); title != aes256FixtureTitle {
+		t.Errorf("Title = %q, want %q", title, aes256FixtureTitle)
+	}
+	if content := objects[5]; content == nil || !bytes.Contains(content.Stream, []byte(aes256FixtureText)) {
+		t.Errorf("content stream was not decrypted")
+	}
+}
+
+func TestExtractPDFAES256(t *testing.T) {
+	data := readAES256Fixture(t)
+	r := bytes.NewReader(data)
+	if !IsEncryptedPDF(r, r.Size()) {
+		t.Fatal("IsEncryptedPDF = false")
+	}
+	tests := []struct {
+		password string
+		wantErr  error
+	}{
+		{"", ErrPDFPasswordRequired},
+		{"wrong", ErrPDFInvalidPassword},
+		{aes256UserPassword, nil},
+		{aes256OwnerPassword, nil},
+	}
+	for _, tt := range tests {
+		result, err := ExtractPDF(r, r.Size(), ExtractOptions{Password: tt.password})
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("password %q: err = %v, want %v", tt.password, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("password %q: %v", tt.password, err)
+			continue
+		}
+		if !strings.Contains(result.Text, aes256FixtureText) {
+			t.Errorf("password %q: text = %q, want it to contain %q", tt.password, result.Text, aes256FixtureText)
+		}
+	}
+}
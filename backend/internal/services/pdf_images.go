@@ -0,0 +1,404 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+
+	"golang.org/x/image/ccitt"
+)
+
+// PageImage is the rendered or embedded image of one page, ready to be sent to an OCR engine.
+type PageImage struct {
+	PageNumber int
+	MIMEType   string
+	Data       []byte
+}
+
+// pdfImageSource cho phép lấy ảnh gốc được nhúng trong từng trang của file PDF.
+type pdfImageSource struct {
+	objects map[int]*pdfObject
+	pages   []pdfDict // tài nguyên (Resources) của từng trang, theo thứ tự trang
+	// limits giới hạn dung lượng giải nén và số điểm ảnh của ảnh được giải mã
+	limits Limits
+}
+
+// newPDFImageSource dựng cây trang từ dữ liệu PDF không mã hoá (hoặc đã giải mã).
+func newPDFImageSource(data []byte, limits Limits) (*pdfImageSource, error) {
+	trailer, err := findTrailer(data)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := loadObjects(data, limits)
+	if err != nil {
+		return nil, err
+	}
+	src := &pdfImageSource{objects: objects, limits: limits}
+	root, _ := resolvePDF(src.objects, trailer["Root"]).(pdfDict)
+	if root == nil {
+		return nil, fmt.Errorf("malformed PDF: missing document catalog")
+	}
+	src.walkPages(resolvePDF(src.objects, root["Pages"]), nil, 0)
+	return src, nil
+}
+
+func (s *pdfImageSource) walkPages(node any, inherited pdfDict, depth int) {
+	dict, _ := node.(pdfDict)
+	if dict == nil || depth > 32 {
+		return
+	}
+	resources := inherited
+	if res, ok := resolvePDF(s.objects, dict["Resources"]).(pdfDict); ok {
+		resources = res
+	}
+	if typ, _ := dict["Type"].(pdfName); typ == "Page" {
+		s.pages = append(s.pages, resources)
+		return
+	}
+	kids, _ := resolvePDF(s.objects, dict["Kids"]).(pdfArray)
+	for _, kid := range kids {
+		s.walkPages(resolvePDF(s.objects, kid), resources, depth+1)
+	}
+}
+
+// errNoPageImage: trang không có ảnh nào (trang trắng chứ không phải trang scan).
+var errNoPageImage = errors.New("page has no image")
+
+// hasImage cho biết trang (1-based) có vẽ ảnh nào không, không giải mã dữ liệu ảnh.
+func (s *pdfImageSource) hasImage(pageNumber int) bool {
+	return pageNumber >= 1 && pageNumber <= len(s.pages) && s.largestImage(s.pages[pageNumber-1], 0) != nil
+}
+
+// PageImage trả về ảnh lớn nhất được vẽ trên trang (1-based), ở dạng JPEG, JPEG 2000 hoặc PNG.
+func (s *pdfImageSource) PageImage(pageNumber int) (*PageImage, error) {
+	if pageNumber < 1 || pageNumber > len(s.pages) {
+		return nil, fmt.Errorf("page %d not found", pageNumber)
+	}
+	img := s.largestImage(s.pages[pageNumber-1], 0)
+	if img == nil {
+		return nil, errNoPageImage
+	}
+	mime, data, err := s.decodeImage(img)
+	if err != nil {
+		return nil, fmt.Errorf("page %d: %w", pageNumber, err)
+	}
+	return &PageImage{PageNumber: pageNumber, MIMEType: mime, Data: data}, nil
+}
+
+// largestImage tìm image XObject có diện tích lớn nhất, kể cả ảnh nằm trong form XObject.
+func (s *pdfImageSource) largestImage(resources pdfDict, depth int) *pdfObject {
+	if resources == nil || depth > 3 {
+		return nil
+	}
+	xobjects, _ := resolvePDF(s.objects, resources["XObject"]).(pdfDict)
+	var best *pdfObject
+	bestArea := int64(0)
+	for _, v := range xobjects {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			continue
+		}
+		obj := s.objects[ref.Num]
+		if obj == nil || !obj.IsStream {
+			continue
+		}
+		dict, _ := obj.Value.(pdfDict)
+		switch dict["Subtype"] {
+		case pdfName("Image"):
+			w, _ := dict["Width"].(int64)
+			h, _ := dict["Height"].(int64)
+			if w*h > bestArea {
+				best, bestArea = obj, w*h
+			}
+		case pdfName("Form"):
+			res, _ := resolvePDF(s.objects, dict["Resources"]).(pdfDict)
+			if inner := s.largestImage(res, depth+1); inner != nil {
+				d, _ := inner.Value.(pdfDict)
+				w, _ := d["Width"].(int64)
+				h, _ := d["Height"].(int64)
+				if w*h > bestArea {
+					best, bestArea = inner, w*h
+				}
+			}
+		}
+	}
+	return best
+}
+
+// decodeImage chuyển dữ liệu ảnh trong PDF thành định dạng OCR đọc được.
+func (s *pdfImageSource) decodeImage(obj *pdfObject) (string, []byte, error) {
+	dict, _ := obj.Value.(pdfDict)
+	var filters []string
+	var params []pdfDict
+	switch f := resolvePDF(s.objects, dict["Filter"]).(type) {
+	case pdfName:
+		filters = []string{string(f)}
+		p, _ := resolvePDF(s.objects, dict["DecodeParms"]).(pdfDict)
+		params = []pdfDict{p}
+	case pdfArray:
+		ps, _ := resolvePDF(s.objects, dict["DecodeParms"]).(pdfArray)
+		for i, name := range f {
+			n, _ := name.(pdfName)
+			filters = append(filters, string(n))
+			var p pdfDict
+			if i < len(ps) {
+				p, _ = resolvePDF(s.objects, ps[i]).(pdfDict)
+			}
+			params = append(params, p)
+		}
+	}
+
+	data := obj.Stream
+	for i, f := range filters {
+		switch f {
+		case "FlateDecode", "Fl":
+			var err error
+			if data, err = inflate(data, s.limits); errors.Is(err, ErrLimitExceeded) {
+				return "", nil, err
+			} else if data == nil {
+				return "", nil, fmt.Errorf("corrupt Flate image data")
+			}
+			if pred, _ := params[i]["Predictor"].(int64); pred >= 10 {
+				colors, bpc, width := imageLayout(dict, params[i], s.objects)
+				if err := checkImageLayout(colors, bpc); err != nil {
+					return "", nil, err
+				}
+				data = undoPNGPredictor(data, (colors*bpc*width+7)/8, (colors*bpc+7)/8)
+			}
+		case "DCTDecode", "DCT":
+			return "image/jpeg", data, nil
+		case "JPXDecode":
+			return "image/jp2", data, nil
+		case "CCITTFaxDecode", "CCF":
+			return encodePNG(decodeCCITT(data, dict, params[i], s.limits))
+		default:
+			return "", nil, fmt.Errorf("unsupported image filter %s", f)
+		}
+	}
+	return encodePNG(rawPixels(data, dict, s.objects, s.limits))
+}
+
+// maxImageColors là số kênh màu tối đa của một color space (DeviceN có tối đa 32 kênh).
+const maxImageColors = 32
+
+// checkImageLayout kiểm tra số kênh màu và số bit mỗi kênh đọc từ file trước khi tính độ dài hàng.
+func checkImageLayout(colors, bpc int) error {
+	if colors < 1 || colors > maxImageColors || bpc < 1 || bpc > 16 {
+		return fmt.Errorf("unsupported image layout: %d colors, %d bits per component", colors, bpc)
+	}
+	return nil
+}
+
+// imageLayout trả về số kênh màu, số bit mỗi kênh và chiều rộng ảnh.
+func imageLayout(dict, params pdfDict, objects map[int]*pdfObject) (colors, bpc, width int) {
+	w, _ := dict["Width"].(int64)
+	b, _ := dict["BitsPerComponent"].(int64)
+	if c, ok := params["Colors"].(int64); ok {
+		colors = int(c)
+	} else {
+		colors = colorComponents(resolvePDF(objects, dict["ColorSpace"]), objects)
+	}
+	if mask, _ := dict["ImageMask"].(bool); mask {
+		colors, b = 1, 1
+	}
+	if b == 0 {
+		b = 8
+	}
+	return colors, int(b), int(w)
+}
+
+func colorComponents(cs any, objects map[int]*pdfObject) int {
+	switch v := cs.(type) {
+	case pdfName:
+		switch v {
+		case "DeviceRGB", "RGB", "CalRGB", "Lab":
+			return 3
+		case "DeviceCMYK", "CMYK":
+			return 4
+		}
+	case pdfArray:
+		if len(v) == 0 {
+			return 1
+		}
+		switch v[0] {
+		case pdfName("ICCBased"):
+			if len(v) > 1 {
+				if ref, ok := v[1].(pdfRef); ok && objects[ref.Num] != nil {
+					d, _ := objects[ref.Num].Value.(pdfDict)
+					if n, ok := d["N"].(int64); ok {
+						return int(n)
+					}
+				}
+			}
+		case pdfName("CalRGB"), pdfName("Lab"):
+			return 3
+		}
+	}
+	return 1
+}
+
+// undoPNGPredictor đảo ngược bộ lọc PNG (Predictor >= 10) trên từng hàng.
+func undoPNGPredictor(data []byte, rowLen, bpp int) []byte {
+	if rowLen <= 0 {
+		return data
+	}
+	if len(data) < rowLen+1 {
+		return nil // không đủ dữ liệu cho một hàng
+	}
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, rowLen)
+	for len(data) >= rowLen+1 {
+		ft, row := data[0], append([]byte(nil), data[1:rowLen+1]...)
+		data = data[rowLen+1:]
+		for i := range row {
+			var left, up, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i-bpp], prev[i-bpp]
+			}
+			up = prev[i]
+			switch ft {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := absInt(p-int(a)), absInt(p-int(b)), absInt(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// rawPixels dựng ảnh từ dữ liệu điểm ảnh chưa nén (sau Flate) theo ColorSpace của ảnh.
+func rawPixels(data []byte, dict pdfDict, objects map[int]*pdfObject, limits Limits) (image.Image, error) {
+	colors, bpc, width := imageLayout(dict, nil, objects)
+	h, _ := dict["Height"].(int64)
+	if err := checkImageSize(int64(width), h, limits); err != nil {
+		return nil, err
+	}
+	height := int(h)
+	if err := checkImageLayout(colors, bpc); err != nil {
+		return nil, err
+	}
+	if bpc != 1 && bpc != 8 {
+		return nil, fmt.Errorf("unsupported image depth %d", bpc)
+	}
+
+	// Ảnh Indexed: tra bảng màu để ra ảnh xám/RGB thật.
+	var palette []byte
+	paletteColors := 0
+	if cs, ok := resolvePDF(objects, dict["ColorSpace"]).(pdfArray); ok && len(cs) == 4 && cs[0] == pdfName("Indexed") {
+		paletteColors = colorComponents(resolvePDF(objects, cs[1]), objects)
+		switch lookup := resolvePDF(objects, cs[3]).(type) {
+		case pdfString:
+			palette = []byte(lookup)
+		}
+		if ref, ok := cs[3].(pdfRef); ok && objects[ref.Num] != nil && objects[ref.Num].IsStream {
+			palette = objects[ref.Num].Stream
+		}
+	}
+
+	rowLen := (colors*bpc*width + 7) / 8
+	if len(data) < rowLen*height {
+		return nil, fmt.Errorf("truncated image data")
+	}
+	mask, _ := dict["ImageMask"].(bool)
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		row := data[y*rowLen : (y+1)*rowLen]
+		for x := 0; x < width; x++ {
+			if bpc == 1 {
+				bit := row[x/8] >> (7 - uint(x%8)) & 1
+				v := bit * 255
+				if mask {
+					v = 255 - v // mặt nạ: bit 1 là phần không vẽ (nền trắng)
+				}
+				img.Set(x, y, color.Gray{Y: v})
+				continue
+			}
+			px := row[x*colors : (x+1)*colors]
+			if palette != nil && paletteColors > 0 {
+				if i := int(px[0]) * paletteColors; i+paletteColors <= len(palette) {
+					px = palette[i : i+paletteColors]
+				}
+			}
+			switch len(px) {
+			case 3:
+				img.Set(x, y, color.RGBA{px[0], px[1], px[2], 255})
+			case 4:
+				img.Set(x, y, color.CMYK{C: px[0], M: px[1], Y: px[2], K: px[3]})
+			default:
+				img.Set(x, y, color.Gray{Y: px[0]})
+			}
+		}
+	}
+	return img, nil
+}
+
+// decodeCCITT giải mã ảnh fax (Group 3/4), định dạng phổ biến của máy scan văn bản đen trắng.
+func decodeCCITT(data []byte, dict, params pdfDict, limits Limits) (image.Image, error) {
+	k, _ := params["K"].(int64)
+	columns, ok := params["Columns"].(int64)
+	if !ok {
+		columns = 1728
+	}
+	rows, _ := params["Rows"].(int64)
+	if rows == 0 {
+		rows, _ = dict["Height"].(int64)
+	}
+	if k > 0 {
+		return nil, fmt.Errorf("unsupported CCITT mixed 1D/2D encoding")
+	}
+	if err := checkImageSize(columns, rows, limits); err != nil {
+		return nil, err
+	}
+	sf := ccitt.Group3
+	if k < 0 {
+		sf = ccitt.Group4
+	}
+	blackIs1, _ := params["BlackIs1"].(bool)
+	align, _ := params["EncodedByteAlign"].(bool)
+	img := image.NewGray(image.Rect(0, 0, int(columns), int(rows)))
+	err := ccitt.DecodeIntoGray(img, bytes.NewReader(data), ccitt.MSB, sf, &ccitt.Options{Align: align, Invert: blackIs1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode CCITT image: %w", err)
+	}
+	return img, nil
+}
+
+func encodePNG(img image.Image, err error) (string, []byte, error) {
+	if err != nil {
+		return "", nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", nil, err
+	}
+	return "image/png", buf.Bytes(), nil
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func deflate(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// scannedPagePDF tạo file PDF một trang chỉ có một image XObject với từ điển imageDict.
+func scannedPagePDF(imageDict string, stream []byte) []byte {
+	objects := []string{
+		"<</Type /Catalog /Pages 2 0 R>>",
+		"<</Type /Pages /Kids [3 0 R] /Count 1>>",
+		"<</Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources <</XObject <</Im0 4 0 R>>>>>>",
+		fmt.Sprintf("<<%s /Length %d>>\nstream\n%s\nendstream", imageDict, len(stream), stream),
+	}
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+	for i, body := range objects {
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 1\n0000000000 65535 f \ntrailer\n<</Root 1 0 R>>\nstartxref\n%d\n%%%%EOF\n", xref)
+	return buf.Bytes()
+}
+
+func TestPageImageLimits(t *testing.T) {
+	limits := Limits{MaxExpandedBytes: 1 << 20, MaxImagePixels: 1000000}.withDefaults()
+	tests := []struct {
+		name      string
+		dict      string
+		stream    []byte
+		wantLimit bool
+	}{
+		{"gray image", "/Subtype /Image /Width 2 /Height 2 /BitsPerComponent 8 /ColorSpace /DeviceGray",
+			[]byte{0, 255, 255, 0}, false},
+		{"huge declared size", "/Subtype /Image /Width 100000 /Height 100000 /BitsPerComponent 1 /ColorSpace /DeviceGray /Filter /FlateDecode",
+			deflate(t, make([]byte, 1000)), true},
+		{"huge CCITT size", "/Subtype /Image /Width 10 /Height 10 /Filter /CCITTFaxDecode /DecodeParms <</K -1 /Columns 100000 /Rows 100000>>",
+			[]byte{0}, true},
+		{"decompression bomb", "/Subtype /Image /Width 10 /Height 10 /BitsPerComponent 8 /ColorSpace /DeviceGray /Filter /FlateDecode",
+			deflate(t, make([]byte, 2<<20)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := newPDFImageSource(scannedPagePDF(tt.dict, tt.stream), limits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !src.hasImage(1) {
+				t.Fatal("hasImage(1) = false")
+			}
+			img, err := src.PageImage(1)
+			var limitErr *LimitError
+			if got := errors.As(err, &limitErr); got != tt.wantLimit {
+				t.Fatalf("PageImage error = %v, want LimitError: %v", err, tt.wantLimit)
+			}
+			if !tt.wantLimit && (err != nil || img.MIMEType != "image/png") {
+				t.Errorf("PageImage = %+v, %v", img, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,366 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// Các ngưỡng dùng khi dựng lại bố cục, tính theo bội số cỡ chữ.
+const (
+	rowToleranceRatio   = 0.4 // hai glyph có Y chênh lệch dưới ngưỡng này thuộc cùng một hàng
+	wordGapRatio        = 0.2 // khoảng trống lớn hơn ngưỡng này được coi là dấu cách
+	fragmentGapRatio    = 1.5 // khoảng trống lớn hơn ngưỡng này tách hàng thành các đoạn riêng (cột, ô bảng)
+	minColumnFragments  = 3   // số đoạn tối thiểu ở mỗi bên để coi trang là hai cột
+	maxSpanningFraction = 0.2 // tỉ lệ tối đa các dòng vắt qua rãnh giữa hai cột
+	edgeLinesPerPage    = 2   // số dòng trên cùng/dưới cùng được xét là header/footer
+	edgeMarginRatio     = 0.1 // header/footer phải nằm trong 10% chiều cao trang ở mép trên hoặc dưới
+	edgeBucket          = 10  // độ lệch dọc (point) được coi là cùng vị trí giữa các trang
+)
+
+var (
+	pageNumberRe = regexp.MustCompile(`(?i)^[-–—\s]*(page|trang)?\s*\d{1,4}\s*((/|of|trên|\|)\s*\d{1,4})?[-–—\s]*$`)
+	digitsRe     = regexp.MustCompile(`\d+`)
+)
+
+// fragment là một đoạn text liền mạch trên một hàng.
+type fragment struct {
+	text     string
+	x0, x1   float64
+	y        float64
+	fontSize float64
+	row      int
+}
+
+// layoutPage dựng lại các dòng của một trang PDF theo thứ tự đọc.
+func layoutPage(glyphs []pdf.Text, pageWidth float64) []TextLine {
+	rows := groupRows(glyphs)
+	var frags []fragment
+	for i, row := range rows {
+		for _, f := range splitRow(row) {
+			f.row = i
+			frags = append(frags, f)
+		}
+	}
+	if len(frags) == 0 {
+		return nil
+	}
+
+	if pageWidth <= 0 {
+		for _, f := range frags {
+			pageWidth = math.Max(pageWidth, f.x1)
+		}
+	}
+	gutter, ok := findGutter(frags, pageWidth)
+	if !ok {
+		return mergeFragments(frags, func(fragment) int { return 0 })
+	}
+
+	column := func(f fragment) int {
+		switch {
+		case f.x1 <= gutter:
+			return 0
+		case f.x0 >= gutter:
+			return 1
+		default:
+			return -1
+		}
+	}
+
+	// Các dòng vắt qua rãnh (tiêu đề, đoạn toàn trang) chia trang thành từng phần;
+	// trong mỗi phần đọc hết cột trái rồi mới sang cột phải.
+	var ordered []fragment
+	var left, right []fragment
+	flush := func() {
+		ordered = append(ordered, left...)
+		ordered = append(ordered, right...)
+		left, right = nil, nil
+	}
+	for _, f := range frags {
+		switch column(f) {
+		case 0:
+			left = append(left, f)
+		case 1:
+			right = append(right, f)
+		default:
+			flush()
+			ordered = append(ordered, f)
+		}
+	}
+	flush()
+	return mergeFragments(ordered, column)
+}
+
+// groupRows gom các glyph có cùng toạ độ Y thành hàng, từ trên xuống dưới.
+func groupRows(glyphs []pdf.Text) [][]pdf.Text {
+	var usable []pdf.Text
+	for _, g := range glyphs {
+		if g.S == "" || g.S == "\n" || g.S == "\r" {
+			continue
+		}
+		usable = append(usable, g)
+	}
+	sort.SliceStable(usable, func(i, j int) bool {
+		if usable[i].Y != usable[j].Y {
+			return usable[i].Y > usable[j].Y
+		}
+		return usable[i].X < usable[j].X
+	})
+
+	var rows [][]pdf.Text
+	var rowY, rowSize float64
+	for _, g := range usable {
+		tol := math.Max(2, rowToleranceRatio*math.Max(rowSize, glyphSize(g)))
+		if len(rows) == 0 || math.Abs(rowY-g.Y) > tol {
+			rows = append(rows, nil)
+			rowY, rowSize = g.Y, glyphSize(g)
+		}
+		rows[len(rows)-1] = append(rows[len(rows)-1], g)
+	}
+	for _, row := range rows {
+		sort.SliceStable(row, func(i, j int) bool { return row[i].X < row[j].X })
+	}
+	return rows
+}
+
+// splitRow ghép glyph trong một hàng thành chữ, chèn dấu cách theo khoảng trống
+// và tách hàng tại những khoảng trống rộng.
+func splitRow(row []pdf.Text) []fragment {
+	var frags []fragment
+	var sb strings.Builder
+	var cur fragment
+	emit := func() {
+		cur.text = strings.TrimSpace(sb.String())
+		if cur.text != "" {
+			frags = append(frags, cur)
+		}
+		sb.Reset()
+	}
+	for i, g := range row {
+		size := glyphSize(g)
+		// Chữ in đậm giả thường được vẽ hai lần lệch nhau rất ít; bỏ glyph trùng.
+		// Font không có bảng độ rộng (W = 0) thì mọi glyph cùng X, không thể phân biệt.
+		if i > 0 && g.W > 0 && g.S == row[i-1].S && math.Abs(g.X-row[i-1].X) < 0.1*size {
+			continue
+		}
+		if sb.Len() > 0 {
+			gap := g.X - cur.x1
+			switch {
+			case gap > fragmentGapRatio*size:
+				emit()
+			case gap > wordGapRatio*size && !strings.HasSuffix(sb.String(), " ") && g.S != " ":
+				sb.WriteByte(' ')
+			}
+		}
+		if sb.Len() == 0 {
+			cur = fragment{x0: g.X, y: g.Y, fontSize: size}
+		}
+		sb.WriteString(g.S)
+		cur.x1 = math.Max(cur.x1, g.X+glyphWidth(g))
+		cur.fontSize = math.Max(cur.fontSize, size)
+	}
+	emit()
+	return frags
+}
+
+// findGutter tìm rãnh dọc ngăn cách hai cột văn bản. Trả về false nếu trang chỉ có một cột.
+func findGutter(frags []fragment, pageWidth float64) (float64, bool) {
+	bestStart, bestWidth := 0.0, 0.0
+	start, width := -1.0, 0.0
+	limit := int(float64(len(frags)) * maxSpanningFraction)
+	for x := 0.3 * pageWidth; x <= 0.7*pageWidth; x++ {
+		crossing := 0
+		for _, f := range frags {
+			if f.x0 < x && f.x1 > x {
+				crossing++
+			}
+		}
+		if crossing > limit {
+			start, width = -1, 0
+			continue
+		}
+		if start < 0 {
+			start = x
+		}
+		width = x - start + 1
+		if width > bestWidth {
+			bestStart, bestWidth = start, width
+		}
+	}
+	if bestWidth < 4 {
+		return 0, false
+	}
+	gutter := bestStart + bestWidth/2
+
+	// Hai cột thật sự phải có đủ dòng ở mỗi bên và nhiều hàng có text ở cả hai bên.
+	var left, right, pairedRows int
+	leftRows := map[int]bool{}
+	for _, f := range frags {
+		if f.x1 <= gutter {
+			left++
+			leftRows[f.row] = true
+		}
+	}
+	for _, f := range frags {
+		if f.x0 >= gutter {
+			right++
+			if leftRows[f.row] {
+				pairedRows++
+				delete(leftRows, f.row)
+			}
+		}
+	}
+	if left < minColumnFragments || right < minColumnFragments || pairedRows < minColumnFragments {
+		return 0, false
+	}
+	return gutter, true
+}
+
+// mergeFragments ghép lại các đoạn cùng hàng và cùng cột thành một dòng.
+func mergeFragments(frags []fragment, column func(fragment) int) []TextLine {
+	var lines []TextLine
+	lastRow, lastCol := -1, -2
+	for _, f := range frags {
+		col := column(f)
+		if n := len(lines); n > 0 && f.row == lastRow && col == lastCol {
+			l := &lines[n-1]
+			l.Text += " " + f.text
+			l.Width = f.x1 - l.X
+			l.FontSize = math.Max(l.FontSize, f.fontSize)
+			continue
+		}
+		lines = append(lines, TextLine{
+			Text:     f.text,
+			X:        f.x0,
+			Y:        f.y,
+			Width:    f.x1 - f.x0,
+			FontSize: f.fontSize,
+			Column:   col,
+		})
+		lastRow, lastCol = f.row, col
+	}
+	return lines
+}
+
+// removeRepeatedEdges loại bỏ header/footer lặp lại giữa các trang và số trang,
+// trả về số dòng đã bị loại.
+func removeRepeatedEdges(pages []ExtractedPage) int {
+	// Header/footer lặp lại ở cùng vị trí; số trong dòng (số trang, ngày) được bỏ qua khi so sánh.
+	edgeKey := func(l TextLine) string {
+		s := strings.ToLower(strings.Join(strings.Fields(l.Text), " "))
+		return fmt.Sprintf("%d|%s", int(l.Y/edgeBucket), digitsRe.ReplaceAllString(s, "#"))
+	}
+
+	counts := map[string]int{}
+	for _, p := range pages {
+		seen := map[string]bool{}
+		for _, i := range edgeLineIndexes(p) {
+			key := edgeKey(p.Lines[i])
+			if !seen[key] {
+				seen[key] = true
+				counts[key]++
+			}
+		}
+	}
+	threshold := len(pages) / 2
+	if threshold < 3 {
+		threshold = 3
+	}
+
+	removed := 0
+	for pi := range pages {
+		drop := map[int]bool{}
+		for _, i := range edgeLineIndexes(pages[pi]) {
+			l := pages[pi].Lines[i]
+			if pageNumberRe.MatchString(strings.TrimSpace(l.Text)) || counts[edgeKey(l)] >= threshold {
+				drop[i] = true
+			}
+		}
+		if len(drop) == 0 {
+			continue
+		}
+		kept := pages[pi].Lines[:0]
+		for i, l := range pages[pi].Lines {
+			if drop[i] {
+				removed++
+				continue
+			}
+			kept = append(kept, l)
+		}
+		pages[pi].Lines = kept
+	}
+	return removed
+}
+
+// edgeLineIndexes trả về chỉ số của các dòng sát mép trên và mép dưới trang.
+// Khi biết chiều cao trang, chỉ xét các dòng nằm trong vùng lề.
+func edgeLineIndexes(p ExtractedPage) []int {
+	idx := make([]int, len(p.Lines))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return p.Lines[idx[a]].Y > p.Lines[idx[b]].Y })
+
+	inMargin := func(i int) bool {
+		if p.Height <= 0 {
+			return true
+		}
+		y := p.Lines[i].Y
+		return y > (1-edgeMarginRatio)*p.Height || y < edgeMarginRatio*p.Height
+	}
+	var edges []int
+	for k, i := range idx {
+		if (k < edgeLinesPerPage || k >= len(idx)-edgeLinesPerPage) && inMargin(i) {
+			edges = append(edges, i)
+		}
+	}
+	return edges
+}
+
+// joinLines ghép các dòng của một trang, nối lại những từ bị ngắt bằng dấu gạch nối cuối dòng.
+func joinLines(lines []TextLine) string {
+	var sb strings.Builder
+	for i, l := range lines {
+		text := strings.TrimSpace(l.Text)
+		if i+1 < len(lines) && isHyphenated(text, strings.TrimSpace(lines[i+1].Text)) {
+			sb.WriteString(strings.TrimSuffix(text, "-"))
+			continue
+		}
+		sb.WriteString(text)
+		if i+1 < len(lines) {
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
+
+// isHyphenated reports whether line ends in a word broken by a hyphen that continues on next.
+func isHyphenated(line, next string) bool {
+	if !strings.HasSuffix(line, "-") || len(line) < 2 {
+		return false
+	}
+	before, _ := utf8.DecodeLastRuneInString(strings.TrimSuffix(line, "-"))
+	first, _ := utf8.DecodeRuneInString(next)
+	return unicode.IsLetter(before) && unicode.IsLower(first)
+}
+
+func glyphSize(g pdf.Text) float64 {
+	if g.FontSize > 0 {
+		return g.FontSize
+	}
+	return 10
+}
+
+func glyphWidth(g pdf.Text) float64 {
+	if g.W > 0 {
+		return g.W
+	}
+	// Font CID thường không có bảng độ rộng; ước lượng nửa cỡ chữ cho mỗi ký tự.
+	return 0.5 * glyphSize(g) * float64(utf8.RuneCountInString(g.S))
+}
@@ -0,0 +1,565 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Bộ đọc/ghi object PDF tối thiểu, chỉ dùng cho những việc thư viện pdf không hỗ trợ
+// (đọc từ điển mã hoá, giải mã AES-256 rồi ghi lại file, lấy dữ liệu ảnh gốc của trang scan).
+
+type (
+	pdfName    string
+	pdfString  string
+	pdfKeyword string
+	pdfArray   []any
+	pdfDict    map[pdfName]any
+	pdfRef     struct{ Num, Gen int }
+)
+
+// pdfObject là một indirect object đã được parse, kèm dữ liệu stream (nếu có).
+type pdfObject struct {
+	Num, Gen int
+	Value    any
+	Stream   []byte
+	IsStream bool
+	// Offset là vị trí của object (hoặc object stream chứa nó) trong file, dùng để ưu tiên bản cập nhật sau cùng.
+	Offset int
+}
+
+// Giới hạn cho file PDF do người dùng tải lên, tránh tràn stack hoặc cấp phát quá lớn.
+const (
+	// maxPDFNesting là số mảng/từ điển lồng nhau tối đa trong một giá trị
+	maxPDFNesting = 256
+	// maxPDFObjectNum là số hiệu object lớn nhất mà chuẩn PDF cho phép (ISO 32000-1, phụ lục C)
+	maxPDFObjectNum = 8388607
+)
+
+type pdfLexer struct {
+	data []byte
+	pos  int
+	// depth là số mảng/từ điển đang mở
+	depth int
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == 0
+}
+
+func isPDFDelim(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// token đọc một từ thường (số, từ khoá) tới dấu phân cách tiếp theo.
+func (l *pdfLexer) token() string {
+	l.skipSpace()
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelim(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+func (l *pdfLexer) hasPrefix(s string) bool {
+	return bytes.HasPrefix(l.data[l.pos:], []byte(s))
+}
+
+// enter mở thêm một mảng hoặc từ điển; lỗi khi vượt quá maxPDFNesting.
+func (l *pdfLexer) enter() error {
+	if l.depth >= maxPDFNesting {
+		return fmt.Errorf("PDF objects nested deeper than %d levels at offset %d", maxPDFNesting, l.pos)
+	}
+	l.depth++
+	return nil
+}
+
+func (l *pdfLexer) leave() {
+	l.depth--
+}
+
+func (l *pdfLexer) value() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, fmt.Errorf("unexpected end of PDF data")
+	}
+	switch c := l.data[l.pos]; {
+	case c == '/':
+		l.pos++
+		start := l.pos
+		for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelim(l.data[l.pos]) {
+			l.pos++
+		}
+		return pdfName(decodeNameEscapes(l.data[start:l.pos])), nil
+	case c == '(':
+		return l.literalString()
+	case l.hasPrefix("<<"):
+		if err := l.enter(); err != nil {
+			return nil, err
+		}
+		defer l.leave()
+		l.pos += 2
+		dict := pdfDict{}
+		for {
+			l.skipSpace()
+			if l.hasPrefix(">>") {
+				l.pos += 2
+				return dict, nil
+			}
+			key, err := l.value()
+			if err != nil {
+				return nil, err
+			}
+			name, ok := key.(pdfName)
+			if !ok {
+				return nil, fmt.Errorf("malformed PDF dictionary key at offset %d", l.pos)
+			}
+			val, err := l.value()
+			if err != nil {
+				return nil, err
+			}
+			dict[name] = val
+		}
+	case c == '<':
+		l.pos++
+		end := bytes.IndexByte(l.data[l.pos:], '>')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated hex string")
+		}
+		hex := l.data[l.pos : l.pos+end]
+		l.pos += end + 1
+		return pdfString(decodeHexString(hex)), nil
+	case c == '[':
+		if err := l.enter(); err != nil {
+			return nil, err
+		}
+		defer l.leave()
+		l.pos++
+		var arr pdfArray
+		for {
+			l.skipSpace()
+			if l.pos < len(l.data) && l.data[l.pos] == ']' {
+				l.pos++
+				return arr, nil
+			}
+			v, err := l.value()
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+	case c == ')' || c == '>' || c == ']' || c == '{' || c == '}':
+		return nil, fmt.Errorf("unexpected %q at offset %d", c, l.pos)
+	}
+
+	tok := l.token()
+	if n, err := strconv.ParseInt(tok, 10, 64); err == nil {
+		// Có thể là tham chiếu "num gen R".
+		save := l.pos
+		if gen, err := strconv.Atoi(l.token()); err == nil && l.token() == "R" {
+			return pdfRef{int(n), gen}, nil
+		}
+		l.pos = save
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(tok, 64); err == nil {
+		return f, nil
+	}
+	switch tok {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	case "":
+		return nil, fmt.Errorf("unexpected %q at offset %d", l.data[l.pos], l.pos)
+	}
+	return pdfKeyword(tok), nil
+}
+
+func (l *pdfLexer) literalString() (any, error) {
+	l.pos++ // '('
+	var buf bytes.Buffer
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return pdfString(buf.String()), nil
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				continue
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		buf.WriteByte(c)
+	}
+	return nil, fmt.Errorf("unterminated literal string")
+}
+
+func decodeNameEscapes(b []byte) string {
+	if bytes.IndexByte(b, '#') < 0 {
+		return string(b)
+	}
+	var out []byte
+	for i := 0; i < len(b); i++ {
+		if b[i] == '#' && i+2 < len(b) {
+			if v, err := strconv.ParseUint(string(b[i+1:i+3]), 16, 8); err == nil {
+				out = append(out, byte(v))
+				i += 2
+				continue
+			}
+		}
+		out = append(out, b[i])
+	}
+	return string(out)
+}
+
+func decodeHexString(hex []byte) string {
+	var digits []byte
+	for _, c := range hex {
+		if !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, 0, len(digits)/2)
+	for i := 0; i < len(digits); i += 2 {
+		v, _ := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+		out = append(out, byte(v))
+	}
+	return string(out)
+}
+
+var objHeaderRe = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// parseObjectAt parse indirect object bắt đầu tại offset và trả về vị trí ngay sau "endobj".
+func parseObjectAt(data []byte, offset int) (*pdfObject, int, error) {
+	m := objHeaderRe.FindSubmatchIndex(data[offset:])
+	if m == nil || m[0] != 0 {
+		return nil, 0, fmt.Errorf("no object header at offset %d", offset)
+	}
+	num, _ := strconv.Atoi(string(data[offset+m[2] : offset+m[3]]))
+	gen, _ := strconv.Atoi(string(data[offset+m[4] : offset+m[5]]))
+	l := &pdfLexer{data: data, pos: offset + m[1]}
+	v, err := l.value()
+	if err != nil {
+		return nil, 0, err
+	}
+	obj := &pdfObject{Num: num, Gen: gen, Value: v, Offset: offset}
+
+	l.skipSpace()
+	if dict, ok := v.(pdfDict); ok && l.hasPrefix("stream") {
+		l.pos += len("stream")
+		if l.hasPrefix("\r\n") {
+			l.pos += 2
+		} else if l.hasPrefix("\n") || l.hasPrefix("\r") {
+			l.pos++
+		}
+		start := l.pos
+		end := -1
+		if n, ok := dict["Length"].(int64); ok {
+			if n < 0 || n > int64(len(data)-start) {
+				return nil, 0, fmt.Errorf("invalid stream length %d in object %d", n, num)
+			}
+			rest := &pdfLexer{data: data, pos: start + int(n)}
+			rest.skipSpace()
+			if rest.hasPrefix("endstream") {
+				end = start + int(n)
+			}
+		}
+		if end < 0 {
+			// /Length là tham chiếu hoặc sai: tìm "endstream" và bỏ ký tự xuống dòng phía trước.
+			i := bytes.Index(data[start:], []byte("endstream"))
+			if i < 0 {
+				return nil, 0, fmt.Errorf("unterminated stream in object %d", num)
+			}
+			end = start + i
+			if end > start && data[end-1] == '\n' {
+				end--
+			}
+			if end > start && data[end-1] == '\r' {
+				end--
+			}
+		}
+		obj.IsStream = true
+		obj.Stream = data[start:end]
+		l.pos = end
+		l.skipSpace()
+		l.pos += len("endstream")
+		l.skipSpace()
+	}
+	if l.hasPrefix("endobj") {
+		l.pos += len("endobj")
+	}
+	return obj, l.pos, nil
+}
+
+// scanObjects quét toàn bộ file và trả về phiên bản mới nhất của mỗi indirect object.
+func scanObjects(data []byte) map[int]*pdfObject {
+	objects := map[int]*pdfObject{}
+	pos := 0
+	for pos < len(data) {
+		m := objHeaderRe.FindIndex(data[pos:])
+		if m == nil {
+			break
+		}
+		start := pos + m[0]
+		// Header object phải đứng đầu dòng (hoặc đầu file).
+		if start > 0 && !isPDFSpace(data[start-1]) {
+			pos = start + 1
+			continue
+		}
+		obj, next, err := parseObjectAt(data, start)
+		if err != nil {
+			pos = start + 1
+			continue
+		}
+		objects[obj.Num] = obj
+		pos = next
+	}
+	return objects
+}
+
+// loadObjects quét file PDF không mã hoá và tách cả các object nằm trong object stream.
+func loadObjects(data []byte, limits Limits) (map[int]*pdfObject, error) {
+	objects := scanObjects(data)
+	for _, obj := range objects {
+		dict, _ := obj.Value.(pdfDict)
+		if typ, _ := dict["Type"].(pdfName); typ != "ObjStm" || !obj.IsStream {
+			continue
+		}
+		expanded, err := expandObjectStream(obj, limits)
+		if err != nil {
+			return nil, err
+		}
+		for _, inner := range expanded {
+			if prev, ok := objects[inner.Num]; !ok || prev.Offset < inner.Offset {
+				objects[inner.Num] = inner
+			}
+		}
+	}
+	return objects, nil
+}
+
+// resolvePDF trả về giá trị mà tham chiếu trỏ tới (hoặc chính giá trị nếu không phải tham chiếu).
+func resolvePDF(objects map[int]*pdfObject, v any) any {
+	for i := 0; i < 8; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		obj, ok := objects[ref.Num]
+		if !ok {
+			return nil
+		}
+		v = obj.Value
+	}
+	return v
+}
+
+// findTrailer trả về trailer dictionary mới nhất (trailer truyền thống hoặc từ điển của xref stream).
+func findTrailer(data []byte) (pdfDict, error) {
+	i := bytes.LastIndex(data, []byte("startxref"))
+	if i < 0 {
+		return nil, fmt.Errorf("malformed PDF file: missing startxref")
+	}
+	l := &pdfLexer{data: data, pos: i + len("startxref")}
+	offset, err := strconv.Atoi(l.token())
+	if err != nil || offset < 0 || offset >= len(data) {
+		return nil, fmt.Errorf("malformed PDF file: invalid startxref")
+	}
+	l = &pdfLexer{data: data, pos: offset}
+	l.skipSpace()
+	if l.hasPrefix("xref") {
+		t := bytes.Index(data[offset:], []byte("trailer"))
+		if t < 0 {
+			return nil, fmt.Errorf("malformed PDF file: missing trailer")
+		}
+		l.pos = offset + t + len("trailer")
+		v, err := l.value()
+		if err != nil {
+			return nil, err
+		}
+		if dict, ok := v.(pdfDict); ok {
+			return dict, nil
+		}
+		return nil, fmt.Errorf("malformed PDF file: trailer is not a dictionary")
+	}
+	obj, _, err := parseObjectAt(data, l.pos)
+	if err != nil {
+		return nil, fmt.Errorf("malformed PDF file: %w", err)
+	}
+	if dict, ok := obj.Value.(pdfDict); ok {
+		return dict, nil
+	}
+	return nil, fmt.Errorf("malformed PDF file: xref stream has no dictionary")
+}
+
+func writePDFValue(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	case pdfName:
+		buf.WriteByte('/')
+		for _, c := range []byte(v) {
+			if c < '!' || c > '~' || c == '#' || isPDFDelim(c) {
+				fmt.Fprintf(buf, "#%02X", c)
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	case pdfString:
+		fmt.Fprintf(buf, "<%X>", []byte(v))
+	case pdfKeyword:
+		buf.WriteString(string(v))
+	case pdfRef:
+		fmt.Fprintf(buf, "%d %d R", v.Num, v.Gen)
+	case pdfArray:
+		buf.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			writePDFValue(buf, e)
+		}
+		buf.WriteByte(']')
+	case pdfDict:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, string(k))
+		}
+		sort.Strings(keys)
+		buf.WriteString("<<")
+		for _, k := range keys {
+			writePDFValue(buf, pdfName(k))
+			buf.WriteByte(' ')
+			writePDFValue(buf, v[pdfName(k)])
+		}
+		buf.WriteString(">>")
+	}
+}
+
+// writePDF ghi lại các object thành một file PDF hoàn chỉnh với bảng xref truyền thống.
+// Bảng xref chỉ liệt kê các object có trong file (mỗi dãy số liên tiếp là một subsection),
+// nên bộ nhớ dùng không phụ thuộc vào số hiệu object.
+func writePDF(objects map[int]*pdfObject, trailer pdfDict) ([]byte, error) {
+	nums := make([]int, 0, len(objects))
+	for num := range objects {
+		if num > maxPDFObjectNum {
+			return nil, fmt.Errorf("malformed PDF file: object number %d exceeds %d", num, maxPDFObjectNum)
+		}
+		if num == 0 {
+			// object 0 luôn là đầu danh sách free trong bảng xref
+			continue
+		}
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(nums))
+	for i, num := range nums {
+		obj := objects[num]
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d %d obj\n", num, obj.Gen)
+		if obj.IsStream {
+			dict, _ := obj.Value.(pdfDict)
+			dict["Length"] = int64(len(obj.Stream))
+			writePDFValue(&buf, dict)
+			buf.WriteString("\nstream\n")
+			buf.Write(obj.Stream)
+			buf.WriteString("\nendstream")
+		} else {
+			writePDFValue(&buf, obj.Value)
+		}
+		buf.WriteString("\nendobj\n")
+	}
+
+	xref := buf.Len()
+	buf.WriteString("xref\n0 1\n0000000000 65535 f \n")
+	for i := 0; i < len(nums); {
+		j := i + 1
+		for j < len(nums) && nums[j] == nums[j-1]+1 {
+			j++
+		}
+		fmt.Fprintf(&buf, "%d %d\n", nums[i], j-i)
+		for ; i < j; i++ {
+			fmt.Fprintf(&buf, "%010d %05d n \n", offsets[i], objects[nums[i]].Gen)
+		}
+	}
+	size := 1
+	if len(nums) > 0 {
+		size = nums[len(nums)-1] + 1
+	}
+	trailer["Size"] = int64(size)
+	buf.WriteString("trailer\n")
+	writePDFValue(&buf, trailer)
+	fmt.Fprintf(&buf, "\nstartxref\n%d\n%%%%EOF\n", xref)
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// pdfWithTrailerObject tạo một file PDF tối thiểu mà startxref trỏ tới object body.
+func pdfWithTrailerObject(body string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+	offset := buf.Len()
+	fmt.Fprintf(&buf, "1 0 obj\n%s\nendobj\n", body)
+	fmt.Fprintf(&buf, "startxref\n%d\n%%%%EOF\n", offset)
+	return buf.Bytes()
+}
+
+func TestIsEncryptedPDFMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"deeply nested arrays", pdfWithTrailerObject(strings.Repeat("[", 20<<20))},
+		{"deeply nested dictionaries", pdfWithTrailerObject(strings.Repeat("<</A ", 4<<20))},
+		{"negative stream length", pdfWithTrailerObject("<</Length -100000>>\nstream\nabc\nendstream")},
+		{"stream length past end of file", pdfWithTrailerObject("<</Length 999999999>>\nstream\nabc\nendstream")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if IsEncryptedPDF(bytes.NewReader(tt.data), int64(len(tt.data))) {
+				t.Error("IsEncryptedPDF = true, want false")
+			}
+		})
+	}
+}
+
+func TestPDFLexerNesting(t *testing.T) {
+	nested := strings.Repeat("[", maxPDFNesting) + strings.Repeat("]", maxPDFNesting)
+	if _, err := (&pdfLexer{data: []byte(nested)}).value(); err != nil {
+		t.Errorf("%d nested arrays: %v", maxPDFNesting, err)
+	}
+	tooDeep := "[" + nested + "]"
+	if _, err := (&pdfLexer{data: []byte(tooDeep)}).value(); err == nil {
+		t.Errorf("%d nested arrays: want error", maxPDFNesting+1)
+	}
+	// Độ sâu được trả lại sau mỗi mảng nên các mảng liền nhau không bị tính dồn
+	siblings := "[" + strings.Repeat("[[]]", 2*maxPDFNesting) + "]"
+	if _, err := (&pdfLexer{data: []byte(siblings)}).value(); err != nil {
+		t.Errorf("sibling arrays: %v", err)
+	}
+}
+
+func TestWritePDFObjectNumbers(t *testing.T) {
+	objects := map[int]*pdfObject{
+		1: {Num: 1, Value: pdfDict{"Type": pdfName("Catalog")}},
+		2: {Num: 2, Value: int64(7)},
+		9: {Num: 9, Value: pdfString("x")},
+	}
+	out, err := writePDF(objects, pdfDict{"Root": pdfRef{1, 0}})
+	if err != nil {
+		t.Fatalf("writePDF: %v", err)
+	}
+	for _, want := range []string{"xref\n0 1\n", "\n1 2\n", "\n9 1\n", "/Size 10"} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	parsed := scanObjects(out)
+	if len(parsed) != len(objects) {
+		t.Errorf("parsed %d objects, want %d", len(parsed), len(objects))
+	}
+	if v, _ := parsed[2].Value.(int64); v != 7 {
+		t.Errorf("object 2 = %v, want 7", parsed[2].Value)
+	}
+
+	objects[maxPDFObjectNum+1] = &pdfObject{Num: maxPDFObjectNum + 1, Value: int64(1)}
+	if _, err := writePDF(objects, pdfDict{}); err == nil {
+		t.Errorf("object number %d: want error", maxPDFObjectNum+1)
+	}
+}
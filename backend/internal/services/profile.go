@@ -0,0 +1,97 @@
+package services
+
+// analysisProfile là phần phụ thuộc ngôn ngữ của việc phân tích: lời dặn trong prompt,
+// bộ từ khoá dùng để chọn model và quy tắc nhận diện tiêu đề điều khoản.
+type analysisProfile struct {
+	language string
+	// replyLanguage là ngôn ngữ AI dùng để trả về kết quả
+	replyLanguage string
+	// guidance là lời dặn riêng cho hợp đồng viết bằng ngôn ngữ này
+	guidance string
+	// pageLabel, annexLabel, clauseExample dùng trong các ví dụ trích dẫn của prompt
+	pageLabel     string
+	annexLabel    string
+	clauseExample string
+	// complexKeywords là các thuật ngữ pháp lý phức tạp; nhiều thuật ngữ thì dùng model Pro
+	complexKeywords []string
+	// headingKeywords là các từ mở đầu tiêu đề điều khoản, dùng để đếm số điều khoản
+	headingKeywords []string
+	clauses         clauseRules
+}
+
+var (
+	viComplexKeywords = []string{
+		"bồi thường", "vi phạm", "tranh chấp", "kiện tụng", "phạt",
+		"lãi suất", "thế chấp", "bảo lãnh", "trách nhiệm pháp lý",
+		"điều khoản phạt", "force majeure", "bất khả kháng",
+		"quyền sở hữu trí tuệ", "bản quyền", "thương hiệu",
+		"miễn trừ trách nhiệm", "hủy bỏ hợp đồng", "chấm dứt",
+	}
+	enComplexKeywords = []string{
+		"indemnif", "liquidated damages", "breach", "dispute", "litigation", "penalty",
+		"interest rate", "mortgage", "guarantee", "limitation of liability",
+		"force majeure", "intellectual property", "copyright", "trademark",
+		"exclusion of liability", "rescission", "termination", "governing law",
+	}
+	viHeadingKeywords = []string{"điều ", "khoản ", "mục ", "chương "}
+	enHeadingKeywords = []string{"article ", "section ", "clause ", "chapter "}
+
+	viClauseKeywords = map[string]bool{"phần": true, "chương": true, "mục": true, "điều": true, "khoản": true, "điểm": true}
+	enClauseKeywords = map[string]bool{"part": true, "chapter": true, "article": true, "section": true, "clause": true}
+)
+
+var analysisProfiles = map[string]*analysisProfile{
+	LanguageVietnamese: {
+		language:        LanguageVietnamese,
+		replyLanguage:   "tiếng Việt",
+		guidance:        "Hợp đồng được soạn bằng tiếng Việt; khi đánh giá rủi ro, đối chiếu với quy định của pháp luật Việt Nam (Bộ luật Dân sự, Luật Thương mại).",
+		pageLabel:       "Trang",
+		annexLabel:      "Phụ lục",
+		clauseExample:   `"Điều 5.2" hoặc "Khoản 2 Điều 5"`,
+		complexKeywords: viComplexKeywords,
+		headingKeywords: viHeadingKeywords,
+		clauses:         clauseRules{keywords: viClauseKeywords, labels: LanguageVietnamese},
+	},
+	LanguageEnglish: {
+		language:        LanguageEnglish,
+		replyLanguage:   "tiếng Anh",
+		guidance:        `Hợp đồng được soạn bằng tiếng Anh: giữ nguyên tên điều khoản và thuật ngữ được định nghĩa như trong văn bản (ví dụ "Indemnification", "Limitation of Liability"); chú ý luật áp dụng và cơ quan giải quyết tranh chấp, có thể không phải pháp luật Việt Nam.`,
+		pageLabel:       "Page",
+		annexLabel:      "Annex",
+		clauseExample:   `"Section 3.1" hoặc "Article 5(a)"`,
+		complexKeywords: enComplexKeywords,
+		headingKeywords: enHeadingKeywords,
+		clauses:         clauseRules{keywords: enClauseKeywords, labels: LanguageEnglish},
+	},
+	LanguageBilingual: {
+		language:        LanguageBilingual,
+		replyLanguage:   "tiếng Việt",
+		guidance:        "Hợp đồng song ngữ Việt – Anh: đối chiếu hai bản và ghi rủi ro khi chúng khác nhau về số tiền, thời hạn hay nghĩa vụ; nêu điều khoản quy định bản ngôn ngữ nào được ưu tiên áp dụng, nếu không có điều khoản này thì đó cũng là một rủi ro.",
+		pageLabel:       "Trang",
+		annexLabel:      "Phụ lục",
+		clauseExample:   `"Điều 5.2" hoặc "Section 3.1"`,
+		complexKeywords: append(append([]string{}, viComplexKeywords...), enComplexKeywords...),
+		headingKeywords: append(append([]string{}, viHeadingKeywords...), enHeadingKeywords...),
+	},
+	LanguageOther: {
+		language:        LanguageOther,
+		replyLanguage:   "tiếng Việt",
+		guidance:        "Không nhận dạng được ngôn ngữ của hợp đồng từ text trích xuất (ngôn ngữ khác, text bị lỗi hoặc bản scan): những phần không đọc được thì ghi rõ trong potential_risks thay vì suy đoán nội dung.",
+		pageLabel:       "Trang",
+		annexLabel:      "Phụ lục",
+		clauseExample:   `"Điều 5.2" hoặc "Section 3.1"`,
+		complexKeywords: append(append([]string{}, viComplexKeywords...), enComplexKeywords...),
+		headingKeywords: append(append([]string{}, viHeadingKeywords...), enHeadingKeywords...),
+	},
+}
+
+// profileFor trả về profile của ngôn ngữ; ngôn ngữ rỗng thì nhận dạng từ text.
+func profileFor(language, text string) *analysisProfile {
+	if language == "" {
+		language = DetectLanguage(text)
+	}
+	if p, ok := analysisProfiles[language]; ok {
+		return p
+	}
+	return analysisProfiles[LanguageOther]
+}
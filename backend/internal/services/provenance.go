@@ -0,0 +1,119 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Phiên bản của các prompt phân tích. Tăng phiên bản khi sửa nội dung prompt để provenance
+// phân biệt được kết quả của prompt cũ và mới.
+const (
+	PromptVersionText     = "analyze-text/v2"
+	PromptVersionBundle   = "analyze-bundle/v2"
+	PromptVersionDocument = "analyze-document/v2"
+)
+
+// ExtractorVersion is the version of the extraction pipeline (text layer, layout, OCR,
+// normalization). Bump it when a change makes the extracted text of the same file differ.
+const ExtractorVersion = "1"
+
+// PipelineVersion identifies the whole analysis pipeline: prompts, default models and
+// extraction. Analyses stored by another version are stale and handled by the stale policy.
+// Bump it together with a prompt version, ExtractorVersion or the default models when stored
+// results should be refreshed.
+const PipelineVersion = "2"
+
+// Cách xử lý kết quả đã lưu bởi phiên bản pipeline cũ khi file được tải lên lại.
+const (
+	// StalePolicyServe trả kết quả cũ kèm "stale": true
+	StalePolicyServe = "serve"
+	// StalePolicyRefresh phân tích lại ngay trong request và trả kết quả mới
+	StalePolicyRefresh = "refresh"
+	// StalePolicyRequeue trả kết quả cũ và đưa tài liệu vào hàng đợi phân tích lại ở nền
+	StalePolicyRequeue = "requeue"
+)
+
+// ParseStalePolicy validates a stale policy; "" means StalePolicyServe.
+func ParseStalePolicy(s string) (string, error) {
+	switch p := strings.ToLower(strings.TrimSpace(s)); p {
+	case "":
+		return StalePolicyServe, nil
+	case StalePolicyServe, StalePolicyRefresh, StalePolicyRequeue:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown stale policy %q", s)
+	}
+}
+
+// DefaultStalePolicy returns the policy configured by STALE_POLICY, or StalePolicyServe.
+func DefaultStalePolicy() string {
+	policy, err := ParseStalePolicy(os.Getenv("STALE_POLICY"))
+	if err != nil {
+		log.Printf("Warning: %v, using %s", err, StalePolicyServe)
+		return StalePolicyServe
+	}
+	return policy
+}
+
+// estimatedOverheadTokens là số token ước lượng của phần prompt cố định và phản hồi JSON.
+const estimatedOverheadTokens = 2000
+
+// EstimateTokens estimates the tokens of one text analysis before it is run: about three
+// characters per token for the content (Vietnamese needs more tokens than English) plus the
+// prompt and the response.
+func EstimateTokens(text string) int {
+	return utf8.RuneCountInString(text)/3 + estimatedOverheadTokens
+}
+
+// GenerationConfig is the generation config sent with an analysis request. Empty fields
+// mean the model default.
+type GenerationConfig struct {
+	Temperature      *float32 `json:"temperature,omitempty"`
+	TopP             *float32 `json:"top_p,omitempty"`
+	TopK             *int32   `json:"top_k,omitempty"`
+	MaxOutputTokens  *int32   `json:"max_output_tokens,omitempty"`
+	ResponseMIMEType string   `json:"response_mime_type,omitempty"`
+}
+
+// ModelCall is the outcome of one analysis request to the model together with what is
+// needed to audit it.
+type ModelCall struct {
+	// Text là phản hồi đã bỏ khoảng trắng đầu cuối, dùng để parse JSON kết quả
+	Text string
+	// RawResponse là phản hồi nguyên văn của model (mọi phần text của candidate đầu tiên)
+	RawResponse      string
+	Model            string
+	PromptVersion    string
+	GenerationConfig GenerationConfig
+	FinishReason     string
+	PromptTokens     int
+	ResponseTokens   int
+	TotalTokens      int
+	// Latency là thời gian từ lúc gửi request tới khi nhận đủ phản hồi, kể cả upload file gốc
+	Latency time.Duration
+}
+
+// generationConfig chuyển cấu hình sinh của model sang dạng lưu trong provenance.
+func generationConfig(c genai.GenerationConfig) GenerationConfig {
+	return GenerationConfig{
+		Temperature:      c.Temperature,
+		TopP:             c.TopP,
+		TopK:             c.TopK,
+		MaxOutputTokens:  c.MaxOutputTokens,
+		ResponseMIMEType: c.ResponseMIMEType,
+	}
+}
+
+// callText trả về phần text của một lần gọi model, cho các hàm chỉ cần kết quả.
+func callText(call *ModelCall, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	return call.Text, nil
+}
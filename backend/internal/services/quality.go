@@ -0,0 +1,233 @@
+package services
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Ngôn ngữ phát hiện được của text trích xuất.
+const (
+	LanguageVietnamese = "vi"
+	LanguageEnglish    = "en"
+	LanguageBilingual  = "bilingual" // hợp đồng song ngữ Việt – Anh
+	LanguageOther      = "other"     // ngôn ngữ khác hoặc text quá ngắn/lỗi để nhận dạng
+)
+
+const (
+	// minLanguageWords: text có ít từ hơn không đủ để nhận dạng ngôn ngữ.
+	minLanguageWords = 20
+	// minDictionaryShare: tỉ lệ từ có trong từ điển tối thiểu để coi text là tiếng Việt/Anh.
+	minDictionaryShare = 0.2
+	// bilingualShare: mỗi ngôn ngữ chiếm ít nhất tỉ lệ này trong số từ nhận dạng được thì là song ngữ.
+	bilingualShare = 0.15
+	// expectedHitRate: tỉ lệ từ có trong từ điển mà từ đó trở lên text được coi là đọc đúng.
+	expectedHitRate = 0.35
+)
+
+// viWords là các âm tiết tiếng Việt thường gặp trong hợp đồng. Bộ từ nhỏ nhưng phủ phần lớn
+// số từ của văn bản, đủ để phân biệt text đọc đúng với text lỗi font hay sai bảng mã (TCVN3, VNI).
+var viWords = wordSet(`
+của và các là có được cho trong người này với không một những bên theo về đến khi đã sẽ phải
+tại từ hoặc nếu thì như để do mà trên dưới sau trước giữa cùng mọi tất cả nào hay vào ra lại
+hợp đồng điều khoản mục chương phụ lục văn bản số ngày tháng năm thời hạn kể hiệu lực
+mua bán thuê cho vay dịch vụ cung cấp cấp giao nhận hàng hoá hóa sản phẩm công trình
+giá trị tiền thanh toán chuyển khoản đặt cọc tạm ứng phí thuế gtgt vat chi đồng việt nam
+quyền nghĩa vụ trách nhiệm bồi thường thiệt hại phạt vi phạm chấm dứt huỷ hủy bỏ gia hạn
+tranh chấp giải quyết toà tòa án trọng tài thương mại luật pháp quy định bất khả kháng
+công ty cổ phần tnhh trách hữu hạn đại diện ông bà chức vụ giám đốc tổng địa chỉ điện thoại
+mã số tài khoản ngân hàng chi nhánh mở người đại uỷ ủy quyền giấy chứng nhận đăng ký kinh doanh
+bảo hành bảo lãnh bảo mật thông tin sở hữu trí tuệ kiểm tra nghiệm thu biên bản chất lượng
+lượng đơn vị tính thành tiền cộng tổng khối kỳ lần đợt hạn chậm lãi suất mức tối đa thiểu
+thoả thỏa thuận đồng ý cam kết xác nhận thông báo yêu cầu đề nghị chấp thuận từ chối
+ký kết thực hiện tiến độ kế hoạch phạm vi nội dung mô tả kỹ thuật tiêu chuẩn yêu
+bằng chữ nhất hai ba bốn năm sáu bảy tám chín mười trăm nghìn ngàn triệu tỷ
+sau đây gọi là căn cứ bộ dân sự nghị định thông tư chính phủ ban hành quốc hội
+hai bên mỗi bất kỳ trường hợp khác liên quan đầy đủ đúng kịp thời hiện hành có thể
+không được phép được quyền chịu gây ra xảy ra biết rõ nêu trên dưới đây kèm theo
+bản gốc sao giá trị pháp lý như nhau tiếng anh việt ngôn ngữ ưu tiên
+việc thống nhất nhau mình họ chúng tôi ta ai gì đó nay cũng rằng thêm hết chỉ còn đang vẫn
+rất nhiều ít lớn nhỏ mới cũ hơn ngoài bao gồm lý hoàn thành trả nộp gửi bàn lắp đặt vận
+thiết bị máy vật tư dụng cụ đất nhà ở cá nhân tổ chức doanh nghiệp nước
+`)
+
+// enWords là các từ tiếng Anh thường gặp trong hợp đồng.
+var enWords = wordSet(`
+the of and to in a is be by for or on as at with from that this which any all such
+shall will may must not no nor if than then other its their his her it they these those
+agreement contract party parties clause section article annex appendix schedule exhibit
+date effective term period days months years year month day time hereof herein hereto
+hereby hereunder thereof whereas witnesseth notwithstanding pursuant subject accordance
+price payment pay paid amount fee fees tax taxes vat invoice currency total sum deposit
+goods services products delivery deliver supply supplier buyer seller customer provider
+rights obligations liability liable damages indemnify indemnification breach default
+terminate termination terminated expiry renewal extend extension notice written consent
+dispute disputes arbitration court law laws governed governing jurisdiction force majeure
+company limited ltd corporation represented representative director address tel phone
+account bank branch registration certificate business license authorized signature
+warranty guarantee confidential confidentiality information intellectual property
+inspection acceptance quality quantity unit specification specifications standard
+agree agrees agreed undertake undertakes confirm request approval approve reject
+including include includes without limitation provided however except unless until
+within after before during upon under over between both each either every same
+hundred thousand million billion one two three four five six seven eight nine ten
+english vietnamese language version prevail copies original equal legal validity
+are was were been has have had does can could would should there where when what
+made make set out up our we you your he she them him us me my who whom whose how why
+also only more most less some many much very into through about against above below
+again further once here now new first last next per via so but because while being
+having said own off just line page word words name title form
+`)
+
+func wordSet(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// QualityMetrics describes how well the text of a document was extracted.
+type QualityMetrics struct {
+	PageCount int `json:"page_count"`
+	// EmptyPages là số trang không có text (trang trắng hoặc trang scan không đọc được).
+	EmptyPages int `json:"empty_pages"`
+	// EmptyPageNumbers chỉ có với tài liệu đơn lẻ; trong bộ hồ sơ số trang của các file trùng nhau.
+	EmptyPageNumbers []int `json:"empty_page_numbers,omitempty"`
+	// Characters là số ký tự khác khoảng trắng.
+	Characters   int     `json:"characters"`
+	CharsPerPage float64 `json:"chars_per_page,omitempty"`
+	// NonLetterRatio là tỉ lệ ký tự không phải chữ cái hay chữ số (dấu câu, ký hiệu, ký tự lỗi).
+	NonLetterRatio float64 `json:"non_letter_ratio"`
+	// DictionaryHitRate là tỉ lệ từ có trong từ điển tiếng Việt hoặc tiếng Anh.
+	DictionaryHitRate float64 `json:"dictionary_hit_rate"`
+	Language          string  `json:"language"`
+	// Score (0..1) tổng hợp chất lượng glyph và tỉ lệ từ có nghĩa; dưới 0.6 là chất lượng thấp.
+	Score float64 `json:"score"`
+}
+
+// Quality measures the extraction quality of the result.
+func (r *ExtractionResult) Quality() *QualityMetrics {
+	m := measureQuality(r.Pages, r.Text)
+	for _, p := range r.Pages {
+		if strings.TrimSpace(p.Text) == "" {
+			m.EmptyPageNumbers = append(m.EmptyPageNumbers, p.Number)
+		}
+	}
+	m.Score = min(r.ExtractionQuality(), m.Score)
+	return m
+}
+
+// Quality measures the extraction quality over every document of the bundle.
+func (b *Bundle) Quality() *QualityMetrics {
+	return b.quality(b.ContentText())
+}
+
+// Quality measures the extraction quality of the e-mail body and its attachments.
+func (m *EmailMessage) Quality() *QualityMetrics {
+	if m.Bundle == nil {
+		q := measureQuality(nil, m.Body)
+		q.Score = min(TextQualityScore(m.Body), q.Score)
+		return q
+	}
+	return m.Bundle.quality(m.ContentText())
+}
+
+func (b *Bundle) quality(text string) *QualityMetrics {
+	var pages []ExtractedPage
+	glyphs := 1.0
+	for _, d := range b.Documents {
+		pages = append(pages, d.Result.Pages...)
+		if strings.TrimSpace(d.Result.Text) != "" {
+			glyphs = min(glyphs, d.Result.ExtractionQuality())
+		}
+	}
+	m := measureQuality(pages, text)
+	m.Score = min(glyphs, m.Score)
+	return m
+}
+
+// measureQuality tính các chỉ số trên text; pages (có thể rỗng) dùng để đếm trang trống.
+// Score ở đây chỉ dựa trên tỉ lệ từ có trong từ điển; người gọi kết hợp thêm điểm glyph.
+func measureQuality(pages []ExtractedPage, text string) *QualityMetrics {
+	m := &QualityMetrics{PageCount: len(pages)}
+	for _, p := range pages {
+		if strings.TrimSpace(p.Text) == "" {
+			m.EmptyPages++
+		}
+	}
+
+	nonLetters := 0
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			continue
+		case unicode.IsLetter(r), unicode.IsDigit(r), unicode.Is(unicode.Mn, r):
+		default:
+			nonLetters++
+		}
+		m.Characters++
+	}
+	if m.Characters > 0 {
+		m.NonLetterRatio = float64(nonLetters) / float64(m.Characters)
+	}
+	if len(pages) > 0 {
+		m.CharsPerPage = float64(m.Characters) / float64(len(pages))
+	}
+
+	words, vi, en, hits := countDictionaryWords(text)
+	m.Score = 1
+	if words > 0 {
+		m.DictionaryHitRate = float64(hits) / float64(words)
+	}
+	// Text quá ngắn thì tỉ lệ từ trong từ điển không có ý nghĩa thống kê
+	if words >= minLanguageWords {
+		m.Score = min(1, m.DictionaryHitRate/expectedHitRate)
+	}
+	m.Language = detectLanguage(words, vi, en, hits)
+	return m
+}
+
+// countDictionaryWords đếm số từ, số từ có trong từ điển tiếng Việt, tiếng Anh và số từ
+// có trong ít nhất một trong hai từ điển. Từ lẫn ký hiệu ở giữa (text sai bảng mã như
+// "hîp ®ång") vẫn được đếm nhưng không bao giờ khớp từ điển.
+func countDictionaryWords(text string) (words, vi, en, hits int) {
+	for _, w := range strings.Fields(strings.ToLower(NormalizeText(text))) {
+		w = strings.TrimFunc(w, func(r rune) bool { return unicode.IsPunct(r) || unicode.IsDigit(r) })
+		if !strings.ContainsFunc(w, unicode.IsLetter) {
+			continue
+		}
+		words++
+		inVi, inEn := viWords[w], enWords[w]
+		if inVi {
+			vi++
+		}
+		if inEn {
+			en++
+		}
+		if inVi || inEn {
+			hits++
+		}
+	}
+	return words, vi, en, hits
+}
+
+func detectLanguage(words, vi, en, hits int) string {
+	if words < minLanguageWords || float64(hits) < minDictionaryShare*float64(words) {
+		return LanguageOther
+	}
+	viShare := float64(vi) / float64(vi+en)
+	switch {
+	case viShare >= 1-bilingualShare:
+		return LanguageVietnamese
+	case viShare <= bilingualShare:
+		return LanguageEnglish
+	default:
+		return LanguageBilingual
+	}
+}
+
+// DetectLanguage returns the language of text: LanguageVietnamese, LanguageEnglish,
+// LanguageBilingual or LanguageOther.
+func DetectLanguage(text string) string {
+	return detectLanguage(countDictionaryWords(text))
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Số tiền trong văn bản: "1.200.000.000 đồng", "1,200,000 VNĐ", "50.000 USD", "2.000.000đ".
+	amountRe = regexp.MustCompile(`(?i)(\d{1,3}(?:[.,]\d{3})+|\d{4,})(?:[.,]\d{1,2})?\s*(?:đồng|vnđ|vnd|usd|đ|₫)(?:[^\p{L}\d]|$)`)
+	// Nhãn của hàng tổng trong bảng (text đã bỏ dấu, viết thường)
+	totalLabelRe = regexp.MustCompile(`^(tong cong|tong gia tri|tong so tien|tong|cong|total|grand total)\b`)
+	numberRe     = regexp.MustCompile(`^[-+]?[\d.,\s]+$`)
+)
+
+// amountTolerance: chênh lệch tối đa (theo đơn vị tiền) để coi hai số tiền là bằng nhau.
+const amountTolerance = 0.5
+
+// tableTotal là giá trị hàng tổng của một bảng.
+type tableTotal struct {
+	label  string
+	value  float64
+	column int
+	row    int
+}
+
+// parseAmount đọc một số được định dạng kiểu Việt Nam ("1.200.000,5") hoặc kiểu Anh ("1,200,000.5"),
+// có thể kèm đơn vị tiền tệ.
+func parseAmount(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	for _, unit := range []string{"₫", "đồng", "VNĐ", "VND", "vnđ", "vnd", "USD", "đ"} {
+		s = strings.TrimSpace(strings.TrimSuffix(s, unit))
+	}
+	if s == "" || !numberRe.MatchString(s) {
+		return 0, false
+	}
+	s = strings.ReplaceAll(s, " ", "")
+
+	dot, comma := strings.Count(s, "."), strings.Count(s, ",")
+	switch {
+	case dot > 0 && comma > 0:
+		// Dấu xuất hiện sau cùng là dấu thập phân
+		if strings.LastIndex(s, ",") > strings.LastIndex(s, ".") {
+			s = strings.ReplaceAll(s, ".", "")
+			s = strings.Replace(s, ",", ".", 1)
+		} else {
+			s = strings.ReplaceAll(s, ",", "")
+		}
+	case dot > 1 || comma > 1:
+		s = strings.NewReplacer(".", "", ",", "").Replace(s)
+	case dot == 1 || comma == 1:
+		// Một dấu duy nhất theo sau bởi đúng 3 chữ số là dấu phân cách hàng nghìn
+		sep := "."
+		if comma == 1 {
+			sep = ","
+		}
+		if i := strings.Index(s, sep); len(s)-i-1 == 3 {
+			s = strings.Replace(s, sep, "", 1)
+		} else {
+			s = strings.Replace(s, sep, ".", 1)
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	return v, err == nil
+}
+
+// formatAmount định dạng số tiền theo kiểu Việt Nam: 1200000 → "1.200.000".
+func formatAmount(v float64) string {
+	whole := strconv.FormatInt(int64(math.Round(math.Abs(v))), 10)
+	var sb strings.Builder
+	if v < 0 {
+		sb.WriteByte('-')
+	}
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// tableTotals tìm các hàng tổng của bảng: hàng có ô nhãn "Tổng cộng"/"Total", lấy số ở ô
+// số cuối cùng của hàng (thường là cột thành tiền).
+func tableTotals(t Table) []tableTotal {
+	var totals []tableTotal
+	for i, row := range t.Rows {
+		label := ""
+		for _, cell := range row {
+			if totalLabelRe.MatchString(foldDiacritics(strings.ToLower(cell))) {
+				label = cell
+				break
+			}
+		}
+		if label == "" {
+			continue
+		}
+		for col := len(row) - 1; col >= 0; col-- {
+			if v, ok := parseAmount(row[col]); ok {
+				totals = append(totals, tableTotal{label: label, value: v, column: col, row: i})
+				break
+			}
+		}
+	}
+	return totals
+}
+
+// checkTableTotals so hàng tổng với tổng các dòng phía trên trong cùng cột.
+func checkTableTotals(t Table) []string {
+	var warnings []string
+	start := 0
+	for _, total := range tableTotals(t) {
+		sum, items := 0.0, 0
+		for _, row := range t.Rows[start:total.row] {
+			if total.column < len(row) {
+				if v, ok := parseAmount(row[total.column]); ok {
+					sum += v
+					items++
+				}
+			}
+		}
+		start = total.row + 1
+		// Cần ít nhất hai dòng số mới có ý nghĩa so sánh
+		if items >= 2 && math.Abs(sum-total.value) > amountTolerance {
+			warnings = append(warnings, fmt.Sprintf("Sheet %s: %s là %s nhưng tổng các dòng phía trên là %s.",
+				t.Name, total.label, formatAmount(total.value), formatAmount(sum)))
+		}
+	}
+	return warnings
+}
+
+// contractAmount là một số tiền xuất hiện trong hợp đồng chính.
+type contractAmount struct {
+	value float64
+	where string
+}
+
+// Reconcile compares the totals of the spreadsheet tables in the bundle (price schedules,
+// payment tables) with the amounts written in the main contract.
+func (b *Bundle) Reconcile() []string {
+	main := b.Main()
+	clauses := main.Result.ClauseStructure()
+	var amounts []contractAmount
+	for _, m := range amountRe.FindAllStringSubmatchIndex(main.Result.Text, -1) {
+		v, ok := parseAmount(main.Result.Text[m[2]:m[3]])
+		if !ok {
+			continue
+		}
+		where := "hợp đồng chính"
+		if c := ClauseAt(clauses, m[0]); c != nil {
+			where = c.Ref + " của hợp đồng chính"
+		}
+		amounts = append(amounts, contractAmount{value: v, where: where})
+	}
+
+	var notes []string
+	for _, d := range b.Documents[1:] {
+		name := d.Name
+		if d.Label != "" {
+			name = d.Label + " (" + d.Name + ")"
+		}
+		for _, t := range d.Result.Tables {
+			for _, total := range tableTotals(t) {
+				source := fmt.Sprintf("%s tại %s, sheet %s", total.label, name, t.Name)
+				if match := findAmount(amounts, total.value); match != nil {
+					notes = append(notes, fmt.Sprintf("%s (%s) khớp với số tiền tại %s.", source, formatAmount(total.value), match.where))
+				} else if largest := largestAmount(amounts); largest != nil {
+					notes = append(notes, fmt.Sprintf("%s (%s) không khớp với số tiền nào trong hợp đồng chính (giá trị lớn nhất: %s tại %s).",
+						source, formatAmount(total.value), formatAmount(largest.value), largest.where))
+				}
+			}
+		}
+	}
+	return notes
+}
+
+func findAmount(amounts []contractAmount, v float64) *contractAmount {
+	for i := range amounts {
+		if math.Abs(amounts[i].value-v) <= amountTolerance {
+			return &amounts[i]
+		}
+	}
+	return nil
+}
+
+func largestAmount(amounts []contractAmount) *contractAmount {
+	var best *contractAmount
+	for i := range amounts {
+		if best == nil || amounts[i].value > best.value {
+			best = &amounts[i]
+		}
+	}
+	return best
+}
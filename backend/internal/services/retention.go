@@ -0,0 +1,76 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Thời hạn lưu giữ mặc định, có thể thay đổi bằng biến môi trường (xem DefaultRetentionPolicy).
+const (
+	defaultTrashRetention = 30 * 24 * time.Hour
+	defaultPurgeInterval  = time.Hour
+)
+
+// RetentionPolicy says how long analyses are kept. Documents under legal hold are never
+// moved to the trash or purged.
+type RetentionPolicy struct {
+	// Analysis: analysis tạo trước chừng này thời gian được chuyển vào thùng rác, 0 là giữ mãi
+	Analysis time.Duration
+	// Trash: analysis nằm trong thùng rác lâu hơn chừng này bị xoá vĩnh viễn, 0 là không tự xoá
+	Trash time.Duration
+	// Interval là khoảng thời gian giữa hai lần áp dụng chính sách
+	Interval time.Duration
+}
+
+// ParseRetention parses a retention period: a number of days such as "30d", a Go duration
+// such as "12h", or "0" for no limit.
+func ParseRetention(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "0" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid retention period %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid retention period %q", s)
+	}
+	return d, nil
+}
+
+// DefaultRetentionPolicy returns the policy configured by ANALYSIS_RETENTION (default 0, keep
+// forever), TRASH_RETENTION (default 30d) and PURGE_INTERVAL (default 1h).
+func DefaultRetentionPolicy() RetentionPolicy {
+	policy := RetentionPolicy{
+		Analysis: envRetention("ANALYSIS_RETENTION", 0),
+		Trash:    envRetention("TRASH_RETENTION", defaultTrashRetention),
+		Interval: envRetention("PURGE_INTERVAL", defaultPurgeInterval),
+	}
+	if policy.Interval <= 0 {
+		policy.Interval = defaultPurgeInterval
+	}
+	return policy
+}
+
+// envRetention đọc thời hạn từ biến môi trường; giá trị không hợp lệ bị bỏ qua.
+func envRetention(name string, fallback time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+	d, err := ParseRetention(v)
+	if err != nil {
+		log.Printf("Warning: %s: %v, using %s", name, err, fallback)
+		return fallback
+	}
+	return d
+}
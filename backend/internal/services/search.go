@@ -0,0 +1,246 @@
+package services
+
+import (
+	"errors"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// ErrEmptySearchQuery is returned by ParseSearchQuery when the query has no word to look for.
+var ErrEmptySearchQuery = errors.New("search query has no words")
+
+// Số từ giữ lại trước và sau lần khớp đầu tiên trong một đoạn trích.
+const (
+	snippetWordsBefore = 10
+	snippetWordsAfter  = 20
+)
+
+// SearchToken is a word of a text, lowercased and without Vietnamese diacritics, with its
+// byte offsets in the original text.
+type SearchToken struct {
+	Term       string
+	Start, End int
+}
+
+// SearchTokens splits s into words (runs of letters and digits), lowercased and without
+// diacritics so that "Bảo lãnh", "bảo lãnh" and "bao lanh" match each other.
+func SearchTokens(s string) []SearchToken {
+	var tokens []SearchToken
+	start := -1
+	for i, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, searchToken(s, start, i))
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, searchToken(s, start, len(s)))
+	}
+	return tokens
+}
+
+func searchToken(s string, start, end int) SearchToken {
+	word := strings.ToLower(s[start:end])
+	for i := 0; i < len(word); i++ {
+		// Chỉ bỏ dấu khi từ có ký tự ngoài ASCII
+		if word[i] >= 0x80 {
+			word = foldDiacritics(word)
+			break
+		}
+	}
+	return SearchToken{Term: word, Start: start, End: end}
+}
+
+// searchTerms trả về các từ đã chuẩn hoá của s.
+func searchTerms(s string) []string {
+	var terms []string
+	for _, t := range SearchTokens(s) {
+		terms = append(terms, t.Term)
+	}
+	return terms
+}
+
+// SearchPhrase is a word or a quoted phrase of a search query.
+type SearchPhrase struct {
+	// Text là từ hoặc cụm từ như người dùng nhập, Terms là các từ đã chuẩn hoá của nó
+	Text  string
+	Terms []string
+}
+
+// SearchQuery is a parsed search query. An analysis matches when it contains at least one
+// phrase of every group of All and none of the phrases of None.
+type SearchQuery struct {
+	All  [][]SearchPhrase
+	None []SearchPhrase
+}
+
+// ParseSearchQuery parses a query in the usual search engine syntax: words separated by
+// spaces must all be present, a "quoted phrase" must appear as consecutive words, OR between
+// two words or phrases accepts either of them, and a leading - excludes a word or phrase.
+// Matching ignores case and diacritics.
+func ParseSearchQuery(q string) (*SearchQuery, error) {
+	query := &SearchQuery{}
+	pendingOr := false
+	for i := 0; i < len(q); {
+		if q[i] == ' ' || q[i] == '\t' || q[i] == '\n' || q[i] == '\r' {
+			i++
+			continue
+		}
+		negate := false
+		if q[i] == '-' && i+1 < len(q) && q[i+1] != ' ' {
+			negate = true
+			i++
+		}
+		var text string
+		quoted := q[i] == '"'
+		if quoted {
+			end := strings.IndexByte(q[i+1:], '"')
+			if end < 0 {
+				text, i = q[i+1:], len(q)
+			} else {
+				text, i = q[i+1:i+1+end], i+end+2
+			}
+		} else {
+			end := strings.IndexAny(q[i:], " \t\r\n\"")
+			if end < 0 {
+				end = len(q) - i
+			}
+			text, i = q[i:i+end], i+end
+		}
+
+		if !quoted && !negate && text == "OR" {
+			pendingOr = len(query.All) > 0
+			continue
+		}
+		terms := searchTerms(text)
+		if len(terms) == 0 {
+			continue
+		}
+		phrase := SearchPhrase{Text: strings.TrimSpace(text), Terms: terms}
+		switch {
+		case negate:
+			query.None = append(query.None, phrase)
+		case pendingOr:
+			last := len(query.All) - 1
+			query.All[last] = append(query.All[last], phrase)
+		default:
+			query.All = append(query.All, []SearchPhrase{phrase})
+		}
+		pendingOr = false
+	}
+	if len(query.All) == 0 {
+		return nil, ErrEmptySearchQuery
+	}
+	return query, nil
+}
+
+// SearchSnippet is an excerpt of a field that matches a search query.
+type SearchSnippet struct {
+	// Field là summary, key_clauses, potential_risks hoặc text
+	Field string `json:"field"`
+	// Text đã được escape HTML; các từ khớp được bọc trong <mark></mark>
+	Text string `json:"text"`
+}
+
+// Snippet returns an excerpt of text around the first match of the query, with every match
+// in the excerpt wrapped in <mark></mark> and the rest HTML-escaped; "" when nothing matches.
+func (q *SearchQuery) Snippet(text string) string {
+	tokens := SearchTokens(text)
+	spans := q.matchSpans(tokens)
+	if len(spans) == 0 {
+		return ""
+	}
+	from := max(spans[0][0]-snippetWordsBefore, 0)
+	to := min(spans[0][1]+snippetWordsAfter, len(tokens))
+
+	// Đoạn trích tới đầu hoặc cuối text thì giữ cả dấu câu ở đầu, cuối
+	pos, last := tokens[from].Start, tokens[to-1].End
+	if from == 0 {
+		pos = 0
+	}
+	if to == len(tokens) {
+		last = len(text)
+	}
+	var sb strings.Builder
+	if from > 0 {
+		sb.WriteString("… ")
+	}
+	for _, span := range spans {
+		if span[0] < from || span[1] > to {
+			continue
+		}
+		start, end := tokens[span[0]].Start, tokens[span[1]-1].End
+		if start < pos {
+			continue
+		}
+		sb.WriteString(compactSpace(html.EscapeString(text[pos:start])))
+		sb.WriteString("<mark>" + compactSpace(html.EscapeString(text[start:end])) + "</mark>")
+		pos = end
+	}
+	sb.WriteString(compactSpace(html.EscapeString(text[pos:last])))
+	if to < len(tokens) {
+		sb.WriteString(" …")
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// matchSpans trả về các khoảng [đầu, cuối) theo chỉ số token của mọi lần khớp một cụm từ của
+// All, theo thứ tự xuất hiện.
+func (q *SearchQuery) matchSpans(tokens []SearchToken) [][2]int {
+	var spans [][2]int
+	for i := range tokens {
+		longest := 0
+		for _, group := range q.All {
+			for _, p := range group {
+				if len(p.Terms) > longest && termsAt(tokens, i, p.Terms) {
+					longest = len(p.Terms)
+				}
+			}
+		}
+		if longest > 0 {
+			spans = append(spans, [2]int{i, i + longest})
+		}
+	}
+	return spans
+}
+
+// termsAt cho biết các từ terms có đứng liền nhau trong tokens bắt đầu từ vị trí i hay không.
+func termsAt(tokens []SearchToken, i int, terms []string) bool {
+	if i+len(terms) > len(tokens) {
+		return false
+	}
+	for j, term := range terms {
+		if tokens[i+j].Term != term {
+			return false
+		}
+	}
+	return true
+}
+
+// compactSpace thay mỗi dãy khoảng trắng (kể cả xuống dòng) bằng một dấu cách.
+func compactSpace(s string) string {
+	if !strings.ContainsAny(s, "\n\r\t") && !strings.Contains(s, "  ") {
+		return s
+	}
+	var sb strings.Builder
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			if !space {
+				sb.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		space = false
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
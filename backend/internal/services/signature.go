@@ -0,0 +1,269 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ledongthuc/pdf"
+	"go.mozilla.org/pkcs7"
+)
+
+// Trạng thái của một chữ ký số.
+const (
+	SignatureValid    = "valid"    // chữ ký đúng và phủ toàn bộ file
+	SignatureModified = "modified" // chữ ký đúng nhưng file có thêm nội dung sau khi ký
+	SignatureInvalid  = "invalid"  // chữ ký không khớp với nội dung đã ký
+	SignatureUnknown  = "unknown"  // không kiểm tra được (định dạng chưa hỗ trợ, dữ liệu hỏng)
+)
+
+// maxFieldDepth giới hạn độ sâu khi duyệt cây trường của AcroForm (phòng vòng lặp Kids).
+const maxFieldDepth = 32
+
+// SignatureInfo describes one digital signature of a PDF and the result of verifying
+// it offline against the bytes it covers. The certificate chain is not checked against
+// a trust store, so a valid signature proves integrity, not the signer's identity.
+type SignatureInfo struct {
+	// Document là tên file trong bộ hồ sơ; rỗng với tài liệu đơn lẻ.
+	Document   string     `json:"document,omitempty"`
+	Field      string     `json:"field,omitempty"`
+	SignerName string     `json:"signer_name,omitempty"`
+	Subject    string     `json:"subject,omitempty"`
+	Issuer     string     `json:"issuer,omitempty"`
+	Serial     string     `json:"serial,omitempty"`
+	SignedAt   *time.Time `json:"signed_at,omitempty"`
+	Reason     string     `json:"reason,omitempty"`
+	Location   string     `json:"location,omitempty"`
+	SubFilter  string     `json:"sub_filter,omitempty"`
+	// ByteRange là [offset1, length1, offset2, length2]: hai đoạn byte của file được ký.
+	ByteRange []int64 `json:"byte_range,omitempty"`
+	// ModifiedAfterSigning cho biết file còn dữ liệu sau đoạn được ký (cập nhật tăng dần).
+	ModifiedAfterSigning bool   `json:"modified_after_signing"`
+	Status               string `json:"status"`
+	Error                string `json:"error,omitempty"`
+}
+
+// signatureField là một trường chữ ký tìm thấy trong AcroForm.
+type signatureField struct {
+	name string
+	v    pdf.Value
+}
+
+// pdfSignatures tìm các trường chữ ký của PDF và kiểm tra từng chữ ký trên dữ liệu gốc
+// của file. ByteRange và Contents luôn tham chiếu tới file gốc (Contents không bị mã hoá),
+// nên chữ ký được kiểm tra trên r chứ không phải bản PDF đã giải mã.
+func pdfSignatures(reader *pdf.Reader, r io.ReaderAt, size int64) []SignatureInfo {
+	fields := reader.Trailer().Key("Root").Key("AcroForm").Key("Fields")
+	var found []signatureField
+	for i := 0; i < fields.Len(); i++ {
+		collectSignatureFields(fields.Index(i), "", "", 0, &found)
+	}
+	if len(found) == 0 {
+		return nil
+	}
+	data, err := readAllAt(r, size)
+	var sigs []SignatureInfo
+	for _, f := range found {
+		if err != nil {
+			sigs = append(sigs, SignatureInfo{Field: f.name, Status: SignatureUnknown, Error: err.Error()})
+			continue
+		}
+		sigs = append(sigs, verifySignatureField(f, data))
+	}
+	return sigs
+}
+
+// collectSignatureFields duyệt cây trường; FT và tên trường được kế thừa từ nút cha.
+func collectSignatureFields(field pdf.Value, parentName, parentType string, depth int, found *[]signatureField) {
+	if field.IsNull() || depth > maxFieldDepth {
+		return
+	}
+	name := field.Key("T").Text()
+	if parentName != "" && name != "" {
+		name = parentName + "." + name
+	} else if name == "" {
+		name = parentName
+	}
+	ft := field.Key("FT").Name()
+	if ft == "" {
+		ft = parentType
+	}
+	if ft == "Sig" && field.Key("V").Kind() == pdf.Dict {
+		*found = append(*found, signatureField{name: name, v: field.Key("V")})
+		return
+	}
+	kids := field.Key("Kids")
+	for i := 0; i < kids.Len(); i++ {
+		collectSignatureFields(kids.Index(i), name, ft, depth+1, found)
+	}
+}
+
+func verifySignatureField(f signatureField, data []byte) SignatureInfo {
+	v := f.v
+	sig := SignatureInfo{
+		Field:      f.name,
+		SignerName: strings.TrimSpace(v.Key("Name").Text()),
+		Reason:     strings.TrimSpace(v.Key("Reason").Text()),
+		Location:   strings.TrimSpace(v.Key("Location").Text()),
+		SubFilter:  v.Key("SubFilter").Name(),
+		SignedAt:   parsePDFDate(v.Key("M").Text()),
+		Status:     SignatureUnknown,
+	}
+	br := v.Key("ByteRange")
+	for i := 0; i < br.Len(); i++ {
+		sig.ByteRange = append(sig.ByteRange, br.Index(i).Int64())
+	}
+
+	signed, contents, err := signedBytes(sig.ByteRange, data)
+	if err != nil {
+		sig.Error = err.Error()
+		return sig
+	}
+	sig.ModifiedAfterSigning = len(bytes.TrimSpace(data[sig.ByteRange[2]+sig.ByteRange[3]:])) > 0
+
+	p7, err := pkcs7.Parse(contents)
+	if err != nil {
+		sig.Error = fmt.Sprintf("failed to parse CMS signature: %v", err)
+		return sig
+	}
+	if cert := p7.GetOnlySigner(); cert != nil {
+		sig.Subject = cert.Subject.String()
+		sig.Issuer = cert.Issuer.String()
+		sig.Serial = cert.SerialNumber.Text(16)
+		if sig.SignerName == "" {
+			sig.SignerName = cert.Subject.CommonName
+		}
+	}
+	// Thời điểm ký trong thuộc tính đã ký đáng tin hơn /M (do phần mềm ký tự ghi)
+	var signingTime time.Time
+	if err := p7.UnmarshalSignedAttribute(pkcs7.OIDAttributeSigningTime, &signingTime); err == nil {
+		sig.SignedAt = &signingTime
+	}
+
+	switch sig.SubFilter {
+	case "adbe.pkcs7.detached", "ETSI.CAdES.detached", "":
+		p7.Content = signed
+	case "adbe.pkcs7.sha1":
+		// Nội dung được đóng gói trong CMS là SHA-1 của đoạn byte được ký
+		sum := sha1.Sum(signed)
+		if !bytes.Equal(p7.Content, sum[:]) {
+			sig.Status = SignatureInvalid
+			sig.Error = "signed SHA-1 digest does not match the document"
+			return sig
+		}
+	default:
+		sig.Error = fmt.Sprintf("unsupported signature format %s", sig.SubFilter)
+		return sig
+	}
+
+	if err := p7.Verify(); err != nil {
+		sig.Status = SignatureInvalid
+		sig.Error = err.Error()
+		return sig
+	}
+	sig.Status = SignatureValid
+	if sig.ModifiedAfterSigning {
+		sig.Status = SignatureModified
+	}
+	return sig
+}
+
+// signedBytes kiểm tra ByteRange và trả về dữ liệu được ký cùng chữ ký CMS (DER) nằm
+// trong khoảng trống giữa hai đoạn, dưới dạng chuỗi hex "<...>".
+func signedBytes(br []int64, data []byte) (signed, contents []byte, err error) {
+	size := int64(len(data))
+	if len(br) != 4 {
+		return nil, nil, errors.New("signature has no valid ByteRange")
+	}
+	a, b, c, d := br[0], br[1], br[2], br[3]
+	if a != 0 || b <= 0 || c <= b || d < 0 || c+d > size {
+		return nil, nil, fmt.Errorf("ByteRange %v is outside the file", br)
+	}
+
+	gap := bytes.TrimSpace(data[b:c])
+	if len(gap) < 2 || gap[0] != '<' || gap[len(gap)-1] != '>' {
+		return nil, nil, errors.New("ByteRange gap does not contain the signature")
+	}
+	raw, err := hex.DecodeString(string(gap[1 : len(gap)-1]))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode signature contents: %w", err)
+	}
+	// Contents được đệm thêm số 0 phía sau; pkcs7.Parse không chấp nhận dữ liệu thừa.
+	// Chữ ký mã hoá BER (độ dài không xác định) không tách được theo DER thì chỉ bỏ phần đệm.
+	contents = bytes.TrimRight(raw, "\x00")
+	var der asn1.RawValue
+	if _, err := asn1.Unmarshal(raw, &der); err == nil {
+		contents = der.FullBytes
+	}
+	if len(contents) == 0 {
+		return nil, nil, errors.New("signature contents are empty")
+	}
+
+	signed = make([]byte, 0, b+d)
+	signed = append(signed, data[a:a+b]...)
+	signed = append(signed, data[c:c+d]...)
+	return signed, contents, nil
+}
+
+// SignatureSummary returns a one-line summary of the signature statuses in Vietnamese,
+// or "" when there are no signatures.
+func SignatureSummary(sigs []SignatureInfo) string {
+	if len(sigs) == 0 {
+		return ""
+	}
+	counts := map[string]int{}
+	for _, s := range sigs {
+		counts[s.Status]++
+	}
+	parts := []string{fmt.Sprintf("%d chữ ký số", len(sigs))}
+	for _, s := range []struct{ status, label string }{
+		{SignatureValid, "hợp lệ"},
+		{SignatureModified, "hợp lệ nhưng tài liệu bị sửa sau khi ký"},
+		{SignatureInvalid, "không hợp lệ"},
+		{SignatureUnknown, "không kiểm tra được"},
+	} {
+		if n := counts[s.status]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, s.label))
+		}
+	}
+	return parts[0] + ": " + strings.Join(parts[1:], ", ") + "."
+}
+
+// signatureWarnings cảnh báo các chữ ký không hợp lệ hoặc tài liệu bị sửa sau khi ký.
+func signatureWarnings(sigs []SignatureInfo) []string {
+	var warnings []string
+	for _, s := range sigs {
+		who := s.SignerName
+		if who == "" {
+			who = s.Field
+		}
+		switch s.Status {
+		case SignatureInvalid:
+			warnings = append(warnings, fmt.Sprintf("Chữ ký số của %s không hợp lệ: nội dung đã ký không khớp với chữ ký.", who))
+		case SignatureModified:
+			warnings = append(warnings, fmt.Sprintf("Tài liệu đã bị thay đổi sau khi %s ký; phần thay đổi không được chữ ký bảo vệ.", who))
+		case SignatureUnknown:
+			warnings = append(warnings, fmt.Sprintf("Không kiểm tra được chữ ký số của %s.", who))
+		}
+	}
+	return warnings
+}
+
+// Signatures returns the signatures of every document of the bundle, each tagged with
+// the name of its file.
+func (b *Bundle) Signatures() []SignatureInfo {
+	var sigs []SignatureInfo
+	for _, d := range b.Documents {
+		for _, s := range d.Result.Signatures {
+			s.Document = d.Name
+			sigs = append(sigs, s)
+		}
+	}
+	return sigs
+}
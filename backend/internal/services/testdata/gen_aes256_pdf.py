@@ -0,0 +1,156 @@
+#!/usr/bin/env python3
+"""Tạo aes256_r6.pdf: PDF một trang mã hoá AES-256 (V5, R6), user password "user",
+owner password "owner".
+
+Mã hoá được viết lại từ FIPS-197 và ISO 32000-2 (Algorithm 2.B, 8, 9, 10), không dùng mã
+Go của gói services, để test giải mã có một bản mã hoá độc lập. Các salt và IV cố định nên
+file sinh ra luôn giống nhau. Chạy từ thư mục testdata: python3 gen_aes256_pdf.py
+"""
+import hashlib
+import struct
+
+# --- AES (FIPS-197), chỉ cần chiều mã hoá ---
+
+SBOX = [0] * 256
+_p = _q = 1
+while True:
+    _p = _p ^ ((_p << 1) & 0xFF) ^ (0x1B if _p & 0x80 else 0)
+    _q ^= _q << 1
+    _q ^= _q << 2
+    _q ^= _q << 4
+    _q &= 0xFF
+    if _q & 0x80:
+        _q ^= 0x09
+    SBOX[_p] = _q ^ (_q << 1 | _q >> 7) & 0xFF ^ (_q << 2 | _q >> 6) & 0xFF ^ (_q << 3 | _q >> 5) & 0xFF ^ (_q << 4 | _q >> 4) & 0xFF ^ 0x63
+    if _p == 1:
+        break
+SBOX[0] = 0x63
+
+
+def xtime(b):
+    return ((b << 1) ^ 0x1B) & 0xFF if b & 0x80 else b << 1
+
+
+def expand_key(key):
+    nk = len(key) // 4
+    rounds = nk + 6
+    w = [list(key[4 * i:4 * i + 4]) for i in range(nk)]
+    rcon = 1
+    for i in range(nk, 4 * (rounds + 1)):
+        t = list(w[i - 1])
+        if i % nk == 0:
+            t = [SBOX[b] for b in t[1:] + t[:1]]
+            t[0] ^= rcon
+            rcon = xtime(rcon)
+        elif nk > 6 and i % nk == 4:
+            t = [SBOX[b] for b in t]
+        w.append([a ^ b for a, b in zip(w[i - nk], t)])
+    return [sum(w[4 * r:4 * r + 4], []) for r in range(rounds + 1)]
+
+
+def encrypt_block(round_keys, block):
+    s = [a ^ b for a, b in zip(block, round_keys[0])]
+    last = len(round_keys) - 1
+    for r in range(1, last + 1):
+        s = [SBOX[b] for b in s]
+        # ShiftRows: trạng thái lưu theo cột, byte (hàng i, cột c) ở vị trí 4c+i
+        s = [s[(4 * (c + i) + i) % 16] for c in range(4) for i in range(4)]
+        if r != last:
+            m = []
+            for c in range(4):
+                a = s[4 * c:4 * c + 4]
+                t = a[0] ^ a[1] ^ a[2] ^ a[3]
+                m += [a[i] ^ t ^ xtime(a[i] ^ a[(i + 1) % 4]) for i in range(4)]
+            s = m
+        s = [a ^ b for a, b in zip(s, round_keys[r])]
+    return bytes(s)
+
+
+def cbc_encrypt(key, iv, data):
+    rk = expand_key(key)
+    out, prev = b"", iv
+    for i in range(0, len(data), 16):
+        prev = encrypt_block(rk, bytes(a ^ b for a, b in zip(data[i:i + 16], prev)))
+        out += prev
+    return out
+
+
+# FIPS-197 phụ lục C.1 và C.3
+assert encrypt_block(expand_key(bytes(range(16))), bytes.fromhex("00112233445566778899aabbccddeeff")).hex() == "69c4e0d86a7b0430d8cdb78070b4c55a"
+assert encrypt_block(expand_key(bytes(range(32))), bytes.fromhex("00112233445566778899aabbccddeeff")).hex() == "8ea2b7ca516745bfeafc49904b496089"
+
+# --- ISO 32000-2 ---
+
+
+def hash_2b(password, salt, udata=b""):
+    k = hashlib.sha256(password + salt + udata).digest()
+    i = 0
+    while True:
+        k1 = (password + k + udata) * 64
+        e = cbc_encrypt(k[:16], k[16:32], k1)
+        n = sum(e[:16]) % 3
+        k = (hashlib.sha256, hashlib.sha384, hashlib.sha512)[n](e).digest()
+        i += 1
+        if i >= 64 and e[-1] <= i - 32:
+            return k[:32]
+
+
+def pad(data):
+    n = 16 - len(data) % 16
+    return data + bytes([n]) * n
+
+
+USER, OWNER = b"user", b"owner"
+FILE_KEY = bytes(range(0x40, 0x60))
+U_VALIDATION, U_KEY = b"UVSALT01", b"UKSALT01"
+O_VALIDATION, O_KEY = b"OVSALT01", b"OKSALT01"
+ZERO_IV = bytes(16)
+P = -4
+
+U = hash_2b(USER, U_VALIDATION) + U_VALIDATION + U_KEY
+UE = cbc_encrypt(hash_2b(USER, U_KEY), ZERO_IV, FILE_KEY)
+O = hash_2b(OWNER, O_VALIDATION, U) + O_VALIDATION + O_KEY
+OE = cbc_encrypt(hash_2b(OWNER, O_KEY, U), ZERO_IV, FILE_KEY)
+PERMS = cbc_encrypt(FILE_KEY, ZERO_IV, struct.pack("<i", P) + b"\xff\xff\xff\xffTadb" + b"0000")
+
+
+def enc(data, iv):
+    return iv + cbc_encrypt(FILE_KEY, iv, pad(data))
+
+
+def hexstr(b):
+    return b"<" + b.hex().upper().encode() + b">"
+
+
+content = b"BT /F1 18 Tf 72 720 Td (Hop dong ma hoa AES-256) Tj ET"
+stream = enc(content, b"STREAM-IV-000001")
+title = enc(b"Hop dong mau", b"STRING-IV-000001")
+
+objects = [
+    b"<</Type /Catalog /Pages 2 0 R>>",
+    b"<</Type /Pages /Kids [3 0 R] /Count 1>>",
+    b"<</Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources <</Font <</F1 4 0 R>>>> /Contents 5 0 R>>",
+    b"<</Type /Font /Subtype /Type1 /BaseFont /Helvetica>>",
+    b"<</Length %d>>\nstream\n" % len(stream) + stream + b"\nendstream",
+    b"<</Title " + hexstr(title) + b">>",
+    b"<</Filter /Standard /V 5 /R 6 /Length 256 /P %d" % P
+    + b" /CF <</StdCF <</CFM /AESV3 /AuthEvent /DocOpen /Length 32>>>> /StmF /StdCF /StrF /StdCF"
+    + b" /U " + hexstr(U) + b" /UE " + hexstr(UE) + b" /O " + hexstr(O) + b" /OE " + hexstr(OE)
+    + b" /Perms " + hexstr(PERMS) + b">>",
+]
+out = b"%PDF-2.0\n"
+offsets = []
+for i, body in enumerate(objects, 1):
+    offsets.append(len(out))
+    out += b"%d 0 obj\n" % i + body + b"\nendobj\n"
+xref = len(out)
+out += b"xref\n0 %d\n0000000000 65535 f \n" % (len(objects) + 1)
+out += b"".join(b"%010d 00000 n \n" % o for o in offsets)
+file_id = hexstr(b"documind-aes256")
+out += b"trailer\n<</Size %d /Root 1 0 R /Info 6 0 R /Encrypt 7 0 R /ID [%s %s]>>\n" % (len(objects) + 1, file_id, file_id)
+out += b"startxref\n%d\n%%%%EOF\n" % xref
+
+with open("aes256_r6.pdf", "wb") as f:
+    f.write(out)
+print("hash_2b(user, UVSALT01) =", hash_2b(USER, U_VALIDATION).hex())
+print("hash_2b(owner, OVSALT01, U) =", hash_2b(OWNER, O_VALIDATION, U).hex())
@@ -4,60 +4,149 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"strings"
 
 	// THAY ĐỔI: Sử dụng đường dẫn import chính xác từ Github
 	"baliance.com/gooxml/document"
 	"github.com/ledongthuc/pdf"
 )
 
-// ExtractTextFromPDF extracts all text from a PDF file given as an io.Reader
-func ExtractTextFromPDF(r io.Reader) (string, error) {
-    // Giữ nguyên logic cho PDF
-    data, err := io.ReadAll(r)
-    if err != nil {
-        return "", fmt.Errorf("failed to read PDF data: %w", err)
-    }
-    reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
-    if err != nil {
-        return "", fmt.Errorf("failed to create PDF reader: %w", err)
-    }
+// ExtractPDF extracts the text of a PDF page by page, reconstructing lines and
+// reading order from glyph positions and dropping repeated headers, footers and page numbers.
+// Encrypted PDFs are opened with opts.Password; ErrPDFPasswordRequired or ErrPDFInvalidPassword
+// is returned when it is missing or wrong.
+func ExtractPDF(r io.ReaderAt, size int64, opts ExtractOptions) (result *ExtractionResult, err error) {
+	// Thư viện pdf báo lỗi cấu trúc file bằng panic.
+	defer func() {
+		if rec := recover(); rec != nil {
+			result, err = nil, fmt.Errorf("malformed PDF: %v", rec)
+		}
+	}()
+
+	limits := opts.Limits.withDefaults()
+	reader, plain, err := openPDF(r, size, opts.Password, limits)
+	if err != nil {
+		return nil, err
+	}
 
-	var buf bytes.Buffer
 	numPages := reader.NumPage()
+	if numPages > limits.MaxPDFPages {
+		return nil, &LimitError{Subject: "PDF", Limit: "pages", Max: int64(limits.MaxPDFPages)}
+	}
+	var pages []ExtractedPage
 	for i := 1; i <= numPages; i++ {
 		page := reader.Page(i)
 		if page.V.IsNull() {
 			continue
 		}
-		content, err := page.GetPlainText(nil)
+		lines, err := extractPageLines(page)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract text from page %d: %w", i, err)
+		}
+		width, height := pageSize(page)
+		pages = append(pages, ExtractedPage{Number: i, Width: width, Height: height, Lines: lines, Source: PageSourceText})
+	}
+
+	// Ảnh gốc của trang chỉ được đọc khi thật sự có trang scan cần OCR.
+	images := func() (*pdfImageSource, error) {
+		switch {
+		case plain != nil:
+			return newPDFImageSource(plain, limits)
+		case !reader.Trailer().Key("Encrypt").IsNull():
+			return nil, fmt.Errorf("images of RC4/AES-128 encrypted PDFs are not supported")
+		}
+		data, err := readAllAt(r, size)
 		if err != nil {
-			return "", fmt.Errorf("failed to extract text from page %d: %w", i, err)
+			return nil, err
+		}
+		return newPDFImageSource(data, limits)
+	}
+	warnings := recognizeScannedPages(pages, images, opts.OCR)
+
+	removed := removeRepeatedEdges(pages)
+	for i := range pages {
+		pages[i].Text = joinLines(pages[i].Lines)
+		if pages[i].Source == PageSourceText {
+			pages[i].Confidence = TextQualityScore(pages[i].Text)
 		}
-		buf.WriteString(content)
 	}
-	return buf.String(), nil
+	result = newPagedResult(pages)
+	result.RemovedLines = removed
+	result.Info = pdfInfo(reader)
+	result.Signatures = pdfSignatures(reader, r, size)
+	if opts.OCR != nil {
+		result.OCREngine = opts.OCR.Name()
+	}
+	result.Warnings = append(warnings, qualityWarnings(pages)...)
+	result.Warnings = append(result.Warnings, signatureWarnings(result.Signatures)...)
+	result.normalize()
+	return result, nil
 }
 
-// ExtractTextFromDOCX extracts all text from a DOCX file given as an io.Reader
-func ExtractTextFromDOCX(r io.Reader) (string, error) {
-	// Logic sử dụng thư viện mới vẫn giữ nguyên
-	data, err := io.ReadAll(r)
+// extractPageLines dựng lại các dòng từ toạ độ glyph; nếu không đọc được toạ độ
+// thì quay về GetPlainText của thư viện.
+func extractPageLines(page pdf.Page) (lines []TextLine, err error) {
+	width, _ := pageSize(page)
+	func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				lines = nil
+			}
+		}()
+		lines = layoutPage(page.Content().Text, width)
+	}()
+	if len(lines) > 0 {
+		return lines, nil
+	}
+
+	content, err := page.GetPlainText(nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to read DOCX data into buffer: %w", err)
+		return nil, err
 	}
-	reader := bytes.NewReader(data)
+	for _, text := range strings.Split(content, "\n") {
+		if text = strings.TrimSpace(text); text != "" {
+			lines = append(lines, TextLine{Text: text})
+		}
+	}
+	return lines, nil
+}
 
-	doc, err := document.Read(reader, int64(reader.Len()))
+// pageSize trả về kích thước trang theo MediaBox (có thể kế thừa từ nút cha), tính bằng point.
+func pageSize(page pdf.Page) (float64, float64) {
+	var box pdf.Value
+	for v := page.V; !v.IsNull() && box.IsNull(); v = v.Key("Parent") {
+		box = v.Key("MediaBox")
+	}
+	if box.Len() != 4 {
+		return 0, 0
+	}
+	return box.Index(2).Float64() - box.Index(0).Float64(), box.Index(3).Float64() - box.Index(1).Float64()
+}
+
+// ExtractDOCX extracts the paragraphs of a DOCX file together with its core properties.
+// The ZIP container is checked against opts.Limits before it is decompressed.
+func ExtractDOCX(r io.ReaderAt, size int64, opts ExtractOptions) (*ExtractionResult, error) {
+	limits := opts.Limits.withDefaults()
+	if err := checkArchive(r, size, "DOCX", limits); err != nil {
+		return nil, err
+	}
+	doc, err := document.Read(r, size)
 	if err != nil {
-		return "", fmt.Errorf("failed to open DOCX with new library: %w", err)
+		return nil, fmt.Errorf("failed to open DOCX with new library: %w", err)
 	}
 
+	paragraphs := doc.Paragraphs()
+	if len(paragraphs) > limits.MaxDOCXParagraphs {
+		return nil, &LimitError{Subject: "DOCX", Limit: "paragraphs", Max: int64(limits.MaxDOCXParagraphs)}
+	}
 	var buf bytes.Buffer
-	for _, para := range doc.Paragraphs() {
+	for _, para := range paragraphs {
 		for _, run := range para.Runs() {
 			buf.WriteString(run.Text())
 		}
 		buf.WriteString("\n")
 	}
-	return buf.String(), nil
-}
\ No newline at end of file
+	result := &ExtractionResult{Text: buf.String(), Info: officeInfo(doc.CoreProperties, doc.AppProperties)}
+	result.normalize()
+	return result, nil
+}
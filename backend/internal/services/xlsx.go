@@ -0,0 +1,140 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"baliance.com/gooxml/spreadsheet"
+)
+
+// Table is one sheet of a spreadsheet as rows of cell text. Empty leading columns
+// are kept so that every row lines up with the sheet's columns.
+type Table struct {
+	Name string     `json:"name"`
+	Rows [][]string `json:"rows"`
+}
+
+type xlsxExtractor struct{}
+
+func (xlsxExtractor) Name() string { return "xlsx" }
+
+func (xlsxExtractor) Match(filename, contentType string) bool {
+	return strings.Contains(contentType, "officedocument.spreadsheetml.sheet") || hasExt(filename, ".xlsx")
+}
+
+func (xlsxExtractor) Extract(r io.ReaderAt, size int64, opts ExtractOptions) (*ExtractionResult, error) {
+	return ExtractXLSX(r, size, opts)
+}
+
+// ExtractXLSX extracts every sheet of an XLSX workbook as a table. The text renders each
+// sheet after a "--- Sheet: name ---" marker with cells separated by " | ".
+func ExtractXLSX(r io.ReaderAt, size int64, opts ExtractOptions) (*ExtractionResult, error) {
+	limits := opts.Limits.withDefaults()
+	if err := checkArchive(r, size, "XLSX", limits); err != nil {
+		return nil, err
+	}
+	wb, err := spreadsheet.Read(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open XLSX: %w", err)
+	}
+
+	result := &ExtractionResult{Info: officeInfo(wb.CoreProperties, wb.AppProperties)}
+	cells := 0
+	var sb strings.Builder
+	for _, sheet := range wb.Sheets() {
+		table := Table{Name: sheet.Name()}
+		for _, row := range sheet.Rows() {
+			var values []string
+			for _, cell := range row.Cells() {
+				col := len(values)
+				if ref := cell.Reference(); ref != "" {
+					// Bỏ các ô có tham chiếu hỏng hoặc vượt quá cột cuối XFD
+					if col = columnIndex(ref); col < 0 {
+						continue
+					}
+				}
+				// Các ô trống chèn vào trước ô cũng tính vào giới hạn để một tham chiếu xa
+				// không dựng được hàng rất rộng
+				added := col + 1 - len(values)
+				if added < 1 {
+					added = 1
+				}
+				if cells += added; cells > limits.MaxSpreadsheetCells {
+					return nil, &LimitError{Subject: "XLSX", Limit: "cells", Max: int64(limits.MaxSpreadsheetCells)}
+				}
+				for len(values) <= col {
+					values = append(values, "")
+				}
+				values[col] = cellText(cell)
+			}
+			// Bỏ các ô trống ở cuối hàng và các hàng trống
+			for len(values) > 0 && values[len(values)-1] == "" {
+				values = values[:len(values)-1]
+			}
+			if len(values) > 0 {
+				table.Rows = append(table.Rows, values)
+			}
+		}
+		if len(table.Rows) == 0 {
+			continue
+		}
+		result.Tables = append(result.Tables, table)
+
+		if sb.Len() > 0 {
+			sb.WriteString(pageSeparator)
+		}
+		fmt.Fprintf(&sb, "--- Sheet: %s ---\n", table.Name)
+		for _, row := range table.Rows {
+			sb.WriteString(strings.Join(row, " | "))
+			sb.WriteByte('\n')
+		}
+	}
+	result.Text = sb.String()
+	result.normalize()
+	for _, t := range result.Tables {
+		result.Warnings = append(result.Warnings, checkTableTotals(t)...)
+	}
+	return result, nil
+}
+
+// cellText trả về giá trị hiển thị của ô. Ô số có định dạng không đọc lại được thành
+// số (ví dụ dạng khoa học) thì dùng giá trị số gốc.
+func cellText(cell spreadsheet.Cell) string {
+	text := strings.TrimSpace(cell.GetFormattedValue())
+	if !cell.IsNumber() {
+		return strings.Join(strings.Fields(NormalizeText(text)), " ")
+	}
+	v, err := cell.GetValueAsNumber()
+	if err != nil {
+		return text
+	}
+	if parsed, ok := parseAmount(text); !ok || parsed != v {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return text
+}
+
+// maxSpreadsheetColumns là số cột của một sheet XLSX (A đến XFD).
+const maxSpreadsheetColumns = 16384
+
+// columnIndex chuyển tham chiếu ô ("C12") thành chỉ số cột bắt đầu từ 0; -1 nếu không hợp lệ
+// hoặc vượt quá cột XFD.
+func columnIndex(ref string) int {
+	col := 0
+	n := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		if col = col*26 + int(r-'A'+1); col > maxSpreadsheetColumns {
+			return -1
+		}
+		n++
+	}
+	if n == 0 {
+		return -1
+	}
+	return col - 1
+}
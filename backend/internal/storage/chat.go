@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"fmt"
+
+	"documind/backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ChatStore keeps the questions asked about a document in contract chat and their answers.
+type ChatStore interface {
+	// Add lưu một câu hỏi và câu trả lời về document m.DocumentID.
+	Add(m *models.ChatMessage) error
+	// History trả về tối đa limit tin nhắn gần nhất của document, cũ nhất trước. Document
+	// trong thùng rác không có tin nhắn nào.
+	History(documentID uint, limit int) ([]models.ChatMessage, error)
+}
+
+type gormChatStore struct {
+	db *gorm.DB
+}
+
+func (s *gormChatStore) Add(m *models.ChatMessage) error {
+	if err := s.db.Create(m).Error; err != nil {
+		return fmt.Errorf("failed to save chat message: %w", err)
+	}
+	return nil
+}
+
+func (s *gormChatStore) History(documentID uint, limit int) ([]models.ChatMessage, error) {
+	var messages []models.ChatMessage
+	err := s.db.Where("document_id = ?", documentID).Where(liveDocument).
+		Order("id DESC").Limit(limit).Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+	// Đọc mới nhất trước để lấy limit tin cuối, rồi đảo lại theo thứ tự hội thoại
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
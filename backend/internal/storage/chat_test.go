@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"documind/backend/internal/models"
+)
+
+func chatQuestions(t *testing.T, store *Store, documentID uint, limit int) []string {
+	t.Helper()
+	messages, err := store.Chats.History(documentID, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	questions := []string{}
+	for _, m := range messages {
+		questions = append(questions, m.Question)
+	}
+	return questions
+}
+
+func TestChatStore(t *testing.T) {
+	store := openTestStore(t)
+	a := createTestAnalysis(t, store, nil, "hợp đồng thuê kho")
+	other := createTestAnalysis(t, store, nil, "hợp đồng mua bán")
+	for i := 1; i <= 3; i++ {
+		m := &models.ChatMessage{DocumentID: a.DocumentID, Question: fmt.Sprintf("câu hỏi %d", i), Answer: "trả lời"}
+		if err := store.Chats.Add(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Chats.Add(&models.ChatMessage{DocumentID: other.DocumentID, Question: "khác", Answer: "trả lời"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := chatQuestions(t, store, a.DocumentID, 10), []string{"câu hỏi 1", "câu hỏi 2", "câu hỏi 3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("history = %v, want %v", got, want)
+	}
+	if got, want := chatQuestions(t, store, a.DocumentID, 2), []string{"câu hỏi 2", "câu hỏi 3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("history limited to 2 = %v, want %v", got, want)
+	}
+
+	// Document trong thùng rác không có lịch sử; xoá vĩnh viễn thì lịch sử bị xoá theo
+	if err := store.Trash.Delete(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := chatQuestions(t, store, a.DocumentID, 10); len(got) != 0 {
+		t.Errorf("history of a trashed document = %v, want none", got)
+	}
+	if err := store.Trash.Purge(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	var left int64
+	if err := store.db.Model(&models.ChatMessage{}).Where("document_id = ?", a.DocumentID).Count(&left).Error; err != nil {
+		t.Fatal(err)
+	}
+	if left != 0 {
+		t.Errorf("%d chat messages left after purge", left)
+	}
+	if got, want := chatQuestions(t, store, other.DocumentID, 10), []string{"khác"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("history of another document = %v, want %v", got, want)
+	}
+}
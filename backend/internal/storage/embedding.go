@@ -0,0 +1,378 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"documind/backend/internal/models"
+	"documind/backend/internal/services"
+
+	"gorm.io/gorm"
+)
+
+// embeddingLoadBatchSize là số embedding đọc mỗi lần khi dựng chỉ mục vector.
+const embeddingLoadBatchSize = 500
+
+// EmbeddingHit is a stored embedding close to a vector.
+type EmbeddingHit struct {
+	EmbeddingID uint
+	DocumentID  uint
+	// AnalysisID là analysis mới nhất có embedding của document, kể cả với embedding điều khoản
+	AnalysisID uint
+	Kind       string
+	Ref        string
+	Text       string
+	// Similarity là cosine similarity, từ -1 tới 1
+	Similarity float64
+}
+
+// EmbeddingStore stores the embeddings of analyses and of document clauses and finds the
+// ones nearest to a vector. Only the latest analysis with embeddings of each document is
+// searched.
+type EmbeddingStore interface {
+	// Save thay các embedding profile và risk của analysis bằng analysis; clauses khác nil
+	// thì thay cả các embedding điều khoản của document.
+	Save(documentID, analysisID uint, analysis, clauses []models.Embedding) error
+	// ByAnalysis trả về các embedding profile và risk của analysis tạo bởi model.
+	ByAnalysis(analysisID uint, model string) ([]models.Embedding, error)
+	// HasClauses cho biết document đã có embedding điều khoản tạo bởi model chưa.
+	HasClauses(documentID uint, model string) (bool, error)
+	// Nearest trả về các embedding của model có loại trong kinds, giống vector nhất trước, bỏ
+	// qua document excludeDocumentID (0 là không bỏ qua). limit <= 0 trả về tất cả.
+	Nearest(vector []float32, model string, kinds []string, excludeDocumentID uint, limit int) ([]EmbeddingHit, error)
+	// Missing trả về analysis mới nhất của các document khi analysis đó chưa có embedding
+	// profile của model, chỉ những analysis có id lớn hơn afterID, tăng dần theo id.
+	Missing(model string, afterID uint, limit int) ([]models.Analysis, error)
+	// CountMissing đếm các document có analysis mới nhất chưa có embedding profile của model.
+	CountMissing(model string) (int64, error)
+}
+
+// EncodeVector chuyển vector thành các số float32 little-endian để lưu vào models.Embedding.
+func EncodeVector(v []float32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(x))
+	}
+	return b
+}
+
+// DecodeVector là hàm ngược của EncodeVector.
+func DecodeVector(b []byte) []float32 {
+	v := make([]float32, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return v
+}
+
+type gormEmbeddingStore struct {
+	db    *gorm.DB
+	index *vectorIndex
+}
+
+func (s *gormEmbeddingStore) Save(documentID, analysisID uint, analysis, clauses []models.Embedding) error {
+	for i := range analysis {
+		analysis[i].DocumentID, analysis[i].AnalysisID = documentID, &analysisID
+	}
+	for i := range clauses {
+		clauses[i].DocumentID, clauses[i].AnalysisID = documentID, nil
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("analysis_id = ?", analysisID).Delete(&models.Embedding{}).Error; err != nil {
+			return fmt.Errorf("failed to delete analysis embeddings: %w", err)
+		}
+		if len(analysis) > 0 {
+			if err := tx.Create(&analysis).Error; err != nil {
+				return fmt.Errorf("failed to save analysis embeddings: %w", err)
+			}
+		}
+		if clauses == nil {
+			return nil
+		}
+		if err := tx.Where("document_id = ? AND analysis_id IS NULL", documentID).Delete(&models.Embedding{}).Error; err != nil {
+			return fmt.Errorf("failed to delete clause embeddings: %w", err)
+		}
+		if len(clauses) > 0 {
+			if err := tx.Create(&clauses).Error; err != nil {
+				return fmt.Errorf("failed to save clause embeddings: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.index.save(documentID, analysisID, analysis, clauses)
+	return nil
+}
+
+func (s *gormEmbeddingStore) ByAnalysis(analysisID uint, model string) ([]models.Embedding, error) {
+	var embeddings []models.Embedding
+	err := s.db.Where("analysis_id = ? AND model = ?", analysisID, model).Order("id").Find(&embeddings).Error
+	return embeddings, err
+}
+
+func (s *gormEmbeddingStore) HasClauses(documentID uint, model string) (bool, error) {
+	var n int64
+	err := s.db.Model(&models.Embedding{}).
+		Where("document_id = ? AND analysis_id IS NULL AND model = ?", documentID, model).Count(&n).Error
+	return n > 0, err
+}
+
+// missingEmbeddings chọn analysis mới nhất của các document khi analysis đó chưa có embedding profile của model.
+func missingEmbeddings(db *gorm.DB, model string) *gorm.DB {
+	return db.Where(latestAnalysis).
+		Where("NOT EXISTS (SELECT 1 FROM embeddings WHERE embeddings.analysis_id = analyses.id AND embeddings.kind = ? AND embeddings.model = ?)", services.EmbeddingProfile, model)
+}
+
+func (s *gormEmbeddingStore) Missing(model string, afterID uint, limit int) ([]models.Analysis, error) {
+	var analyses []models.Analysis
+	err := missingEmbeddings(s.db, model).Where("analyses.id > ?", afterID).Order("analyses.id").Limit(limit).Find(&analyses).Error
+	return analyses, err
+}
+
+func (s *gormEmbeddingStore) CountMissing(model string) (int64, error) {
+	var n int64
+	err := missingEmbeddings(s.db.Model(&models.Analysis{}), model).Count(&n).Error
+	return n, err
+}
+
+func (s *gormEmbeddingStore) Nearest(vector []float32, model string, kinds []string, excludeDocumentID uint, limit int) ([]EmbeddingHit, error) {
+	if err := s.index.load(s.db); err != nil {
+		return nil, err
+	}
+	hits := s.index.nearest(vector, model, kinds, excludeDocumentID, limit)
+	if len(hits) == 0 {
+		return hits, nil
+	}
+	// Text không được giữ trong bộ nhớ, chỉ đọc cho các kết quả trả về
+	ids := make([]uint, len(hits))
+	for i, h := range hits {
+		ids[i] = h.EmbeddingID
+	}
+	var rows []models.Embedding
+	if err := s.db.Select("id", "text").Find(&rows, ids).Error; err != nil {
+		return nil, err
+	}
+	texts := make(map[uint]string, len(rows))
+	for _, r := range rows {
+		texts[r.ID] = r.Text
+	}
+	for i := range hits {
+		hits[i].Text = texts[hits[i].EmbeddingID]
+	}
+	return hits, nil
+}
+
+// vectorIndex giữ trong bộ nhớ các vector của analysis mới nhất có embedding và của các điều
+// khoản của mỗi document, để tìm vector gần nhất mà không phải đọc lại bảng embeddings. Chỉ
+// mục được dựng ở lần tìm đầu tiên và cập nhật khi lưu embedding hoặc khi analysis bị xoá, khôi phục.
+type vectorIndex struct {
+	mu     sync.RWMutex
+	loaded bool
+	docs   map[uint]*vectorDocument
+}
+
+type vectorDocument struct {
+	analysisID uint
+	analysis   []vectorEntry
+	clauses    []vectorEntry
+}
+
+type vectorEntry struct {
+	id        uint
+	kind, ref string
+	model     string
+	vector    []float32
+}
+
+func newVectorIndex() *vectorIndex {
+	return &vectorIndex{docs: map[uint]*vectorDocument{}}
+}
+
+func newVectorEntry(e *models.Embedding) vectorEntry {
+	return vectorEntry{id: e.ID, kind: e.Kind, ref: e.Ref, model: e.Model, vector: DecodeVector(e.Vector)}
+}
+
+func (x *vectorIndex) load(db *gorm.DB) error {
+	x.mu.RLock()
+	loaded := x.loaded
+	x.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.loaded {
+		return nil
+	}
+	var afterID uint
+	for {
+		var rows []models.Embedding
+		err := db.Select("id", "document_id", "analysis_id", "kind", "ref", "model", "vector").
+			Where("id > ?", afterID).Where("analysis_id IS NULL OR " + liveAnalysis).Order("id").Limit(embeddingLoadBatchSize).Find(&rows).Error
+		if err != nil {
+			return fmt.Errorf("failed to load embeddings: %w", err)
+		}
+		for i := range rows {
+			x.document(rows[i].DocumentID).add(&rows[i])
+		}
+		if len(rows) < embeddingLoadBatchSize {
+			break
+		}
+		afterID = rows[len(rows)-1].ID
+	}
+	x.loaded = true
+	return nil
+}
+
+func (x *vectorIndex) document(documentID uint) *vectorDocument {
+	doc := x.docs[documentID]
+	if doc == nil {
+		doc = &vectorDocument{}
+		x.docs[documentID] = doc
+	}
+	return doc
+}
+
+// add thêm một embedding đọc từ cơ sở dữ liệu; chỉ giữ vector của analysis mới nhất.
+func (doc *vectorDocument) add(e *models.Embedding) {
+	switch {
+	case e.AnalysisID == nil:
+		doc.clauses = append(doc.clauses, newVectorEntry(e))
+	case *e.AnalysisID > doc.analysisID:
+		doc.analysisID, doc.analysis = *e.AnalysisID, []vectorEntry{newVectorEntry(e)}
+	case *e.AnalysisID == doc.analysisID:
+		doc.analysis = append(doc.analysis, newVectorEntry(e))
+	}
+}
+
+// save cập nhật chỉ mục sau khi lưu embedding, nếu chỉ mục đã được dựng.
+func (x *vectorIndex) save(documentID, analysisID uint, analysis, clauses []models.Embedding) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.loaded {
+		return
+	}
+	doc := x.document(documentID)
+	if analysisID >= doc.analysisID {
+		doc.analysisID, doc.analysis = analysisID, nil
+		for i := range analysis {
+			doc.analysis = append(doc.analysis, newVectorEntry(&analysis[i]))
+		}
+	}
+	if clauses != nil {
+		doc.clauses = nil
+		for i := range clauses {
+			doc.clauses = append(doc.clauses, newVectorEntry(&clauses[i]))
+		}
+	}
+}
+
+// refresh đọc lại vector analysis của một document sau khi analysis removedID của nó bị xoá
+// (removedID là 0 khi khôi phục). Vector của analysis mới hơn được lưu trong lúc đọc không bị
+// ghi đè.
+func (x *vectorIndex) refresh(db *gorm.DB, documentID, removedID uint) error {
+	x.mu.RLock()
+	loaded := x.loaded
+	x.mu.RUnlock()
+	if !loaded {
+		return nil
+	}
+
+	var rows []models.Embedding
+	err := db.Select("id", "document_id", "analysis_id", "kind", "ref", "model", "vector").
+		Where("document_id = ? AND analysis_id IS NOT NULL", documentID).Where(liveAnalysis).Order("id").Find(&rows).Error
+	if err != nil {
+		return fmt.Errorf("failed to refresh embeddings: %w", err)
+	}
+	latest := &vectorDocument{}
+	for i := range rows {
+		latest.add(&rows[i])
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.loaded {
+		return nil
+	}
+	doc, ok := x.docs[documentID]
+	if !ok {
+		if latest.analysisID == 0 {
+			return nil
+		}
+		doc = x.document(documentID)
+	}
+	if doc.analysisID == removedID || latest.analysisID >= doc.analysisID {
+		doc.analysisID, doc.analysis = latest.analysisID, latest.analysis
+	}
+	return nil
+}
+
+// drop bỏ các vector của một document đã bị xoá vĩnh viễn.
+func (x *vectorIndex) drop(documentID uint) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	delete(x.docs, documentID)
+}
+
+// reset bỏ chỉ mục để dựng lại ở lần tìm sau, khi không cập nhật được bằng refresh.
+func (x *vectorIndex) reset() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.docs = map[uint]*vectorDocument{}
+	x.loaded = false
+}
+
+func (x *vectorIndex) nearest(vector []float32, model string, kinds []string, excludeDocumentID uint, limit int) []EmbeddingHit {
+	wanted := map[string]bool{}
+	for _, k := range kinds {
+		wanted[k] = true
+	}
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	var hits []EmbeddingHit
+	for documentID, doc := range x.docs {
+		if documentID == excludeDocumentID || doc.analysisID == 0 {
+			continue
+		}
+		for _, entries := range [][]vectorEntry{doc.analysis, doc.clauses} {
+			for _, e := range entries {
+				if !wanted[e.kind] || e.model != model || len(e.vector) != len(vector) {
+					continue
+				}
+				hits = append(hits, EmbeddingHit{
+					EmbeddingID: e.id,
+					DocumentID:  documentID,
+					AnalysisID:  doc.analysisID,
+					Kind:        e.kind,
+					Ref:         e.ref,
+					Similarity:  dot(vector, e.vector),
+				})
+			}
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Similarity != hits[j].Similarity {
+			return hits[i].Similarity > hits[j].Similarity
+		}
+		return hits[i].EmbeddingID < hits[j].EmbeddingID
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// dot là tích vô hướng, bằng cosine similarity với vector đã chuẩn hoá.
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
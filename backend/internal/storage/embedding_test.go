@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+
+	"documind/backend/internal/models"
+)
+
+const testEmbeddingModel = "test-model"
+
+func saveTestEmbeddings(t *testing.T, store *Store, a *models.Analysis, clauses bool) {
+	t.Helper()
+	vector := EncodeVector([]float32{1, 0})
+	analysis := []models.Embedding{{Kind: "profile", Model: testEmbeddingModel, Vector: vector}}
+	var clauseEmbeddings []models.Embedding
+	if clauses {
+		clauseEmbeddings = []models.Embedding{{Kind: "clause", Ref: "Điều 1", Model: testEmbeddingModel, Vector: vector}}
+	}
+	if err := store.Embeddings.Save(a.DocumentID, a.ID, analysis, clauseEmbeddings); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// nearestAnalyses trả về analysis của các kết quả Nearest, mỗi kết quả một phần tử.
+func nearestAnalyses(t *testing.T, store *Store) []uint {
+	t.Helper()
+	hits, err := store.Embeddings.Nearest([]float32{1, 0}, testEmbeddingModel, []string{"profile", "clause"}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []uint{}
+	for _, h := range hits {
+		ids = append(ids, h.AnalysisID)
+	}
+	return ids
+}
+
+func TestVectorIndexTrash(t *testing.T) {
+	store := openTestStore(t)
+	first := createTestAnalysis(t, store, nil, "hợp đồng thuê kho")
+	saveTestEmbeddings(t, store, first, true)
+	second := createTestAnalysis(t, store, &models.Document{ID: first.DocumentID}, "phụ lục thuê kho")
+	saveTestEmbeddings(t, store, second, false)
+	index := store.Trash.(*gormTrashStore).vectors
+
+	steps := []struct {
+		name   string
+		change func() error
+		// want là analysis của kết quả profile và điều khoản
+		want []uint
+	}{
+		{"latest analysis", nil, []uint{second.ID, second.ID}},
+		{"delete latest falls back to previous", func() error { return store.Trash.Delete(second.ID) }, []uint{first.ID, first.ID}},
+		{"restore brings the latest back", func() error { return store.Trash.Restore(second.ID) }, []uint{second.ID, second.ID}},
+		{"delete older analysis keeps the latest", func() error { return store.Trash.Delete(first.ID) }, []uint{second.ID, second.ID}},
+		{"delete last analysis hides the document", func() error { return store.Trash.Delete(second.ID) }, []uint{}},
+		{"purge one analysis keeps the document", func() error { return store.Trash.Purge(first.ID) }, []uint{}},
+		{"restore after partial purge", func() error { return store.Trash.Restore(second.ID) }, []uint{second.ID, second.ID}},
+	}
+	for _, step := range steps {
+		if step.change != nil {
+			if err := step.change(); err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+			if !index.loaded {
+				t.Fatalf("%s: vector index was reset", step.name)
+			}
+		}
+		if got := nearestAnalyses(t, store); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: nearest analyses = %v, want %v", step.name, got, step.want)
+		}
+	}
+
+	if err := store.Trash.Delete(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Trash.Purge(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := index.docs[first.DocumentID]; ok || !index.loaded {
+		t.Errorf("purged document is still in the vector index (loaded=%v)", index.loaded)
+	}
+}
@@ -0,0 +1,367 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"documind/backend/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// gormAnalysisStore và gormDetailStore dùng chung cho Postgres và SQLite: các truy vấn chỉ
+// dùng SQL chung của hai cơ sở dữ liệu (LOWER ... LIKE thay cho ILIKE).
+type gormAnalysisStore struct {
+	db *gorm.DB
+	// index là chỉ mục tìm kiếm trong bộ nhớ của SQLite, nil với Postgres
+	index *searchIndex
+}
+
+func (s *gormAnalysisStore) Create(a *NewAnalysis) error {
+	if err := s.create(a); err != nil {
+		return err
+	}
+	if s.index != nil {
+		s.index.add(a.Analysis.ID, a.Analysis.DocumentID, a.Detail)
+	}
+	return nil
+}
+
+func (s *gormAnalysisStore) create(a *NewAnalysis) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// Các bản ghi liên quan được tạo riêng bên dưới, không để GORM tự lưu association
+		if a.Document != nil {
+			if err := tx.Omit(clause.Associations).Create(a.Document).Error; err != nil {
+				return fmt.Errorf("failed to save document: %w", err)
+			}
+			a.Analysis.DocumentID = a.Document.ID
+		}
+		if a.Analysis.DocumentID == 0 {
+			return fmt.Errorf("analysis has no document")
+		}
+		if err := tx.Omit(clause.Associations).Create(a.Analysis).Error; err != nil {
+			return fmt.Errorf("failed to save main analysis record: %w", err)
+		}
+		id := a.Analysis.ID
+		a.Detail.AnalysisID = id
+		if err := tx.Create(a.Detail).Error; err != nil {
+			return fmt.Errorf("failed to save analysis details: %w", err)
+		}
+		if a.Provenance != nil {
+			a.Provenance.AnalysisID = id
+			if err := tx.Create(a.Provenance).Error; err != nil {
+				return fmt.Errorf("failed to save analysis provenance: %w", err)
+			}
+		}
+		if len(a.Parties) > 0 {
+			for i := range a.Parties {
+				a.Parties[i].AnalysisID = id
+			}
+			if err := tx.Create(&a.Parties).Error; err != nil {
+				return fmt.Errorf("failed to save contract parties: %w", err)
+			}
+		}
+		if a.Document == nil {
+			return nil
+		}
+
+		// Các bản ghi gắn với file chỉ được tạo cùng document
+		documentID := a.Document.ID
+		if a.Fingerprint != nil {
+			a.Fingerprint.DocumentID = documentID
+			if err := tx.Create(a.Fingerprint).Error; err != nil {
+				return fmt.Errorf("failed to save content fingerprint: %w", err)
+			}
+		}
+		if a.Metadata != nil {
+			a.Metadata.DocumentID = documentID
+			if err := tx.Create(a.Metadata).Error; err != nil {
+				return fmt.Errorf("failed to save document metadata: %w", err)
+			}
+		}
+		if a.Metrics != nil {
+			a.Metrics.DocumentID = documentID
+			if err := tx.Create(a.Metrics).Error; err != nil {
+				return fmt.Errorf("failed to save extraction metrics: %w", err)
+			}
+		}
+		if len(a.Files) > 0 {
+			for i := range a.Files {
+				a.Files[i].DocumentID = documentID
+			}
+			if err := tx.Create(&a.Files).Error; err != nil {
+				return fmt.Errorf("failed to save bundle files: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// withDetails nạp các bản ghi cần để trả lại kết quả phân tích đã lưu.
+func (s *gormAnalysisStore) withDetails() *gorm.DB {
+	return s.db.Preload("AnalysisDetail").Preload("Provenance").Preload("Parties", orderByID).
+		Preload("Document.Files", orderByID).
+		Preload("Document.Metrics").Preload("Document.Tags", orderByTag)
+}
+
+func orderByID(db *gorm.DB) *gorm.DB  { return db.Order("id") }
+func orderByTag(db *gorm.DB) *gorm.DB { return db.Order("tag") }
+
+func (s *gormAnalysisStore) ByFileHash(fileHash string) (*models.Analysis, error) {
+	var a models.Analysis
+	if err := s.withDetails().Where("file_hash = ?", fileHash).Last(&a).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &a, nil
+}
+
+func (s *gormAnalysisStore) ByContentHash(contentHash string) (*models.Analysis, error) {
+	var fingerprint models.ContentFingerprint
+	if err := s.db.Where("content_hash = ?", contentHash).Where(liveDocument).First(&fingerprint).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return s.LatestByDocument(fingerprint.DocumentID)
+}
+
+func (s *gormAnalysisStore) ByID(id uint) (*models.Analysis, error) {
+	var a models.Analysis
+	if err := s.withDetails().First(&a, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &a, nil
+}
+
+func (s *gormAnalysisStore) LatestByDocument(documentID uint) (*models.Analysis, error) {
+	var a models.Analysis
+	if err := s.withDetails().Where("document_id = ?", documentID).Last(&a).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &a, nil
+}
+
+func (s *gormAnalysisStore) ByDocument(documentID uint) ([]models.Analysis, error) {
+	var analyses []models.Analysis
+	err := s.db.Preload("Provenance").Where("document_id = ?", documentID).Order("id").Find(&analyses).Error
+	return analyses, err
+}
+
+func (s *gormAnalysisStore) ByIDs(ids []uint) ([]models.Analysis, error) {
+	var analyses []models.Analysis
+	if len(ids) == 0 {
+		return analyses, nil
+	}
+	err := s.db.Preload("Document.Metadata").Find(&analyses, ids).Error
+	return analyses, err
+}
+
+// latestAnalysis chọn analysis mới nhất chưa bị xoá của mỗi document.
+const latestAnalysis = "analyses.id IN (SELECT MAX(id) FROM analyses WHERE deleted_at IS NULL GROUP BY document_id)"
+
+// liveAnalysis và liveDocument loại các bản ghi phụ của analysis, document đã vào thùng rác.
+const (
+	liveAnalysis = "analysis_id IN (SELECT id FROM analyses WHERE deleted_at IS NULL)"
+	liveDocument = "document_id IN (SELECT id FROM documents WHERE deleted_at IS NULL)"
+)
+
+// latestStale chọn analysis mới nhất của mỗi document khi analysis đó có phiên bản pipeline khác version.
+func latestStale(db *gorm.DB, version string) *gorm.DB {
+	return db.Where(latestAnalysis).
+		Where("analyses.pipeline_version IS NULL OR analyses.pipeline_version <> ?", version)
+}
+
+func (s *gormAnalysisStore) Stale(version string, afterID uint, limit int) ([]models.Analysis, error) {
+	var analyses []models.Analysis
+	err := latestStale(s.withDetails(), version).Where("analyses.id > ?", afterID).Order("analyses.id").Limit(limit).Find(&analyses).Error
+	return analyses, err
+}
+
+func (s *gormAnalysisStore) CountStale(version string) (int64, error) {
+	var n int64
+	err := latestStale(s.db.Model(&models.Analysis{}), version).Count(&n).Error
+	return n, err
+}
+
+func (s *gormAnalysisStore) FingerprintsByBand(bands [4]int) ([]models.ContentFingerprint, error) {
+	var candidates []models.ContentFingerprint
+	err := s.db.Where("band0 = ? OR band1 = ? OR band2 = ? OR band3 = ?", bands[0], bands[1], bands[2], bands[3]).
+		Where(liveDocument).Find(&candidates).Error
+	return candidates, err
+}
+
+func (s *gormAnalysisStore) List(f AnalysisFilter, opts ListOptions) (*AnalysisPage, error) {
+	query := s.db.Model(&models.Analysis{})
+	// Ngôn ngữ, loại hợp đồng, mức rủi ro và thời điểm phân tích lưu trên bảng analyses nên không cần join
+	if f.Language != "" {
+		query = query.Where("analyses.language = ?", strings.ToLower(f.Language))
+	}
+	if f.ContractType != "" {
+		query = query.Where("analyses.contract_type = ?", strings.ToLower(f.ContractType))
+	}
+	if len(f.RiskSeverities) > 0 {
+		query = query.Where("analyses.risk_severity IN ?", f.RiskSeverities)
+	}
+	if f.AnalyzedFrom != nil {
+		query = query.Where("analyses.created_at >= ?", *f.AnalyzedFrom)
+	}
+	if f.AnalyzedBefore != nil {
+		query = query.Where("analyses.created_at < ?", *f.AnalyzedBefore)
+	}
+	if f.Party != "" {
+		query = query.Where("EXISTS (SELECT 1 FROM analysis_parties WHERE analysis_parties.analysis_id = analyses.id AND LOWER(analysis_parties.name) LIKE ?)",
+			"%"+strings.ToLower(f.Party)+"%")
+	}
+	if f.Tag != "" {
+		query = query.Where("EXISTS (SELECT 1 FROM document_tags WHERE document_tags.document_id = analyses.document_id AND document_tags.tag = ?)",
+			strings.ToLower(f.Tag))
+	}
+	if f.Model != "" {
+		query = query.Where("EXISTS (SELECT 1 FROM analysis_provenance WHERE analysis_provenance.analysis_id = analyses.id AND analysis_provenance.model = ?)", f.Model)
+	}
+
+	var conds []string
+	var args []interface{}
+	for _, m := range []struct{ column, value string }{
+		{"file_name", f.FileName}, {"author", f.Author}, {"title", f.Title}, {"producer", f.Producer},
+	} {
+		if m.value != "" {
+			conds = append(conds, "LOWER(document_metadata."+m.column+") LIKE ?")
+			args = append(args, "%"+strings.ToLower(m.value)+"%")
+		}
+	}
+	for _, m := range []struct{ column, value string }{{"mime_type", f.MIMEType}, {"format", f.Format}} {
+		if m.value != "" {
+			conds = append(conds, "document_metadata."+m.column+" = ?")
+			args = append(args, strings.ToLower(m.value))
+		}
+	}
+	if f.MinPages != nil {
+		conds = append(conds, "document_metadata.page_count >= ?")
+		args = append(args, *f.MinPages)
+	}
+	if f.MaxPages != nil {
+		conds = append(conds, "document_metadata.page_count <= ?")
+		args = append(args, *f.MaxPages)
+	}
+	if f.CreatedFrom != nil {
+		conds = append(conds, "document_metadata.document_created_at >= ?")
+		args = append(args, *f.CreatedFrom)
+	}
+	if f.CreatedBefore != nil {
+		conds = append(conds, "document_metadata.document_created_at < ?")
+		args = append(args, *f.CreatedBefore)
+	}
+	// Chỉ join bảng document_metadata khi có ít nhất một bộ lọc theo metadata
+	if len(conds) > 0 {
+		query = query.Joins("JOIN document_metadata ON document_metadata.document_id = analyses.document_id").
+			Where(strings.Join(conds, " AND "), args...)
+	}
+
+	page := &AnalysisPage{}
+	// Tổng số được đếm trước khi áp dụng cursor và giới hạn trang
+	if err := query.Session(&gorm.Session{}).Count(&page.Total).Error; err != nil {
+		return nil, err
+	}
+
+	column := "analyses.created_at"
+	switch opts.Sort {
+	case SortRiskSeverity, SortRiskCount:
+		column = "analyses." + opts.Sort
+	}
+	op, dir := ">", "asc"
+	if opts.Desc {
+		op, dir = "<", "desc"
+	}
+	if c := opts.After; c != nil {
+		var value interface{} = c.Value
+		if column == "analyses.created_at" {
+			value = c.CreatedAt
+		}
+		// Keyset: các analysis đứng sau cursor theo (cột sắp xếp, id)
+		query = query.Where("(("+column+" "+op+" ?) OR ("+column+" = ? AND analyses.id "+op+" ?))", value, value, c.ID)
+	}
+	// Lấy thêm một bản ghi để biết còn trang sau hay không
+	query = query.Order(column+" "+dir).Order("analyses.id "+dir).Limit(opts.Limit+1).
+		Preload("Document.Metadata").Preload("Document.Tags", orderByTag).Preload("Parties", orderByID).
+		Preload("Provenance", func(db *gorm.DB) *gorm.DB { return db.Select("id", "analysis_id", "model") })
+	if err := query.Find(&page.Analyses).Error; err != nil {
+		return nil, err
+	}
+	if len(page.Analyses) > opts.Limit {
+		page.Analyses = page.Analyses[:opts.Limit]
+		last := page.Analyses[len(page.Analyses)-1]
+		page.Next = &Cursor{ID: last.ID, CreatedAt: last.CreatedAt}
+		switch opts.Sort {
+		case SortRiskSeverity:
+			page.Next.Value = last.RiskSeverity
+		case SortRiskCount:
+			page.Next.Value = last.RiskCount
+		}
+	}
+	return page, nil
+}
+
+func (s *gormAnalysisStore) SetTags(documentID uint, tags []string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var document models.Document
+		if err := tx.Select("id").First(&document, documentID).Error; err != nil {
+			return notFound(err)
+		}
+		if err := tx.Where("document_id = ?", documentID).Delete(&models.DocumentTag{}).Error; err != nil {
+			return fmt.Errorf("failed to delete document tags: %w", err)
+		}
+		if len(tags) == 0 {
+			return nil
+		}
+		records := make([]models.DocumentTag, len(tags))
+		for i, tag := range tags {
+			records[i] = models.DocumentTag{DocumentID: documentID, Tag: tag}
+		}
+		if err := tx.Create(&records).Error; err != nil {
+			return fmt.Errorf("failed to save document tags: %w", err)
+		}
+		return nil
+	})
+}
+
+type gormDetailStore struct {
+	db *gorm.DB
+}
+
+func (s *gormDetailStore) Detail(analysisID uint) (*models.AnalysisDetail, error) {
+	var detail models.AnalysisDetail
+	if err := s.db.Where("analysis_id = ?", analysisID).Where(liveAnalysis).First(&detail).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &detail, nil
+}
+
+func (s *gormDetailStore) Files(documentID uint) ([]models.AnalysisFile, error) {
+	var files []models.AnalysisFile
+	err := s.db.Where("document_id = ?", documentID).Order("id").Find(&files).Error
+	return files, err
+}
+
+func (s *gormDetailStore) File(documentID, fileID uint) (*models.AnalysisFile, error) {
+	var file models.AnalysisFile
+	if err := s.db.Where("id = ? AND document_id = ?", fileID, documentID).First(&file).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &file, nil
+}
+
+func (s *gormDetailStore) Metrics(documentID uint) (*models.ExtractionMetrics, error) {
+	var metrics models.ExtractionMetrics
+	if err := s.db.Where("document_id = ?", documentID).First(&metrics).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &metrics, nil
+}
+
+func (s *gormDetailStore) Provenance(analysisID uint) (*models.AnalysisProvenance, error) {
+	var provenance models.AnalysisProvenance
+	if err := s.db.Where("analysis_id = ?", analysisID).Where(liveAnalysis).First(&provenance).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &provenance, nil
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"fmt"
+
+	"documind/backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of background jobs.
+const (
+	JobKindReanalysis = "reanalysis"
+)
+
+// JobStore records the progress of background jobs so that it outlives the process that
+// ran them.
+type JobStore interface {
+	// Create lưu job mới và gán job.ID.
+	Create(job *models.Job) error
+	// Update ghi lại trạng thái và tiến độ của job.
+	Update(job *models.Job) error
+	// Latest trả về job gần nhất thuộc loại kind; ErrNotFound khi chưa có job nào.
+	Latest(kind string) (*models.Job, error)
+}
+
+type gormJobStore struct {
+	db *gorm.DB
+}
+
+func (s *gormJobStore) Create(job *models.Job) error {
+	if err := s.db.Create(job).Error; err != nil {
+		return fmt.Errorf("failed to save job: %w", err)
+	}
+	return nil
+}
+
+func (s *gormJobStore) Update(job *models.Job) error {
+	if err := s.db.Save(job).Error; err != nil {
+		return fmt.Errorf("failed to update job: %w", err)
+	}
+	return nil
+}
+
+func (s *gormJobStore) Latest(kind string) (*models.Job, error) {
+	var job models.Job
+	if err := s.db.Where("kind = ?", kind).Order("id DESC").First(&job).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &job, nil
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"documind/backend/internal/models"
+)
+
+func TestJobStore(t *testing.T) {
+	store := openTestStore(t)
+	if _, err := store.Jobs.Latest(JobKindReanalysis); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Latest with no jobs: err = %v, want ErrNotFound", err)
+	}
+	for _, budget := range []int{1000, 2000} {
+		job := &models.Job{Kind: JobKindReanalysis, State: "running", TokenBudget: budget, StartedAt: time.Now()}
+		if err := store.Jobs.Create(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	job, err := store.Jobs.Latest(JobKindReanalysis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.TokenBudget != 2000 {
+		t.Fatalf("latest job has budget %d, want 2000", job.TokenBudget)
+	}
+
+	finished := time.Now()
+	job.State, job.Succeeded, job.TokensUsed, job.FinishedAt = "completed", 3, 1500, &finished
+	if err := store.Jobs.Update(job); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := store.Jobs.Latest(JobKindReanalysis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.ID != job.ID || saved.State != "completed" || saved.Succeeded != 3 || saved.TokensUsed != 1500 || saved.FinishedAt == nil {
+		t.Errorf("saved job = %+v, want the update of job #%d", saved, job.ID)
+	}
+}
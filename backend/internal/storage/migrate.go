@@ -0,0 +1,287 @@
+package storage
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// ErrSchemaBehind is returned by CheckSchema when the database has migrations that were
+// not applied yet.
+var ErrSchemaBehind = errors.New("database schema is behind")
+
+// migrationFileName là tên file migration: <phiên bản>_<tên>.up.sql hoặc .down.sql
+var migrationFileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one versioned schema change, embedded in the binary as a pair of
+// migrations/<driver>/<version>_<name>.up.sql and .down.sql files.
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationState is a migration together with when it was applied.
+type MigrationState struct {
+	Version int
+	Name    string
+	// AppliedAt là nil với migration chưa được áp dụng
+	AppliedAt *time.Time
+	// Unknown là migration đã áp dụng trong cơ sở dữ liệu nhưng không có trong bản build này
+	Unknown bool
+}
+
+// schemaMigration là một dòng của bảng schema_migrations.
+type schemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// loadMigrations đọc các migration nhúng của driver, sắp xếp theo phiên bản.
+func loadMigrations(driver string) ([]Migration, error) {
+	dir := path.Join("migrations", driver)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for driver %q: %w", driver, err)
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		m := migrationFileName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", e.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		data, err := fs.ReadFile(migrationFiles, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", e.Name(), err)
+		}
+		mig := byVersion[version]
+		if mig == nil {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration version %d is used by both %q and %q", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.up = string(data)
+		} else {
+			mig.down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.up == "" || mig.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// appliedMigrations tạo bảng schema_migrations nếu chưa có và trả về các migration đã áp dụng.
+func (s *Store) appliedMigrations() (map[int]schemaMigration, error) {
+	if err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name varchar(255) NOT NULL,
+		applied_at timestamp NOT NULL
+	)`).Error; err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	var rows []schemaMigration
+	if err := s.db.Order("version").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	applied := make(map[int]schemaMigration, len(rows))
+	for _, r := range rows {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// MigrateUp applies all pending migrations in order, each in its own transaction, and
+// returns the ones it applied.
+func (s *Store) MigrateUp() ([]Migration, error) {
+	migrations, err := loadMigrations(s.Driver)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, mig := range migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(mig.up).Error; err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now().UTC()}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("failed to apply migration %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// MigrateDown rolls back the last steps applied migrations, newest first, and returns the
+// ones it rolled back.
+func (s *Store) MigrateDown(steps int) ([]Migration, error) {
+	migrations, err := loadMigrations(s.Driver)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[int]Migration, len(migrations))
+	for _, mig := range migrations {
+		known[mig.Version] = mig
+	}
+	versions := make([]int, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+	var done []Migration
+	for _, v := range versions {
+		if len(done) >= steps {
+			break
+		}
+		mig, ok := known[v]
+		if !ok {
+			// Không có file down của migration này nên không thể rollback
+			return done, fmt.Errorf("migration %d (%s) is not known to this build", v, applied[v].Name)
+		}
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(mig.down).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{}, "version = ?", mig.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("failed to roll back migration %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// MigrationStatus lists the migrations of this build and whether they were applied, followed
+// by applied migrations this build does not know about.
+func (s *Store) MigrationStatus() ([]MigrationState, error) {
+	migrations, err := loadMigrations(s.Driver)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, mig := range migrations {
+		state := MigrationState{Version: mig.Version, Name: mig.Name}
+		if row, ok := applied[mig.Version]; ok {
+			at := row.AppliedAt
+			state.AppliedAt = &at
+			delete(applied, mig.Version)
+		}
+		states = append(states, state)
+	}
+	var unknown []MigrationState
+	for _, row := range applied {
+		at := row.AppliedAt
+		unknown = append(unknown, MigrationState{Version: row.Version, Name: row.Name, AppliedAt: &at, Unknown: true})
+	}
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i].Version < unknown[j].Version })
+	return append(states, unknown...), nil
+}
+
+// CheckSchema returns an error wrapping ErrSchemaBehind when some migrations of this build
+// have not been applied to the database.
+func (s *Store) CheckSchema() error {
+	states, err := s.MigrationStatus()
+	if err != nil {
+		return err
+	}
+	var pending []string
+	for _, st := range states {
+		if st.AppliedAt == nil {
+			pending = append(pending, fmt.Sprintf("%04d_%s", st.Version, st.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %d pending migration(s): %s", ErrSchemaBehind, len(pending), strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// CreateMigration writes empty up and down files for a new migration for every driver under
+// dir (the migrations source directory) and returns their paths. The version is one more
+// than the highest existing version.
+func CreateMigration(dir, name string) ([]string, error) {
+	name = strings.Trim(regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return nil, errors.New("migration name is empty")
+	}
+
+	drivers := []string{DriverPostgres, DriverSQLite}
+	version := 0
+	for _, driver := range drivers {
+		entries, err := os.ReadDir(filepath.Join(dir, driver))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migrations directory: %w", err)
+		}
+		for _, e := range entries {
+			if m := migrationFileName.FindStringSubmatch(e.Name()); m != nil {
+				if v, _ := strconv.Atoi(m[1]); v > version {
+					version = v
+				}
+			}
+		}
+	}
+	version++
+
+	var paths []string
+	for _, driver := range drivers {
+		for _, direction := range []string{"up", "down"} {
+			p := filepath.Join(dir, driver, fmt.Sprintf("%04d_%s.%s.sql", version, name, direction))
+			header := fmt.Sprintf("-- %04d_%s (%s, %s)\n", version, name, driver, direction)
+			if err := os.WriteFile(p, []byte(header), 0o644); err != nil {
+				return paths, fmt.Errorf("failed to create migration file: %w", err)
+			}
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"documind/backend/internal/models"
+)
+
+// baselineSchema là hai bảng do AutoMigrate tạo trước khi có migration, chưa có schema_migrations.
+const baselineSchema = "CREATE TABLE `analyses` (`id` integer PRIMARY KEY AUTOINCREMENT, `file_hash` varchar(64), `created_at` datetime, `summary_preview` varchar(200));" +
+	"CREATE UNIQUE INDEX `idx_analyses_file_hash` ON `analyses` (`file_hash`);" +
+	"CREATE TABLE `analysis_details` (`id` integer PRIMARY KEY AUTOINCREMENT, `analysis_id` integer NOT NULL, `summary` text, `key_clauses` text, `potential_risks` text," +
+	" CONSTRAINT `fk_analyses_analysis_detail` FOREIGN KEY (`analysis_id`) REFERENCES `analyses` (`id`));" +
+	"CREATE INDEX `idx_analysis_details_analysis_id` ON `analysis_details` (`analysis_id`);"
+
+func TestMigrateUpFromBaseline(t *testing.T) {
+	store, err := Open(Config{Driver: DriverSQLite, DSN: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if err := store.db.Exec(baselineSchema).Error; err != nil {
+		t.Fatal(err)
+	}
+	err = store.db.Exec("INSERT INTO `analyses` (`file_hash`, `created_at`, `summary_preview`) VALUES (?, ?, ?)",
+		"baseline-hash", time.Now().UTC(), "hợp đồng thuê kho").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.db.Exec("INSERT INTO `analysis_details` (`analysis_id`, `summary`, `key_clauses`, `potential_risks`) VALUES (1, ?, ?, ?)",
+		"hợp đồng thuê kho", `{"Điều 1","Điều 2"}`, `{}`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CheckSchema(); err != nil {
+		t.Fatal(err)
+	}
+	old, err := store.Analyses.ByFileHash("baseline-hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.AnalysisDetail.Summary != "hợp đồng thuê kho" {
+		t.Fatalf("baseline detail = %+v", old.AnalysisDetail)
+	}
+	if want := (models.StringList{"Điều 1", "Điều 2"}); !reflect.DeepEqual(old.AnalysisDetail.KeyClauses, want) {
+		t.Errorf("key clauses = %v, want %v", old.AnalysisDetail.KeyClauses, want)
+	}
+
+	a := &NewAnalysis{
+		Document: &models.Document{FileHash: "new-hash", Language: "en"},
+		Analysis: &models.Analysis{Language: "en", EmailSubject: "Lease"},
+		Detail:   &models.AnalysisDetail{Summary: "lease", Warnings: models.StringList{"scanned"}, AnalysisMode: "full"},
+	}
+	if err := store.Analyses.Create(a); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Analyses.ByID(a.Analysis.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.EmailSubject != "Lease" || got.AnalysisDetail.AnalysisMode != "full" || len(got.AnalysisDetail.Warnings) != 1 {
+		t.Errorf("new analysis = %+v, detail %+v", got, got.AnalysisDetail)
+	}
+
+	migrations, err := loadMigrations(store.Driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.MigrateDown(len(migrations)); err != nil {
+		t.Fatalf("migrate down: %v", err)
+	}
+	if _, err := store.MigrateUp(); err != nil {
+		t.Fatalf("migrate up again: %v", err)
+	}
+}
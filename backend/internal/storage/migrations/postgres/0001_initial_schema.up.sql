@@ -0,0 +1,23 @@
+-- Schema ban đầu, giống hệt schema mà AutoMigrate tạo ra cho phiên bản đầu tiên (chỉ có
+-- analyses và analysis_details). IF NOT EXISTS để cơ sở dữ liệu cũ (đã được AutoMigrate tạo)
+-- được đánh dấu là đã ở phiên bản này; các cột và bảng thêm sau đó nằm trong 0002.
+
+CREATE TABLE IF NOT EXISTS "analyses" (
+    "id" bigserial,
+    "file_hash" varchar(64),
+    "created_at" timestamptz,
+    "summary_preview" varchar(200),
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_analyses_file_hash" ON "analyses" ("file_hash");
+
+CREATE TABLE IF NOT EXISTS "analysis_details" (
+    "id" bigserial,
+    "analysis_id" bigint NOT NULL,
+    "summary" text,
+    "key_clauses" text[],
+    "potential_risks" text[],
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_analyses_analysis_detail" FOREIGN KEY ("analysis_id") REFERENCES "analyses" ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_analysis_details_analysis_id" ON "analysis_details" ("analysis_id");
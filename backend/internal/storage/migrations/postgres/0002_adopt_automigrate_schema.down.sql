@@ -0,0 +1,20 @@
+DROP TABLE "extraction_metrics";
+DROP TABLE "content_fingerprints";
+DROP TABLE "document_metadata";
+DROP TABLE "analysis_files";
+
+ALTER TABLE "analysis_details"
+    DROP COLUMN "analysis_mode",
+    DROP COLUMN "signatures",
+    DROP COLUMN "extracted_text",
+    DROP COLUMN "reconciliation",
+    DROP COLUMN "cross_references",
+    DROP COLUMN "structure",
+    DROP COLUMN "warnings";
+
+DROP INDEX "idx_analyses_language";
+ALTER TABLE "analyses"
+    DROP COLUMN "email_date",
+    DROP COLUMN "email_subject",
+    DROP COLUMN "email_from",
+    DROP COLUMN "language";
@@ -0,0 +1,98 @@
+-- Các cột và bảng mà AutoMigrate thêm dần trước khi có migration (cảnh báo trích xuất, cây
+-- điều khoản, bộ hồ sơ, e-mail, metadata, khoá nội dung, đối chiếu số liệu, chữ ký, chế độ
+-- phân tích, chỉ số chất lượng, ngôn ngữ). Cơ sở dữ liệu cũ có thể đã có một phần trong số
+-- này, tuỳ phiên bản đã chạy AutoMigrate, nên mọi thay đổi đều dùng IF NOT EXISTS.
+
+ALTER TABLE "analyses"
+    ADD COLUMN IF NOT EXISTS "language" varchar(10),
+    ADD COLUMN IF NOT EXISTS "email_from" varchar(320),
+    ADD COLUMN IF NOT EXISTS "email_subject" text,
+    ADD COLUMN IF NOT EXISTS "email_date" timestamptz;
+CREATE INDEX IF NOT EXISTS "idx_analyses_language" ON "analyses" ("language");
+
+ALTER TABLE "analysis_details"
+    ADD COLUMN IF NOT EXISTS "warnings" text[],
+    ADD COLUMN IF NOT EXISTS "structure" text,
+    ADD COLUMN IF NOT EXISTS "cross_references" text[],
+    ADD COLUMN IF NOT EXISTS "reconciliation" text[],
+    ADD COLUMN IF NOT EXISTS "extracted_text" text,
+    ADD COLUMN IF NOT EXISTS "signatures" text,
+    ADD COLUMN IF NOT EXISTS "analysis_mode" varchar(20);
+
+CREATE TABLE IF NOT EXISTS "analysis_files" (
+    "id" bigserial,
+    "analysis_id" bigint NOT NULL,
+    "file_name" text,
+    "file_hash" varchar(64),
+    "role" varchar(20),
+    "label" varchar(100),
+    "size" bigint,
+    "page_count" bigint,
+    "structure" text,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_analyses_files" FOREIGN KEY ("analysis_id") REFERENCES "analyses" ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_analysis_files_analysis_id" ON "analysis_files" ("analysis_id");
+CREATE INDEX IF NOT EXISTS "idx_analysis_files_file_hash" ON "analysis_files" ("file_hash");
+
+CREATE TABLE IF NOT EXISTS "document_metadata" (
+    "id" bigserial,
+    "analysis_id" bigint NOT NULL,
+    "file_name" text,
+    "file_size" bigint,
+    "mime_type" varchar(255),
+    "format" varchar(20),
+    "page_count" bigint,
+    "title" text,
+    "author" text,
+    "subject" text,
+    "keywords" text,
+    "creator" text,
+    "producer" text,
+    "company" text,
+    "last_modified_by" text,
+    "document_created_at" timestamptz,
+    "document_modified_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_analyses_metadata" FOREIGN KEY ("analysis_id") REFERENCES "analyses" ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_document_metadata_analysis_id" ON "document_metadata" ("analysis_id");
+CREATE INDEX IF NOT EXISTS "idx_document_metadata_mime_type" ON "document_metadata" ("mime_type");
+CREATE INDEX IF NOT EXISTS "idx_document_metadata_format" ON "document_metadata" ("format");
+CREATE INDEX IF NOT EXISTS "idx_document_metadata_author" ON "document_metadata" ("author");
+CREATE INDEX IF NOT EXISTS "idx_document_metadata_document_created_at" ON "document_metadata" ("document_created_at");
+
+CREATE TABLE IF NOT EXISTS "content_fingerprints" (
+    "id" bigserial,
+    "analysis_id" bigint NOT NULL,
+    "content_hash" varchar(64),
+    "sim_hash" bigint,
+    "band0" bigint,
+    "band1" bigint,
+    "band2" bigint,
+    "band3" bigint,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_content_fingerprints_analysis_id" ON "content_fingerprints" ("analysis_id");
+CREATE INDEX IF NOT EXISTS "idx_content_fingerprints_content_hash" ON "content_fingerprints" ("content_hash");
+CREATE INDEX IF NOT EXISTS "idx_content_fingerprints_band0" ON "content_fingerprints" ("band0");
+CREATE INDEX IF NOT EXISTS "idx_content_fingerprints_band1" ON "content_fingerprints" ("band1");
+CREATE INDEX IF NOT EXISTS "idx_content_fingerprints_band2" ON "content_fingerprints" ("band2");
+CREATE INDEX IF NOT EXISTS "idx_content_fingerprints_band3" ON "content_fingerprints" ("band3");
+
+CREATE TABLE IF NOT EXISTS "extraction_metrics" (
+    "id" bigserial,
+    "analysis_id" bigint NOT NULL,
+    "page_count" bigint,
+    "empty_pages" bigint,
+    "characters" bigint,
+    "chars_per_page" decimal,
+    "non_letter_ratio" decimal,
+    "dictionary_hit_rate" decimal,
+    "language" varchar(10),
+    "score" decimal,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_analyses_metrics" FOREIGN KEY ("analysis_id") REFERENCES "analyses" ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_extraction_metrics_analysis_id" ON "extraction_metrics" ("analysis_id");
+CREATE INDEX IF NOT EXISTS "idx_extraction_metrics_language" ON "extraction_metrics" ("language");
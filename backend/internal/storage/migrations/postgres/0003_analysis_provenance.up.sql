@@ -0,0 +1,24 @@
+CREATE TABLE "analysis_provenance" (
+    "id" bigserial,
+    "analysis_id" bigint NOT NULL,
+    "model" varchar(100),
+    "prompt_version" varchar(50),
+    "generation_config" text,
+    "analysis_mode" varchar(20),
+    "extractor" varchar(20),
+    "extractor_version" varchar(20),
+    "ocr_engine" varchar(100),
+    "upload_ms" bigint,
+    "extract_ms" bigint,
+    "model_ms" bigint,
+    "total_ms" bigint,
+    "raw_response" text,
+    "finish_reason" varchar(30),
+    "prompt_tokens" bigint,
+    "response_tokens" bigint,
+    "total_tokens" bigint,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_analyses_provenance" FOREIGN KEY ("analysis_id") REFERENCES "analyses" ("id")
+);
+CREATE UNIQUE INDEX "idx_analysis_provenance_analysis_id" ON "analysis_provenance" ("analysis_id");
@@ -0,0 +1,42 @@
+-- Mỗi document chỉ giữ lại analysis đầu tiên; các bảng gắn với file quay về analysis_id.
+-- Index unique được tạo lại sau khi đổi id để tránh trùng tạm thời trong lúc UPDATE.
+
+DELETE FROM "analysis_provenance" WHERE "analysis_id" IN (
+    SELECT "id" FROM "analyses" WHERE "id" NOT IN (SELECT MIN("id") FROM "analyses" GROUP BY "document_id"));
+DELETE FROM "analysis_details" WHERE "analysis_id" IN (
+    SELECT "id" FROM "analyses" WHERE "id" NOT IN (SELECT MIN("id") FROM "analyses" GROUP BY "document_id"));
+DELETE FROM "analyses" WHERE "id" NOT IN (SELECT MIN("id") FROM "analyses" GROUP BY "document_id");
+
+ALTER TABLE "analysis_provenance" DROP COLUMN "instructions";
+ALTER TABLE "analysis_provenance" DROP COLUMN "depth";
+
+ALTER TABLE "extraction_metrics" DROP CONSTRAINT "fk_documents_metrics";
+DROP INDEX "idx_extraction_metrics_document_id";
+UPDATE "extraction_metrics" SET "document_id" = (SELECT a."id" FROM "analyses" a WHERE a."document_id" = "extraction_metrics"."document_id");
+ALTER TABLE "extraction_metrics" RENAME COLUMN "document_id" TO "analysis_id";
+CREATE UNIQUE INDEX "idx_extraction_metrics_analysis_id" ON "extraction_metrics" ("analysis_id");
+ALTER TABLE "extraction_metrics" ADD CONSTRAINT "fk_analyses_metrics" FOREIGN KEY ("analysis_id") REFERENCES "analyses" ("id");
+
+DROP INDEX "idx_content_fingerprints_document_id";
+UPDATE "content_fingerprints" SET "document_id" = (SELECT a."id" FROM "analyses" a WHERE a."document_id" = "content_fingerprints"."document_id");
+ALTER TABLE "content_fingerprints" RENAME COLUMN "document_id" TO "analysis_id";
+CREATE UNIQUE INDEX "idx_content_fingerprints_analysis_id" ON "content_fingerprints" ("analysis_id");
+
+ALTER TABLE "document_metadata" DROP CONSTRAINT "fk_documents_metadata";
+DROP INDEX "idx_document_metadata_document_id";
+UPDATE "document_metadata" SET "document_id" = (SELECT a."id" FROM "analyses" a WHERE a."document_id" = "document_metadata"."document_id");
+ALTER TABLE "document_metadata" RENAME COLUMN "document_id" TO "analysis_id";
+CREATE UNIQUE INDEX "idx_document_metadata_analysis_id" ON "document_metadata" ("analysis_id");
+ALTER TABLE "document_metadata" ADD CONSTRAINT "fk_analyses_metadata" FOREIGN KEY ("analysis_id") REFERENCES "analyses" ("id");
+
+ALTER TABLE "analysis_files" DROP CONSTRAINT "fk_documents_files";
+UPDATE "analysis_files" SET "document_id" = (SELECT a."id" FROM "analyses" a WHERE a."document_id" = "analysis_files"."document_id");
+ALTER TABLE "analysis_files" RENAME COLUMN "document_id" TO "analysis_id";
+ALTER INDEX "idx_analysis_files_document_id" RENAME TO "idx_analysis_files_analysis_id";
+ALTER TABLE "analysis_files" ADD CONSTRAINT "fk_analyses_files" FOREIGN KEY ("analysis_id") REFERENCES "analyses" ("id");
+
+DROP INDEX "idx_analyses_file_hash";
+CREATE UNIQUE INDEX "idx_analyses_file_hash" ON "analyses" ("file_hash");
+ALTER TABLE "analyses" DROP COLUMN "document_id";
+
+DROP TABLE "documents";
@@ -0,0 +1,54 @@
+-- Tách document (file đã tải lên) khỏi analysis (một lần phân tích file) để một file có
+-- nhiều lần phân tích. Mỗi analysis cũ trở thành một document cùng id, nên các bảng gắn
+-- với file chỉ cần đổi tên cột analysis_id thành document_id.
+
+CREATE TABLE "documents" (
+    "id" bigserial,
+    "file_hash" varchar(64),
+    "created_at" timestamptz,
+    "format" varchar(20),
+    "language" varchar(10),
+    "analysis_text" text,
+    "bundle" boolean,
+    "prompt_references" text[],
+    PRIMARY KEY ("id")
+);
+
+INSERT INTO "documents" ("id", "file_hash", "created_at", "format", "language", "bundle")
+SELECT a."id", a."file_hash", a."created_at", m."format", a."language",
+       EXISTS (SELECT 1 FROM "analysis_files" f WHERE f."analysis_id" = a."id")
+FROM "analyses" a
+LEFT JOIN "document_metadata" m ON m."analysis_id" = a."id";
+SELECT setval(pg_get_serial_sequence('documents', 'id'), COALESCE((SELECT MAX("id") FROM "documents"), 0) + 1, false);
+
+CREATE UNIQUE INDEX "idx_documents_file_hash" ON "documents" ("file_hash");
+CREATE INDEX "idx_documents_language" ON "documents" ("language");
+
+ALTER TABLE "analyses" ADD COLUMN "document_id" bigint;
+UPDATE "analyses" SET "document_id" = "id";
+ALTER TABLE "analyses" ALTER COLUMN "document_id" SET NOT NULL;
+ALTER TABLE "analyses" ADD CONSTRAINT "fk_analyses_document" FOREIGN KEY ("document_id") REFERENCES "documents" ("id");
+CREATE INDEX "idx_analyses_document_id" ON "analyses" ("document_id");
+DROP INDEX "idx_analyses_file_hash";
+CREATE INDEX "idx_analyses_file_hash" ON "analyses" ("file_hash");
+
+ALTER TABLE "analysis_files" DROP CONSTRAINT IF EXISTS "fk_analyses_files";
+ALTER TABLE "analysis_files" RENAME COLUMN "analysis_id" TO "document_id";
+ALTER INDEX "idx_analysis_files_analysis_id" RENAME TO "idx_analysis_files_document_id";
+ALTER TABLE "analysis_files" ADD CONSTRAINT "fk_documents_files" FOREIGN KEY ("document_id") REFERENCES "documents" ("id");
+
+ALTER TABLE "document_metadata" DROP CONSTRAINT IF EXISTS "fk_analyses_metadata";
+ALTER TABLE "document_metadata" RENAME COLUMN "analysis_id" TO "document_id";
+ALTER INDEX "idx_document_metadata_analysis_id" RENAME TO "idx_document_metadata_document_id";
+ALTER TABLE "document_metadata" ADD CONSTRAINT "fk_documents_metadata" FOREIGN KEY ("document_id") REFERENCES "documents" ("id");
+
+ALTER TABLE "content_fingerprints" RENAME COLUMN "analysis_id" TO "document_id";
+ALTER INDEX "idx_content_fingerprints_analysis_id" RENAME TO "idx_content_fingerprints_document_id";
+
+ALTER TABLE "extraction_metrics" DROP CONSTRAINT IF EXISTS "fk_analyses_metrics";
+ALTER TABLE "extraction_metrics" RENAME COLUMN "analysis_id" TO "document_id";
+ALTER INDEX "idx_extraction_metrics_analysis_id" RENAME TO "idx_extraction_metrics_document_id";
+ALTER TABLE "extraction_metrics" ADD CONSTRAINT "fk_documents_metrics" FOREIGN KEY ("document_id") REFERENCES "documents" ("id");
+
+ALTER TABLE "analysis_provenance" ADD COLUMN "depth" varchar(20);
+ALTER TABLE "analysis_provenance" ADD COLUMN "instructions" text;
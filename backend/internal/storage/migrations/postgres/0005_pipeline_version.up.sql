@@ -0,0 +1,6 @@
+-- Phiên bản pipeline (prompt, model mặc định, extractor) đã tạo ra mỗi analysis. Analysis có
+-- provenance được tạo bởi pipeline 1; analysis cũ hơn không rõ phiên bản nên được coi là cũ.
+
+ALTER TABLE "analyses" ADD COLUMN "pipeline_version" varchar(20);
+UPDATE "analyses" SET "pipeline_version" = '1' WHERE "id" IN (SELECT "analysis_id" FROM "analysis_provenance");
+CREATE INDEX "idx_analyses_pipeline_version" ON "analyses" ("pipeline_version");
@@ -0,0 +1,6 @@
+-- Extension unaccent được giữ lại vì có thể được dùng ngoài DocuMind
+DROP INDEX "idx_analysis_details_search_vector";
+DROP TRIGGER "analysis_details_search_vector" ON "analysis_details";
+DROP FUNCTION analysis_details_search_vector();
+ALTER TABLE "analysis_details" DROP COLUMN "search_vector";
+DROP TEXT SEARCH CONFIGURATION vietnamese;
@@ -0,0 +1,30 @@
+-- Tìm kiếm toàn văn trên tóm tắt, điều khoản, rủi ro và text của tài liệu. Cấu hình vietnamese
+-- tách từ như simple rồi bỏ dấu bằng unaccent, để "bao lanh" khớp với "bảo lãnh". Cột
+-- search_vector do trigger cập nhật vì array_to_string không dùng được trong cột generated.
+
+CREATE EXTENSION IF NOT EXISTS unaccent;
+CREATE TEXT SEARCH CONFIGURATION vietnamese (COPY = simple);
+ALTER TEXT SEARCH CONFIGURATION vietnamese
+    ALTER MAPPING FOR hword, hword_part, word WITH unaccent, simple;
+
+ALTER TABLE "analysis_details" ADD COLUMN "search_vector" tsvector;
+
+CREATE FUNCTION analysis_details_search_vector() RETURNS trigger AS $$
+BEGIN
+    -- Trọng số: tóm tắt A, điều khoản và rủi ro B, text của tài liệu D. Text quá dài bị cắt
+    -- để tsvector không vượt giới hạn 1 MB
+    NEW.search_vector :=
+        setweight(to_tsvector('vietnamese', COALESCE(NEW.summary, '')), 'A') ||
+        setweight(to_tsvector('vietnamese', COALESCE(array_to_string(NEW.key_clauses, E'\n'), '')), 'B') ||
+        setweight(to_tsvector('vietnamese', COALESCE(array_to_string(NEW.potential_risks, E'\n'), '')), 'B') ||
+        setweight(to_tsvector('vietnamese', COALESCE(left(NEW.extracted_text, 1000000), '')), 'D');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER "analysis_details_search_vector"
+    BEFORE INSERT OR UPDATE OF "summary", "key_clauses", "potential_risks", "extracted_text" ON "analysis_details"
+    FOR EACH ROW EXECUTE FUNCTION analysis_details_search_vector();
+
+UPDATE "analysis_details" SET "summary" = "summary";
+CREATE INDEX "idx_analysis_details_search_vector" ON "analysis_details" USING GIN ("search_vector");
@@ -0,0 +1,19 @@
+-- Embedding của analysis (profile, risk) và của các điều khoản của document, cho tìm kiếm ngữ
+-- nghĩa và GET /analyses/:id/similar. Analysis cũ có embedding sau khi chạy
+-- POST /api/v1/admin/embeddings.
+
+CREATE TABLE "embeddings" (
+    "id" bigserial,
+    "document_id" bigint NOT NULL,
+    "analysis_id" bigint,
+    "kind" varchar(20) NOT NULL,
+    "ref" varchar(100),
+    "text" text,
+    "model" varchar(100),
+    "vector" bytea,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_embeddings_model" ON "embeddings" ("model");
+CREATE INDEX "idx_embeddings_analysis_id" ON "embeddings" ("analysis_id");
+CREATE INDEX "idx_embeddings_document_id" ON "embeddings" ("document_id");
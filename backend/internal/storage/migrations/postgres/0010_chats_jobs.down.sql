@@ -0,0 +1,2 @@
+DROP TABLE "jobs";
+DROP TABLE "chat_messages";
@@ -0,0 +1,28 @@
+-- Lịch sử hỏi đáp của contract chat theo document, và tiến độ các tác vụ nền (phân tích lại
+-- hàng loạt) để xem lại sau khi server khởi động lại.
+
+CREATE TABLE "chat_messages" (
+    "id" bigserial,
+    "document_id" bigint NOT NULL,
+    "question" text NOT NULL,
+    "answer" text NOT NULL,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_chat_messages_document_id" ON "chat_messages" ("document_id");
+
+CREATE TABLE "jobs" (
+    "id" bigserial,
+    "kind" varchar(20) NOT NULL,
+    "state" varchar(20) NOT NULL,
+    "token_budget" bigint,
+    "item_limit" bigint,
+    "tokens_used" bigint,
+    "succeeded" bigint,
+    "failed" bigint,
+    "last_error" text,
+    "started_at" timestamptz,
+    "finished_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_jobs_kind" ON "jobs" ("kind");
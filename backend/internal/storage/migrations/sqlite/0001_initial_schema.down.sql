@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS `analysis_details`;
+DROP TABLE IF EXISTS `analyses`;
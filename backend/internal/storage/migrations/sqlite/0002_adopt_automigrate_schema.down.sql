@@ -0,0 +1,18 @@
+DROP TABLE `extraction_metrics`;
+DROP TABLE `content_fingerprints`;
+DROP TABLE `document_metadata`;
+DROP TABLE `analysis_files`;
+
+ALTER TABLE `analysis_details` DROP COLUMN `analysis_mode`;
+ALTER TABLE `analysis_details` DROP COLUMN `signatures`;
+ALTER TABLE `analysis_details` DROP COLUMN `extracted_text`;
+ALTER TABLE `analysis_details` DROP COLUMN `reconciliation`;
+ALTER TABLE `analysis_details` DROP COLUMN `cross_references`;
+ALTER TABLE `analysis_details` DROP COLUMN `structure`;
+ALTER TABLE `analysis_details` DROP COLUMN `warnings`;
+
+DROP INDEX `idx_analyses_language`;
+ALTER TABLE `analyses` DROP COLUMN `email_date`;
+ALTER TABLE `analyses` DROP COLUMN `email_subject`;
+ALTER TABLE `analyses` DROP COLUMN `email_from`;
+ALTER TABLE `analyses` DROP COLUMN `language`;
@@ -0,0 +1,116 @@
+-- Các cột và bảng mà AutoMigrate thêm dần trước khi có migration (cảnh báo trích xuất, cây
+-- điều khoản, bộ hồ sơ, e-mail, metadata, khoá nội dung, đối chiếu số liệu, chữ ký, chế độ
+-- phân tích, chỉ số chất lượng, ngôn ngữ). SQLite không có ADD COLUMN IF NOT EXISTS nên hai
+-- bảng của 0001 được tạo lại với đủ cột và chép dữ liệu của các cột ban đầu sang.
+
+CREATE TABLE `analyses_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `file_hash` varchar(64),
+    `created_at` datetime,
+    `summary_preview` varchar(200),
+    `language` varchar(10),
+    `email_from` varchar(320),
+    `email_subject` text,
+    `email_date` datetime
+);
+INSERT INTO `analyses_new` (`id`, `file_hash`, `created_at`, `summary_preview`)
+SELECT `id`, `file_hash`, `created_at`, `summary_preview` FROM `analyses`;
+DROP TABLE `analyses`;
+ALTER TABLE `analyses_new` RENAME TO `analyses`;
+CREATE UNIQUE INDEX `idx_analyses_file_hash` ON `analyses` (`file_hash`);
+CREATE INDEX `idx_analyses_language` ON `analyses` (`language`);
+
+CREATE TABLE `analysis_details_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `analysis_id` integer NOT NULL,
+    `summary` text,
+    `key_clauses` text,
+    `potential_risks` text,
+    `warnings` text,
+    `structure` text,
+    `cross_references` text,
+    `reconciliation` text,
+    `extracted_text` text,
+    `signatures` text,
+    `analysis_mode` varchar(20),
+    CONSTRAINT `fk_analyses_analysis_detail` FOREIGN KEY (`analysis_id`) REFERENCES `analyses` (`id`)
+);
+INSERT INTO `analysis_details_new` (`id`, `analysis_id`, `summary`, `key_clauses`, `potential_risks`)
+SELECT `id`, `analysis_id`, `summary`, `key_clauses`, `potential_risks` FROM `analysis_details`;
+DROP TABLE `analysis_details`;
+ALTER TABLE `analysis_details_new` RENAME TO `analysis_details`;
+CREATE INDEX `idx_analysis_details_analysis_id` ON `analysis_details` (`analysis_id`);
+
+CREATE TABLE IF NOT EXISTS `analysis_files` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `analysis_id` integer NOT NULL,
+    `file_name` text,
+    `file_hash` varchar(64),
+    `role` varchar(20),
+    `label` varchar(100),
+    `size` integer,
+    `page_count` integer,
+    `structure` text,
+    CONSTRAINT `fk_analyses_files` FOREIGN KEY (`analysis_id`) REFERENCES `analyses` (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_analysis_files_analysis_id` ON `analysis_files` (`analysis_id`);
+CREATE INDEX IF NOT EXISTS `idx_analysis_files_file_hash` ON `analysis_files` (`file_hash`);
+
+CREATE TABLE IF NOT EXISTS `document_metadata` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `analysis_id` integer NOT NULL,
+    `file_name` text,
+    `file_size` integer,
+    `mime_type` varchar(255),
+    `format` varchar(20),
+    `page_count` integer,
+    `title` text,
+    `author` text,
+    `subject` text,
+    `keywords` text,
+    `creator` text,
+    `producer` text,
+    `company` text,
+    `last_modified_by` text,
+    `document_created_at` datetime,
+    `document_modified_at` datetime,
+    CONSTRAINT `fk_analyses_metadata` FOREIGN KEY (`analysis_id`) REFERENCES `analyses` (`id`)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_document_metadata_analysis_id` ON `document_metadata` (`analysis_id`);
+CREATE INDEX IF NOT EXISTS `idx_document_metadata_mime_type` ON `document_metadata` (`mime_type`);
+CREATE INDEX IF NOT EXISTS `idx_document_metadata_format` ON `document_metadata` (`format`);
+CREATE INDEX IF NOT EXISTS `idx_document_metadata_author` ON `document_metadata` (`author`);
+CREATE INDEX IF NOT EXISTS `idx_document_metadata_document_created_at` ON `document_metadata` (`document_created_at`);
+
+CREATE TABLE IF NOT EXISTS `content_fingerprints` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `analysis_id` integer NOT NULL,
+    `content_hash` varchar(64),
+    `sim_hash` integer,
+    `band0` integer,
+    `band1` integer,
+    `band2` integer,
+    `band3` integer
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_content_fingerprints_analysis_id` ON `content_fingerprints` (`analysis_id`);
+CREATE INDEX IF NOT EXISTS `idx_content_fingerprints_content_hash` ON `content_fingerprints` (`content_hash`);
+CREATE INDEX IF NOT EXISTS `idx_content_fingerprints_band0` ON `content_fingerprints` (`band0`);
+CREATE INDEX IF NOT EXISTS `idx_content_fingerprints_band1` ON `content_fingerprints` (`band1`);
+CREATE INDEX IF NOT EXISTS `idx_content_fingerprints_band2` ON `content_fingerprints` (`band2`);
+CREATE INDEX IF NOT EXISTS `idx_content_fingerprints_band3` ON `content_fingerprints` (`band3`);
+
+CREATE TABLE IF NOT EXISTS `extraction_metrics` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `analysis_id` integer NOT NULL,
+    `page_count` integer,
+    `empty_pages` integer,
+    `characters` integer,
+    `chars_per_page` real,
+    `non_letter_ratio` real,
+    `dictionary_hit_rate` real,
+    `language` varchar(10),
+    `score` real,
+    CONSTRAINT `fk_analyses_metrics` FOREIGN KEY (`analysis_id`) REFERENCES `analyses` (`id`)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_extraction_metrics_analysis_id` ON `extraction_metrics` (`analysis_id`);
+CREATE INDEX IF NOT EXISTS `idx_extraction_metrics_language` ON `extraction_metrics` (`language`);
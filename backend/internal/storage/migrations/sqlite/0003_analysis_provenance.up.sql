@@ -0,0 +1,23 @@
+CREATE TABLE `analysis_provenance` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `analysis_id` integer NOT NULL,
+    `model` varchar(100),
+    `prompt_version` varchar(50),
+    `generation_config` text,
+    `analysis_mode` varchar(20),
+    `extractor` varchar(20),
+    `extractor_version` varchar(20),
+    `ocr_engine` varchar(100),
+    `upload_ms` integer,
+    `extract_ms` integer,
+    `model_ms` integer,
+    `total_ms` integer,
+    `raw_response` text,
+    `finish_reason` varchar(30),
+    `prompt_tokens` integer,
+    `response_tokens` integer,
+    `total_tokens` integer,
+    `created_at` datetime,
+    CONSTRAINT `fk_analyses_provenance` FOREIGN KEY (`analysis_id`) REFERENCES `analyses` (`id`)
+);
+CREATE UNIQUE INDEX `idx_analysis_provenance_analysis_id` ON `analysis_provenance` (`analysis_id`);
@@ -0,0 +1,119 @@
+-- Mỗi document chỉ giữ lại analysis đầu tiên; các bảng gắn với file quay về analysis_id.
+
+DELETE FROM `analysis_provenance` WHERE `analysis_id` IN (
+    SELECT `id` FROM `analyses` WHERE `id` NOT IN (SELECT MIN(`id`) FROM `analyses` GROUP BY `document_id`));
+DELETE FROM `analysis_details` WHERE `analysis_id` IN (
+    SELECT `id` FROM `analyses` WHERE `id` NOT IN (SELECT MIN(`id`) FROM `analyses` GROUP BY `document_id`));
+DELETE FROM `analyses` WHERE `id` NOT IN (SELECT MIN(`id`) FROM `analyses` GROUP BY `document_id`);
+
+ALTER TABLE `analysis_provenance` DROP COLUMN `instructions`;
+ALTER TABLE `analysis_provenance` DROP COLUMN `depth`;
+
+CREATE TABLE `analysis_files_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `analysis_id` integer NOT NULL,
+    `file_name` text,
+    `file_hash` varchar(64),
+    `role` varchar(20),
+    `label` varchar(100),
+    `size` integer,
+    `page_count` integer,
+    `structure` text,
+    CONSTRAINT `fk_analyses_files` FOREIGN KEY (`analysis_id`) REFERENCES `analyses` (`id`)
+);
+INSERT INTO `analysis_files_new` (`id`, `analysis_id`, `file_name`, `file_hash`, `role`, `label`, `size`, `page_count`, `structure`)
+SELECT `id`, (SELECT a.`id` FROM `analyses` a WHERE a.`document_id` = `analysis_files`.`document_id`), `file_name`, `file_hash`, `role`, `label`, `size`, `page_count`, `structure` FROM `analysis_files`;
+DROP TABLE `analysis_files`;
+ALTER TABLE `analysis_files_new` RENAME TO `analysis_files`;
+CREATE INDEX `idx_analysis_files_analysis_id` ON `analysis_files` (`analysis_id`);
+CREATE INDEX `idx_analysis_files_file_hash` ON `analysis_files` (`file_hash`);
+
+CREATE TABLE `document_metadata_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `analysis_id` integer NOT NULL,
+    `file_name` text,
+    `file_size` integer,
+    `mime_type` varchar(255),
+    `format` varchar(20),
+    `page_count` integer,
+    `title` text,
+    `author` text,
+    `subject` text,
+    `keywords` text,
+    `creator` text,
+    `producer` text,
+    `company` text,
+    `last_modified_by` text,
+    `document_created_at` datetime,
+    `document_modified_at` datetime,
+    CONSTRAINT `fk_analyses_metadata` FOREIGN KEY (`analysis_id`) REFERENCES `analyses` (`id`)
+);
+INSERT INTO `document_metadata_new` (`id`, `analysis_id`, `file_name`, `file_size`, `mime_type`, `format`, `page_count`, `title`, `author`, `subject`, `keywords`, `creator`, `producer`, `company`, `last_modified_by`, `document_created_at`, `document_modified_at`)
+SELECT `id`, (SELECT a.`id` FROM `analyses` a WHERE a.`document_id` = `document_metadata`.`document_id`), `file_name`, `file_size`, `mime_type`, `format`, `page_count`, `title`, `author`, `subject`, `keywords`, `creator`, `producer`, `company`, `last_modified_by`, `document_created_at`, `document_modified_at` FROM `document_metadata`;
+DROP TABLE `document_metadata`;
+ALTER TABLE `document_metadata_new` RENAME TO `document_metadata`;
+CREATE UNIQUE INDEX `idx_document_metadata_analysis_id` ON `document_metadata` (`analysis_id`);
+CREATE INDEX `idx_document_metadata_mime_type` ON `document_metadata` (`mime_type`);
+CREATE INDEX `idx_document_metadata_format` ON `document_metadata` (`format`);
+CREATE INDEX `idx_document_metadata_author` ON `document_metadata` (`author`);
+CREATE INDEX `idx_document_metadata_document_created_at` ON `document_metadata` (`document_created_at`);
+
+CREATE TABLE `content_fingerprints_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `analysis_id` integer NOT NULL,
+    `content_hash` varchar(64),
+    `sim_hash` integer,
+    `band0` integer,
+    `band1` integer,
+    `band2` integer,
+    `band3` integer
+);
+INSERT INTO `content_fingerprints_new` (`id`, `analysis_id`, `content_hash`, `sim_hash`, `band0`, `band1`, `band2`, `band3`)
+SELECT `id`, (SELECT a.`id` FROM `analyses` a WHERE a.`document_id` = `content_fingerprints`.`document_id`), `content_hash`, `sim_hash`, `band0`, `band1`, `band2`, `band3` FROM `content_fingerprints`;
+DROP TABLE `content_fingerprints`;
+ALTER TABLE `content_fingerprints_new` RENAME TO `content_fingerprints`;
+CREATE UNIQUE INDEX `idx_content_fingerprints_analysis_id` ON `content_fingerprints` (`analysis_id`);
+CREATE INDEX `idx_content_fingerprints_content_hash` ON `content_fingerprints` (`content_hash`);
+CREATE INDEX `idx_content_fingerprints_band0` ON `content_fingerprints` (`band0`);
+CREATE INDEX `idx_content_fingerprints_band1` ON `content_fingerprints` (`band1`);
+CREATE INDEX `idx_content_fingerprints_band2` ON `content_fingerprints` (`band2`);
+CREATE INDEX `idx_content_fingerprints_band3` ON `content_fingerprints` (`band3`);
+
+CREATE TABLE `extraction_metrics_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `analysis_id` integer NOT NULL,
+    `page_count` integer,
+    `empty_pages` integer,
+    `characters` integer,
+    `chars_per_page` real,
+    `non_letter_ratio` real,
+    `dictionary_hit_rate` real,
+    `language` varchar(10),
+    `score` real,
+    CONSTRAINT `fk_analyses_metrics` FOREIGN KEY (`analysis_id`) REFERENCES `analyses` (`id`)
+);
+INSERT INTO `extraction_metrics_new` (`id`, `analysis_id`, `page_count`, `empty_pages`, `characters`, `chars_per_page`, `non_letter_ratio`, `dictionary_hit_rate`, `language`, `score`)
+SELECT `id`, (SELECT a.`id` FROM `analyses` a WHERE a.`document_id` = `extraction_metrics`.`document_id`), `page_count`, `empty_pages`, `characters`, `chars_per_page`, `non_letter_ratio`, `dictionary_hit_rate`, `language`, `score` FROM `extraction_metrics`;
+DROP TABLE `extraction_metrics`;
+ALTER TABLE `extraction_metrics_new` RENAME TO `extraction_metrics`;
+CREATE UNIQUE INDEX `idx_extraction_metrics_analysis_id` ON `extraction_metrics` (`analysis_id`);
+CREATE INDEX `idx_extraction_metrics_language` ON `extraction_metrics` (`language`);
+
+CREATE TABLE `analyses_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `file_hash` varchar(64),
+    `created_at` datetime,
+    `summary_preview` varchar(200),
+    `language` varchar(10),
+    `email_from` varchar(320),
+    `email_subject` text,
+    `email_date` datetime
+);
+INSERT INTO `analyses_new` (`id`, `file_hash`, `created_at`, `summary_preview`, `language`, `email_from`, `email_subject`, `email_date`)
+SELECT `id`, `file_hash`, `created_at`, `summary_preview`, `language`, `email_from`, `email_subject`, `email_date` FROM `analyses`;
+DROP TABLE `analyses`;
+ALTER TABLE `analyses_new` RENAME TO `analyses`;
+CREATE UNIQUE INDEX `idx_analyses_file_hash` ON `analyses` (`file_hash`);
+CREATE INDEX `idx_analyses_language` ON `analyses` (`language`);
+
+DROP TABLE `documents`;
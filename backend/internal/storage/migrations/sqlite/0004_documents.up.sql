@@ -0,0 +1,134 @@
+-- Tách document (file đã tải lên) khỏi analysis (một lần phân tích file) để một file có
+-- nhiều lần phân tích. Mỗi analysis cũ trở thành một document cùng id. SQLite không đổi được
+-- khoá ngoại của bảng có sẵn nên các bảng gắn với file được tạo lại với cột document_id.
+
+CREATE TABLE `documents` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `file_hash` varchar(64),
+    `created_at` datetime,
+    `format` varchar(20),
+    `language` varchar(10),
+    `analysis_text` text,
+    `bundle` numeric,
+    `prompt_references` text
+);
+INSERT INTO `documents` (`id`, `file_hash`, `created_at`, `format`, `language`, `bundle`)
+SELECT a.`id`, a.`file_hash`, a.`created_at`, m.`format`, a.`language`,
+       EXISTS (SELECT 1 FROM `analysis_files` f WHERE f.`analysis_id` = a.`id`)
+FROM `analyses` a
+LEFT JOIN `document_metadata` m ON m.`analysis_id` = a.`id`;
+CREATE UNIQUE INDEX `idx_documents_file_hash` ON `documents` (`file_hash`);
+CREATE INDEX `idx_documents_language` ON `documents` (`language`);
+
+CREATE TABLE `analyses_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `document_id` integer NOT NULL,
+    `file_hash` varchar(64),
+    `created_at` datetime,
+    `summary_preview` varchar(200),
+    `language` varchar(10),
+    `email_from` varchar(320),
+    `email_subject` text,
+    `email_date` datetime,
+    CONSTRAINT `fk_analyses_document` FOREIGN KEY (`document_id`) REFERENCES `documents` (`id`)
+);
+INSERT INTO `analyses_new` (`id`, `document_id`, `file_hash`, `created_at`, `summary_preview`, `language`, `email_from`, `email_subject`, `email_date`)
+SELECT `id`, `id`, `file_hash`, `created_at`, `summary_preview`, `language`, `email_from`, `email_subject`, `email_date` FROM `analyses`;
+DROP TABLE `analyses`;
+ALTER TABLE `analyses_new` RENAME TO `analyses`;
+CREATE INDEX `idx_analyses_document_id` ON `analyses` (`document_id`);
+CREATE INDEX `idx_analyses_file_hash` ON `analyses` (`file_hash`);
+CREATE INDEX `idx_analyses_language` ON `analyses` (`language`);
+
+CREATE TABLE `analysis_files_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `document_id` integer NOT NULL,
+    `file_name` text,
+    `file_hash` varchar(64),
+    `role` varchar(20),
+    `label` varchar(100),
+    `size` integer,
+    `page_count` integer,
+    `structure` text,
+    CONSTRAINT `fk_documents_files` FOREIGN KEY (`document_id`) REFERENCES `documents` (`id`)
+);
+INSERT INTO `analysis_files_new` (`id`, `document_id`, `file_name`, `file_hash`, `role`, `label`, `size`, `page_count`, `structure`)
+SELECT `id`, `analysis_id`, `file_name`, `file_hash`, `role`, `label`, `size`, `page_count`, `structure` FROM `analysis_files`;
+DROP TABLE `analysis_files`;
+ALTER TABLE `analysis_files_new` RENAME TO `analysis_files`;
+CREATE INDEX `idx_analysis_files_document_id` ON `analysis_files` (`document_id`);
+CREATE INDEX `idx_analysis_files_file_hash` ON `analysis_files` (`file_hash`);
+
+CREATE TABLE `document_metadata_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `document_id` integer NOT NULL,
+    `file_name` text,
+    `file_size` integer,
+    `mime_type` varchar(255),
+    `format` varchar(20),
+    `page_count` integer,
+    `title` text,
+    `author` text,
+    `subject` text,
+    `keywords` text,
+    `creator` text,
+    `producer` text,
+    `company` text,
+    `last_modified_by` text,
+    `document_created_at` datetime,
+    `document_modified_at` datetime,
+    CONSTRAINT `fk_documents_metadata` FOREIGN KEY (`document_id`) REFERENCES `documents` (`id`)
+);
+INSERT INTO `document_metadata_new` (`id`, `document_id`, `file_name`, `file_size`, `mime_type`, `format`, `page_count`, `title`, `author`, `subject`, `keywords`, `creator`, `producer`, `company`, `last_modified_by`, `document_created_at`, `document_modified_at`)
+SELECT `id`, `analysis_id`, `file_name`, `file_size`, `mime_type`, `format`, `page_count`, `title`, `author`, `subject`, `keywords`, `creator`, `producer`, `company`, `last_modified_by`, `document_created_at`, `document_modified_at` FROM `document_metadata`;
+DROP TABLE `document_metadata`;
+ALTER TABLE `document_metadata_new` RENAME TO `document_metadata`;
+CREATE UNIQUE INDEX `idx_document_metadata_document_id` ON `document_metadata` (`document_id`);
+CREATE INDEX `idx_document_metadata_mime_type` ON `document_metadata` (`mime_type`);
+CREATE INDEX `idx_document_metadata_format` ON `document_metadata` (`format`);
+CREATE INDEX `idx_document_metadata_author` ON `document_metadata` (`author`);
+CREATE INDEX `idx_document_metadata_document_created_at` ON `document_metadata` (`document_created_at`);
+
+CREATE TABLE `content_fingerprints_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `document_id` integer NOT NULL,
+    `content_hash` varchar(64),
+    `sim_hash` integer,
+    `band0` integer,
+    `band1` integer,
+    `band2` integer,
+    `band3` integer
+);
+INSERT INTO `content_fingerprints_new` (`id`, `document_id`, `content_hash`, `sim_hash`, `band0`, `band1`, `band2`, `band3`)
+SELECT `id`, `analysis_id`, `content_hash`, `sim_hash`, `band0`, `band1`, `band2`, `band3` FROM `content_fingerprints`;
+DROP TABLE `content_fingerprints`;
+ALTER TABLE `content_fingerprints_new` RENAME TO `content_fingerprints`;
+CREATE UNIQUE INDEX `idx_content_fingerprints_document_id` ON `content_fingerprints` (`document_id`);
+CREATE INDEX `idx_content_fingerprints_content_hash` ON `content_fingerprints` (`content_hash`);
+CREATE INDEX `idx_content_fingerprints_band0` ON `content_fingerprints` (`band0`);
+CREATE INDEX `idx_content_fingerprints_band1` ON `content_fingerprints` (`band1`);
+CREATE INDEX `idx_content_fingerprints_band2` ON `content_fingerprints` (`band2`);
+CREATE INDEX `idx_content_fingerprints_band3` ON `content_fingerprints` (`band3`);
+
+CREATE TABLE `extraction_metrics_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `document_id` integer NOT NULL,
+    `page_count` integer,
+    `empty_pages` integer,
+    `characters` integer,
+    `chars_per_page` real,
+    `non_letter_ratio` real,
+    `dictionary_hit_rate` real,
+    `language` varchar(10),
+    `score` real,
+    CONSTRAINT `fk_documents_metrics` FOREIGN KEY (`document_id`) REFERENCES `documents` (`id`)
+);
+INSERT INTO `extraction_metrics_new` (`id`, `document_id`, `page_count`, `empty_pages`, `characters`, `chars_per_page`, `non_letter_ratio`, `dictionary_hit_rate`, `language`, `score`)
+SELECT `id`, `analysis_id`, `page_count`, `empty_pages`, `characters`, `chars_per_page`, `non_letter_ratio`, `dictionary_hit_rate`, `language`, `score` FROM `extraction_metrics`;
+DROP TABLE `extraction_metrics`;
+ALTER TABLE `extraction_metrics_new` RENAME TO `extraction_metrics`;
+CREATE UNIQUE INDEX `idx_extraction_metrics_document_id` ON `extraction_metrics` (`document_id`);
+CREATE INDEX `idx_extraction_metrics_language` ON `extraction_metrics` (`language`);
+
+ALTER TABLE `analysis_provenance` ADD COLUMN `depth` varchar(20);
+ALTER TABLE `analysis_provenance` ADD COLUMN `instructions` text;
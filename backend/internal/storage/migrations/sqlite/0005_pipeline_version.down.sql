@@ -0,0 +1,2 @@
+DROP INDEX `idx_analyses_pipeline_version`;
+ALTER TABLE `analyses` DROP COLUMN `pipeline_version`;
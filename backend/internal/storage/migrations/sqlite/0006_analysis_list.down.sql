@@ -0,0 +1,11 @@
+DROP INDEX `idx_analysis_provenance_model`;
+DROP TABLE `document_tags`;
+DROP TABLE `analysis_parties`;
+
+DROP INDEX `idx_analyses_risk_count_id`;
+DROP INDEX `idx_analyses_risk_severity_id`;
+DROP INDEX `idx_analyses_created_at_id`;
+DROP INDEX `idx_analyses_contract_type`;
+ALTER TABLE `analyses` DROP COLUMN `risk_count`;
+ALTER TABLE `analyses` DROP COLUMN `risk_severity`;
+ALTER TABLE `analyses` DROP COLUMN `contract_type`;
@@ -0,0 +1,32 @@
+-- Phân loại của analysis (loại hợp đồng, mức rủi ro, các bên), nhãn của document và các index
+-- cho việc lọc, sắp xếp và phân trang theo cursor danh sách analysis. Loại hợp đồng, mức rủi ro
+-- và các bên của analysis cũ được điền khi phân tích lại theo pipeline mới.
+
+ALTER TABLE `analyses` ADD COLUMN `contract_type` varchar(20);
+ALTER TABLE `analyses` ADD COLUMN `risk_severity` integer NOT NULL DEFAULT 0;
+ALTER TABLE `analyses` ADD COLUMN `risk_count` integer NOT NULL DEFAULT 0;
+UPDATE `analyses` SET `risk_count` = COALESCE((
+    SELECT json_array_length(d.`potential_risks`) FROM `analysis_details` d WHERE d.`analysis_id` = `analyses`.`id`), 0);
+CREATE INDEX `idx_analyses_contract_type` ON `analyses` (`contract_type`);
+CREATE INDEX `idx_analyses_created_at_id` ON `analyses` (`created_at`, `id`);
+CREATE INDEX `idx_analyses_risk_severity_id` ON `analyses` (`risk_severity`, `id`);
+CREATE INDEX `idx_analyses_risk_count_id` ON `analyses` (`risk_count`, `id`);
+
+CREATE TABLE `analysis_parties` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `analysis_id` integer NOT NULL,
+    `name` text,
+    CONSTRAINT `fk_analyses_parties` FOREIGN KEY (`analysis_id`) REFERENCES `analyses` (`id`)
+);
+CREATE INDEX `idx_analysis_parties_analysis_id` ON `analysis_parties` (`analysis_id`);
+
+CREATE TABLE `document_tags` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `document_id` integer NOT NULL,
+    `tag` varchar(50) NOT NULL,
+    CONSTRAINT `fk_documents_tags` FOREIGN KEY (`document_id`) REFERENCES `documents` (`id`)
+);
+CREATE UNIQUE INDEX `idx_document_tags_document_tag` ON `document_tags` (`document_id`, `tag`);
+CREATE INDEX `idx_document_tags_tag` ON `document_tags` (`tag`);
+
+CREATE INDEX `idx_analysis_provenance_model` ON `analysis_provenance` (`model`);
@@ -0,0 +1,3 @@
+-- SQLite không có tìm kiếm toàn văn bỏ dấu tiếng Việt: chỉ mục tìm kiếm được dựng trong bộ
+-- nhớ của tiến trình (xem storage.searchIndex) nên migration này không đổi schema.
+SELECT 1;
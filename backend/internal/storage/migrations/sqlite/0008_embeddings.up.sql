@@ -0,0 +1,18 @@
+-- Embedding của analysis (profile, risk) và của các điều khoản của document, cho tìm kiếm ngữ
+-- nghĩa và GET /analyses/:id/similar. Analysis cũ có embedding sau khi chạy
+-- POST /api/v1/admin/embeddings.
+
+CREATE TABLE `embeddings` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `document_id` integer NOT NULL,
+    `analysis_id` integer,
+    `kind` varchar(20) NOT NULL,
+    `ref` varchar(100),
+    `text` text,
+    `model` varchar(100),
+    `vector` blob,
+    `created_at` datetime
+);
+CREATE INDEX `idx_embeddings_model` ON `embeddings` (`model`);
+CREATE INDEX `idx_embeddings_analysis_id` ON `embeddings` (`analysis_id`);
+CREATE INDEX `idx_embeddings_document_id` ON `embeddings` (`document_id`);
@@ -0,0 +1,6 @@
+DROP INDEX `idx_documents_deleted_at`;
+ALTER TABLE `documents` DROP COLUMN `deleted_at`;
+ALTER TABLE `documents` DROP COLUMN `legal_hold_reason`;
+ALTER TABLE `documents` DROP COLUMN `legal_hold`;
+DROP INDEX `idx_analyses_deleted_at`;
+ALTER TABLE `analyses` DROP COLUMN `deleted_at`;
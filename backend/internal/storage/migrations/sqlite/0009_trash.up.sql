@@ -0,0 +1,10 @@
+-- Thùng rác và legal hold: analysis bị xoá được đánh dấu deleted_at và chỉ bị xoá vĩnh viễn
+-- khi dọn thùng rác; document vào thùng rác cùng analysis cuối cùng của nó. Document có
+-- legal_hold không thể bị xoá.
+
+ALTER TABLE `analyses` ADD COLUMN `deleted_at` datetime;
+CREATE INDEX `idx_analyses_deleted_at` ON `analyses` (`deleted_at`);
+ALTER TABLE `documents` ADD COLUMN `legal_hold` numeric NOT NULL DEFAULT false;
+ALTER TABLE `documents` ADD COLUMN `legal_hold_reason` text;
+ALTER TABLE `documents` ADD COLUMN `deleted_at` datetime;
+CREATE INDEX `idx_documents_deleted_at` ON `documents` (`deleted_at`);
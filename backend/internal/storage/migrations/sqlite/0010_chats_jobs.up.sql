@@ -0,0 +1,26 @@
+-- Lịch sử hỏi đáp của contract chat theo document, và tiến độ các tác vụ nền (phân tích lại
+-- hàng loạt) để xem lại sau khi server khởi động lại.
+
+CREATE TABLE `chat_messages` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `document_id` integer NOT NULL,
+    `question` text NOT NULL,
+    `answer` text NOT NULL,
+    `created_at` datetime
+);
+CREATE INDEX `idx_chat_messages_document_id` ON `chat_messages` (`document_id`);
+
+CREATE TABLE `jobs` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `kind` varchar(20) NOT NULL,
+    `state` varchar(20) NOT NULL,
+    `token_budget` integer,
+    `item_limit` integer,
+    `tokens_used` integer,
+    `succeeded` integer,
+    `failed` integer,
+    `last_error` text,
+    `started_at` datetime,
+    `finished_at` datetime
+);
+CREATE INDEX `idx_jobs_kind` ON `jobs` (`kind`);
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"strings"
+
+	"documind/backend/internal/models"
+	"documind/backend/internal/services"
+
+	"gorm.io/gorm"
+)
+
+// SearchHit is an analysis that matches a search query.
+type SearchHit struct {
+	Analysis models.Analysis
+	// Score càng cao thì analysis càng khớp; chỉ dùng để so sánh trong cùng một truy vấn
+	Score float64
+}
+
+// SearchPage is one page of search results.
+type SearchPage struct {
+	Hits []SearchHit
+	// Total là số analysis khớp truy vấn trên mọi trang
+	Total int64
+}
+
+// SearchStore finds analyses by the words of their summary, key clauses, potential risks
+// and extracted text. Only the latest analysis of each document is searched.
+type SearchStore interface {
+	// Search trả về một trang kết quả, điểm cao nhất trước, kèm AnalysisDetail và
+	// Document.Metadata.
+	Search(q *services.SearchQuery, limit, offset int) (*SearchPage, error)
+}
+
+// searchHit là id và điểm của một analysis khớp truy vấn, trước khi nạp analysis.
+type searchHit struct {
+	ID    uint
+	Score float64
+}
+
+// gormSearchStore tìm kiếm bằng tsvector trên Postgres (xem migration 0007_search) và bằng
+// chỉ mục trong bộ nhớ trên SQLite.
+type gormSearchStore struct {
+	db *gorm.DB
+	// index là nil với Postgres
+	index *searchIndex
+}
+
+func (s *gormSearchStore) Search(q *services.SearchQuery, limit, offset int) (*SearchPage, error) {
+	var hits []searchHit
+	var total int64
+	if s.index != nil {
+		if err := s.index.load(s.db); err != nil {
+			return nil, err
+		}
+		all := s.index.search(q)
+		total = int64(len(all))
+		if offset < len(all) {
+			hits = all[offset:min(offset+limit, len(all))]
+		}
+	} else {
+		var err error
+		if hits, total, err = s.searchPostgres(q, limit, offset); err != nil {
+			return nil, err
+		}
+	}
+
+	page := &SearchPage{Total: total}
+	if len(hits) == 0 {
+		return page, nil
+	}
+	ids := make([]uint, len(hits))
+	for i, h := range hits {
+		ids[i] = h.ID
+	}
+	var analyses []models.Analysis
+	if err := s.db.Preload("AnalysisDetail").Preload("Document.Metadata").Find(&analyses, ids).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Analysis, len(analyses))
+	for _, a := range analyses {
+		byID[a.ID] = a
+	}
+	for _, h := range hits {
+		if a, ok := byID[h.ID]; ok {
+			page.Hits = append(page.Hits, SearchHit{Analysis: a, Score: h.Score})
+		}
+	}
+	return page, nil
+}
+
+// searchPostgres xếp hạng bằng ts_rank_cd trên cột analysis_details.search_vector.
+func (s *gormSearchStore) searchPostgres(q *services.SearchQuery, limit, offset int) ([]searchHit, int64, error) {
+	tsquery, args := postgresTSQuery(q)
+	query := s.db.Table("analyses").
+		Joins("JOIN analysis_details ON analysis_details.analysis_id = analyses.id").
+		Where(latestAnalysis).
+		Where("analysis_details.search_vector @@ ("+tsquery+")", args...)
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var hits []searchHit
+	err := query.Select("analyses.id AS id, ts_rank_cd(analysis_details.search_vector, ("+tsquery+")) AS score", args...).
+		Order("score DESC").Order("analyses.id DESC").Limit(limit).Offset(offset).Scan(&hits).Error
+	return hits, total, err
+}
+
+// postgresTSQuery tạo biểu thức tsquery của q. Mỗi từ hoặc cụm từ được tách từ bằng
+// phraseto_tsquery với cấu hình vietnamese để khớp cách Postgres tách text của tài liệu.
+func postgresTSQuery(q *services.SearchQuery) (string, []interface{}) {
+	var parts []string
+	var args []interface{}
+	phrase := func(p services.SearchPhrase) string {
+		args = append(args, p.Text)
+		return "phraseto_tsquery('vietnamese', ?)"
+	}
+	for _, group := range q.All {
+		var alternatives []string
+		for _, p := range group {
+			alternatives = append(alternatives, phrase(p))
+		}
+		parts = append(parts, "("+strings.Join(alternatives, " || ")+")")
+	}
+	for _, p := range q.None {
+		parts = append(parts, "!!"+phrase(p))
+	}
+	return strings.Join(parts, " && "), args
+}
@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"documind/backend/internal/models"
+	"documind/backend/internal/services"
+
+	"gorm.io/gorm"
+)
+
+// Các trường được tìm kiếm của một analysis, theo thứ tự trọng số giảm dần.
+const (
+	searchFieldSummary = iota
+	searchFieldClauses
+	searchFieldRisks
+	searchFieldText
+	searchFieldCount
+)
+
+// searchFieldWeights giống trọng số mặc định của ts_rank trên Postgres: tóm tắt là A, điều
+// khoản và rủi ro là B, text của tài liệu là D.
+var searchFieldWeights = [searchFieldCount]float64{1.0, 0.4, 0.4, 0.1}
+
+const (
+	// searchLoadBatchSize là số analysis đọc mỗi lần khi dựng chỉ mục lúc tìm kiếm lần đầu.
+	searchLoadBatchSize = 100
+	// searchMaxTextRunes giới hạn số ký tự text của tài liệu được đưa vào chỉ mục, giống
+	// left(extracted_text, 1000000) trong trigger của Postgres.
+	searchMaxTextRunes = 1000000
+)
+
+// searchIndex là chỉ mục đảo ngược trong bộ nhớ cho SQLite, thay cho tsvector của Postgres.
+// Chỉ mục chứa analysis mới nhất của mỗi document và được dựng từ cơ sở dữ liệu ở lần tìm
+// kiếm đầu tiên, sau đó cập nhật khi có analysis mới.
+type searchIndex struct {
+	mu     sync.RWMutex
+	loaded bool
+	// postings: từ → analysis → vị trí của từ trong từng trường
+	postings map[string]map[uint]*searchPositions
+	// terms là các từ của mỗi analysis, để xoá analysis khỏi postings
+	terms map[uint][]string
+	// latest: document → analysis mới nhất của document trong chỉ mục
+	latest map[uint]uint
+}
+
+type searchPositions [searchFieldCount][]int
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		postings: map[string]map[uint]*searchPositions{},
+		terms:    map[uint][]string{},
+		latest:   map[uint]uint{},
+	}
+}
+
+// searchFields trả về text của các trường được tìm kiếm.
+func searchFields(d *models.AnalysisDetail) [searchFieldCount]string {
+	return [searchFieldCount]string{
+		d.Summary,
+		strings.Join(d.KeyClauses, "\n"),
+		strings.Join(d.PotentialRisks, "\n"),
+		leftRunes(d.ExtractedText, searchMaxTextRunes),
+	}
+}
+
+// leftRunes trả về n ký tự đầu của s.
+func leftRunes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
+// load dựng chỉ mục từ analysis mới nhất của mỗi document nếu chưa dựng.
+func (x *searchIndex) load(db *gorm.DB) error {
+	x.mu.RLock()
+	loaded := x.loaded
+	x.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.loaded {
+		return nil
+	}
+	var afterID uint
+	for {
+		var analyses []models.Analysis
+		err := db.Preload("AnalysisDetail").
+			Where(latestAnalysis).Where("analyses.id > ?", afterID).
+			Order("analyses.id").Limit(searchLoadBatchSize).Find(&analyses).Error
+		if err != nil {
+			return fmt.Errorf("failed to load search index: %w", err)
+		}
+		for i := range analyses {
+			x.addLocked(analyses[i].ID, analyses[i].DocumentID, &analyses[i].AnalysisDetail)
+		}
+		if len(analyses) < searchLoadBatchSize {
+			break
+		}
+		afterID = analyses[len(analyses)-1].ID
+	}
+	x.loaded = true
+	return nil
+}
+
+// add đưa một analysis mới vào chỉ mục nếu chỉ mục đã được dựng; chưa dựng thì analysis sẽ
+// được đọc khi dựng.
+func (x *searchIndex) add(analysisID, documentID uint, detail *models.AnalysisDetail) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.loaded {
+		x.addLocked(analysisID, documentID, detail)
+	}
+}
+
+// refresh cập nhật chỉ mục cho một document sau khi analysis removedID của nó bị xoá
+// (removedID là 0 khi khôi phục): analysis mới nhất còn hiệu lực của document được đọc lại
+// từ cơ sở dữ liệu và thay cho analysis đang có trong chỉ mục. Analysis mới hơn được thêm
+// trong lúc đọc không bị ghi đè.
+func (x *searchIndex) refresh(db *gorm.DB, documentID, removedID uint) error {
+	x.mu.RLock()
+	loaded := x.loaded
+	x.mu.RUnlock()
+	if !loaded {
+		return nil
+	}
+
+	// Find thay cho First: document không còn analysis nào là trường hợp bình thường
+	var latest []models.Analysis
+	err := db.Preload("AnalysisDetail").Where("document_id = ?", documentID).Order("id DESC").Limit(1).Find(&latest).Error
+	if err != nil {
+		return fmt.Errorf("failed to refresh search index: %w", err)
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.loaded {
+		return nil
+	}
+	prev, ok := x.latest[documentID]
+	if ok && prev == removedID {
+		x.removeLocked(prev)
+		delete(x.latest, documentID)
+		ok = false
+	}
+	if len(latest) > 0 && (!ok || prev != latest[0].ID) {
+		x.addLocked(latest[0].ID, documentID, &latest[0].AnalysisDetail)
+	}
+	return nil
+}
+
+// reset bỏ chỉ mục để dựng lại ở lần tìm sau, khi không cập nhật được bằng refresh.
+func (x *searchIndex) reset() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.postings = map[string]map[uint]*searchPositions{}
+	x.terms = map[uint][]string{}
+	x.latest = map[uint]uint{}
+	x.loaded = false
+}
+
+func (x *searchIndex) addLocked(analysisID, documentID uint, detail *models.AnalysisDetail) {
+	if prev, ok := x.latest[documentID]; ok {
+		if prev > analysisID {
+			return
+		}
+		x.removeLocked(prev)
+	}
+	x.latest[documentID] = analysisID
+	seen := map[string]bool{}
+	for field, text := range searchFields(detail) {
+		for pos, t := range services.SearchTokens(text) {
+			docs := x.postings[t.Term]
+			if docs == nil {
+				docs = map[uint]*searchPositions{}
+				x.postings[t.Term] = docs
+			}
+			p := docs[analysisID]
+			if p == nil {
+				p = &searchPositions{}
+				docs[analysisID] = p
+			}
+			p[field] = append(p[field], pos)
+			if !seen[t.Term] {
+				seen[t.Term] = true
+				x.terms[analysisID] = append(x.terms[analysisID], t.Term)
+			}
+		}
+	}
+}
+
+// removeLocked xoá một analysis khỏi postings.
+func (x *searchIndex) removeLocked(analysisID uint) {
+	for _, term := range x.terms[analysisID] {
+		delete(x.postings[term], analysisID)
+		if len(x.postings[term]) == 0 {
+			delete(x.postings, term)
+		}
+	}
+	delete(x.terms, analysisID)
+}
+
+// search trả về các analysis khớp q, điểm cao nhất trước.
+func (x *searchIndex) search(q *services.SearchQuery) []searchHit {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	scores := map[uint]float64{}
+	for i, group := range q.All {
+		groupScores := map[uint]float64{}
+		for _, phrase := range group {
+			for id, score := range x.phraseScores(phrase.Terms) {
+				groupScores[id] += score
+			}
+		}
+		if i == 0 {
+			scores = groupScores
+			continue
+		}
+		for id := range scores {
+			if s, ok := groupScores[id]; ok {
+				scores[id] += s
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+	for _, phrase := range q.None {
+		for id := range x.phraseScores(phrase.Terms) {
+			delete(scores, id)
+		}
+	}
+
+	hits := make([]searchHit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, searchHit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID > hits[j].ID
+	})
+	return hits
+}
+
+// phraseScores trả về điểm của các analysis chứa cụm từ terms: tổng theo trường của trọng số
+// trường nhân với log của số lần xuất hiện.
+func (x *searchIndex) phraseScores(terms []string) map[uint]float64 {
+	scores := map[uint]float64{}
+	for id, first := range x.postings[terms[0]] {
+		var score float64
+		for field := range first {
+			n := 0
+			for _, pos := range first[field] {
+				if x.phraseAt(id, field, pos, terms) {
+					n++
+				}
+			}
+			if n > 0 {
+				score += searchFieldWeights[field] * (1 + math.Log(float64(n)))
+			}
+		}
+		if score > 0 {
+			scores[id] = score
+		}
+	}
+	return scores
+}
+
+// phraseAt cho biết các từ sau từ đầu tiên của terms có đứng liền sau vị trí pos của trường
+// field trong analysis id hay không.
+func (x *searchIndex) phraseAt(id uint, field, pos int, terms []string) bool {
+	for i, term := range terms[1:] {
+		p := x.postings[term][id]
+		if p == nil {
+			return false
+		}
+		positions := p[field]
+		want := pos + i + 1
+		j := sort.SearchInts(positions, want)
+		if j == len(positions) || positions[j] != want {
+			return false
+		}
+	}
+	return true
+}
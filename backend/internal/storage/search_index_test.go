@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"documind/backend/internal/models"
+	"documind/backend/internal/services"
+)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := Open(Config{Driver: DriverSQLite, DSN: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if _, err := store.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// createTestAnalysis lưu một analysis có tóm tắt summary; document là nil thì tạo document mới.
+func createTestAnalysis(t *testing.T, store *Store, document *models.Document, summary string) *models.Analysis {
+	t.Helper()
+	a := &NewAnalysis{Analysis: &models.Analysis{}, Detail: &models.AnalysisDetail{Summary: summary}}
+	if document == nil {
+		a.Document = &models.Document{FileHash: summary}
+	} else {
+		a.Analysis.DocumentID = document.ID
+	}
+	if err := store.Analyses.Create(a); err != nil {
+		t.Fatal(err)
+	}
+	return a.Analysis
+}
+
+func searchIDs(t *testing.T, store *Store, query string) []uint {
+	t.Helper()
+	q, err := services.ParseSearchQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := store.Search.Search(q, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []uint{}
+	for _, hit := range page.Hits {
+		ids = append(ids, hit.Analysis.ID)
+	}
+	return ids
+}
+
+func TestSearchIndexTrash(t *testing.T) {
+	store := openTestStore(t)
+	first := createTestAnalysis(t, store, nil, "hợp đồng thuê kho")
+	other := createTestAnalysis(t, store, nil, "hợp đồng mua bán")
+	// Dựng chỉ mục trước khi thay đổi thùng rác
+	if got := searchIDs(t, store, "hợp đồng"); len(got) != 2 {
+		t.Fatalf("search before changes = %v, want 2 hits", got)
+	}
+	second := createTestAnalysis(t, store, &models.Document{ID: first.DocumentID}, "phụ lục thuê kho")
+	index := store.Trash.(*gormTrashStore).search
+
+	steps := []struct {
+		name   string
+		change func() error
+		query  string
+		want   []uint
+	}{
+		{"new analysis replaces the old one", nil, "thuê kho", []uint{second.ID}},
+		{"delete latest falls back to previous", func() error { return store.Trash.Delete(second.ID) }, "thuê kho", []uint{first.ID}},
+		{"restore brings the latest back", func() error { return store.Trash.Restore(second.ID) }, "thuê kho", []uint{second.ID}},
+		{"delete older analysis keeps the latest", func() error { return store.Trash.Delete(first.ID) }, "thuê kho", []uint{second.ID}},
+		{"delete last analysis removes the document", func() error { return store.Trash.Delete(second.ID) }, "thuê kho", []uint{}},
+		{"other documents are untouched", nil, "mua bán", []uint{other.ID}},
+		{"restore older analysis", func() error { return store.Trash.Restore(first.ID) }, "thuê kho", []uint{first.ID}},
+		{"purge keeps the search index", func() error { return store.Trash.Purge(second.ID) }, "thuê kho", []uint{first.ID}},
+	}
+	for _, step := range steps {
+		if step.change != nil {
+			if err := step.change(); err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+		}
+		if !index.loaded {
+			t.Fatalf("%s: search index was reset", step.name)
+		}
+		if got := searchIDs(t, store, step.query); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: search %q = %v, want %v", step.name, step.query, got, step.want)
+		}
+	}
+}
+
+func TestLeftRunes(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"hợp đồng", 3, "hợp"},
+		{"hợp đồng", 8, "hợp đồng"},
+		{"hợp đồng", 100, "hợp đồng"},
+		{"abc", 0, ""},
+	}
+	for _, tt := range tests {
+		if got := leftRunes(tt.s, tt.n); got != tt.want {
+			t.Errorf("leftRunes(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+	long := strings.Repeat("đ", searchMaxTextRunes+10)
+	fields := searchFields(&models.AnalysisDetail{ExtractedText: long})
+	if n := len([]rune(fields[searchFieldText])); n != searchMaxTextRunes {
+		t.Errorf("indexed text has %d runes, want %d", n, searchMaxTextRunes)
+	}
+}
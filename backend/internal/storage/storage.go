@@ -0,0 +1,265 @@
+// Package storage is the persistence layer of DocuMind: repositories for analyses and
+// their details, contract chats and background jobs, backed by Postgres in production or an embedded SQLite file for local
+// development and tests.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"documind/backend/internal/models"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Supported database drivers.
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// ErrNotFound is returned when the requested record does not exist.
+var ErrNotFound = errors.New("record not found")
+
+// Config selects the database backend.
+type Config struct {
+	Driver string
+	// DSN là chuỗi kết nối Postgres, hoặc đường dẫn file SQLite (":memory:" cho cơ sở dữ liệu tạm)
+	DSN string
+}
+
+// NewAnalysis is everything saved for a new analysis. The records are created in one
+// transaction and their AnalysisID/DocumentID is set from the created records. Document is
+// nil when an existing document is analysed again; Analysis.DocumentID must be set then, and
+// the records that belong to the file (Metadata, Metrics, Fingerprint, Files) are not saved.
+type NewAnalysis struct {
+	Document *models.Document
+	Analysis *models.Analysis
+	Detail   *models.AnalysisDetail
+	// Provenance là nil với analysis không gọi model
+	Provenance *models.AnalysisProvenance
+	Metadata   *models.DocumentMetadata
+	Metrics    *models.ExtractionMetrics
+	// Fingerprint là nil với tài liệu không có text
+	Fingerprint *models.ContentFingerprint
+	// Files chỉ có với bộ hồ sơ ZIP và e-mail có file đính kèm
+	Files []models.AnalysisFile
+	// Parties là các bên của hợp đồng theo kết quả phân tích
+	Parties []models.AnalysisParty
+}
+
+// AnalysisFilter filters the analysis list. Empty fields are ignored; text fields other
+// than MIMEType, Format, Language, ContractType, Tag and Model match a case-insensitive substring.
+type AnalysisFilter struct {
+	FileName string
+	Author   string
+	Title    string
+	Producer string
+	MIMEType string
+	Format   string
+	Language string
+	MinPages *int
+	MaxPages *int
+	// CreatedFrom/CreatedBefore lọc theo ngày tạo ghi trong file, CreatedBefore không bao gồm chính nó
+	CreatedFrom   *time.Time
+	CreatedBefore *time.Time
+	// AnalyzedFrom/AnalyzedBefore lọc theo thời điểm phân tích, AnalyzedBefore không bao gồm chính nó
+	AnalyzedFrom   *time.Time
+	AnalyzedBefore *time.Time
+	ContractType   string
+	// RiskSeverities: analysis có mức rủi ro là một trong các giá trị, xem models.Analysis.RiskSeverity
+	RiskSeverities []int
+	// Party: tên một bên của hợp đồng chứa chuỗi này
+	Party string
+	// Tag: document có nhãn này
+	Tag string
+	// Model: model đã tạo ra analysis, theo provenance
+	Model string
+}
+
+// Các cột sắp xếp của danh sách analysis. Mọi cách sắp xếp đều lấy id làm tiêu chí phụ để
+// cursor xác định đúng một vị trí.
+const (
+	SortCreatedAt    = "created_at"
+	SortRiskSeverity = "risk_severity"
+	SortRiskCount    = "risk_count"
+)
+
+// ListOptions orders and pages the analysis list.
+type ListOptions struct {
+	// Sort là một trong SortCreatedAt, SortRiskSeverity, SortRiskCount; "" là SortCreatedAt
+	Sort  string
+	Desc  bool
+	Limit int
+	// After là vị trí của analysis cuối trang trước, nil cho trang đầu
+	After *Cursor
+}
+
+// Cursor is the position of an analysis in the list: the value of the sort column and the id.
+type Cursor struct {
+	// CreatedAt dùng khi sắp xếp theo SortCreatedAt, Value với các cột số
+	CreatedAt time.Time
+	Value     int
+	ID        uint
+}
+
+// AnalysisPage is one page of the analysis list.
+type AnalysisPage struct {
+	Analyses []models.Analysis
+	// Total là số analysis khớp bộ lọc trên mọi trang
+	Total int64
+	// Next là vị trí để lấy trang sau, nil khi đây là trang cuối
+	Next *Cursor
+}
+
+// AnalysisStore stores documents and their analyses together with the records created
+// alongside them.
+type AnalysisStore interface {
+	Create(a *NewAnalysis) error
+	// ByFileHash, ByContentHash, ByID và LatestByDocument nạp kèm AnalysisDetail, Provenance
+	// và Document với Files và Metrics. ByFileHash, ByContentHash trả về analysis mới nhất của file.
+	ByFileHash(fileHash string) (*models.Analysis, error)
+	ByContentHash(contentHash string) (*models.Analysis, error)
+	ByID(id uint) (*models.Analysis, error)
+	LatestByDocument(documentID uint) (*models.Analysis, error)
+	// ByDocument trả về mọi analysis của document kèm Provenance, cũ nhất trước.
+	ByDocument(documentID uint) ([]models.Analysis, error)
+	// ByIDs trả về các analysis có id trong ids kèm Document.Metadata, không theo thứ tự nào.
+	ByIDs(ids []uint) ([]models.Analysis, error)
+	// Stale trả về analysis mới nhất của các document có PipelineVersion khác version, chỉ
+	// những analysis có id lớn hơn afterID, tăng dần theo id. Nạp kèm như ByID.
+	Stale(version string, afterID uint, limit int) ([]models.Analysis, error)
+	// CountStale đếm các document có analysis mới nhất với PipelineVersion khác version.
+	CountStale(version string) (int64, error)
+	// FingerprintsByBand trả về các khoá nội dung có ít nhất một dải SimHash trùng với bands.
+	FingerprintsByBand(bands [4]int) ([]models.ContentFingerprint, error)
+	// List trả về một trang analysis khớp filter kèm Document với Metadata và Tags, Parties
+	// và model của Provenance.
+	List(filter AnalysisFilter, opts ListOptions) (*AnalysisPage, error)
+	// SetTags thay các nhãn của document bằng tags; ErrNotFound khi document không tồn tại.
+	SetTags(documentID uint, tags []string) error
+}
+
+// DetailStore reads the long-form records of an analysis and of its document.
+type DetailStore interface {
+	// Detail và Provenance trả về ErrNotFound với analysis đã bị xoá.
+	Detail(analysisID uint) (*models.AnalysisDetail, error)
+	Files(documentID uint) ([]models.AnalysisFile, error)
+	File(documentID, fileID uint) (*models.AnalysisFile, error)
+	Metrics(documentID uint) (*models.ExtractionMetrics, error)
+	// Provenance cũng trả về ErrNotFound với analysis tạo trước khi có provenance.
+	Provenance(analysisID uint) (*models.AnalysisProvenance, error)
+}
+
+// Store groups the repositories of one database connection.
+type Store struct {
+	Analyses   AnalysisStore
+	Details    DetailStore
+	Search     SearchStore
+	Embeddings EmbeddingStore
+	Trash      TrashStore
+	Chats      ChatStore
+	Jobs       JobStore
+	Driver     string
+
+	db *gorm.DB
+}
+
+// Open connects to the database described by cfg. It does not change the schema: that is
+// done by MigrateUp, and CheckSchema tells whether it is needed.
+func Open(cfg Config) (*Store, error) {
+	var dialector gorm.Dialector
+	switch cfg.Driver {
+	case DriverPostgres:
+		if cfg.DSN == "" {
+			return nil, errors.New("postgres connection string is empty")
+		}
+		dialector = postgres.Open(cfg.DSN)
+	case DriverSQLite:
+		dialector = sqlite.Open(sqliteDSN(cfg.DSN))
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", cfg.Driver)
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	if cfg.Driver == DriverSQLite {
+		// SQLite chỉ cho một kết nối ghi tại một thời điểm; một kết nối duy nhất cũng giữ
+		// được cơ sở dữ liệu ":memory:" giữa các request
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure sqlite: %w", err)
+		}
+		sqlDB.SetMaxOpenConns(1)
+	}
+
+	return newStore(db, cfg.Driver), nil
+}
+
+func newStore(db *gorm.DB, driver string) *Store {
+	// SQLite không có tìm kiếm toàn văn tiếng Việt nên dùng chỉ mục trong bộ nhớ
+	var index *searchIndex
+	if driver == DriverSQLite {
+		index = newSearchIndex()
+	}
+	vectors := newVectorIndex()
+	return &Store{
+		Analyses:   &gormAnalysisStore{db: db, index: index},
+		Details:    &gormDetailStore{db: db},
+		Search:     &gormSearchStore{db: db, index: index},
+		Embeddings: &gormEmbeddingStore{db: db, index: vectors},
+		Trash:      &gormTrashStore{db: db, search: index, vectors: vectors},
+		Chats:      &gormChatStore{db: db},
+		Jobs:       &gormJobStore{db: db},
+		Driver:     driver,
+		db:         db,
+	}
+}
+
+// Ping checks that the database is reachable. database/sql reopens broken connections by
+// itself, so a successful Ping after a failed one means the connection is back.
+func (s *Store) Ping(ctx context.Context) error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// Close closes the database connection.
+func (s *Store) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// sqliteDSN thêm thời gian chờ khoá: file SQLite đang bị tiến trình khác ghi thì chờ thay vì báo lỗi ngay.
+func sqliteDSN(path string) string {
+	if path == "" {
+		path = "documind.db"
+	}
+	if path == ":memory:" {
+		return path
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + "_busy_timeout=5000"
+}
+
+// notFound chuyển lỗi không tìm thấy của GORM thành ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"documind/backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrLegalHold is returned when deleting an analysis whose document is under legal hold.
+var ErrLegalHold = errors.New("document is under legal hold")
+
+// TrashStore moves analyses to the trash, restores them and purges them for good together
+// with the records derived from them. Deleted analyses are hidden from every other store.
+type TrashStore interface {
+	// Delete chuyển analysis vào thùng rác; document cũng vào thùng rác khi không còn analysis
+	// nào khác. ErrNotFound khi analysis không tồn tại hoặc đã bị xoá, ErrLegalHold khi
+	// document đang bị giữ.
+	Delete(analysisID uint) error
+	// List trả về một trang các analysis trong thùng rác, xoá gần nhất trước, kèm Document với
+	// Metadata, và tổng số analysis trong thùng rác.
+	List(limit, offset int) ([]models.Analysis, int64, error)
+	// Restore đưa analysis và document của nó ra khỏi thùng rác; ErrNotFound khi analysis
+	// không nằm trong thùng rác.
+	Restore(analysisID uint) error
+	// Purge xoá vĩnh viễn một analysis trong thùng rác cùng chi tiết, provenance, các bên và
+	// embedding của nó. Khi document không còn analysis nào, document được xoá cùng metadata,
+	// chỉ số chất lượng, khoá nội dung, các file con, nhãn, embedding điều khoản và lịch sử chat.
+	// ErrNotFound khi analysis không nằm trong thùng rác, ErrLegalHold khi document đang bị giữ.
+	Purge(analysisID uint) error
+	// DeleteCreatedBefore chuyển vào thùng rác tối đa limit analysis tạo trước before, bỏ qua
+	// document đang bị giữ, và trả về số analysis đã chuyển.
+	DeleteCreatedBefore(before time.Time, limit int) (int, error)
+	// PurgeDeletedBefore xoá vĩnh viễn tối đa limit analysis đã vào thùng rác trước before, bỏ
+	// qua document đang bị giữ, và trả về số analysis đã xoá.
+	PurgeDeletedBefore(before time.Time, limit int) (int, error)
+	// TrashedDocument trả về document trong thùng rác có file hash này; ErrNotFound khi không có.
+	TrashedDocument(fileHash string) (*models.Document, error)
+	// SetLegalHold đặt hoặc bỏ legal hold của document, kể cả document trong thùng rác.
+	SetLegalHold(documentID uint, hold bool, reason string) (*models.Document, error)
+}
+
+// gormTrashStore dùng soft delete của GORM (cột deleted_at); các chỉ mục tìm kiếm và vector
+// trong bộ nhớ được cập nhật cho document bị thay đổi.
+type gormTrashStore struct {
+	db *gorm.DB
+	// search là nil với Postgres
+	search  *searchIndex
+	vectors *vectorIndex
+}
+
+// unheldDocument loại các analysis có document đang bị giữ.
+const unheldDocument = "analyses.document_id IN (SELECT id FROM documents WHERE legal_hold = ?)"
+
+// refreshIndexes cập nhật các chỉ mục trong bộ nhớ cho document sau khi analysis removedID
+// bị xoá hoặc một analysis được khôi phục (removedID = 0). Không đọc lại được thì bỏ chỉ mục
+// để dựng lại ở lần tìm sau.
+func (s *gormTrashStore) refreshIndexes(documentID, removedID uint) {
+	if s.search != nil {
+		if err := s.search.refresh(s.db, documentID, removedID); err != nil {
+			s.search.reset()
+		}
+	}
+	if err := s.vectors.refresh(s.db, documentID, removedID); err != nil {
+		s.vectors.reset()
+	}
+}
+
+// legalHold cho biết document có đang bị giữ không, kể cả khi document đã vào thùng rác.
+func legalHold(tx *gorm.DB, documentID uint) (bool, error) {
+	var document models.Document
+	if err := tx.Unscoped().Select("id", "legal_hold").First(&document, documentID).Error; err != nil {
+		return false, notFound(err)
+	}
+	return document.LegalHold, nil
+}
+
+func (s *gormTrashStore) Delete(analysisID uint) error {
+	documentID, err := s.delete(analysisID)
+	if err != nil {
+		return err
+	}
+	s.refreshIndexes(documentID, analysisID)
+	return nil
+}
+
+// delete chuyển analysis vào thùng rác và trả về document của nó.
+func (s *gormTrashStore) delete(analysisID uint) (uint, error) {
+	var documentID uint
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var a models.Analysis
+		if err := tx.Select("id", "document_id").First(&a, analysisID).Error; err != nil {
+			return notFound(err)
+		}
+		held, err := legalHold(tx, a.DocumentID)
+		if err != nil {
+			return err
+		}
+		if held {
+			return ErrLegalHold
+		}
+		documentID = a.DocumentID
+		if err := tx.Delete(&a).Error; err != nil {
+			return fmt.Errorf("failed to delete analysis: %w", err)
+		}
+		var remaining int64
+		if err := tx.Model(&models.Analysis{}).Where("document_id = ?", a.DocumentID).Count(&remaining).Error; err != nil {
+			return err
+		}
+		if remaining == 0 {
+			if err := tx.Delete(&models.Document{}, a.DocumentID).Error; err != nil {
+				return fmt.Errorf("failed to delete document: %w", err)
+			}
+		}
+		return nil
+	})
+	return documentID, err
+}
+
+func (s *gormTrashStore) List(limit, offset int) ([]models.Analysis, int64, error) {
+	query := s.db.Unscoped().Model(&models.Analysis{}).Where("analyses.deleted_at IS NOT NULL")
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var analyses []models.Analysis
+	err := query.Preload("Document", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).Preload("Document.Metadata").
+		Order("analyses.deleted_at DESC").Order("analyses.id DESC").Limit(limit).Offset(offset).Find(&analyses).Error
+	return analyses, total, err
+}
+
+func (s *gormTrashStore) Restore(analysisID uint) error {
+	var a models.Analysis
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Select("id", "document_id").Where("deleted_at IS NOT NULL").First(&a, analysisID).Error; err != nil {
+			return notFound(err)
+		}
+		if err := tx.Unscoped().Model(&models.Analysis{}).Where("id = ?", a.ID).Update("deleted_at", nil).Error; err != nil {
+			return fmt.Errorf("failed to restore analysis: %w", err)
+		}
+		if err := tx.Unscoped().Model(&models.Document{}).Where("id = ?", a.DocumentID).Update("deleted_at", nil).Error; err != nil {
+			return fmt.Errorf("failed to restore document: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.refreshIndexes(a.DocumentID, 0)
+	return nil
+}
+
+func (s *gormTrashStore) Purge(analysisID uint) error {
+	documentID, err := s.purge(analysisID)
+	if err != nil {
+		return err
+	}
+	// Analysis trong thùng rác không có trong các chỉ mục, chỉ cần bỏ các vector điều khoản
+	// khi document bị xoá vĩnh viễn
+	if documentID != 0 {
+		s.vectors.drop(documentID)
+	}
+	return nil
+}
+
+// purge xoá vĩnh viễn analysis; khi đó là analysis cuối cùng, document cũng bị xoá và purge
+// trả về id của document.
+func (s *gormTrashStore) purge(analysisID uint) (uint, error) {
+	var a models.Analysis
+	purgedDocument := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Select("id", "document_id").Where("deleted_at IS NOT NULL").First(&a, analysisID).Error; err != nil {
+			return notFound(err)
+		}
+		held, err := legalHold(tx, a.DocumentID)
+		if err != nil {
+			return err
+		}
+		if held {
+			return ErrLegalHold
+		}
+		// Xoá các bản ghi con trước bản ghi cha vì khoá ngoại không có ON DELETE CASCADE
+		for _, record := range []interface{}{
+			&models.Embedding{}, &models.AnalysisParty{}, &models.AnalysisProvenance{}, &models.AnalysisDetail{},
+		} {
+			if err := tx.Where("analysis_id = ?", a.ID).Delete(record).Error; err != nil {
+				return fmt.Errorf("failed to purge analysis records: %w", err)
+			}
+		}
+		if err := tx.Unscoped().Delete(&models.Analysis{}, a.ID).Error; err != nil {
+			return fmt.Errorf("failed to purge analysis: %w", err)
+		}
+
+		var remaining int64
+		if err := tx.Unscoped().Model(&models.Analysis{}).Where("document_id = ?", a.DocumentID).Count(&remaining).Error; err != nil {
+			return err
+		}
+		if remaining > 0 {
+			return nil
+		}
+		for _, record := range []interface{}{
+			&models.Embedding{}, &models.DocumentTag{}, &models.AnalysisFile{}, &models.ContentFingerprint{},
+			&models.ExtractionMetrics{}, &models.DocumentMetadata{}, &models.ChatMessage{},
+		} {
+			if err := tx.Where("document_id = ?", a.DocumentID).Delete(record).Error; err != nil {
+				return fmt.Errorf("failed to purge document records: %w", err)
+			}
+		}
+		if err := tx.Unscoped().Delete(&models.Document{}, a.DocumentID).Error; err != nil {
+			return fmt.Errorf("failed to purge document: %w", err)
+		}
+		purgedDocument = true
+		return nil
+	})
+	if err != nil || !purgedDocument {
+		return 0, err
+	}
+	return a.DocumentID, nil
+}
+
+func (s *gormTrashStore) DeleteCreatedBefore(before time.Time, limit int) (int, error) {
+	var ids []uint
+	err := s.db.Model(&models.Analysis{}).Where("analyses.created_at < ?", before).Where(unheldDocument, false).
+		Order("analyses.id").Limit(limit).Pluck("analyses.id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, id := range ids {
+		// Analysis vừa bị xoá hoặc document vừa bị giữ bởi request khác thì bỏ qua
+		documentID, err := s.delete(id)
+		if err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrLegalHold) {
+			return deleted, err
+		} else if err == nil {
+			s.refreshIndexes(documentID, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *gormTrashStore) PurgeDeletedBefore(before time.Time, limit int) (int, error) {
+	var ids []uint
+	err := s.db.Unscoped().Model(&models.Analysis{}).Where("analyses.deleted_at < ?", before).Where(unheldDocument, false).
+		Order("analyses.id").Limit(limit).Pluck("analyses.id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, id := range ids {
+		documentID, err := s.purge(id)
+		if err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrLegalHold) {
+			return purged, err
+		} else if err == nil {
+			if documentID != 0 {
+				s.vectors.drop(documentID)
+			}
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (s *gormTrashStore) TrashedDocument(fileHash string) (*models.Document, error) {
+	var document models.Document
+	if err := s.db.Unscoped().Where("file_hash = ? AND deleted_at IS NOT NULL", fileHash).First(&document).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &document, nil
+}
+
+func (s *gormTrashStore) SetLegalHold(documentID uint, hold bool, reason string) (*models.Document, error) {
+	if !hold {
+		reason = ""
+	}
+	var document models.Document
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Select("id").First(&document, documentID).Error; err != nil {
+			return notFound(err)
+		}
+		err := tx.Unscoped().Model(&models.Document{}).Where("id = ?", documentID).
+			Updates(map[string]interface{}{"legal_hold": hold, "legal_hold_reason": reason}).Error
+		if err != nil {
+			return fmt.Errorf("failed to update legal hold: %w", err)
+		}
+		return tx.Unscoped().First(&document, documentID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &document, nil
+}
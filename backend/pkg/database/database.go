@@ -3,31 +3,32 @@ package database
 import (
 	"fmt"
 	"os"
+	"strings"
 
-	"documind/backend/internal/models"
-
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
+	"documind/backend/internal/storage"
 )
 
-var DB *gorm.DB
-
-func Connect() (*gorm.DB, error) {
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		return nil, fmt.Errorf("DATABASE_URL environment variable is not set")
+// Config đọc cấu hình cơ sở dữ liệu từ biến môi trường: DB_DRIVER (postgres mặc định, hoặc sqlite)
+// và DATABASE_URL (chuỗi kết nối Postgres, hoặc đường dẫn file SQLite, mặc định documind.db).
+func Config() (storage.Config, error) {
+	cfg := storage.Config{
+		Driver: strings.ToLower(strings.TrimSpace(os.Getenv("DB_DRIVER"))),
+		DSN:    os.Getenv("DATABASE_URL"),
 	}
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	if cfg.Driver == "" {
+		cfg.Driver = storage.DriverPostgres
 	}
-
-	// THAY ĐỔI: Thêm models.AnalysisDetail{} vào AutoMigrate
-	// GORM sẽ tự động tạo cả hai bảng `analyses` và `analysis_details`
-	if err := db.AutoMigrate(&models.Analysis{}, &models.AnalysisDetail{}); err != nil {
-		return nil, fmt.Errorf("auto-migration failed: %w", err)
+	if cfg.Driver == storage.DriverPostgres && cfg.DSN == "" {
+		return cfg, fmt.Errorf("DATABASE_URL environment variable is not set")
 	}
+	return cfg, nil
+}
 
-	DB = db
-	return db, nil
-}
\ No newline at end of file
+// Connect mở cơ sở dữ liệu theo cấu hình trong biến môi trường.
+func Connect() (*storage.Store, error) {
+	cfg, err := Config()
+	if err != nil {
+		return nil, err
+	}
+	return storage.Open(cfg)
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"documind/backend/internal/storage"
+)
+
+const (
+	minRetryDelay = time.Second
+	maxRetryDelay = 30 * time.Second
+	// pingInterval là chu kỳ kiểm tra kết nối khi cơ sở dữ liệu đang hoạt động
+	pingInterval = 15 * time.Second
+	pingTimeout  = 5 * time.Second
+)
+
+// Supervisor keeps the database connection: it connects with exponential backoff, pings the
+// database periodically and reports every change through onChange — the store once it is
+// ready, nil while the database is unreachable.
+type Supervisor struct {
+	onChange func(*storage.Store)
+}
+
+// NewSupervisor tạo Supervisor; onChange thường là Handler.SetStore.
+func NewSupervisor(onChange func(*storage.Store)) *Supervisor {
+	return &Supervisor{onChange: onChange}
+}
+
+// Run connects to the database and watches the connection until ctx is cancelled. The
+// process exits when the schema is behind the migrations of this build, because retrying
+// cannot fix that.
+func (s *Supervisor) Run(ctx context.Context) {
+	store := s.connect(ctx)
+	if store == nil {
+		return
+	}
+	defer store.Close()
+	s.onChange(store)
+	log.Printf("Database connection established successfully (%s).", store.Driver)
+
+	ready := true
+	delay := minRetryDelay
+	for {
+		wait := pingInterval
+		if !ready {
+			wait = delay
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+		err := store.Ping(pingCtx)
+		cancel()
+		switch {
+		case err != nil && ready:
+			ready = false
+			s.onChange(nil)
+			log.Printf("!!! Lost database connection: %v", err)
+		case err != nil:
+			delay = nextDelay(delay)
+		case !ready:
+			ready = true
+			delay = minRetryDelay
+			s.onChange(store)
+			log.Println("Database connection re-established.")
+		}
+	}
+}
+
+// connect thử kết nối cho tới khi thành công; trả về nil khi ctx bị huỷ.
+func (s *Supervisor) connect(ctx context.Context) *storage.Store {
+	delay := minRetryDelay
+	for {
+		log.Println("Attempting to connect to the database...")
+		store, err := open()
+		if err == nil {
+			return store
+		}
+		if errors.Is(err, storage.ErrSchemaBehind) {
+			// Schema cũ hơn bản build thì không phục vụ request, tránh ghi dữ liệu vào schema sai
+			log.Fatalf("!!! Refusing to serve: %v (run `migrate up` or set MIGRATE_ON_START=true)", err)
+		}
+		log.Printf("!!! Database connection failed, retrying in %s: %v", delay, err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		delay = nextDelay(delay)
+	}
+}
+
+// open kết nối, áp dụng migration nếu MIGRATE_ON_START=true và kiểm tra schema.
+func open() (*storage.Store, error) {
+	store, err := Connect()
+	if err != nil {
+		return nil, err
+	}
+	if os.Getenv("MIGRATE_ON_START") == "true" {
+		done, err := store.MigrateUp()
+		for _, m := range done {
+			log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
+	if err := store.CheckSchema(); err != nil {
+		store.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+func nextDelay(d time.Duration) time.Duration {
+	d *= 2
+	if d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	return d
+}